@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// recordFileName returns the name under which -save stores a run.
+func recordFileName(rec bench.RunRecord) string {
+	host := rec.Host
+	if host == "" {
+		host = "local"
+	}
+	return fmt.Sprintf("dnsbench-%s-%s.json", host, rec.Started.UTC().Format("20060102T150405Z"))
+}
+
+// saveRun writes the results of a run to dir as a RunRecord.
+func saveRun(dir string, runner *bench.Runner, started time.Time, rows []bench.Result) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	rec := bench.NewRunRecord(runner, started, rows)
+	exportAnonymizer.Record(&rec)
+	path := filepath.Join(dir, recordFileName(rec))
+	return path, rec.WriteFile(path)
+}
+
+// loadRecords reads saved runs from files and from the *.json files in
+// directories, ordered by start time.
+func loadRecords(paths []string) ([]bench.RunRecord, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	recs := make([]bench.RunRecord, 0, len(files))
+	for _, f := range files {
+		rec, err := bench.ReadRunRecord(f)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Started.Before(recs[j].Started) })
+	return recs, nil
+}
+
+// AggregateRow combines one resolver's samples from many runs.
+type AggregateRow struct {
+	Name    string
+	Runs    int // runs that included the resolver
+	UpRuns  int // ... in which at least one query succeeded
+	Samples []bench.Sample
+}
+
+// Availability is the percentage of runs in which the resolver answered.
+func (a AggregateRow) Availability() float64 {
+	if a.Runs == 0 {
+		return 0
+	}
+	return 100.0 * float64(a.UpRuns) / float64(a.Runs)
+}
+
+// aggregateBy groups the resolver results of recs by key(rec), keeping
+// resolvers in first-seen order within each group.
+func aggregateBy(recs []bench.RunRecord, key func(bench.RunRecord) string) (keys []string, groups map[string][]*AggregateRow) {
+	groups = make(map[string][]*AggregateRow)
+	for _, rec := range recs {
+		k := key(rec)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		for _, res := range rec.Results() {
+			var row *AggregateRow
+			for _, r := range groups[k] {
+				if r.Name == res.Name {
+					row = r
+					break
+				}
+			}
+			if row == nil {
+				row = &AggregateRow{Name: res.Name}
+				groups[k] = append(groups[k], row)
+			}
+			row.Runs++
+			if res.Stats.Successes > 0 {
+				row.UpRuns++
+			}
+			row.Samples = append(row.Samples, res.Samples...)
+		}
+	}
+	sort.Strings(keys)
+	return keys, groups
+}
+
+// runAggregate implements the aggregate subcommand.
+func runAggregate(args []string) int {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	outCSV := fs.String("out", "", "Optional path to write per-day CSV statistics")
+	outParquet := fs.String("parquet", "", "Optional path to write the samples of all runs to as a Parquet file")
+	byHost := fs.Bool("by-host", false, "Also break latency and availability down by host, such as the nodes of a DaemonSet")
+	heatMap := fs.Bool("heatmap", false, "Also print a heat map of median latency by resolver and hour of day")
+	heatMapHTML := fs.String("heatmap-html", "", "Optional path to write the heat map to as an HTML page")
+	colorMode := fs.String("color", "auto", "Color the heat map: auto (on a terminal, unless NO_COLOR is set), always or never")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench aggregate [-out file.csv] [-parquet file.parquet] [-by-host] [-heatmap] [-heatmap-html file.html] FILE|DIR...\n\n"+
+			"Combines runs saved with -save into overall and per-day statistics and\n"+
+			"an availability SLA over the whole window.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	color, err := colorOutput(*colorMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	recs, err := loadRecords(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(recs) == 0 {
+		fmt.Fprintln(os.Stderr, "No saved runs found.")
+		return 1
+	}
+
+	hosts := make(map[string]bool)
+	for _, rec := range recs {
+		hosts[rec.Host] = true
+	}
+	fmt.Printf("DNS Benchmark Aggregate\n")
+	fmt.Printf("Runs: %d | Hosts: %d | From: %s | To: %s\n", len(recs), len(hosts),
+		recs[0].Started.Local().Format("2006-01-02 15:04"), recs[len(recs)-1].Started.Local().Format("2006-01-02 15:04"))
+	fmt.Println(strings.Repeat("-", 80))
+
+	_, all := aggregateBy(recs, func(bench.RunRecord) string { return "" })
+	fmt.Printf("%-12s  %5s  %7s  %6s  %6s  %6s  %9s  %6s\n",
+		"Resolver", "Runs", "Queries", "Min", "Med", "p95", "Success%", "Avail%")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, row := range all[""] {
+		s := bench.Summarize(row.Samples)
+		fmt.Printf("%-12s  %5d  %7d  %6s  %6s  %6s  %8.1f%%  %5.1f%%\n",
+			row.Name, row.Runs, s.Count, durFmt(s.Min), durFmt(s.Median), durFmt(s.P95),
+			successPct(s), row.Availability())
+	}
+	sla := newSLAAggregate()
+	for _, rec := range recs {
+		sla.Add(rec.Started, rec.Results())
+	}
+	printSLA(sla.SLAs(), recs[0].Started, recs[len(recs)-1].Started)
+
+	days, byDay := aggregateBy(recs, func(rec bench.RunRecord) string {
+		return rec.Started.Local().Format("2006-01-02")
+	})
+	names := make([]string, 0, len(all[""]))
+	for _, row := range all[""] {
+		names = append(names, row.Name)
+	}
+	median := func(row *AggregateRow) string { return durFmt(bench.Summarize(row.Samples).Median) }
+	avail := func(row *AggregateRow) string { return fmt.Sprintf("%.1f%%", row.Availability()) }
+	printDaily("Median latency by day", "Day", days, names, byDay, median)
+	printDaily("Availability by day", "Day", days, names, byDay, avail)
+	if *byHost {
+		hostNames, byHostRows := aggregateBy(recs, func(rec bench.RunRecord) string { return orDash(rec.Host) })
+		printDaily("Median latency by host", "Host", hostNames, names, byHostRows, median)
+		printDaily("Availability by host", "Host", hostNames, names, byHostRows, avail)
+	}
+
+	if *heatMap || *heatMapHTML != "" {
+		hourly := newHourlyAggregate()
+		for _, rec := range recs {
+			hourly.Add(rec.Started.Local(), rec.Results())
+		}
+		if *heatMap {
+			printHeatMap(hourly, color)
+		}
+		if *heatMapHTML != "" {
+			if err := writeHeatMapHTML(*heatMapHTML, hourly, len(recs), recs[0].Started, recs[len(recs)-1].Started); err != nil {
+				slog.Error("heat map write failed", "path", *heatMapHTML, "err", err)
+				return 1
+			}
+			fmt.Printf("\nHeat map written to: %s\n", *heatMapHTML)
+		}
+	}
+
+	if *outCSV != "" {
+		if err := writeDailyCSV(*outCSV, days, byDay); err != nil {
+			slog.Error("CSV write failed", "path", *outCSV, "err", err)
+			return 1
+		}
+		fmt.Printf("\nCSV written to: %s\n", *outCSV)
+	}
+	if *outParquet != "" {
+		if err := writeParquet(*outParquet, recs); err != nil {
+			slog.Error("Parquet write failed", "path", *outParquet, "err", err)
+			return 1
+		}
+		fmt.Printf("\nParquet written to: %s\n", *outParquet)
+	}
+	return 0
+}
+
+func successPct(s bench.Stats) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return 100.0 * float64(s.Successes) / float64(s.Count)
+}
+
+// printDaily prints a table of cell(row) with a line per key, such as a
+// day, and a column per resolver.
+func printDaily(title, label string, days, names []string, byDay map[string][]*AggregateRow, cell func(*AggregateRow) string) {
+	width := 10
+	for _, day := range days {
+		width = max(width, len(day))
+	}
+	fmt.Printf("\n%s\n", title)
+	fmt.Printf("%-*s", width, label)
+	for _, name := range names {
+		fmt.Printf("  %10s", name)
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", width+12*len(names)))
+	for _, day := range days {
+		fmt.Printf("%-*s", width, day)
+		for _, name := range names {
+			v := "--"
+			for _, row := range byDay[day] {
+				if row.Name == name {
+					v = cell(row)
+				}
+			}
+			fmt.Printf("  %10s", v)
+		}
+		fmt.Println()
+	}
+}
+
+func writeDailyCSV(path string, days []string, byDay map[string][]*AggregateRow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	defer w.Flush()
+
+	if err := w.Write([]string{"day", "resolver", "runs", "count", "successes", "availability_pct", "min_ms", "median_ms", "p95_ms", "max_ms"}); err != nil {
+		return err
+	}
+	for _, day := range days {
+		for _, row := range byDay[day] {
+			s := bench.Summarize(row.Samples)
+			rec := []string{
+				day,
+				row.Name,
+				fmt.Sprintf("%d", row.Runs),
+				fmt.Sprintf("%d", s.Count),
+				fmt.Sprintf("%d", s.Successes),
+				fmt.Sprintf("%.1f", row.Availability()),
+				fmt.Sprintf("%.3f", float64(s.Min.Microseconds())/1000.0),
+				fmt.Sprintf("%.3f", float64(s.Median.Microseconds())/1000.0),
+				fmt.Sprintf("%.3f", float64(s.P95.Microseconds())/1000.0),
+				fmt.Sprintf("%.3f", float64(s.Max.Microseconds())/1000.0),
+			}
+			if err := w.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return writeCSVVersion(w)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// Alert describes a resolver that breached a threshold for Consecutive runs
+// in a row. It is the JSON body POSTed to the webhook.
+type Alert struct {
+	Time        time.Time `json:"time"`
+	Resolver    string    `json:"resolver"`
+	Reason      string    `json:"reason"`
+	Consecutive int       `json:"consecutive"`
+	MedianMs    float64   `json:"median_ms"`
+	P95Ms       float64   `json:"p95_ms"`
+	SuccessPct  float64   `json:"success_pct"`
+}
+
+// alerter tracks threshold breaches across repeated runs. An alert fires
+// once when a resolver has breached for After consecutive runs and is
+// re-armed by the first run that passes.
+type alerter struct {
+	P95        time.Duration // zero disables the p95 check
+	MinSuccess float64       // percent; zero disables the success check
+	After      int
+	Exec       string // shell command, run with the alert in DNSBENCH_* variables
+	Webhook    string // URL receiving the alert as JSON
+
+	streak map[string]int
+	client *http.Client
+}
+
+func newAlerter(p95 time.Duration, minSuccess float64, after int, execCmd, webhook string) *alerter {
+	if p95 <= 0 && minSuccess <= 0 {
+		return nil
+	}
+	return &alerter{
+		P95:        p95,
+		MinSuccess: minSuccess,
+		After:      max(after, 1),
+		Exec:       execCmd,
+		Webhook:    webhook,
+		streak:     make(map[string]int),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// breach returns why s violates the thresholds, or "" if it does not.
+func (a *alerter) breach(s bench.Stats) string {
+	var reasons []string
+	if pct := successPct(s); a.MinSuccess > 0 && pct < a.MinSuccess {
+		reasons = append(reasons, fmt.Sprintf("success %.1f%% < %.1f%%", pct, a.MinSuccess))
+	}
+	if a.P95 > 0 && s.Successes > 0 && s.P95 > a.P95 {
+		reasons = append(reasons, fmt.Sprintf("p95 %s > %s", durFmt(s.P95), durFmt(a.P95)))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// Check updates the breach streaks with a completed run and fires alerts.
+func (a *alerter) Check(ctx context.Context, at time.Time, rows []bench.Result) {
+	for _, r := range rows {
+		reason := a.breach(r.Stats)
+		if reason == "" {
+			a.streak[r.Name] = 0
+			continue
+		}
+		a.streak[r.Name]++
+		if a.streak[r.Name] != a.After {
+			continue
+		}
+		alert := Alert{
+			Time:        at,
+			Resolver:    r.Name,
+			Reason:      reason,
+			Consecutive: a.After,
+			MedianMs:    ms(r.Stats.Median),
+			P95Ms:       ms(r.Stats.P95),
+			SuccessPct:  successPct(r.Stats),
+		}
+		fmt.Printf("ALERT %s: %s (%d consecutive runs)\n", alert.Resolver, alert.Reason, alert.Consecutive)
+		if err := a.fire(ctx, alert); err != nil {
+			slog.Error("alert delivery failed", "resolver", alert.Resolver, "err", err)
+		}
+	}
+}
+
+func (a *alerter) fire(ctx context.Context, alert Alert) error {
+	if a.Exec != "" {
+		cmd := shellCommand(ctx, a.Exec)
+		cmd.Env = append(os.Environ(),
+			"DNSBENCH_RESOLVER="+alert.Resolver,
+			"DNSBENCH_REASON="+alert.Reason,
+			fmt.Sprintf("DNSBENCH_CONSECUTIVE=%d", alert.Consecutive),
+			fmt.Sprintf("DNSBENCH_MEDIAN_MS=%.3f", alert.MedianMs),
+			fmt.Sprintf("DNSBENCH_P95_MS=%.3f", alert.P95Ms),
+			fmt.Sprintf("DNSBENCH_SUCCESS_PCT=%.1f", alert.SuccessPct),
+		)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("alert command: %w", err)
+		}
+	}
+	if a.Webhook != "" {
+		body, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Webhook, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("alert webhook: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("alert webhook: %s", resp.Status)
+		}
+	}
+	return nil
+}
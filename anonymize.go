@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// defaultInternalDomains are suffixes commonly used for private names.
+const defaultInternalDomains = "local,lan,home,internal,intranet,corp,localdomain,home.arpa"
+
+// exportAnonymizer, when set by -anonymize, rewrites everything written for
+// other programs before it is written: CSV files, saved runs, -template and
+// -format output, hook events and the control API.
+var exportAnonymizer *anonymizer
+
+// anonymizer replaces private IP addresses, the local host name and names
+// under internal domains with pseudonyms. A pseudonym is a keyed hash of
+// the original, so it is the same in every file written with the same key
+// but cannot be reversed without it.
+type anonymizer struct {
+	key      []byte
+	host     string   // lower-cased local host name
+	internal []string // lower-cased domain suffixes, without dots
+}
+
+var (
+	ipv4Pattern = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+	ipv6Pattern = regexp.MustCompile(`\[?[0-9A-Fa-f]{0,4}(:[0-9A-Fa-f]{0,4}){2,7}(%[\w.-]+)?\]?`)
+	namePattern = regexp.MustCompile(`\b[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*\.?`)
+)
+
+// newAnonymizer returns an anonymizer with the key stored in the user
+// configuration directory, creating the key on first use.
+func newAnonymizer(internalDomains []string) (*anonymizer, error) {
+	key, err := anonymizeKey()
+	if err != nil {
+		return nil, err
+	}
+	a := &anonymizer{key: key}
+	if host, err := os.Hostname(); err == nil {
+		a.host = strings.ToLower(host)
+	}
+	for _, d := range internalDomains {
+		if d = strings.ToLower(strings.Trim(d, ".")); d != "" {
+			a.internal = append(a.internal, d)
+		}
+	}
+	return a, nil
+}
+
+func anonymizeKey() ([]byte, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "dnsbench", "anonymize.key")
+	if b, err := os.ReadFile(path); err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(b)))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	return key, os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600)
+}
+
+// pseudonym returns kind followed by a short keyed hash of v.
+func (a *anonymizer) pseudonym(kind, v string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + ":" + strings.ToLower(v)))
+	return kind + "-" + hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// Text replaces every private address and internal name within s, such as
+// an address or an error message, leaving public ones as they are.
+func (a *anonymizer) Text(s string) string {
+	if a == nil || s == "" {
+		return s
+	}
+	s = ipv6Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		ip, err := netip.ParseAddr(strings.Trim(m, "[]"))
+		if err != nil || !isPrivateAddr(ip) {
+			return m
+		}
+		return strings.Replace(m, strings.Trim(m, "[]"), a.pseudonym("ip6", ip.String()), 1)
+	})
+	s = ipv4Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		if ip, err := netip.ParseAddr(m); err == nil && isPrivateAddr(ip) {
+			return a.pseudonym("ip", m)
+		}
+		return m
+	})
+	return namePattern.ReplaceAllStringFunc(s, func(m string) string {
+		name := strings.ToLower(strings.TrimSuffix(m, "."))
+		if name != "" && (name == a.host || a.isInternal(name)) {
+			return a.pseudonym("host", name) + ".invalid"
+		}
+		return m
+	})
+}
+
+// isInternal reports a name below one of the internal domains. The bare
+// suffix is left alone: it is a common word, as in a resolver named Local.
+func (a *anonymizer) isInternal(name string) bool {
+	for _, d := range a.internal {
+		if strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivateAddr reports addresses that identify a network or machine
+// rather than a public service: RFC 1918, CGNAT, loopback, link-local and
+// unique local addresses.
+func isPrivateAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		netip.MustParsePrefix("100.64.0.0/10").Contains(ip)
+}
+
+// Results returns a copy of rows with anonymized names and errors.
+func (a *anonymizer) Results(rows []bench.Result) []bench.Result {
+	if a == nil {
+		return rows
+	}
+	out := make([]bench.Result, len(rows))
+	for i, r := range rows {
+		r.Name, r.Group = a.Text(r.Name), a.Text(r.Group)
+		r.Samples = append([]bench.Sample(nil), r.Samples...)
+		for j := range r.Samples {
+			r.Samples[j].Err = a.err(r.Samples[j].Err)
+		}
+		r.Stats.Errors = append([]error(nil), r.Stats.Errors...)
+		for j := range r.Stats.Errors {
+			r.Stats.Errors[j] = a.err(r.Stats.Errors[j])
+		}
+		out[i] = r
+	}
+	return out
+}
+
+func (a *anonymizer) err(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.New(a.Text(err.Error()))
+}
+
+// Resolvers returns a copy of rs with anonymized names and addresses.
+func (a *anonymizer) Resolvers(rs []bench.Resolver) []bench.Resolver {
+	if a == nil {
+		return rs
+	}
+	out := make([]bench.Resolver, len(rs))
+	for i, r := range rs {
+		r.Name, r.Addr, r.Group = a.Text(r.Name), a.Text(r.Addr), a.Text(r.Group)
+		out[i] = r
+	}
+	return out
+}
+
+// HookEvent anonymizes a hook event in place.
+func (a *anonymizer) HookEvent(ev *HookEvent) {
+	if a == nil {
+		return
+	}
+	ev.Host, ev.Domain = a.Text(ev.Host), a.Text(ev.Domain)
+	for i := range ev.Resolvers {
+		ev.Resolvers[i].Name, ev.Resolvers[i].Addr = a.Text(ev.Resolvers[i].Name), a.Text(ev.Resolvers[i].Addr)
+	}
+	if s := ev.Sample; s != nil {
+		s.Resolver, s.Addr, s.QName, s.Error = a.Text(s.Resolver), a.Text(s.Addr), a.Text(s.QName), a.Text(s.Error)
+	}
+	for i := range ev.Results {
+		ev.Results[i].Resolver = a.Text(ev.Results[i].Resolver)
+	}
+}
+
+// Record anonymizes a saved run in place.
+func (a *anonymizer) Record(rec *bench.RunRecord) {
+	if a == nil {
+		return
+	}
+	rec.Host = a.Text(rec.Host)
+	rec.Domain = a.Text(rec.Domain)
+	for i := range rec.Resolvers {
+		rr := &rec.Resolvers[i]
+		rr.Name, rr.Addr, rr.Group = a.Text(rr.Name), a.Text(rr.Addr), a.Text(rr.Group)
+		for j := range rr.IPs {
+			rr.IPs[j] = a.Text(rr.IPs[j])
+		}
+		for j := range rr.Samples {
+			rr.Samples[j].Error = a.Text(rr.Samples[j].Error)
+		}
+	}
+}
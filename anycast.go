@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// printSites reports the anycast identities each resolver gave during the
+// run and the median latency of the samples served by each of them. A site
+// change mid-run commonly explains a bimodal latency distribution.
+func printSites(rows []bench.Result) {
+	checked := false
+	for _, r := range rows {
+		checked = checked || len(r.Sites) > 0
+	}
+	if !checked {
+		return
+	}
+	fmt.Printf("\nAnycast sites (CHAOS id.server)\n")
+	fmt.Printf("%-12s  %6s  %5s  %7s  %s\n", "Resolver", "Checks", "Sites", "Changes", "Note")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range rows {
+		if len(r.Sites) == 0 {
+			continue
+		}
+		var order []string
+		latency := make(map[string][]float64)
+		for i, s := range r.Samples {
+			id := bench.SiteOf(r.Sites, i)
+			if _, ok := latency[id]; !ok {
+				order = append(order, id)
+				latency[id] = nil
+			}
+			if s.Err == nil {
+				latency[id] = append(latency[id], ms(s.Duration))
+			}
+		}
+		changes := bench.SiteChanges(r.Sites)
+		named := 0
+		for _, id := range order {
+			if id != "" {
+				named++
+			}
+		}
+		note := ""
+		switch {
+		case named == 0:
+			note = "no identity"
+			if err := r.Sites[0].Err; err != nil {
+				note += ": " + err.Error()
+			}
+		case changes > 0:
+			note = "site changed mid-run"
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("%-12s  %6d  %5d  %7d  %s", r.Name, len(r.Sites), named, changes, note), " "))
+		if changes == 0 && named == 1 {
+			fmt.Printf("  %s\n", order[len(order)-1])
+			continue
+		}
+		for _, id := range order {
+			if id == "" {
+				continue
+			}
+			v := latency[id]
+			sort.Float64s(v)
+			med := durFmt(time.Duration(bench.Percentile(v, 50) * float64(time.Millisecond)))
+			fmt.Printf("  %-30s  %3d samples, median %s\n", id, len(v), med)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// dnsTarget is a place the system resolver configuration can be written.
+type dnsTarget interface {
+	// Plan describes the change that Apply would make.
+	Plan(servers []string) string
+	Apply(servers []string) error
+}
+
+// dnsTargets are the supported -target values besides "auto".
+var dnsTargets = map[string]func(service string) dnsTarget{
+	"systemd-resolved": func(string) dnsTarget { return resolvedTarget{} },
+	"resolv.conf":      func(string) dnsTarget { return resolvConfTarget{path: "/etc/resolv.conf"} },
+	"networksetup":     func(service string) dnsTarget { return networksetupTarget{service: service} },
+	"netsh":            func(adapter string) dnsTarget { return netshTarget{adapter: adapter} },
+}
+
+// autoTarget picks the target that manages DNS on this system.
+func autoTarget() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "networksetup"
+	case "windows":
+		return "netsh"
+	case "linux":
+		if _, err := os.Stat("/run/systemd/resolve"); err == nil {
+			return "systemd-resolved"
+		}
+		return "resolv.conf"
+	}
+	return ""
+}
+
+const resolvedDropIn = "/etc/systemd/resolved.conf.d/dns-bench.conf"
+
+type resolvedTarget struct{}
+
+func (resolvedTarget) Plan(servers []string) string {
+	return fmt.Sprintf("write %s with DNS=%s and restart systemd-resolved", resolvedDropIn, strings.Join(servers, " "))
+}
+
+func (resolvedTarget) Apply(servers []string) error {
+	if err := os.MkdirAll("/etc/systemd/resolved.conf.d", 0o755); err != nil {
+		return err
+	}
+	conf := "# Written by dnsbench apply\n[Resolve]\nDNS=" + strings.Join(servers, " ") + "\n"
+	if err := os.WriteFile(resolvedDropIn, []byte(conf), 0o644); err != nil {
+		return err
+	}
+	return run("systemctl", "restart", "systemd-resolved")
+}
+
+type resolvConfTarget struct{ path string }
+
+func (t resolvConfTarget) Plan(servers []string) string {
+	return fmt.Sprintf("replace the nameserver lines of %s with %s (backup in %s.dnsbench.bak)", t.path, strings.Join(servers, ", "), t.path)
+}
+
+// Apply rewrites the nameserver lines and keeps search, options and
+// comments.
+func (t resolvConfTarget) Apply(servers []string) error {
+	if fi, err := os.Lstat(t.path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symlink managed by another service; use -target systemd-resolved", t.path)
+	}
+	old, err := os.ReadFile(t.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.WriteFile(t.path+".dnsbench.bak", old, 0o644); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("# nameservers written by dnsbench apply\n")
+	for _, s := range servers {
+		fmt.Fprintf(&b, "nameserver %s\n", s)
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(old)))
+	for sc.Scan() {
+		if f := strings.Fields(sc.Text()); len(f) > 0 && f[0] == "nameserver" {
+			continue
+		}
+		b.WriteString(sc.Text() + "\n")
+	}
+	return os.WriteFile(t.path, []byte(b.String()), 0o644)
+}
+
+type networksetupTarget struct{ service string }
+
+func (t networksetupTarget) Plan(servers []string) string {
+	return fmt.Sprintf("networksetup -setdnsservers %q %s", t.service, strings.Join(servers, " "))
+}
+
+func (t networksetupTarget) Apply(servers []string) error {
+	return run("networksetup", append([]string{"-setdnsservers", t.service}, servers...)...)
+}
+
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// plainServer returns the IP and port of a resolver reachable as plain DNS,
+// the only kind every system resolver configuration accepts.
+func plainServer(addr string) (ip, port string, ok bool) {
+	if s := transport.Scheme(addr); s != "udp" && s != "tcp" {
+		return "", "", false
+	}
+	host, port, err := net.SplitHostPort(transport.HostPort(addr, "53"))
+	if err != nil || net.ParseIP(host) == nil {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+// rankResults orders the names of resolvers that answered at least once,
+// best first: by composite score when a profile is given, else by success
+// rate and then median latency. It also returns the scores, nil without a
+// profile.
+func rankResults(ctx context.Context, rows []bench.Result, resolvers []bench.Resolver, cfg Config, timeout time.Duration) ([]string, []ResolverScore) {
+	working := make(map[string]bool)
+	for _, r := range rows {
+		working[r.Name] = r.Stats.Successes > 0
+	}
+	var names []string
+	if cfg.Score != nil {
+		var feats map[string]bench.Features
+		var featErrs map[string]error
+		if cfg.Score.NeedsFeatures() {
+			feats, featErrs = probeFeatures(ctx, resolvers, timeout)
+		}
+		scores := scoreResults(rows, *cfg.Score, feats, featErrs)
+		for _, s := range scores {
+			if working[s.Name] {
+				names = append(names, s.Name)
+			}
+		}
+		return names, scores
+	}
+	sorted := append([]bench.Result(nil), rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Stats, sorted[j].Stats
+		if pa, pb := successPct(a), successPct(b); pa != pb {
+			return pa > pb
+		}
+		return a.Median < b.Median
+	})
+	for _, r := range sorted {
+		if working[r.Name] {
+			names = append(names, r.Name)
+		}
+	}
+	return names, nil
+}
+
+// runApply implements the apply subcommand: benchmark, pick the best plain
+// DNS resolvers, and write them to the system configuration after
+// confirmation.
+func runApply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	resolversCSV := fs.String("resolvers", defaultResolvers, "Resolvers to choose from, as Name=Addr[,...]; only plain DNS IPs on port 53 can be applied")
+	domain := fs.String("domain", "example.com", "Domain to resolve")
+	count := fs.Int("count", 10, "Number of queries per resolver")
+	timeout := fs.Duration("timeout", 1500*time.Millisecond, "Per-query timeout")
+	network := fs.String("network", "ip4", "Network: ip4 or ip6 (A vs AAAA)")
+	top := fs.Int("top", 2, "Number of resolvers to configure")
+	target := fs.String("target", "auto", "Where to write: auto, systemd-resolved, resolv.conf, networksetup or netsh")
+	service := fs.String("service", "Wi-Fi", "macOS network service (networksetup) or Windows adapter (netsh)")
+	configPath := fs.String("config", "", "Optional JSON config with a scoring profile used for ranking")
+	yes := fs.Bool("yes", false, "Apply without asking for confirmation")
+	dryRun := fs.Bool("dry-run", false, "Only print the change that would be made")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench apply [flags]\n\n"+
+			"Benchmarks the resolvers and configures the fastest reliable ones as the system resolvers.\n\n")
+		fs.PrintDefaults()
+	}
+	setHooks := hookFlags(fs)
+	logLevelFlag(fs)
+	fs.Parse(args)
+	setHooks()
+
+	var cfg Config
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	name := *target
+	if name == "auto" {
+		name = autoTarget()
+	}
+	newTarget, ok := dnsTargets[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "No DNS configuration target %q for %s\n", *target, runtime.GOOS)
+		return 1
+	}
+	resolvers := bench.ParseResolvers(*resolversCSV)
+	if len(resolvers) == 0 {
+		fmt.Fprintln(os.Stderr, "No resolvers provided.")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runner := &bench.Runner{Resolvers: resolvers, Domain: *domain, Count: *count, Timeout: *timeout, Network: *network}
+	rows, err := runHooks.Run(ctx, runner, nil)
+	if err != nil {
+		slog.Error("run interrupted", "err", err)
+		return 1
+	}
+	printTable(rows)
+
+	ranked, scores := rankResults(ctx, rows, resolvers, cfg, *timeout)
+	if scores != nil {
+		printScores(scores, *cfg.Score)
+	}
+	chosen, servers := selectResolvers(ranked, resolvers, *top, selectIPs)
+	if len(servers) == 0 {
+		fmt.Fprintln(os.Stderr, "No working plain DNS resolver to apply.")
+		return 1
+	}
+
+	t := newTarget(*service)
+	fmt.Printf("\nBest resolvers: %s\n", strings.Join(chosen, ", "))
+	fmt.Printf("Plan: %s\n", t.Plan(servers))
+	if *dryRun {
+		return 0
+	}
+	if !*yes {
+		fmt.Print("Apply this change? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Not applied.")
+			return 0
+		}
+	}
+	if err := t.Apply(servers); err != nil {
+		slog.Error("apply failed", "err", err)
+		return 1
+	}
+	fmt.Println("Applied.")
+	return 0
+}
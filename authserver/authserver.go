@@ -0,0 +1,329 @@
+// Package authserver is a small authoritative DNS server for one zone of
+// fixed records, over UDP and TCP on loopback: a known-good target for the
+// self-test of dnsbench and for end-to-end tests of the measurement
+// pipeline, whose answers, TTLs and delays are known in advance. The zone
+// has the layout of -test-zone, unsigned, and names that fail on purpose.
+package authserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// Labels below the zone apex and what the server answers for them. Names
+// that are none of these, nor below wild, ttl, slow, drop or servfail, do
+// not exist.
+const (
+	LabelWild     = "wild"     // wild and *.wild: Addr4 and Addr6
+	LabelTTL      = "ttl"      // *.ttl: as wild, with ShortTTL
+	LabelLarge    = "large"    // a TXT record of LargeSize bytes
+	LabelBogus    = "bogus"    // Addr4; bogus only in a signed zone
+	LabelSlow     = "slow"     // slow and *.slow: as wild, after Server.SlowDelay
+	LabelDrop     = "drop"     // drop and *.drop: no answer at all
+	LabelServFail = "servfail" // servfail and *.servfail: SERVFAIL
+)
+
+// The records of the zone.
+var (
+	Addr4 = netip.MustParseAddr("192.0.2.1")   // TEST-NET-1
+	Addr6 = netip.MustParseAddr("2001:db8::1") // documentation prefix
+)
+
+const (
+	TTL         = 300  // of the records, except those below ttl
+	ShortTTL    = 20   // of the records below ttl
+	NegativeTTL = 60   // the SOA MINIMUM, for NXDOMAIN and NODATA answers
+	LargeSize   = 3000 // the TXT strings of large, in bytes
+)
+
+// maxUDPSize is the largest answer sent over UDP, the EDNS(0) buffer size
+// of DNS Flag Day 2020; queries without EDNS(0) get 512 bytes.
+const maxUDPSize = 1232
+
+// idleTimeout is how long a TCP connection may wait for its next query.
+const idleTimeout = 10 * time.Second
+
+// Server answers the queries for Zone. Set the fields before Start.
+type Server struct {
+	Zone string // the apex, e.g. "dnsbench.test"
+	// SlowDelay is how long the answers for slow and the names below it
+	// wait before they are sent.
+	SlowDelay time.Duration
+	// OnQuery, if set, is called with the question of every query
+	// received, over "udp" or "tcp", from the goroutines serving them.
+	OnQuery func(network string, q dnsmsg.Question)
+
+	udp   net.PacketConn
+	tcp   net.Listener
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// Start listens on addr, a host:port whose port may be 0 for a free one,
+// over UDP and TCP on the same port, and serves until Close.
+func (s *Server) Start(addr string) error {
+	s.Zone = strings.ToLower(strings.TrimSuffix(s.Zone, "."))
+	if s.Zone == "" {
+		return errors.New("authserver: no zone")
+	}
+	// With port 0 the TCP port the system picks may be taken for UDP;
+	// try a few.
+	for try := 0; ; try++ {
+		tcp, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		udp, err := net.ListenPacket("udp", tcp.Addr().String())
+		if err != nil {
+			tcp.Close()
+			if _, port, _ := net.SplitHostPort(addr); port == "0" && try < 10 {
+				continue
+			}
+			return err
+		}
+		s.tcp, s.udp = tcp, udp
+		break
+	}
+	s.conns = make(map[net.Conn]bool)
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.tcp.Addr().String()
+}
+
+// Close stops the server and waits for the queries in progress.
+func (s *Server) Close() error {
+	err := errors.Join(s.udp.Close(), s.tcp.Close())
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		wire := append([]byte(nil), buf[:n]...)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			resp := s.respond("udp", wire)
+			if resp == nil {
+				return
+			}
+			out, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			if len(out) > udpLimit(wire) {
+				resp.Truncated = true
+				resp.Answers, resp.Authorities = nil, nil
+				if out, err = resp.Pack(); err != nil {
+					return
+				}
+			}
+			s.udp.WriteTo(out, from)
+		}()
+	}
+}
+
+// udpLimit returns the largest answer the sender of query can take over
+// UDP.
+func udpLimit(query []byte) int {
+	m, err := dnsmsg.Unpack(query)
+	if err != nil {
+		return 512
+	}
+	opt, ok := m.OPT()
+	if !ok {
+		return 512
+	}
+	return min(max(int(opt.Class), 512), maxUDPSize)
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// serveConn answers the queries of a TCP connection in turn, until the
+// client closes it or leaves it idle for idleTimeout.
+func (s *Server) serveConn(conn net.Conn) {
+	var hdr [2]byte
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			return
+		}
+		wire := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+		if _, err := io.ReadFull(conn, wire); err != nil {
+			return
+		}
+		resp := s.respond("tcp", wire)
+		if resp == nil {
+			continue
+		}
+		out, err := resp.Pack()
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(out)))); err != nil {
+			return
+		}
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+// respond returns the response to the query in wire, or nil for none.
+func (s *Server) respond(network string, wire []byte) *dnsmsg.Message {
+	q, err := dnsmsg.Unpack(wire)
+	if err != nil || q.Response {
+		return nil
+	}
+	resp := &dnsmsg.Message{
+		ID:               q.ID,
+		Response:         true,
+		Opcode:           q.Opcode,
+		RecursionDesired: q.RecursionDesired,
+		CheckingDisabled: q.CheckingDisabled,
+		Questions:        q.Questions,
+	}
+	if _, ok := q.OPT(); ok {
+		resp.SetEDNS0(maxUDPSize, false)
+	}
+	switch {
+	case q.Opcode != 0:
+		resp.RCode = dnsmsg.RCodeNotImplemented
+		return resp
+	case len(q.Questions) != 1:
+		resp.RCode = dnsmsg.RCodeFormatError
+		return resp
+	}
+	question := q.Questions[0]
+	if s.OnQuery != nil {
+		s.OnQuery(network, question)
+	}
+	name := strings.ToLower(strings.TrimSuffix(question.Name, "."))
+	rel, ok := strings.CutSuffix(name, s.Zone)
+	if !ok || rel != "" && !strings.HasSuffix(rel, ".") {
+		resp.RCode = dnsmsg.RCodeRefused
+		return resp
+	}
+	rel = strings.TrimSuffix(rel, ".")
+	resp.Authoritative = true
+
+	below := func(label string) bool { return rel == label || strings.HasSuffix(rel, "."+label) }
+	var records []dnsmsg.Resource
+	switch {
+	case rel == "":
+		records = append(s.addrs(question.Name, TTL), s.soa())
+	case below(LabelDrop):
+		return nil
+	case below(LabelServFail):
+		resp.RCode = dnsmsg.RCodeServerFailure
+		return resp
+	case below(LabelSlow):
+		time.Sleep(s.SlowDelay)
+		records = s.addrs(question.Name, TTL)
+	case below(LabelWild):
+		records = s.addrs(question.Name, TTL)
+	case strings.HasSuffix(rel, "."+LabelTTL):
+		records = s.addrs(question.Name, ShortTTL)
+	case rel == LabelTTL:
+		// An empty non-terminal: the name exists, without records.
+	case rel == LabelBogus:
+		records = s.addrs(question.Name, TTL)[:1]
+	case rel == LabelLarge:
+		records = []dnsmsg.Resource{largeTXT(question.Name)}
+	default:
+		resp.RCode = dnsmsg.RCodeNameError
+		resp.Authorities = []dnsmsg.Resource{s.soa()}
+		return resp
+	}
+	for _, rr := range records {
+		if rr.Type == question.Type || question.Type == dnsmsg.TypeANY {
+			rr.Name = question.Name
+			resp.Answers = append(resp.Answers, rr)
+		}
+	}
+	if len(resp.Answers) == 0 {
+		resp.Authorities = []dnsmsg.Resource{s.soa()}
+	}
+	return resp
+}
+
+// addrs returns the A and AAAA records of name.
+func (s *Server) addrs(name string, ttl uint32) []dnsmsg.Resource {
+	return []dnsmsg.Resource{
+		{Name: name, Type: dnsmsg.TypeA, Class: dnsmsg.ClassINET, TTL: ttl, Data: Addr4.AsSlice()},
+		{Name: name, Type: dnsmsg.TypeAAAA, Class: dnsmsg.ClassINET, TTL: ttl, Data: Addr6.AsSlice()},
+	}
+}
+
+// soa returns the SOA record of the zone.
+func (s *Server) soa() dnsmsg.Resource {
+	data, _ := dnsmsg.AppendName(nil, s.Zone)
+	data, _ = dnsmsg.AppendName(data, "hostmaster."+s.Zone)
+	for _, v := range []uint32{1, 3600, 600, 86400, NegativeTTL} { // serial, refresh, retry, expire, minimum
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	return dnsmsg.Resource{Name: s.Zone + ".", Type: dnsmsg.TypeSOA, Class: dnsmsg.ClassINET, TTL: TTL, Data: data}
+}
+
+// largeTXT returns a TXT record whose strings hold LargeSize bytes.
+func largeTXT(name string) dnsmsg.Resource {
+	var data []byte
+	for left := LargeSize; left > 0; left -= 250 {
+		n := min(left, 250)
+		data = append(data, byte(n))
+		data = append(data, strings.Repeat("x", n)...)
+	}
+	return dnsmsg.Resource{Name: name, Type: dnsmsg.TypeTXT, Class: dnsmsg.ClassINET, TTL: TTL, Data: data}
+}
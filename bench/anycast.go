@@ -0,0 +1,82 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// SiteObservation is the server identity an anycast resolver reported
+// before sample Index.
+type SiteObservation struct {
+	Index int
+	At    time.Time
+	ID    string // empty when the resolver did not identify itself
+	Err   error
+}
+
+var errNoIdentity = errors.New("no id.server or hostname.bind answer")
+
+// ServerIdentity asks the resolver behind tr which server answered, with
+// the CHAOS TXT queries id.server (RFC 4892) and, failing that,
+// hostname.bind. Anycast operators encode the site in the answer, such as
+// "AMS" or "fra08", so it changes when routing moves the client to another
+// point of presence.
+func ServerIdentity(ctx context.Context, tr transport.Transport, timeout time.Duration) (string, error) {
+	var lastErr error = errNoIdentity
+	for _, name := range []string{"id.server", "hostname.bind"} {
+		qctx, cancel := withTimeout(ctx, timeout)
+		q := dnsmsg.NewQuery(name, dnsmsg.TypeTXT)
+		q.Questions[0].Class = dnsmsg.ClassCHAOS
+		resp, err := tr.SendQuery(qctx, q)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, rr := range resp.Answers {
+			if rr.Type != dnsmsg.TypeTXT {
+				continue
+			}
+			if txt, err := rr.TXT(); err == nil && len(txt) > 0 {
+				return strings.Join(txt, ""), nil
+			}
+		}
+	}
+	return "", lastErr
+}
+
+// SiteChanges returns the number of times the reported identity changed
+// between consecutive observations that both had one.
+func SiteChanges(sites []SiteObservation) int {
+	n, prev := 0, ""
+	for _, s := range sites {
+		if s.ID == "" {
+			continue
+		}
+		if prev != "" && s.ID != prev {
+			n++
+		}
+		prev = s.ID
+	}
+	return n
+}
+
+// SiteOf returns the identity in effect for sample i: the last identified
+// observation at or before it.
+func SiteOf(sites []SiteObservation, i int) string {
+	id := ""
+	for _, s := range sites {
+		if s.Index > i {
+			break
+		}
+		if s.ID != "" {
+			id = s.ID
+		}
+	}
+	return id
+}
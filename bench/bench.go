@@ -0,0 +1,372 @@
+// Package bench is the benchmarking engine behind dnsbench. A Runner issues
+// timed queries against a set of resolvers and summarizes the samples;
+// embedding applications can observe progress through events and cancel a
+// run through its context.
+package bench
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// Sample is the outcome of a single timed query.
+type Sample struct {
+	Duration time.Duration
+	Err      error
+	// FirstByte is the time until the first byte of the response arrived,
+	// reported by stream transports (TCP, TLS, HTTPS) only; zero otherwise.
+	FirstByte time.Duration
+	// Size is the length in bytes of the response message, also for
+	// failed samples that got one (such as NXDOMAIN); zero without one.
+	Size int
+	// Padded reports an EDNS(0) Padding option in the response.
+	Padded bool
+	// RTT is the network round trip to the server measured just before
+	// the query with Runner.RTT; zero without one.
+	RTT time.Duration
+	// Queries is the number of queries the sample sent: one, the
+	// BrowserTypes bundle with BrowserSim, or one per name tried with a
+	// Runner.Search list.
+	Queries int
+	// SrcPort and ID are the local port and DNS message ID of the first
+	// query of the sample, to find it in firewall and server logs. SrcPort
+	// is zero when the transport does not tell it, and DoH sends ID zero.
+	SrcPort int
+	ID      uint16
+	// QuerySize is the length in bytes of the first query message of the
+	// sample, zero when the transport does not tell it.
+	QuerySize int
+	// Response holds the header and section counts of the response the
+	// sample got, for failed samples too; nil without one.
+	Response *ResponseHeader
+	// Overhead is the time of the sample off the wire with
+	// Runner.WireTiming, which Duration leaves out: packing the query,
+	// connecting, parsing the response and scheduling. Zero without wire
+	// timing or when the transport does not report the moments.
+	Overhead time.Duration
+	// Build and Parse are the time spent packing the queries of the
+	// sample and parsing their responses with Runner.Phases, which
+	// Duration leaves out. Zero without phases or when the transport
+	// does not report them.
+	Build, Parse time.Duration
+}
+
+// Result holds the samples and statistics collected for one resolver.
+type Result struct {
+	Name        string
+	Stats       Stats
+	Samples     []Sample
+	NAT64Prefix string            // detected prefix in DNS64 mode
+	Aborted     bool              // stopped early after Runner.AbortAfterErrors consecutive failures
+	Failures    int               // consecutive failed queries at the end, whatever Filter keeps
+	Sites       []SiteObservation // anycast identities, with Runner.SiteCheckEvery
+	Group       string            // Resolver.Group
+	Filtered    int               // samples Runner.Filter left out of Stats and Samples
+	Tags        []string          // Resolver.Tags
+	Elapsed     time.Duration     // wall time from the first query to the last answer
+	Operator    *Operator         // Resolver.Operator
+	Pairs       []Pair            // with Runner.ColdWarm, of all queries whatever Filter keeps; a random subset with MaxSamples
+	Busy        int               // queries sent while the host's CPUs were above Runner.BusyCPU
+	Paused      time.Duration     // waited for the host's CPUs with Runner.PauseWhenBusy
+}
+
+// Runner benchmarks a set of resolvers. The zero value is not usable; set at
+// least Resolvers, Domain and Count.
+type Runner struct {
+	Resolvers []Resolver
+	Domain    string
+	Count     int           // queries per resolver
+	Timeout   time.Duration // per query; zero means no timeout
+	Network   string        // "ip4" (A) or "ip6" (AAAA)
+	Cold      bool          // prefix a random label to bypass resolver caches
+	DNS64     bool          // verify answers are synthesized from the resolver's NAT64 prefix
+	QType     dnsmsg.Type   // record type to query; zero means the address type of Network
+	// Duration, if positive, replaces Count: each resolver gets as many
+	// queries, one after another, as it answers in this time.
+	Duration time.Duration
+	// Domains, if set, are queried in turn instead of Domain, as a workload
+	// of many names; Domain then only labels the run.
+	Domains []string
+	// DomainTypes, if set, holds the record type of each name of Domains,
+	// as query files of dnsperf do. It replaces QType and QTypeMix for the
+	// names with a type; zero leaves the type of a name to them.
+	DomainTypes []dnsmsg.Type
+	// ZipfExponent, if positive, draws the name of each query from Domains
+	// at random instead of in turn, the name of rank k with weight 1/k^s for
+	// this exponent s. Every resolver gets the same sequence of names.
+	ZipfExponent float64
+	// Seed makes the random choices of a run, the cache-busting labels of
+	// Cold and the names drawn with ZipfExponent, repeat exactly in every
+	// run with the same seed. Zero picks a random seed.
+	Seed uint64
+	// QTypeMix, if set, cycles the queries through these record types, as
+	// clients asking for several types per name do. It replaces QType.
+	QTypeMix []dnsmsg.Type
+	// ColdShare is the fraction of queries, from 0 to 1, that get a
+	// cache-busting label when Cold is unset, for a mix of cached and
+	// uncached names. As the random names rarely exist, NXDOMAIN answers
+	// to these queries count as success.
+	ColdShare float64
+	// ColdWarm alternates cold and warm queries: every even query gets a
+	// cache-busting label and the odd one after it asks for the same name
+	// without, so that each pair shows what the resolver's cache saves
+	// (Result.Pairs). It replaces Cold and ColdShare.
+	ColdWarm bool
+	// BrowserSim makes every sample the bundle of queries a browser sends
+	// per host name (see LookupBrowser), timed until all are answered. It
+	// replaces QType and QTypeMix.
+	BrowserSim bool
+	// Search, if set, resolves every query name through this search list
+	// with the Ndots option, as a stub resolver with these resolv.conf
+	// settings does (see LookupSearch). A sample is timed until a candidate
+	// name has records. Fully qualified names, ending in a dot, are queried
+	// as is.
+	Search []string
+	Ndots  int
+	// NonRecursive sends queries without recursion desired and counts
+	// referrals as success, for benchmarking root and TLD servers.
+	NonRecursive bool
+	// SiteCheckEvery asks each resolver for its server identity (see
+	// ServerIdentity) before the first query and then every this many
+	// queries, to spot anycast site changes during a run. Zero disables it.
+	SiteCheckEvery int
+
+	// Concurrency is the number of resolvers benchmarked at once; values
+	// below 2 run them one after another. Each resolver runs in its own
+	// goroutine with its own query deadlines, so a slow or dead resolver
+	// does not hold up the queries of another.
+	Concurrency int
+	// AbortAfterErrors stops querying a resolver after this many
+	// consecutive failed queries; zero never aborts.
+	AbortAfterErrors int
+	// RTT, if set, measures the network round trip to a resolver's server
+	// before every query, outside the query's time, so that the time the
+	// resolver itself takes can be told apart from the path. A failed
+	// measurement leaves Sample.RTT zero.
+	RTT func(ctx context.Context, res Resolver) (time.Duration, error)
+	// Path, if set, sends all queries through this interface or with this
+	// routing mark (see transport.Path).
+	Path transport.Path
+	// MaxSamples, if positive, bounds the memory of long runs: each Result
+	// keeps at most this many Samples and Pairs, uniform random subsets,
+	// while its Stats cover every query (see Accumulator).
+	MaxSamples int
+	// ReuseSockets sends the plain DNS queries to a resolver from the
+	// same UDP socket, as stub resolvers do, instead of a fresh socket
+	// each (see transport.UDP.Reuse).
+	ReuseSockets bool
+	// DoHMethod is the HTTP method of DNS-over-HTTPS queries: "POST" (the
+	// default when empty) or "GET" (see transport.HTTPS.Method).
+	DoHMethod string
+	// ConnsPerResolver, if positive, keeps up to this many TCP, DoT or DoH
+	// connections to each resolver open and reuses them, as forwarders
+	// do, instead of a new TCP or DoT connection per query (see
+	// transport.TCP.Pool). Queries in flight beyond it wait for one.
+	ConnsPerResolver int
+	// FastOpen opens the TCP and DoT connections with TCP Fast Open,
+	// where the OS supports it (see transport.WithFastOpen).
+	FastOpen bool
+	// WireTiming times each sample from immediately before its query is
+	// written to the socket to immediately after the response is read
+	// (transport.Trace.WriteStart and ReadDone), for sub-millisecond
+	// comparisons that packing, connection setup and parsing would blur.
+	// The time left out is Sample.Overhead.
+	WireTiming bool
+	// BusyPoll waits for UDP and TCP answers by polling the socket rather
+	// than sleeping (see transport.WithBusyPoll).
+	BusyPoll bool
+	// Phases times the packing of each sample's queries and the parsing
+	// of its responses (transport.Trace.Packed and Parsed) and leaves
+	// them out of its Duration, so that the statistics rank resolvers by
+	// the network alone and not by the CPU time of this host. The time
+	// left out is Sample.Build and Sample.Parse.
+	Phases bool
+	// BusyCPU, if positive, watches the share of the host's CPUs, from 0
+	// to 1, that other processes keep busy (Linux only): a busy host
+	// delays the benchmark's timers and socket wakeups and inflates the
+	// latencies. The queries sent while it is above are counted in
+	// Result.Busy, or with PauseWhenBusy wait until it is down again.
+	BusyCPU       float64
+	PauseWhenBusy bool
+	// PinCPU locks the goroutine sending each resolver's queries to an OS
+	// thread of its own, bound to one CPU where the OS allows (Linux), so
+	// that its timing does not move between threads and CPUs. It goes
+	// best with BusyPoll, which keeps the thread on its CPU.
+	PinCPU bool
+	// Rate, if positive, sends each resolver at most this many queries per
+	// second, one after another as before.
+	Rate float64
+	// Retries re-sends a query that got no answer, because it timed out or
+	// failed on the network, up to this many times, as a stub resolver
+	// does. The Sample covers all attempts: its Duration is their sum and
+	// its Queries counts every query sent.
+	Retries int
+	// Buffer is the number of events a run queues for its consumer, the
+	// onProgress callback of Run or the receiver of Stream, before the
+	// resolvers wait for it; zero means DefaultBuffer.
+	Buffer int
+	// Filter, if set, leaves the samples it does not match out of the
+	// Stats and Samples of each Result, for excluding a known-bad window
+	// or focusing on one class of responses. Their events are sent all
+	// the same, and they count toward AbortAfterErrors.
+	Filter *Filter
+}
+
+// EventKind identifies the type of an Event.
+type EventKind int
+
+const (
+	// EventResolverStart is emitted before the first query to a resolver.
+	EventResolverStart EventKind = iota
+	// EventSample is emitted after every query.
+	EventSample
+	// EventResolverDone is emitted once a resolver's samples are summarized.
+	EventResolverDone
+)
+
+// Event reports run progress to the onProgress callback of Run.
+type Event struct {
+	Kind     EventKind
+	Resolver Resolver
+	Index    int           // run index of Sample (EventSample)
+	QName    string        // name queried (EventSample)
+	QType    dnsmsg.Type   // type queried (EventSample)
+	Elapsed  time.Duration // since the resolver's first query (EventSample)
+	Sample   Sample        // EventSample
+	Result   *Result       // EventResolverDone
+}
+
+// newQuery returns the transport to res, nil if it cannot be created, and
+// the function that sends one sample's queries through it and returns how
+// many it sent. With DNS64 it detects the NAT64 prefix first and returns it.
+func (r *Runner) newQuery(ctx context.Context, res Resolver) (transport.Transport, func(ctx context.Context, qname string, qtype dnsmsg.Type) (int, error), string) {
+	tr, err := transport.New(res.Addr)
+	if udp, ok := tr.(*transport.UDP); ok {
+		udp.Reuse = r.ReuseSockets
+	}
+	switch t := tr.(type) {
+	case *transport.HTTPS:
+		t.Method = r.DoHMethod
+		if r.ConnsPerResolver > 0 {
+			t.LimitConns(r.ConnsPerResolver)
+		}
+	case *transport.TCP:
+		t.Pool = r.ConnsPerResolver
+	case *transport.TLS:
+		t.Pool = r.ConnsPerResolver
+	}
+	query := func(ctx context.Context, qname string, qtype dnsmsg.Type) (int, error) {
+		if r.NonRecursive {
+			return 1, QueryNonRecursive(ctx, tr, qname, qtype)
+		}
+		if qtype == dnsmsg.TypeA || qtype == dnsmsg.TypeAAAA {
+			_, err := LookupIP(ctx, tr, qname, qtype)
+			return 1, err
+		}
+		_, err := LookupRecords(ctx, tr, qname, qtype)
+		return 1, err
+	}
+	var nat64 string
+	switch {
+	case err != nil:
+		query = func(context.Context, string, dnsmsg.Type) (int, error) { return 0, err }
+	case r.BrowserSim:
+		query = func(ctx context.Context, qname string, _ dnsmsg.Type) (int, error) {
+			return len(BrowserTypes), LookupBrowser(ctx, tr, qname)
+		}
+	case len(r.Search) > 0:
+		query = func(ctx context.Context, qname string, qtype dnsmsg.Type) (int, error) {
+			return LookupSearch(ctx, tr, qname, qtype, r.Search, r.Ndots)
+		}
+	case r.DNS64:
+		qctx, cancel := r.queryContext(ctx)
+		prefix, err := DetectNAT64Prefix(qctx, tr)
+		cancel()
+		if err != nil {
+			query = func(context.Context, string, dnsmsg.Type) (int, error) { return 0, err }
+		} else {
+			nat64 = prefix.String()
+			query = func(ctx context.Context, qname string, _ dnsmsg.Type) (int, error) {
+				return 1, dns64Query(ctx, tr, qname, prefix)
+			}
+		}
+	}
+	return tr, query, nat64
+}
+
+// closeIdle closes the sockets tr keeps open between queries, if any.
+func closeIdle(tr transport.Transport) {
+	if c, ok := tr.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// bustedResult returns the error of a query, except for the NXDOMAIN a
+// name made up by ColdShare usually gets, which is no failure.
+func bustedResult(err error, busted bool) error {
+	if rc := RCodeError(0); busted && errors.As(err, &rc) && dnsmsg.RCode(rc) == dnsmsg.RCodeNameError {
+		return nil
+	}
+	return err
+}
+
+// QueryInfo identifies the sample a benchmark query belongs to.
+type QueryInfo struct {
+	Resolver Resolver
+	Index    int // run index of the sample
+}
+
+type queryInfoKey struct{}
+
+// QueryInfoFrom returns the sample that the query using ctx was sent for.
+// Transport taps use it to attribute messages to resolvers; it reports false
+// for queries outside a Runner's samples, such as DNS64 prefix detection.
+func QueryInfoFrom(ctx context.Context) (QueryInfo, bool) {
+	qi, ok := ctx.Value(queryInfoKey{}).(QueryInfo)
+	return qi, ok
+}
+
+// parseResponse returns the length of a response, whether it is padded
+// and its header, which is nil if the response does not decode.
+func parseResponse(wire []byte) (int, bool, *ResponseHeader) {
+	if len(wire) == 0 {
+		return 0, false, nil
+	}
+	m, err := dnsmsg.Unpack(wire)
+	if err != nil {
+		return len(wire), false, nil
+	}
+	_, padded := m.EDNSOption(dnsmsg.OptionPadding)
+	return len(wire), padded, newResponseHeader(m)
+}
+
+// pathContext returns ctx with the Path of the run, if any, fast open and
+// busy polling.
+func (r *Runner) pathContext(ctx context.Context) context.Context {
+	if r.FastOpen {
+		ctx = transport.WithFastOpen(ctx)
+	}
+	if r.BusyPoll {
+		ctx = transport.WithBusyPoll(ctx)
+	}
+	if r.Path == (transport.Path{}) {
+		return ctx
+	}
+	return transport.WithPath(ctx, r.Path)
+}
+
+func (r *Runner) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, r.Timeout)
+}
+
+// withTimeout is context.WithTimeout where a zero timeout means none.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,56 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// BrowserTypes are the queries a current browser sends at once for every
+// host name: the addresses of both families and the HTTPS record that may
+// advertise HTTP/3 or Encrypted Client Hello.
+var BrowserTypes = []dnsmsg.Type{dnsmsg.TypeA, dnsmsg.TypeAAAA, dnsmsg.TypeHTTPS}
+
+// LookupBrowser sends the BrowserTypes queries for name in parallel and
+// returns once all are answered, as a browser waits for the HTTPS record
+// before connecting. Empty answers are normal for AAAA and HTTPS, but at
+// least one address is needed. A failed query or a response code other
+// than NOERROR is an error.
+func LookupBrowser(ctx context.Context, tr transport.Transport, name string) error {
+	var wg sync.WaitGroup
+	resps := make([]*dnsmsg.Message, len(BrowserTypes))
+	errs := make([]error, len(BrowserTypes))
+	for i, qtype := range BrowserTypes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resps[i], errs[i] = tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+		}()
+	}
+	wg.Wait()
+
+	addrs := 0
+	for i, qtype := range BrowserTypes {
+		if errs[i] != nil {
+			return fmt.Errorf("lookup %s %s: %w", name, qtype, errs[i])
+		}
+		if resps[i].RCode != dnsmsg.RCodeSuccess {
+			return fmt.Errorf("lookup %s %s: %w", name, qtype, RCodeError(resps[i].RCode))
+		}
+		if qtype == dnsmsg.TypeHTTPS {
+			continue
+		}
+		for _, rr := range resps[i].Answers {
+			if rr.Type == qtype {
+				addrs++
+			}
+		}
+	}
+	if addrs == 0 {
+		return fmt.Errorf("lookup %s: no A or AAAA records in answer", name)
+	}
+	return nil
+}
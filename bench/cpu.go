@@ -0,0 +1,73 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// cpuWatchEvery is how often the CPU use of the host is sampled with
+// Runner.BusyCPU.
+const cpuWatchEvery = 250 * time.Millisecond
+
+// cpuWatch follows the share of the host's CPUs that other processes kept
+// busy over the last cpuWatchEvery.
+type cpuWatch struct {
+	use atomic.Uint64 // math.Float64bits of the share
+}
+
+// watchCPU samples the CPU use of the host until ctx is done, warning the
+// first time it rises above limit. It returns nil where the OS does not
+// tell the CPU use.
+func watchCPU(ctx context.Context, limit float64) *cpuWatch {
+	busy, total, err := cpuTimes()
+	if err != nil {
+		slog.WarnContext(ctx, "cannot watch the CPU use of the host", "err", err)
+		return nil
+	}
+	w := &cpuWatch{}
+	go func() {
+		t := time.NewTicker(cpuWatchEvery)
+		defer t.Stop()
+		warned := false
+		for {
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+			b, tot, err := cpuTimes()
+			if err != nil || tot <= total {
+				continue
+			}
+			use := float64(b-min(b, busy)) / float64(tot-total)
+			busy, total = b, tot
+			w.use.Store(math.Float64bits(use))
+			if use > limit && !warned {
+				slog.WarnContext(ctx, "the host's CPUs are busy, latencies may be inflated", "use", fmt.Sprintf("%.0f%%", 100*use))
+				warned = true
+			}
+		}
+	}()
+	return w
+}
+
+// busy reports whether the CPU use last sampled was above limit.
+func (w *cpuWatch) busy(limit float64) bool {
+	return math.Float64frombits(w.use.Load()) > limit
+}
+
+// waitIdle waits until the CPU use is down to limit or ctx is done, and
+// returns how long it waited.
+func (w *cpuWatch) waitIdle(ctx context.Context, limit float64) time.Duration {
+	if !w.busy(limit) {
+		return 0
+	}
+	start := time.Now()
+	for w.busy(limit) && sleepUntil(ctx, time.Now().Add(cpuWatchEvery)) {
+	}
+	return time.Since(start)
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package bench
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// cpuTimes returns the time all the CPUs of the host spent busy with
+// other processes than this one, and in total, in clock ticks since boot,
+// from /proc/stat and /proc/self/stat: the benchmark's own use, such as
+// Runner.BusyPoll, does not count as a busy host.
+func cpuTimes() (busy, total uint64, err error) {
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	line, _, _ := strings.Cut(string(b), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, errors.New("bench: unexpected /proc/stat")
+	}
+	// user nice system idle iowait irq softirq steal guest guest_nice; the
+	// guest times are part of user and nice already.
+	for i, f := range fields[1:min(len(fields), 9)] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += v
+		if i != 3 && i != 4 {
+			busy += v
+		}
+	}
+	if b, err = os.ReadFile("/proc/self/stat"); err != nil {
+		return 0, 0, err
+	}
+	// The fields after the command name in parentheses, from state on;
+	// utime and stime are the 14th and 15th of all.
+	_, rest, _ := strings.Cut(string(b), ") ")
+	fields = strings.Fields(rest)
+	if len(fields) < 13 {
+		return 0, 0, errors.New("bench: unexpected /proc/self/stat")
+	}
+	for _, f := range fields[11:13] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		busy -= min(v, busy)
+	}
+	return busy, total, nil
+}
+
+// maxCPUs is the number of CPUs the affinity masks below cover.
+const maxCPUs = 1024
+
+// pinThread binds the calling thread to the n-th, modulo their number, of
+// the CPUs the process may run on.
+func pinThread(n int) error {
+	var mask [maxCPUs / 64]uint64
+	if _, _, e := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask))); e != 0 {
+		return e
+	}
+	var cpus []int
+	for cpu := range maxCPUs {
+		if mask[cpu/64]&(1<<(cpu%64)) != 0 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	if len(cpus) == 0 {
+		return errors.New("bench: no CPU to pin to")
+	}
+	cpu := cpus[n%len(cpus)]
+	mask = [maxCPUs / 64]uint64{}
+	mask[cpu/64] = 1 << (cpu % 64)
+	if _, _, e := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask))); e != 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package bench
+
+import "errors"
+
+func cpuTimes() (busy, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+func pinThread(n int) error {
+	return errors.ErrUnsupported
+}
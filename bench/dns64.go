@@ -0,0 +1,101 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// IPv4OnlyName is the well-known name from RFC 7050 that only has A records
+// (192.0.0.170 and 192.0.0.171). Any AAAA answer for it is synthesized.
+const IPv4OnlyName = "ipv4only.arpa"
+
+var (
+	wellKnownV4 = []net.IP{
+		net.IPv4(192, 0, 0, 170).To4(),
+		net.IPv4(192, 0, 0, 171).To4(),
+	}
+	// nat64PrefixLens are the prefix lengths allowed by RFC 6052 section 2.2.
+	nat64PrefixLens = []int{96, 64, 56, 48, 40, 32}
+
+	errNoNAT64Prefix  = errors.New("no NAT64 prefix detected (resolver does not synthesize AAAA)")
+	errNotSynthesized = errors.New("AAAA answer not synthesized from NAT64 prefix")
+)
+
+// DetectNAT64Prefix queries ipv4only.arpa for AAAA and returns the NAT64
+// prefix the resolver embeds IPv4 addresses into.
+func DetectNAT64Prefix(ctx context.Context, tr transport.Transport) (*net.IPNet, error) {
+	ips, err := LookupIP(ctx, tr, IPv4OnlyName, dnsmsg.TypeAAAA)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		for _, l := range nat64PrefixLens {
+			v4 := extractIPv4(ip, l)
+			if v4 == nil {
+				continue
+			}
+			for _, wk := range wellKnownV4 {
+				if v4.Equal(wk) {
+					mask := net.CIDRMask(l, 128)
+					return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+				}
+			}
+		}
+	}
+	return nil, errNoNAT64Prefix
+}
+
+// extractIPv4 returns the IPv4 address embedded in ip for a NAT64 prefix of
+// length l, following the address format of RFC 6052 section 2.2. Bits 64-71
+// (the "u" octet) are skipped for prefixes shorter than /96.
+func extractIPv4(ip net.IP, l int) net.IP {
+	ip = ip.To16()
+	if ip == nil || ip.To4() != nil {
+		return nil
+	}
+	var idx []int
+	switch l {
+	case 32:
+		idx = []int{4, 5, 6, 7}
+	case 40:
+		idx = []int{5, 6, 7, 9}
+	case 48:
+		idx = []int{6, 7, 9, 10}
+	case 56:
+		idx = []int{7, 9, 10, 11}
+	case 64:
+		idx = []int{9, 10, 11, 12}
+	case 96:
+		idx = []int{12, 13, 14, 15}
+	default:
+		return nil
+	}
+	if l < 96 && ip[8] != 0 {
+		return nil
+	}
+	v4 := make(net.IP, 4)
+	for i, j := range idx {
+		v4[i] = ip[j]
+	}
+	return v4
+}
+
+// dns64Query performs a AAAA lookup and fails unless at least one address in
+// the answer was synthesized from prefix.
+func dns64Query(ctx context.Context, tr transport.Transport, name string, prefix *net.IPNet) error {
+	ips, err := LookupIP(ctx, tr, name, dnsmsg.TypeAAAA)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: got %s", errNotSynthesized, ips[0])
+}
@@ -0,0 +1,142 @@
+package bench
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// Names used by ProbeFeatures. dnssec-failed.org is deliberately signed
+// with a broken chain of trust, so validating resolvers answer SERVFAIL.
+const (
+	SignedName    = "isc.org"
+	BadSignedName = "dnssec-failed.org"
+	BlockTestName = "doubleclick.net"
+	AnyTestName   = "isc.org" // publishes many record types
+)
+
+// FeatureNames are the names ProbeFeatures queries.
+type FeatureNames struct {
+	Signed    string // in a signed zone, with an A record
+	BadSigned string // with an A record whose signature does not validate
+	Block     string // a name filtering resolvers block
+	Any       string // with records of many types
+}
+
+// DefaultFeatureNames are public names for ProbeFeatures. A test zone of
+// one's own can stand in for the signed ones.
+var DefaultFeatureNames = FeatureNames{Signed: SignedName, BadSigned: BadSignedName, Block: BlockTestName, Any: AnyTestName}
+
+// AnyBehavior classifies how a resolver answers an ANY query.
+type AnyBehavior string
+
+const (
+	AnyHINFO   AnyBehavior = "hinfo"    // a synthesized HINFO record, as RFC 8482 recommends
+	AnyFull    AnyBehavior = "full"     // records of several types
+	AnySubset  AnyBehavior = "subset"   // records of a single type
+	AnyEmpty   AnyBehavior = "empty"    // NOERROR without answers
+	AnyRefused AnyBehavior = "refused"  // REFUSED or NOTIMP
+	AnyError   AnyBehavior = "error"    // another response code
+	AnyDropped AnyBehavior = "no reply" // timeout or transport error
+)
+
+// Features are resolver capabilities that affect its suitability beyond
+// latency.
+type Features struct {
+	DNSSEC    bool // validates DNSSEC: sets AD on signed answers, rejects bogus ones
+	Filtering bool // blocks a well-known advertising domain
+	ANY       AnyBehavior
+	// Refresh is set by ProbeCacheRefresh, which needs a zone of test
+	// records and takes as long as their TTL; nil without it.
+	Refresh *CacheRefresh
+}
+
+// ProbeFeatures checks whether the resolver behind tr validates DNSSEC,
+// filters an advertising domain, and how it answers ANY queries, with
+// DefaultFeatureNames. Each of its four queries gets its own timeout; zero
+// means none. Resolvers that ignore ANY queries are common, so an ANY
+// query without reply is a result rather than an error.
+func ProbeFeatures(ctx context.Context, tr transport.Transport, timeout time.Duration) (Features, error) {
+	return ProbeFeatureNames(ctx, tr, DefaultFeatureNames, timeout)
+}
+
+// ProbeFeatureNames is ProbeFeatures with other names.
+func ProbeFeatureNames(ctx context.Context, tr transport.Transport, names FeatureNames, timeout time.Duration) (Features, error) {
+	var f Features
+	exchange := func(name string, qtype dnsmsg.Type) (*dnsmsg.Message, error) {
+		ctx, cancel := withTimeout(ctx, timeout)
+		defer cancel()
+		q := dnsmsg.NewQuery(name, qtype)
+		q.SetEDNS0(1232, true)
+		return tr.SendQuery(ctx, q)
+	}
+
+	signed, err := exchange(names.Signed, dnsmsg.TypeA)
+	if err != nil {
+		return f, err
+	}
+	bogus, err := exchange(names.BadSigned, dnsmsg.TypeA)
+	if err != nil {
+		return f, err
+	}
+	f.DNSSEC = signed.AuthenticData && bogus.RCode == dnsmsg.RCodeServerFailure
+
+	blocked, err := exchange(names.Block, dnsmsg.TypeA)
+	if err != nil {
+		return f, err
+	}
+	f.Filtering = isBlockedAnswer(blocked)
+
+	f.ANY = AnyDropped
+	if resp, err := exchange(names.Any, dnsmsg.TypeANY); err == nil {
+		f.ANY = classifyANY(resp)
+	}
+	return f, nil
+}
+
+// classifyANY sorts an ANY response into one of the AnyBehavior classes.
+func classifyANY(resp *dnsmsg.Message) AnyBehavior {
+	switch resp.RCode {
+	case dnsmsg.RCodeSuccess:
+	case dnsmsg.RCodeRefused, dnsmsg.RCodeNotImplemented:
+		return AnyRefused
+	default:
+		return AnyError
+	}
+	types := make(map[dnsmsg.Type]bool)
+	for _, rr := range resp.Answers {
+		if rr.Type != dnsmsg.TypeRRSIG {
+			types[rr.Type] = true
+		}
+	}
+	switch {
+	case len(types) == 0:
+		return AnyEmpty
+	case len(types) == 1 && types[dnsmsg.TypeHINFO]:
+		return AnyHINFO
+	case len(types) == 1:
+		return AnySubset
+	}
+	return AnyFull
+}
+
+// isBlockedAnswer recognizes the usual ways filtering resolvers refuse a
+// name: NXDOMAIN, REFUSED, or an unspecified or loopback address.
+func isBlockedAnswer(resp *dnsmsg.Message) bool {
+	switch resp.RCode {
+	case dnsmsg.RCodeNameError, dnsmsg.RCodeRefused:
+		return true
+	case dnsmsg.RCodeSuccess:
+	default:
+		return false
+	}
+	for _, rr := range resp.Answers {
+		if ip, err := rr.IP(); err == nil {
+			return ip.IsUnspecified() || ip.IsLoopback() || ip.Equal(net.IPv4bcast)
+		}
+	}
+	return false
+}
@@ -0,0 +1,385 @@
+package bench
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter selects the samples of a run that count toward its results with
+// an expression over their fields, such as
+//
+//	duration_ms < 500 && rcode == "NOERROR"
+//
+// It compares numbers, quoted strings and the booleans true and false with
+// ==, !=, <, <=, > and >=, and combines the comparisons and boolean fields
+// with &&, || and ! and parentheses. Strings compare byte by byte.
+type Filter struct {
+	src  string
+	eval func(*Event) bool
+}
+
+// filterKind is the type of a filter expression.
+type filterKind int
+
+const (
+	filterNum filterKind = iota
+	filterStr
+	filterBool
+)
+
+func (k filterKind) String() string {
+	return [...]string{"number", "string", "boolean"}[k]
+}
+
+// filterExpr is a compiled expression; the function of its kind is set.
+type filterExpr struct {
+	kind filterKind
+	num  func(*Event) float64
+	str  func(*Event) string
+	bool func(*Event) bool
+}
+
+func numField(f func(*Event) float64) filterExpr { return filterExpr{kind: filterNum, num: f} }
+
+func strField(f func(*Event) string) filterExpr { return filterExpr{kind: filterStr, str: f} }
+
+func boolField(f func(*Event) bool) filterExpr { return filterExpr{kind: filterBool, bool: f} }
+
+// filterFields are the fields of an EventSample a Filter can test.
+var filterFields = func() map[string]filterExpr {
+	fields := map[string]filterExpr{
+		"resolver":    strField(func(e *Event) string { return e.Resolver.Name }),
+		"qname":       strField(func(e *Event) string { return e.QName }),
+		"qtype":       strField(func(e *Event) string { return e.QType.String() }),
+		"index":       numField(func(e *Event) float64 { return float64(e.Index) }),
+		"elapsed_s":   numField(func(e *Event) float64 { return e.Elapsed.Seconds() }),
+		"duration_ms": numField(func(e *Event) float64 { return durationMs(e.Sample.Duration) }),
+		"ttfb_ms":     numField(func(e *Event) float64 { return durationMs(e.Sample.FirstByte) }),
+		"rtt_ms":      numField(func(e *Event) float64 { return durationMs(e.Sample.RTT) }),
+		"ok":          boolField(func(e *Event) bool { return e.Sample.Err == nil }),
+		"error":       strField(func(e *Event) string { return errText(e.Sample.Err) }),
+		"queries":     numField(func(e *Event) float64 { return float64(e.Sample.Queries) }),
+		"size":        numField(func(e *Event) float64 { return float64(e.Sample.Size) }),
+		"rcode": strField(func(e *Event) string {
+			if h := e.Sample.Response; h != nil {
+				return h.RCode.String()
+			}
+			return ""
+		}),
+		"answers":     numField(func(e *Event) float64 { return float64(responseOf(e).Answers) }),
+		"authorities": numField(func(e *Event) float64 { return float64(responseOf(e).Authorities) }),
+		"additionals": numField(func(e *Event) float64 { return float64(responseOf(e).Additionals) }),
+		"min_ttl":     numField(func(e *Event) float64 { return float64(responseOf(e).MinTTL) }),
+	}
+	for _, f := range headerFlags {
+		fields[f.name] = boolField(func(e *Event) bool { return *f.flag(responseOf(e)) })
+	}
+	return fields
+}()
+
+// responseOf returns the response header of the sample of e, or an empty
+// one without a response.
+func responseOf(e *Event) *ResponseHeader {
+	if e.Sample.Response != nil {
+		return e.Sample.Response
+	}
+	return &ResponseHeader{}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000.0
+}
+
+func errText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// ParseFilter compiles a filter expression.
+func ParseFilter(src string) (*Filter, error) {
+	p := &filterParser{src: src}
+	p.next()
+	e, err := p.parseOr()
+	if err == nil && p.err != nil {
+		err = p.err
+	}
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err == nil && e.kind != filterBool {
+		err = fmt.Errorf("the expression is a %s, not a condition", e.kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", src, err)
+	}
+	return &Filter{src: src, eval: e.bool}, nil
+}
+
+// Match reports whether the sample of the EventSample e passes the filter.
+func (f *Filter) Match(e Event) bool {
+	return f.eval(&e)
+}
+
+// String returns the expression of f.
+func (f *Filter) String() string {
+	return f.src
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNum
+	tokStr
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string // the identifier, operator, number or unquoted string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokStr:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type filterParser struct {
+	src string
+	off int
+	tok token
+	err error // a malformed token
+}
+
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+// next scans the next token into p.tok.
+func (p *filterParser) next() {
+	for p.off < len(p.src) && unicode.IsSpace(rune(p.src[p.off])) {
+		p.off++
+	}
+	start := p.off
+	if p.off == len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	c := p.src[p.off]
+	switch {
+	case c == '"':
+		end := p.off + 1
+		for end < len(p.src) && p.src[end] != '"' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		s, err := strconv.Unquote(p.src[p.off:min(end+1, len(p.src))])
+		if err != nil && p.err == nil {
+			p.err = fmt.Errorf("at offset %d: malformed string", start)
+		}
+		p.off = min(end+1, len(p.src))
+		p.tok = token{kind: tokStr, text: s, pos: start}
+		return
+	case c == '.' || c >= '0' && c <= '9':
+		for p.off < len(p.src) && (p.src[p.off] == '.' || p.src[p.off] >= '0' && p.src[p.off] <= '9') {
+			p.off++
+		}
+		p.tok = token{kind: tokNum, text: p.src[start:p.off], pos: start}
+		return
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.off < len(p.src) && (p.src[p.off] == '_' || unicode.IsLetter(rune(p.src[p.off])) || unicode.IsDigit(rune(p.src[p.off]))) {
+			p.off++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.off], pos: start}
+		return
+	}
+	for _, op := range filterOps {
+		if strings.HasPrefix(p.src[p.off:], op) {
+			p.off += len(op)
+			p.tok = token{kind: tokOp, text: op, pos: start}
+			return
+		}
+	}
+	if p.err == nil {
+		p.err = fmt.Errorf("at offset %d: unexpected %q", start, c)
+	}
+	p.off = len(p.src)
+	p.tok = token{kind: tokEOF, pos: start}
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("at offset %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	return p.parseLogical("||", p.parseAnd, func(a, b func(*Event) bool) func(*Event) bool {
+		return func(e *Event) bool { return a(e) || b(e) }
+	})
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	return p.parseLogical("&&", p.parseUnary, func(a, b func(*Event) bool) func(*Event) bool {
+		return func(e *Event) bool { return a(e) && b(e) }
+	})
+}
+
+// parseLogical parses operands joined by op.
+func (p *filterParser) parseLogical(op string, operand func() (filterExpr, error), join func(a, b func(*Event) bool) func(*Event) bool) (filterExpr, error) {
+	x, err := operand()
+	if err != nil || !p.isOp(op) {
+		return x, err
+	}
+	for p.isOp(op) {
+		pos := p.tok.pos
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return x, err
+		}
+		if x.kind != filterBool || y.kind != filterBool {
+			return x, fmt.Errorf("at offset %d: %s needs conditions, not a %s and a %s", pos, op, x.kind, y.kind)
+		}
+		x.bool = join(x.bool, y.bool)
+	}
+	return x, nil
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	if !p.isOp("!") {
+		return p.parseComparison()
+	}
+	pos := p.tok.pos
+	p.next()
+	x, err := p.parseUnary()
+	if err != nil {
+		return x, err
+	}
+	if x.kind != filterBool {
+		return x, fmt.Errorf("at offset %d: ! needs a condition, not a %s", pos, x.kind)
+	}
+	f := x.bool
+	x.bool = func(e *Event) bool { return !f(e) }
+	return x, nil
+}
+
+func (p *filterParser) parseComparison() (filterExpr, error) {
+	x, err := p.parsePrimary()
+	if err != nil || p.tok.kind != tokOp {
+		return x, err
+	}
+	op, pos := p.tok.text, p.tok.pos
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return x, nil
+	}
+	p.next()
+	y, err := p.parsePrimary()
+	if err != nil {
+		return x, err
+	}
+	if x.kind != y.kind {
+		return x, fmt.Errorf("at offset %d: cannot compare a %s with a %s", pos, x.kind, y.kind)
+	}
+	var cmp func(e *Event) int
+	switch x.kind {
+	case filterNum:
+		a, b := x.num, y.num
+		cmp = func(e *Event) int {
+			av, bv := a(e), b(e)
+			return ternaryInt(av < bv, -1, ternaryInt(av > bv, 1, 0))
+		}
+	case filterStr:
+		a, b := x.str, y.str
+		cmp = func(e *Event) int { return strings.Compare(a(e), b(e)) }
+	case filterBool:
+		if op != "==" && op != "!=" {
+			return x, fmt.Errorf("at offset %d: booleans compare with == and != only", pos)
+		}
+		a, b := x.bool, y.bool
+		cmp = func(e *Event) int { return ternaryInt(a(e) == b(e), 0, 1) }
+	}
+	test := map[string]func(int) bool{
+		"==": func(c int) bool { return c == 0 },
+		"!=": func(c int) bool { return c != 0 },
+		"<":  func(c int) bool { return c < 0 },
+		"<=": func(c int) bool { return c <= 0 },
+		">":  func(c int) bool { return c > 0 },
+		">=": func(c int) bool { return c >= 0 },
+	}[op]
+	return filterExpr{kind: filterBool, bool: func(e *Event) bool { return test(cmp(e)) }}, nil
+}
+
+func (p *filterParser) parsePrimary() (filterExpr, error) {
+	t := p.tok
+	if p.err != nil {
+		return filterExpr{}, p.err
+	}
+	switch t.kind {
+	case tokNum:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return filterExpr{}, p.errorf("malformed number %q", t.text)
+		}
+		p.next()
+		return filterExpr{kind: filterNum, num: func(*Event) float64 { return v }}, nil
+	case tokStr:
+		p.next()
+		return filterExpr{kind: filterStr, str: func(*Event) string { return t.text }}, nil
+	case tokIdent:
+		p.next()
+		switch t.text {
+		case "true", "false":
+			v := t.text == "true"
+			return filterExpr{kind: filterBool, bool: func(*Event) bool { return v }}, nil
+		}
+		f, ok := filterFields[t.text]
+		if !ok {
+			names := slices.Sorted(maps.Keys(filterFields))
+			return filterExpr{}, fmt.Errorf("at offset %d: unknown field %q (want one of %s)", t.pos, t.text, strings.Join(names, ", "))
+		}
+		return f, nil
+	case tokOp:
+		if t.text == "(" {
+			p.next()
+			x, err := p.parseOr()
+			if err != nil {
+				return x, err
+			}
+			if !p.isOp(")") {
+				return x, p.errorf("expected ) instead of %s", p.tok)
+			}
+			p.next()
+			return x, nil
+		}
+	}
+	return filterExpr{}, p.errorf("unexpected %s", t)
+}
+
+func ternaryInt(cond bool, a, b int) int {
+	if cond {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+package bench
+
+// CombineGroups merges the results of resolvers in the same Group into one
+// Result per group, named after it, with the samples of all its addresses
+// and statistics over them. Groups appear in the order of their first
+// address; results without a group are not included.
+func CombineGroups(results []Result) []Result {
+	var out []Result
+	index := make(map[string]int)
+	for _, r := range results {
+		if r.Group == "" {
+			continue
+		}
+		i, ok := index[r.Group]
+		if !ok {
+			i = len(out)
+			index[r.Group] = i
+			out = append(out, Result{Name: r.Group})
+		}
+		out[i].Samples = append(out[i].Samples, r.Samples...)
+		out[i].Pairs = append(out[i].Pairs, r.Pairs...)
+	}
+	for i := range out {
+		out[i].Stats = Summarize(out[i].Samples)
+	}
+	return out
+}
+
+// CombineTags merges the results of resolvers by their Tags into one Result
+// per tag, named after it, like CombineGroups. A resolver with several tags
+// counts toward each. Tags appear in the order of their first resolver.
+func CombineTags(results []Result) []Result {
+	var out []Result
+	index := make(map[string]int)
+	for _, r := range results {
+		for _, tag := range r.Tags {
+			i, ok := index[tag]
+			if !ok {
+				i = len(out)
+				index[tag] = i
+				out = append(out, Result{Name: tag})
+			}
+			out[i].Samples = append(out[i].Samples, r.Samples...)
+			out[i].Pairs = append(out[i].Pairs, r.Pairs...)
+		}
+	}
+	for i := range out {
+		out[i].Stats = Summarize(out[i].Samples)
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package bench
+
+import (
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// ResponseHeader holds the attributes of a response that analyses beyond
+// latency and errors group samples by: its response code, flags and
+// section counts.
+type ResponseHeader struct {
+	RCode              dnsmsg.RCode
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticData      bool
+	CheckingDisabled   bool
+	Answers            int
+	Authorities        int
+	Additionals        int // with the OPT record of EDNS(0)
+	// MinTTL is the lowest TTL of the answer and authority records, the
+	// time until a cache drops part of the answer; zero without records.
+	MinTTL uint32
+}
+
+func newResponseHeader(m *dnsmsg.Message) *ResponseHeader {
+	h := &ResponseHeader{
+		RCode:              m.RCode,
+		Authoritative:      m.Authoritative,
+		Truncated:          m.Truncated,
+		RecursionDesired:   m.RecursionDesired,
+		RecursionAvailable: m.RecursionAvailable,
+		AuthenticData:      m.AuthenticData,
+		CheckingDisabled:   m.CheckingDisabled,
+		Answers:            len(m.Answers),
+		Authorities:        len(m.Authorities),
+		Additionals:        len(m.Additionals),
+	}
+	first := true
+	for _, section := range [][]dnsmsg.Resource{m.Answers, m.Authorities} {
+		for _, rr := range section {
+			if first || rr.TTL < h.MinTTL {
+				h.MinTTL, first = rr.TTL, false
+			}
+		}
+	}
+	return h
+}
+
+// headerFlags are the flags of a ResponseHeader by their names in dig
+// output, in dig's order.
+var headerFlags = []struct {
+	name string
+	flag func(h *ResponseHeader) *bool
+}{
+	{"aa", func(h *ResponseHeader) *bool { return &h.Authoritative }},
+	{"tc", func(h *ResponseHeader) *bool { return &h.Truncated }},
+	{"rd", func(h *ResponseHeader) *bool { return &h.RecursionDesired }},
+	{"ra", func(h *ResponseHeader) *bool { return &h.RecursionAvailable }},
+	{"ad", func(h *ResponseHeader) *bool { return &h.AuthenticData }},
+	{"cd", func(h *ResponseHeader) *bool { return &h.CheckingDisabled }},
+}
+
+// Flags returns the flags that are set as dig shows them, such as
+// "rd ra ad".
+func (h ResponseHeader) Flags() string {
+	var set []string
+	for _, f := range headerFlags {
+		if *f.flag(&h) {
+			set = append(set, f.name)
+		}
+	}
+	return strings.Join(set, " ")
+}
+
+// setFlags sets the flags named in s, as Flags returns them.
+func (h *ResponseHeader) setFlags(s string) {
+	for _, name := range strings.Fields(s) {
+		for _, f := range headerFlags {
+			if f.name == name {
+				*f.flag(h) = true
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package bench
+
+import (
+	"math/bits"
+	"time"
+)
+
+// histSubBits sets the precision of a Histogram: durations up to
+// 2^(histSubBits+1) µs (about 2ms) are counted exactly, longer ones in
+// buckets of 2^histSubBits per power of two, within 0.1% of their value.
+const histSubBits = 10
+
+const histSub = 1 << histSubBits
+
+// Histogram counts durations with microsecond resolution in log-linear
+// buckets, as HDR histograms do: its percentiles are within 0.1% of the
+// exact values, however many durations it counts, in memory that grows
+// with the logarithm of the longest one only.
+type Histogram struct {
+	counts []int64
+	total  int64
+}
+
+// bucket returns the index of the bucket counting v microseconds.
+func histBucket(v int64) int {
+	if v < 2*histSub {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBits - 1
+	return 2*histSub + (shift-1)*histSub + int(v>>shift) - histSub
+}
+
+// histValue returns the midpoint of bucket i, in microseconds.
+func histValue(i int) float64 {
+	if i < 2*histSub {
+		return float64(i)
+	}
+	shift := (i-2*histSub)/histSub + 1
+	low := int64((i-2*histSub)%histSub+histSub) << shift
+	return float64(low) + float64(int64(1)<<shift-1)/2
+}
+
+// Record counts one duration.
+func (h *Histogram) Record(d time.Duration) {
+	i := histBucket(max(d.Microseconds(), 0))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.total++
+}
+
+// Merge adds the durations counted by o, which may be nil.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]int64, len(o.counts)-len(h.counts))...)
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+}
+
+// Count returns the number of durations counted.
+func (h *Histogram) Count() int64 {
+	if h == nil {
+		return 0
+	}
+	return h.total
+}
+
+// Percentile returns the p-th percentile of the counted durations, with
+// linear interpolation between the closest ranks like the package-level
+// Percentile, or zero for an empty histogram.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.Count() == 0 {
+		return 0
+	}
+	pos := max(0, min(p, 100)) / 100 * float64(h.total-1)
+	lo := h.valueAt(int64(pos))
+	hi := lo
+	if frac := pos - float64(int64(pos)); frac > 0 {
+		hi = h.valueAt(int64(pos) + 1)
+		lo += (hi - lo) * frac
+	}
+	return time.Duration(lo * float64(time.Microsecond))
+}
+
+// valueAt returns the value of the zero-based rank r.
+func (h *Histogram) valueAt(r int64) float64 {
+	var seen int64
+	for i, c := range h.counts {
+		if seen += c; seen > r {
+			return histValue(i)
+		}
+	}
+	return histValue(len(h.counts) - 1)
+}
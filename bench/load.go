@@ -0,0 +1,128 @@
+package bench
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A LoadStep is one level of a load sweep against a single resolver.
+type LoadStep struct {
+	Concurrency int     // queries in flight, for RunConcurrent
+	Rate        float64 // queries sent per second, for RunRate
+	Samples     []Sample
+	Elapsed     time.Duration
+}
+
+// QPS returns the answered queries per second.
+func (s LoadStep) QPS() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	ok := 0
+	for _, smp := range s.Samples {
+		if smp.Err == nil {
+			ok++
+		}
+	}
+	return float64(ok) / s.Elapsed.Seconds()
+}
+
+// RunConcurrent sends r.Count queries to res with concurrency of them in
+// flight at all times: each of concurrency workers sends its next query as
+// soon as the previous one is answered, as a pool of stub resolvers does.
+// Names and record types are those a Run would send, in the order the
+// queries start.
+func (r *Runner) RunConcurrent(ctx context.Context, res Resolver, concurrency int) LoadStep {
+	ctx = r.pathContext(ctx)
+	tr, query, _ := r.newQuery(ctx, res)
+	defer closeIdle(tr)
+	qnames, qtypes, busted := r.queryNames(res, r.workloadOrder())
+	samples := make([]Sample, r.Count)
+	sent := make([]bool, r.Count)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				qctx, cancel := r.queryContext(ctx)
+				qctx = context.WithValue(qctx, queryInfoKey{}, QueryInfo{Resolver: res, Index: i})
+				t := time.Now()
+				queries, err := query(qctx, qnames[i], qtypes[i])
+				samples[i] = Sample{Duration: time.Since(t), Err: bustedResult(err, busted[i]), Queries: queries}
+				cancel()
+			}
+		}()
+	}
+	for i := 0; i < r.Count && ctx.Err() == nil; i++ {
+		select {
+		case next <- i:
+			sent[i] = true
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+	step := LoadStep{Concurrency: concurrency, Elapsed: time.Since(start)}
+	for i, s := range samples {
+		// Queries cut short by the caller are not resolver failures.
+		if sent[i] && (ctx.Err() == nil || s.Err == nil) {
+			step.Samples = append(step.Samples, s)
+		}
+	}
+	return step
+}
+
+// rateTick is how often RunRate sends the queries that have come due.
+const rateTick = time.Millisecond
+
+// RunRate sends queries to res at qps queries per second for d, whether or
+// not earlier ones have been answered, as independent clients do, and waits
+// for the last answers. Elapsed covers the sending, so QPS compares with
+// qps.
+func (r *Runner) RunRate(ctx context.Context, res Resolver, qps float64, d time.Duration) LoadStep {
+	ctx = r.pathContext(ctx)
+	n := max(int(qps*d.Seconds()), 1)
+	rr := *r
+	rr.Count = n
+	tr, query, _ := rr.newQuery(ctx, res)
+	defer closeIdle(tr)
+	qnames, qtypes, busted := rr.queryNames(res, rr.workloadOrder())
+	samples := make([]Sample, n)
+	sent := 0
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(rateTick)
+	defer ticker.Stop()
+	start := time.Now()
+	for sent < n && ctx.Err() == nil {
+		due := min(int(time.Since(start).Seconds()*qps)+1, n)
+		for ; sent < due; sent++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				qctx, cancel := rr.queryContext(ctx)
+				defer cancel()
+				qctx = context.WithValue(qctx, queryInfoKey{}, QueryInfo{Resolver: res, Index: i})
+				t := time.Now()
+				queries, err := query(qctx, qnames[i], qtypes[i])
+				samples[i] = Sample{Duration: time.Since(t), Err: bustedResult(err, busted[i]), Queries: queries}
+			}(sent)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+	}
+	elapsed := max(time.Since(start), d)
+	wg.Wait()
+	step := LoadStep{Rate: qps, Elapsed: elapsed}
+	for _, s := range samples[:sent] {
+		if ctx.Err() == nil || s.Err == nil {
+			step.Samples = append(step.Samples, s)
+		}
+	}
+	return step
+}
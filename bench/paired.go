@@ -0,0 +1,67 @@
+package bench
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Pair is a cold query with Runner.ColdWarm and the warm query for the same
+// name right after it, both answered.
+type Pair struct {
+	Cold, Warm time.Duration
+}
+
+// PairStats summarizes the paired differences of cold minus warm latency:
+// how much sooner a resolver answers from its cache than by asking the
+// authoritative servers. Pairing the queries cancels out drifts in the
+// network and the load of the resolver that comparing a cold run with a
+// warm run would mix into the difference.
+type PairStats struct {
+	Pairs      int
+	Cold, Warm time.Duration // medians
+	Median     time.Duration // of the differences
+	Mean       time.Duration
+	CI95       time.Duration // half-width of the 95% confidence interval of Mean
+	WarmFaster int           // pairs whose warm query was answered sooner
+}
+
+// SummarizePairs computes PairStats over pairs.
+func SummarizePairs(pairs []Pair) PairStats {
+	st := PairStats{Pairs: len(pairs)}
+	if len(pairs) == 0 {
+		return st
+	}
+	cold := make([]float64, len(pairs))
+	warm := make([]float64, len(pairs))
+	diff := make([]float64, len(pairs))
+	var sum float64
+	for i, p := range pairs {
+		cold[i] = float64(p.Cold) / float64(time.Millisecond)
+		warm[i] = float64(p.Warm) / float64(time.Millisecond)
+		diff[i] = cold[i] - warm[i]
+		sum += diff[i]
+		if p.Warm < p.Cold {
+			st.WarmFaster++
+		}
+	}
+	mean := sum / float64(len(diff))
+	if len(diff) > 1 {
+		var ss float64
+		for _, d := range diff {
+			ss += (d - mean) * (d - mean)
+		}
+		sd := math.Sqrt(ss / float64(len(diff)-1))
+		st.CI95 = msDuration(1.96 * sd / math.Sqrt(float64(len(diff))))
+	}
+	sort.Float64s(cold)
+	sort.Float64s(warm)
+	sort.Float64s(diff)
+	st.Cold, st.Warm = msDuration(Percentile(cold, 50)), msDuration(Percentile(warm, 50))
+	st.Median, st.Mean = msDuration(Percentile(diff, 50)), msDuration(mean)
+	return st
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
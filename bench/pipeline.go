@@ -0,0 +1,364 @@
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// DefaultBuffer is the number of events a run queues for its consumer when
+// Runner.Buffer is zero.
+const DefaultBuffer = 64
+
+// A run is a pipeline of goroutines connected by bounded channels. For
+// every resolver, Concurrency of them at a time, a producer picks the name
+// and type of each query and paces them to Rate; a worker takes them one by
+// one, sends them with their Retries and summarizes the samples; and both
+// stop at Count queries, after Duration, after AbortAfterErrors or when the
+// context is cancelled. The workers' events go to a single collector, the
+// consumer of Stream or the onProgress callback of Run, which does not have
+// to be safe for concurrent use. A slow consumer holds up the workers once
+// Buffer events are queued, but not the timing of their queries.
+
+// job is a query the producer of a resolver hands to its worker.
+type job struct {
+	index  int
+	qname  string
+	qtype  dnsmsg.Type
+	busted bool // got a cache-busting label because of ColdShare or ColdWarm
+}
+
+// Run benchmarks each resolver in turn, or Concurrency of them at a time,
+// and returns the results in the order of Resolvers. onProgress, if
+// non-nil, is called for every event, from the goroutine calling Run. If
+// ctx is cancelled Run stops issuing queries and returns the results
+// collected so far (the interrupted resolvers included) together with
+// ctx.Err().
+func (r *Runner) Run(ctx context.Context, onProgress func(Event)) ([]Result, error) {
+	events := make(chan Event, r.buffer())
+	var results []Result
+	go func() {
+		defer close(events)
+		results = r.pipeline(ctx, events)
+	}()
+	for e := range events {
+		if onProgress != nil {
+			onProgress(e)
+		}
+	}
+	return results, ctx.Err()
+}
+
+// Stream starts the benchmark of Run and returns its events, for callers
+// that collect them in a select loop or pass them on to other goroutines.
+// The results come with the EventResolverDone of each resolver. The
+// channel is closed when the run is over; the caller must receive until
+// then, or cancel ctx and drain it.
+func (r *Runner) Stream(ctx context.Context) <-chan Event {
+	events := make(chan Event, r.buffer())
+	go func() {
+		defer close(events)
+		r.pipeline(ctx, events)
+	}()
+	return events
+}
+
+func (r *Runner) buffer() int {
+	if r.Buffer > 0 {
+		return r.Buffer
+	}
+	return DefaultBuffer
+}
+
+// pipeline benchmarks the resolvers, Concurrency of them at a time, sends
+// their events to events and returns the results of those it started.
+func (r *Runner) pipeline(ctx context.Context, events chan<- Event) []Result {
+	ctx = r.pathContext(ctx)
+	order := r.workloadOrder()
+	var cpu *cpuWatch
+	if r.BusyCPU > 0 {
+		cpu = watchCPU(ctx, r.BusyCPU)
+	}
+	results := make([]Result, len(r.Resolvers))
+	started := make([]bool, len(r.Resolvers))
+	sem := make(chan struct{}, max(r.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, res := range r.Resolvers {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		started[i] = true
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if r.PinCPU {
+				// Never unlocked: the thread, bound to its CPU, ends with
+				// the goroutine.
+				runtime.LockOSThread()
+				if err := pinThread(i); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+					slog.WarnContext(ctx, "cannot pin to a CPU", "resolver", res.Name, "err", err)
+				}
+			}
+			events <- Event{Kind: EventResolverStart, Resolver: res}
+			results[i] = r.runResolver(ctx, res, order, cpu, events)
+			events <- Event{Kind: EventResolverDone, Resolver: res, Result: &results[i]}
+		}()
+	}
+	wg.Wait()
+	out := results[:0]
+	for i := range results {
+		if started[i] {
+			out = append(out, results[i])
+		}
+	}
+	return out
+}
+
+// produce sends the queries to res to jobs until Count of them are taken,
+// Duration has passed or ctx is cancelled, and closes jobs. order, if
+// non-nil, draws the index into Domains of each query.
+func (r *Runner) produce(ctx context.Context, res Resolver, order *zipfOrder, jobs chan<- job) {
+	defer close(jobs)
+	if r.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Duration)
+		defer cancel()
+	}
+	names := r.nameSource(res, order)
+	var last time.Time
+	for i := 0; r.Duration > 0 || i < r.Count; i++ {
+		if r.Rate > 0 && i > 0 && !sleepUntil(ctx, last.Add(time.Duration(float64(time.Second)/r.Rate))) {
+			return
+		}
+		qname, qtype, busted := names.next()
+		select {
+		case jobs <- job{index: i, qname: qname, qtype: qtype, busted: busted}:
+			last = time.Now()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sleepUntil waits until t and reports whether ctx was still live then.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// runResolver benchmarks one resolver: it sends the queries of its
+// producer and sends an EventSample for each to events. cpu, if non-nil,
+// watches the host's CPUs for BusyCPU.
+func (r *Runner) runResolver(ctx context.Context, res Resolver, order *zipfOrder, cpu *cpuWatch, events chan<- Event) Result {
+	result := Result{Name: res.Name, Group: res.Group, Tags: res.Tags, Operator: res.Operator}
+	failures := 0
+	tr, query, nat64 := r.newQuery(ctx, res)
+	defer closeIdle(tr)
+	result.NAT64Prefix = nat64
+
+	var samples []Sample
+	var acc *Accumulator
+	if r.MaxSamples > 0 {
+		acc = NewAccumulator(r.MaxSamples, r.rng("reservoir/"+res.Name))
+	} else {
+		samples = make([]Sample, 0, r.Count)
+	}
+	pctx, stop := context.WithCancel(ctx)
+	defer stop()
+	jobs := make(chan job)
+	go r.produce(pctx, res, order, jobs)
+	began := time.Now()
+	var cold *Sample // the answered cold query of the pair in progress
+	pairs := 0       // completed, of which MaxSamples keeps a reservoir
+	var pairRNG *rand.Rand
+	if r.MaxSamples > 0 {
+		pairRNG = r.rng("pairs/" + res.Name)
+	}
+	for j := range jobs {
+		i := j.index
+		if r.SiteCheckEvery > 0 && i%r.SiteCheckEvery == 0 && tr != nil {
+			id, err := ServerIdentity(ctx, tr, r.Timeout)
+			result.Sites = append(result.Sites, SiteObservation{Index: i, At: time.Now(), ID: id, Err: err})
+		}
+		var rtt time.Duration
+		if r.RTT != nil {
+			rctx, cancel := r.queryContext(ctx)
+			var err error
+			if rtt, err = r.RTT(rctx, res); err != nil {
+				slog.DebugContext(ctx, "RTT probe failed", "resolver", res.Name, "err", err)
+			}
+			cancel()
+		}
+		if cpu != nil {
+			if r.PauseWhenBusy {
+				result.Paused += cpu.waitIdle(ctx, r.BusyCPU)
+			} else if cpu.busy(r.BusyCPU) {
+				result.Busy++
+			}
+		}
+		elapsed := time.Since(began)
+		var s Sample
+		for attempt := 0; attempt <= r.Retries; attempt++ {
+			a := r.send(ctx, res, query, j, attempt)
+			if ctx.Err() != nil {
+				break
+			}
+			if a.FirstByte > 0 {
+				a.FirstByte += s.Duration
+			}
+			a.Duration += s.Duration
+			a.Overhead += s.Overhead
+			a.Build += s.Build
+			a.Parse += s.Parse
+			a.Queries += s.Queries
+			if attempt > 0 {
+				a.SrcPort, a.ID, a.QuerySize = s.SrcPort, s.ID, s.QuerySize
+			}
+			if s = a; !retryable(a.Err) {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			// Interrupted by the caller, not a resolver failure.
+			break
+		}
+		s.RTT = rtt
+		if r.ColdWarm {
+			switch {
+			case j.busted && s.Err == nil:
+				cold = &s
+			case !j.busted && s.Err == nil && cold != nil:
+				p := Pair{Cold: cold.Duration, Warm: s.Duration}
+				pairs++
+				switch {
+				case pairRNG == nil || len(result.Pairs) < r.MaxSamples:
+					result.Pairs = append(result.Pairs, p)
+				default:
+					if k := pairRNG.IntN(pairs); k < r.MaxSamples {
+						result.Pairs[k] = p
+					}
+				}
+				fallthrough
+			default:
+				cold = nil
+			}
+		}
+		e := Event{Kind: EventSample, Resolver: res, Index: i, QName: j.qname, QType: j.qtype, Elapsed: elapsed, Sample: s}
+		switch {
+		case r.Filter != nil && !r.Filter.Match(e):
+			result.Filtered++
+		case acc != nil:
+			acc.Add(s)
+		default:
+			samples = append(samples, s)
+		}
+		events <- e
+		if s.Err == nil {
+			failures = 0
+		} else if failures++; r.AbortAfterErrors > 0 && failures >= r.AbortAfterErrors {
+			slog.InfoContext(ctx, "aborting resolver after consecutive failures", "resolver", res.Name, "failures", failures)
+			result.Aborted = true
+			break
+		}
+	}
+	result.Elapsed = time.Since(began)
+	result.Failures = failures
+	if acc != nil {
+		result.Stats, result.Samples = acc.Stats(), acc.Samples()
+		return result
+	}
+	result.Stats = Summarize(samples)
+	result.Samples = samples
+	return result
+}
+
+// send times one attempt at the query of j.
+func (r *Runner) send(ctx context.Context, res Resolver, query func(context.Context, string, dnsmsg.Type) (int, error), j job, attempt int) Sample {
+	qctx, cancel := r.queryContext(ctx)
+	defer cancel()
+	qctx = context.WithValue(qctx, queryInfoKey{}, QueryInfo{Resolver: res, Index: j.index})
+	var start time.Time
+	var firstByte atomic.Int64
+	var respMu sync.Mutex
+	var respWire []byte
+	var srcPort, querySize int
+	var id uint16
+	sent := false
+	var wireStart, wireEnd, build, parse atomic.Int64
+	trace := &transport.Trace{
+		WroteQuery: func(src, _ net.Addr, msg []byte) {
+			respMu.Lock()
+			defer respMu.Unlock()
+			if sent || len(msg) < 2 {
+				return
+			}
+			sent, id, querySize = true, binary.BigEndian.Uint16(msg), len(msg)
+			if a, ok := src.(interface{ AddrPort() netip.AddrPort }); ok {
+				srcPort = int(a.AddrPort().Port())
+			}
+		},
+		GotFirstResponseByte: func() { firstByte.CompareAndSwap(0, int64(time.Since(start))) },
+		GotResponse: func(msg []byte) {
+			respMu.Lock()
+			respWire = msg
+			respMu.Unlock()
+		},
+	}
+	if r.WireTiming {
+		trace.WriteStart = func() { wireStart.CompareAndSwap(0, int64(time.Since(start))) }
+		trace.ReadDone = func() { wireEnd.Store(int64(time.Since(start))) }
+	}
+	if r.Phases {
+		trace.Packed = func(took time.Duration) { build.Add(int64(took)) }
+		trace.Parsed = func(took time.Duration) { parse.Add(int64(took)) }
+	}
+	qctx = transport.WithTrace(qctx, trace)
+	start = time.Now()
+	queries, err := query(qctx, j.qname, j.qtype)
+	d := time.Since(start)
+	err = bustedResult(err, j.busted)
+
+	s := Sample{Duration: d, Err: err, FirstByte: time.Duration(firstByte.Load()), Queries: queries}
+	if r.WireTiming {
+		s.wireTime(time.Duration(wireStart.Load()), time.Duration(wireEnd.Load()))
+	}
+	if r.Phases {
+		s.phaseTime(time.Duration(build.Load()), time.Duration(parse.Load()))
+	}
+	respMu.Lock()
+	s.Size, s.Padded, s.Response = parseResponse(respWire)
+	s.SrcPort, s.ID, s.QuerySize = srcPort, id, querySize
+	respMu.Unlock()
+	slog.DebugContext(ctx, "query", "resolver", res.Name, "index", j.index, "attempt", attempt, "qname", j.qname, "qtype", j.qtype,
+		"src_port", s.SrcPort, "id", s.ID, "took", d, "bytes", s.Size, "err", err)
+	return s
+}
+
+// retryable reports whether a query that failed with err got no answer,
+// so that Runner.Retries sends it again. Answers with an error code are
+// final.
+func retryable(err error) bool {
+	rc := RCodeError(0)
+	return err != nil && !errors.As(err, &rc)
+}
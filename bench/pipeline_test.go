@@ -0,0 +1,56 @@
+package bench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// TestFailureStreak checks that Result.Failures counts the failures at the
+// end of a run whether or not Filter and MaxSamples keep those samples.
+func TestFailureStreak(t *testing.T) {
+	transport.UseScenario(&transport.Scenario{TTL: 300, Resolvers: []transport.MockResolver{{
+		Name: "Script",
+		Script: []transport.MockStep{
+			{Latency: time.Millisecond},
+			{Latency: time.Millisecond},
+			{Latency: time.Millisecond, RCode: dnsmsg.RCodeServerFailure},
+			{Latency: time.Millisecond, RCode: dnsmsg.RCodeServerFailure},
+		},
+	}}})
+	defer transport.UseScenario(nil)
+	noErrors, err := ParseFilter(`rcode == "NOERROR"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name       string
+		filter     *Filter
+		maxSamples int
+	}{
+		{name: "all samples"},
+		{name: "filtered", filter: noErrors},
+		{name: "max samples", maxSamples: 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{
+				Resolvers:  []Resolver{{Name: "Script", Addr: "mock://Script"}},
+				Domain:     "example.com",
+				Count:      11, // ok ok fail fail ok ok fail fail ok ok fail
+				Timeout:    time.Second,
+				Filter:     tt.filter,
+				MaxSamples: tt.maxSamples,
+			}
+			results, err := r.Run(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results[0].Failures; got != 1 {
+				t.Errorf("Failures = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package bench
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// RecordVersion is the schema version written to saved runs. Version 2
+// always sets QType; version 1 left it empty for the A or AAAA query of
+// the network. ReadRunRecord upgrades older records to this version.
+const RecordVersion = 2
+
+// Tool identifies the program and its version in every RunRecord. Programs
+// using the package set it at startup.
+var Tool = "dnsbench"
+
+// Host names the machine in every RunRecord; empty means the host name of
+// the system. Programs running in containers set it to the node they run on.
+var Host string
+
+// RunRecord is the on-disk form of one benchmark run, written as JSON so
+// that runs from cron jobs or several machines can be combined later.
+type RunRecord struct {
+	Version          int              `json:"version"`
+	Tool             string           `json:"tool,omitempty"` // since version 2
+	Started          time.Time        `json:"started"`
+	Host             string           `json:"host,omitempty"`
+	Domain           string           `json:"domain"`
+	Domains          int              `json:"domains,omitempty"`     // size of the Runner.Domains workload
+	DurationMs       float64          `json:"duration_ms,omitempty"` // Runner.Duration of a time-based run, instead of a count
+	ZipfExponent     float64          `json:"zipf_exponent,omitempty"`
+	Seed             uint64           `json:"seed,omitempty"`
+	Network          string           `json:"network"`
+	QType            string           `json:"qtype,omitempty"` // comma-separated for a QTypeMix or BrowserSim
+	Cold             bool             `json:"cold,omitempty"`
+	ColdShare        float64          `json:"cold_share,omitempty"`
+	ColdWarm         bool             `json:"cold_warm,omitempty"` // Runner.ColdWarm
+	BrowserSim       bool             `json:"browser_sim,omitempty"`
+	Search           []string         `json:"search,omitempty"`
+	Ndots            int              `json:"ndots,omitempty"`
+	DNS64            bool             `json:"dns64,omitempty"`
+	NonRecursive     bool             `json:"non_recursive,omitempty"`
+	Impairment       string           `json:"impairment,omitempty"`         // transport.SetImpairment, if any
+	Path             string           `json:"path,omitempty"`               // Runner.Path, if any
+	MaxSamples       int              `json:"max_samples,omitempty"`        // Runner.MaxSamples: samples are a random subset
+	ReuseSockets     bool             `json:"reuse_sockets,omitempty"`      // Runner.ReuseSockets
+	DoHMethod        string           `json:"doh_method,omitempty"`         // Runner.DoHMethod
+	ConnsPerResolver int              `json:"conns_per_resolver,omitempty"` // Runner.ConnsPerResolver
+	FastOpen         bool             `json:"fast_open,omitempty"`          // Runner.FastOpen
+	WireTiming       bool             `json:"wire_timing,omitempty"`        // Runner.WireTiming
+	BusyPoll         bool             `json:"busy_poll,omitempty"`          // Runner.BusyPoll
+	Phases           bool             `json:"phases,omitempty"`             // Runner.Phases
+	BusyCPU          float64          `json:"busy_cpu,omitempty"`           // Runner.BusyCPU
+	PauseWhenBusy    bool             `json:"pause_when_busy,omitempty"`    // Runner.PauseWhenBusy
+	PinCPU           bool             `json:"pin_cpu,omitempty"`            // Runner.PinCPU
+	Rate             float64          `json:"rate,omitempty"`               // Runner.Rate, queries per second per resolver
+	Retries          int              `json:"retries,omitempty"`            // Runner.Retries
+	Filter           string           `json:"filter,omitempty"`             // Runner.Filter: samples it left out are not recorded
+	Resolvers        []ResolverRecord `json:"resolvers"`
+}
+
+// ResolverRecord holds the samples of one resolver in a RunRecord.
+type ResolverRecord struct {
+	Name        string         `json:"name"`
+	Addr        string         `json:"addr,omitempty"`
+	IPs         []string       `json:"ips,omitempty"` // Resolver.IPs
+	Group       string         `json:"group,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Operator    *Operator      `json:"operator,omitempty"`
+	NAT64Prefix string         `json:"nat64_prefix,omitempty"`
+	Aborted     bool           `json:"aborted,omitempty"`
+	Failures    int            `json:"failures,omitempty"`  // Result.Failures
+	Filtered    int            `json:"filtered,omitempty"`  // Result.Filtered
+	Pairs       []PairRecord   `json:"pairs,omitempty"`     // Result.Pairs
+	Busy        int            `json:"busy,omitempty"`      // Result.Busy
+	PausedMs    float64        `json:"paused_ms,omitempty"` // Result.Paused
+	Samples     []SampleRecord `json:"samples"`
+}
+
+// PairRecord is a Pair in milliseconds.
+type PairRecord struct {
+	ColdMs float64 `json:"cold_ms"`
+	WarmMs float64 `json:"warm_ms"`
+}
+
+// SampleRecord is a Sample with its duration in milliseconds and its error
+// as text.
+type SampleRecord struct {
+	Ms      float64 `json:"ms"`
+	TTFBMs  float64 `json:"ttfb_ms,omitempty"`  // Sample.FirstByte
+	RTTMs   float64 `json:"rtt_ms,omitempty"`   // Sample.RTT
+	BuildMs float64 `json:"build_ms,omitempty"` // Sample.Build
+	ParseMs float64 `json:"parse_ms,omitempty"` // Sample.Parse
+	// OverheadMs is Sample.Overhead.
+	OverheadMs float64 `json:"overhead_ms,omitempty"`
+	Bytes      int     `json:"bytes,omitempty"`
+	Padded     bool    `json:"padded,omitempty"`
+	Queries    int     `json:"queries,omitempty"` // Sample.Queries, omitted when one
+	SrcPort    int     `json:"src_port,omitempty"`
+	ID         uint16  `json:"id,omitempty"` // Sample.ID, the DNS message ID
+	// Response is Sample.Response.
+	Response *ResponseRecord `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// ResponseRecord is a ResponseHeader with its response code and flags as
+// text.
+type ResponseRecord struct {
+	RCode       string  `json:"rcode"`
+	Flags       string  `json:"flags,omitempty"` // as dig shows them, e.g. "rd ra ad"
+	Answers     int     `json:"answers"`
+	Authorities int     `json:"authorities"`
+	Additionals int     `json:"additionals"`
+	MinTTL      *uint32 `json:"min_ttl,omitempty"` // omitted without answer and authority records
+}
+
+// NewRunRecord captures the results of a run of r that started at started.
+func NewRunRecord(r *Runner, started time.Time, results []Result) RunRecord {
+	host := Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	rec := RunRecord{
+		Version: RecordVersion,
+		Tool:    Tool,
+		Started: started,
+		Host:    host,
+		Domain:  r.Domain,
+		Domains: len(r.Domains),
+		Network: r.Network,
+		Cold:    r.Cold,
+		DNS64:   r.DNS64,
+
+		DurationMs:       float64(r.Duration.Microseconds()) / 1000.0,
+		ColdShare:        r.ColdShare,
+		ColdWarm:         r.ColdWarm,
+		BrowserSim:       r.BrowserSim,
+		Search:           r.Search,
+		NonRecursive:     r.NonRecursive,
+		MaxSamples:       r.MaxSamples,
+		ReuseSockets:     r.ReuseSockets,
+		DoHMethod:        r.DoHMethod,
+		ConnsPerResolver: r.ConnsPerResolver,
+		FastOpen:         r.FastOpen,
+		WireTiming:       r.WireTiming,
+		BusyPoll:         r.BusyPoll,
+		Phases:           r.Phases,
+		BusyCPU:          r.BusyCPU,
+		PauseWhenBusy:    r.PauseWhenBusy,
+		PinCPU:           r.PinCPU,
+		Rate:             r.Rate,
+		Retries:          r.Retries,
+		ZipfExponent:     r.ZipfExponent,
+		Seed:             r.Seed,
+	}
+	if len(r.Search) > 0 {
+		rec.Ndots = r.Ndots
+	}
+	if r.Filter != nil {
+		rec.Filter = r.Filter.String()
+	}
+	if r.Path != (transport.Path{}) {
+		rec.Path = r.Path.String()
+	}
+	if imp := transport.CurrentImpairment(); imp != (transport.Impairment{}) {
+		rec.Impairment = imp.String()
+	}
+	types := make([]string, 0, 1)
+	for _, t := range r.QueryTypes() {
+		types = append(types, t.String())
+	}
+	rec.QType = strings.Join(types, ",")
+	byName := make(map[string]Resolver, len(r.Resolvers))
+	for _, res := range r.Resolvers {
+		byName[res.Name] = res
+	}
+	for _, res := range results {
+		rr := ResolverRecord{
+			Name: res.Name, Addr: byName[res.Name].Addr, IPs: byName[res.Name].IPs,
+			Group: res.Group, NAT64Prefix: res.NAT64Prefix, Aborted: res.Aborted, Failures: res.Failures, Filtered: res.Filtered,
+			Tags: res.Tags, Operator: res.Operator, Busy: res.Busy, PausedMs: float64(res.Paused.Microseconds()) / 1000.0,
+		}
+		for _, p := range res.Pairs {
+			rr.Pairs = append(rr.Pairs, PairRecord{
+				ColdMs: float64(p.Cold.Microseconds()) / 1000.0,
+				WarmMs: float64(p.Warm.Microseconds()) / 1000.0,
+			})
+		}
+		for _, s := range res.Samples {
+			sr := SampleRecord{
+				Ms:         float64(s.Duration.Microseconds()) / 1000.0,
+				TTFBMs:     float64(s.FirstByte.Microseconds()) / 1000.0,
+				RTTMs:      float64(s.RTT.Microseconds()) / 1000.0,
+				OverheadMs: float64(s.Overhead.Microseconds()) / 1000.0,
+				BuildMs:    float64(s.Build.Nanoseconds()) / 1e6,
+				ParseMs:    float64(s.Parse.Nanoseconds()) / 1e6,
+				Bytes:      s.Size,
+				Padded:     s.Padded,
+				SrcPort:    s.SrcPort,
+				ID:         s.ID,
+			}
+			if s.Queries != 1 {
+				sr.Queries = s.Queries
+			}
+			if s.Err != nil {
+				sr.Error = s.Err.Error()
+			}
+			if h := s.Response; h != nil {
+				sr.Response = &ResponseRecord{
+					RCode: h.RCode.String(), Flags: h.Flags(),
+					Answers: h.Answers, Authorities: h.Authorities, Additionals: h.Additionals,
+				}
+				if ttl := h.MinTTL; h.Answers+h.Authorities > 0 {
+					sr.Response.MinTTL = &ttl
+				}
+			}
+			rr.Samples = append(rr.Samples, sr)
+		}
+		rec.Resolvers = append(rec.Resolvers, rr)
+	}
+	return rec
+}
+
+// Results converts the record back into summarized Results.
+func (rec RunRecord) Results() []Result {
+	out := make([]Result, 0, len(rec.Resolvers))
+	for _, rr := range rec.Resolvers {
+		res := Result{Name: rr.Name, Group: rr.Group, NAT64Prefix: rr.NAT64Prefix, Aborted: rr.Aborted, Failures: rr.Failures, Filtered: rr.Filtered, Tags: rr.Tags, Operator: rr.Operator,
+			Busy: rr.Busy, Paused: msDuration(rr.PausedMs)}
+		for _, p := range rr.Pairs {
+			res.Pairs = append(res.Pairs, Pair{Cold: msDuration(p.ColdMs), Warm: msDuration(p.WarmMs)})
+		}
+		for _, sr := range rr.Samples {
+			s := Sample{
+				Duration:  time.Duration(sr.Ms * float64(time.Millisecond)),
+				FirstByte: time.Duration(sr.TTFBMs * float64(time.Millisecond)),
+				RTT:       time.Duration(sr.RTTMs * float64(time.Millisecond)),
+				Overhead:  time.Duration(sr.OverheadMs * float64(time.Millisecond)),
+				Build:     time.Duration(sr.BuildMs * float64(time.Millisecond)),
+				Parse:     time.Duration(sr.ParseMs * float64(time.Millisecond)),
+				Size:      sr.Bytes,
+				Padded:    sr.Padded,
+				Queries:   max(sr.Queries, 1),
+				SrcPort:   sr.SrcPort,
+				ID:        sr.ID,
+			}
+			if sr.Error != "" {
+				s.Err = errors.New(sr.Error)
+			}
+			if r := sr.Response; r != nil {
+				rcode, _ := dnsmsg.ParseRCode(r.RCode)
+				s.Response = &ResponseHeader{RCode: rcode, Answers: r.Answers, Authorities: r.Authorities, Additionals: r.Additionals}
+				s.Response.setFlags(r.Flags)
+				if r.MinTTL != nil {
+					s.Response.MinTTL = *r.MinTTL
+				}
+			}
+			res.Samples = append(res.Samples, s)
+		}
+		res.Stats = Summarize(res.Samples)
+		out = append(out, res)
+	}
+	return out
+}
+
+// WriteFile saves the record as indented JSON.
+func (rec RunRecord) WriteFile(path string) error {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// ReadRunRecord loads a record saved by WriteFile.
+func ReadRunRecord(path string) (RunRecord, error) {
+	var rec RunRecord
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return rec, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := rec.upgrade(); err != nil {
+		return rec, fmt.Errorf("%s: %w", path, err)
+	}
+	return rec, nil
+}
+
+// upgrade converts a record of an older schema version to RecordVersion,
+// one version at a time.
+func (rec *RunRecord) upgrade() error {
+	switch {
+	case rec.Version <= 0:
+		return errors.New("not a saved run (no schema version)")
+	case rec.Version > RecordVersion:
+		return fmt.Errorf("schema version %d is newer than this build reads (%d); update dnsbench", rec.Version, RecordVersion)
+	}
+	if rec.Version == 1 {
+		if rec.QType == "" {
+			rec.QType = QType(rec.Network).String()
+		}
+		rec.Version = 2
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// Bounds on the TTL of the records of a stale zone: long enough for the
+// prefetch triggers of BIND (9s eligibility) and Unbound (the last 10%)
+// and to tell a prefetched record from a stale one with TTL 0, short
+// enough for a probe.
+const (
+	MinRefreshTTL = 20
+	MaxRefreshTTL = 300
+)
+
+// CacheRefresh is how a resolver treats cached records that are about to
+// expire or have expired, as ProbeCacheRefresh finds it.
+type CacheRefresh struct {
+	TTL uint32 // of the test records
+	// Prefetch: a record queried over its lifetime and once more just
+	// before it expired was fetched again before it expired, so its
+	// clients never wait for the authoritative servers.
+	Prefetch bool
+	// ServeStale: a record queried again after it expired was answered
+	// from the cache rather than fetched (RFC 8767 and the optimistic
+	// caching of Unbound's serve-expired), usually with a TTL of 30s or 0.
+	ServeStale bool
+	StaleTTL   uint32 // the TTL of the stale answer
+}
+
+// prefetchLead is how long before a popular record expires the probe
+// queries it a last time: within the last 10% of the TTL (Unbound) and
+// under BIND's 2s trigger.
+const prefetchLead = 1500 * time.Millisecond
+
+// ProbeCacheRefresh looks for prefetching and serve-stale with two random
+// names below zone, a wildcard whose records have a TTL between
+// MinRefreshTTL and MaxRefreshTTL seconds: names no one else asks for, so
+// the resolver's cache holds them exactly as the probe left them. The
+// first is queried over its lifetime, the last time shortly before it
+// expires, and the second only once; after both expired, a fresh answer
+// for either shows a resolver that fetches again, while a TTL short of
+// full shows a record refreshed early (the first) or served stale (the
+// second). The probe takes a little longer than the TTL. Resolvers with
+// several caches behind one address may answer from one that never saw
+// the names, which looks like a resolver without either feature.
+func ProbeCacheRefresh(ctx context.Context, tr transport.Transport, zone string, timeout time.Duration) (CacheRefresh, error) {
+	var cr CacheRefresh
+	ttlOf := func(name string) (uint32, error) {
+		ctx, cancel := withTimeout(ctx, timeout)
+		defer cancel()
+		resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, dnsmsg.TypeA))
+		if err != nil {
+			return 0, err
+		}
+		if resp.RCode != dnsmsg.RCodeSuccess {
+			return 0, fmt.Errorf("%s: %w", name, RCodeError(resp.RCode))
+		}
+		if len(resp.Answers) == 0 {
+			return 0, fmt.Errorf("%s: no answer; the stale zone needs a wildcard A record", name)
+		}
+		ttl := resp.Answers[0].TTL
+		for _, rr := range resp.Answers[1:] {
+			ttl = min(ttl, rr.TTL)
+		}
+		return ttl, nil
+	}
+	sleep := func(until time.Time) error {
+		t := time.NewTimer(time.Until(until))
+		defer t.Stop()
+		select {
+		case <-t.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	popular := RandomLabel() + "." + zone
+	stale := RandomLabel() + "." + zone
+	fetched := time.Now()
+	ttl, err := ttlOf(popular)
+	if err != nil {
+		return cr, err
+	}
+	if ttl < MinRefreshTTL || ttl > MaxRefreshTTL {
+		return cr, fmt.Errorf("%s: TTL %ds, the stale zone needs %d to %ds", popular, ttl, MinRefreshTTL, MaxRefreshTTL)
+	}
+	cr.TTL = ttl
+	if _, err := ttlOf(stale); err != nil {
+		return cr, err
+	}
+	life := time.Duration(ttl) * time.Second
+	expires := fetched.Add(life)
+	for _, at := range []time.Time{fetched.Add(life / 4), fetched.Add(life / 2), fetched.Add(life * 3 / 4), expires.Add(-prefetchLead)} {
+		if err := sleep(at); err != nil {
+			return cr, err
+		}
+		if _, err := ttlOf(popular); err != nil {
+			return cr, err
+		}
+	}
+
+	// Two seconds past the expiry, so that TTLs rounded to whole seconds
+	// cannot be mistaken for fresh ones.
+	if err := sleep(expires.Add(2 * time.Second)); err != nil {
+		return cr, err
+	}
+	checked := time.Now()
+	staleTTL, err := ttlOf(stale)
+	if err != nil {
+		return cr, err
+	}
+	popularTTL, err := ttlOf(popular)
+	if err != nil {
+		return cr, err
+	}
+	// A record fetched at the check has the full TTL, give or take a
+	// second of rounding. A prefetched one was fetched again between the
+	// first repeat and the expiry; a stale answer with TTL 0 would date
+	// from before the first repeat.
+	fresh := func(got uint32) bool { return got+1 >= ttl && got <= ttl }
+	if !fresh(staleTTL) {
+		cr.ServeStale, cr.StaleTTL = true, staleTTL
+	}
+	// A popular record with the TTL of the stale answer was served stale
+	// too, not prefetched: Unbound's serve-expired replies with 30s
+	// whatever the record, which would date a refresh inside the lifetime
+	// for TTLs from 33 to 131s.
+	if !fresh(popularTTL) && !(cr.ServeStale && popularTTL == staleTTL) {
+		refreshedAt := checked.Add(time.Duration(popularTTL)*time.Second - life)
+		cr.Prefetch = refreshedAt.Before(expires) && refreshedAt.After(fetched.Add(life/4-time.Second))
+	}
+	return cr, nil
+}
@@ -0,0 +1,239 @@
+package bench
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	mrand "math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/stamp"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// Resolver is a named DNS server to benchmark.
+type Resolver struct {
+	Name string
+	Addr string // host[:port] for UDP, or scheme://... for another transport
+	// QName, if set, is queried instead of Runner.Domain. Authoritative
+	// servers of a single zone, such as a TLD, need a name inside it.
+	QName string
+	// IPs are the addresses a server host name resolved to at startup, for
+	// the run record. Empty when Addr holds an IP address.
+	IPs []string
+	// Group is the name of the entry that listed this address among several,
+	// as in Quad9=9.9.9.9|149.112.112.112; empty otherwise.
+	Group string
+	// Tags label the resolver for CombineTags, as in
+	// Cloudflare=1.1.1.1#tags=anycast,privacy.
+	Tags []string
+	// Operator is who runs the server, when known; see Operator.
+	Operator *Operator
+}
+
+// Operator describes the network a resolver's server sits in: the
+// autonomous system announcing its address, the organisation behind it and
+// the country that organisation is registered in. It tells users who gets
+// to see the queries they would send.
+type Operator struct {
+	ASN     uint32 `json:"asn,omitempty"` // zero for private networks
+	Name    string `json:"name"`
+	Country string `json:"country,omitempty"` // ISO 3166 alpha-2 code
+	Source  string `json:"source,omitempty"`  // how it was found, e.g. "builtin"
+	// Logging and Filtering summarize the published policy of the service
+	// at this address, such as "no IP logs" and "malware"; empty when not
+	// known. Filtering is "none" for services that block nothing.
+	Logging   string `json:"logging,omitempty"`
+	Filtering string `json:"filtering,omitempty"`
+}
+
+// String formats o as "AS13335 Cloudflare (US)".
+func (o *Operator) String() string {
+	s := o.Name
+	if o.ASN != 0 {
+		s = fmt.Sprintf("AS%d %s", o.ASN, s)
+	}
+	if o.Country != "" {
+		s += " (" + o.Country + ")"
+	}
+	return s
+}
+
+// tagsSuffix starts the tags of a resolver entry.
+const tagsSuffix = "#tags="
+
+// ParseResolvers parses a comma-separated list of Name=Addr pairs. An entry
+// may also be a bare sdns:// stamp. Addr may list several addresses of one
+// service separated by "|"; each becomes a resolver named Name/Addr in the
+// group Name. Addr may end in #tags= and a comma-separated list of tags,
+// which run to the next Name=Addr pair. Malformed entries are skipped.
+func ParseResolvers(s string) []Resolver {
+	parts := strings.Split(s, ",")
+	var out []Resolver
+	var tagged []int // indexes in out of the resolvers of the last entry with tags
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || strings.HasPrefix(p, "sdns://") {
+			if tagged != nil && !strings.HasPrefix(p, "sdns://") {
+				// Another tag of the previous entry.
+				for _, i := range tagged {
+					out[i].Tags = append(out[i].Tags, p)
+				}
+				continue
+			}
+			tagged = nil
+			// A bare DNS stamp is named after the server it describes.
+			if st, err := stamp.Parse(p); err == nil {
+				out = append(out, Resolver{Name: st.Name(), Addr: p})
+			}
+			continue
+		}
+		tagged = nil
+		name := strings.TrimSpace(kv[0])
+		addr, tagList, hasTags := strings.Cut(kv[1], tagsSuffix)
+		var tags []string
+		if hasTags {
+			if t := strings.TrimSpace(tagList); t != "" {
+				tags = []string{t}
+			}
+		}
+		first := len(out)
+		addrs := strings.Split(addr, "|")
+		if len(addrs) == 1 {
+			out = append(out, Resolver{Name: name, Addr: strings.TrimSpace(addrs[0]), Tags: tags})
+		} else {
+			for _, a := range addrs {
+				if a = strings.TrimSpace(a); a != "" {
+					out = append(out, Resolver{Name: name + "/" + a, Addr: a, Group: name, Tags: slices.Clone(tags)})
+				}
+			}
+		}
+		if hasTags {
+			tagged = make([]int, 0, len(out)-first)
+			for i := first; i < len(out); i++ {
+				tagged = append(tagged, i)
+			}
+		}
+	}
+	return out
+}
+
+// RCodeError is the error of a lookup answered with a response code other
+// than NOERROR.
+type RCodeError dnsmsg.RCode
+
+func (e RCodeError) Error() string { return "rcode " + dnsmsg.RCode(e).String() }
+
+// LookupIP sends a single A or AAAA query through tr and returns the
+// addresses in the answer. A non-NOERROR response code or an answer without
+// addresses is an error.
+func LookupIP(ctx context.Context, tr transport.Transport, name string, qtype dnsmsg.Type) ([]net.IP, error) {
+	resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+	if err != nil {
+		return nil, err
+	}
+	if resp.RCode != dnsmsg.RCodeSuccess {
+		return nil, fmt.Errorf("lookup %s: %w", name, RCodeError(resp.RCode))
+	}
+	var ips []net.IP
+	for _, rr := range resp.Answers {
+		if rr.Type != qtype {
+			continue
+		}
+		if ip, err := rr.IP(); err == nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("lookup %s: no %s records in answer", name, qtype)
+	}
+	return ips, nil
+}
+
+// LookupRecords sends a single query for name/qtype through tr and returns
+// the answer records of that type. A non-NOERROR response code, an answer
+// without such records, or SVCB/HTTPS data that does not decode is an error.
+func LookupRecords(ctx context.Context, tr transport.Transport, name string, qtype dnsmsg.Type) ([]dnsmsg.Resource, error) {
+	resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+	if err != nil {
+		return nil, err
+	}
+	if resp.RCode != dnsmsg.RCodeSuccess {
+		return nil, fmt.Errorf("lookup %s: %w", name, RCodeError(resp.RCode))
+	}
+	var rrs []dnsmsg.Resource
+	for _, rr := range resp.Answers {
+		if rr.Type != qtype {
+			continue
+		}
+		if qtype == dnsmsg.TypeSVCB || qtype == dnsmsg.TypeHTTPS {
+			if _, err := rr.SVCB(); err != nil {
+				return nil, fmt.Errorf("lookup %s: %s record: %w", name, qtype, err)
+			}
+		}
+		rrs = append(rrs, rr)
+	}
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("lookup %s: no %s records in answer", name, qtype)
+	}
+	return rrs, nil
+}
+
+// QueryNonRecursive sends a single query with the RD bit clear, as a
+// resolver does when it walks the delegation from the root. Any answer or
+// referral (NOERROR) and NXDOMAIN count as success; other response codes
+// are errors.
+func QueryNonRecursive(ctx context.Context, tr transport.Transport, name string, qtype dnsmsg.Type) error {
+	q := dnsmsg.NewQuery(name, qtype)
+	q.RecursionDesired = false
+	resp, err := tr.SendQuery(ctx, q)
+	if err != nil {
+		return err
+	}
+	if resp.RCode != dnsmsg.RCodeSuccess && resp.RCode != dnsmsg.RCodeNameError {
+		return fmt.Errorf("query %s: rcode %s", name, resp.RCode)
+	}
+	return nil
+}
+
+// QType maps a network name ("ip4" or "ip6") to the address record type
+// to query.
+func QType(network string) dnsmsg.Type {
+	switch strings.ToLower(network) {
+	case "ip6", "ipv6":
+		return dnsmsg.TypeAAAA
+	default:
+		return dnsmsg.TypeA
+	}
+}
+
+// RandomLabel returns a random 16-character hex label, used to build
+// cache-busting query names.
+func RandomLabel() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hexLabel(b)
+}
+
+// seededLabel is RandomLabel drawing from rng, for reproducible runs.
+func seededLabel(rng *mrand.Rand) string {
+	return hexLabel(binary.BigEndian.AppendUint64(nil, rng.Uint64()))
+}
+
+func hexLabel(b []byte) string {
+	hex := make([]byte, len(b)*2)
+	const hexdigits = "0123456789abcdef"
+	for i, v := range b {
+		hex[i*2] = hexdigits[v>>4]
+		hex[i*2+1] = hexdigits[v&0x0f]
+	}
+	return string(hex)
+}
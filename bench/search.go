@@ -0,0 +1,59 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// SearchNames returns the names a stub resolver tries for name, in order,
+// given the search domains and ndots option of resolv.conf. A name ending
+// in a dot is only tried as is. A name with at least ndots dots is tried as
+// is first and then with each search domain appended; a shorter one the
+// other way round, as glibc and musl do.
+func SearchNames(name string, search []string, ndots int) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+	names := make([]string, 0, len(search)+1)
+	for _, s := range search {
+		if s = strings.Trim(s, "."); s != "" {
+			names = append(names, name+"."+s+".")
+		}
+	}
+	if strings.Count(name, ".") >= ndots {
+		return append([]string{name + "."}, names...)
+	}
+	return append(names, name+".")
+}
+
+// LookupSearch resolves name through a search list as a stub resolver
+// does: it queries the SearchNames candidates in turn until one has records
+// of qtype. NXDOMAIN, an empty answer and SERVFAIL move on to the next
+// candidate; a failed query ends the lookup. It returns the number of
+// queries sent.
+func LookupSearch(ctx context.Context, tr transport.Transport, name string, qtype dnsmsg.Type, search []string, ndots int) (int, error) {
+	var err error
+	sent := 0
+	for _, qname := range SearchNames(name, search, ndots) {
+		sent++
+		resp, qerr := tr.SendQuery(ctx, dnsmsg.NewQuery(qname, qtype))
+		if qerr != nil {
+			return sent, qerr
+		}
+		if resp.RCode != dnsmsg.RCodeSuccess {
+			err = fmt.Errorf("lookup %s: %w", qname, RCodeError(resp.RCode))
+			continue
+		}
+		for _, rr := range resp.Answers {
+			if rr.Type == qtype {
+				return sent, nil
+			}
+		}
+		err = fmt.Errorf("lookup %s: no %s records in answer", qname, qtype)
+	}
+	return sent, err
+}
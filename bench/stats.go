@@ -0,0 +1,120 @@
+package bench
+
+import (
+	"math"
+	"time"
+)
+
+// Stats summarizes the successful samples of one resolver.
+type Stats struct {
+	Count       int
+	Successes   int
+	Min         time.Duration
+	Max         time.Duration
+	Avg         time.Duration
+	Median      time.Duration
+	P95         time.Duration
+	P99         time.Duration
+	P999        time.Duration // 99.9th percentile
+	P9999       time.Duration // 99.99th percentile
+	Errors      []error
+	DurationsMs []float64
+	// Histogram holds the durations of the successful samples, for other
+	// percentiles.
+	Histogram *Histogram
+
+	// Response sizes in bytes, over all samples that got a response.
+	Responses int
+	MinSize   int
+	MaxSize   int
+	AvgSize   float64
+	Padded    int // responses with EDNS(0) padding
+}
+
+// Summarize computes Stats over samples. Failed samples only contribute to
+// Count and Errors.
+func Summarize(samples []Sample) Stats {
+	var stats Stats
+	stats.Count = len(samples)
+	stats.Min = time.Duration(math.MaxInt64)
+	var sizeSum int
+	hist := new(Histogram)
+	for _, s := range samples {
+		if s.Size > 0 {
+			if stats.Responses == 0 || s.Size < stats.MinSize {
+				stats.MinSize = s.Size
+			}
+			stats.MaxSize = max(stats.MaxSize, s.Size)
+			sizeSum += s.Size
+			stats.Responses++
+			if s.Padded {
+				stats.Padded++
+			}
+		}
+		if s.Err == nil {
+			stats.Successes++
+			if s.Duration < stats.Min {
+				stats.Min = s.Duration
+			}
+			if s.Duration > stats.Max {
+				stats.Max = s.Duration
+			}
+			stats.DurationsMs = append(stats.DurationsMs, float64(s.Duration.Microseconds())/1000.0)
+			hist.Record(s.Duration)
+		} else {
+			stats.Errors = append(stats.Errors, s.Err)
+		}
+	}
+	if stats.Responses > 0 {
+		stats.AvgSize = float64(sizeSum) / float64(stats.Responses)
+	}
+	if stats.Successes == 0 {
+		stats.Min = 0
+		stats.Max = 0
+		return stats
+	}
+	// avg
+	var sum float64
+	for _, v := range stats.DurationsMs {
+		sum += v
+	}
+	avgMs := sum / float64(stats.Successes)
+	stats.Avg = time.Duration(avgMs * float64(time.Millisecond))
+
+	stats.setPercentiles(hist)
+	return stats
+}
+
+// setPercentiles sets the median and tail percentiles from h, within Min
+// and Max: a bucket's midpoint can lie beyond the samples it holds.
+func (s *Stats) setPercentiles(h *Histogram) {
+	s.Histogram = h
+	p := func(q float64) time.Duration { return min(max(h.Percentile(q), s.Min), s.Max) }
+	s.Median = p(50)
+	s.P95 = p(95)
+	s.P99 = p(99)
+	s.P999 = p(99.9)
+	s.P9999 = p(99.99)
+}
+
+// Percentile returns the p-th percentile of sorted using linear
+// interpolation between closest ranks.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return sorted[0]
+	}
+	if p >= 100 {
+		return sorted[len(sorted)-1]
+	}
+	pos := (p / 100) * float64(len(sorted)-1)
+	l := int(math.Floor(pos))
+	u := int(math.Ceil(pos))
+	if l == u {
+		return sorted[l]
+	}
+	frac := pos - float64(l)
+	return sorted[l]*(1-frac) + sorted[u]*frac
+}
@@ -0,0 +1,52 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPercentilesWithinRange checks that the percentiles read from the
+// histogram stay between the fastest and the slowest sample.
+func TestPercentilesWithinRange(t *testing.T) {
+	for _, durations := range [][]time.Duration{
+		{5 * time.Second},
+		{1234567 * time.Nanosecond},
+		{time.Millisecond, 2 * time.Millisecond, 4999 * time.Millisecond},
+	} {
+		samples := make([]Sample, len(durations))
+		for i, d := range durations {
+			samples[i] = Sample{Duration: d}
+		}
+		s := Summarize(samples)
+		for name, p := range map[string]time.Duration{"median": s.Median, "p95": s.P95, "p99": s.P99, "p99.9": s.P999, "p99.99": s.P9999} {
+			if p < s.Min || p > s.Max {
+				t.Errorf("%v: %s %v outside %v to %v", durations, name, p, s.Min, s.Max)
+			}
+		}
+	}
+}
+
+// TestHistogramMerge checks that merged histograms count as one that
+// recorded every duration.
+func TestHistogramMerge(t *testing.T) {
+	var a, b, all Histogram
+	for i := 1; i <= 100; i++ {
+		d := time.Duration(i*i) * 37 * time.Microsecond
+		all.Record(d)
+		if i%3 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+	}
+	a.Merge(&b)
+	a.Merge(nil)
+	if a.Count() != all.Count() {
+		t.Fatalf("merged count = %d, want %d", a.Count(), all.Count())
+	}
+	for _, p := range []float64{0, 50, 95, 99, 100} {
+		if got, want := a.Percentile(p), all.Percentile(p); got != want {
+			t.Errorf("merged p%v = %v, want %v", p, got, want)
+		}
+	}
+}
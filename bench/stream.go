@@ -0,0 +1,104 @@
+package bench
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Accumulator summarizes samples as they arrive in constant memory, for
+// runs too long to keep every sample. Its Stats cover every sample, with
+// percentiles from a Histogram. Samples returns a uniform random reservoir
+// of at most Size samples (Vitter's Algorithm R). Each distinct error is
+// kept once.
+type Accumulator struct {
+	Size int
+	rng  *rand.Rand
+
+	seen    int
+	kept    []Sample
+	index   []int // run index of each kept sample
+	stats   Stats
+	sum     time.Duration
+	hist    Histogram
+	sizeSum int
+	errs    map[string]bool
+}
+
+// NewAccumulator returns an Accumulator that keeps at most size samples,
+// drawn with rng.
+func NewAccumulator(size int, rng *rand.Rand) *Accumulator {
+	return &Accumulator{Size: size, rng: rng, errs: make(map[string]bool)}
+}
+
+// Add records the next sample.
+func (a *Accumulator) Add(s Sample) {
+	st := &a.stats
+	st.Count++
+	if s.Size > 0 {
+		if st.Responses == 0 || s.Size < st.MinSize {
+			st.MinSize = s.Size
+		}
+		st.MaxSize = max(st.MaxSize, s.Size)
+		a.sizeSum += s.Size
+		st.Responses++
+		if s.Padded {
+			st.Padded++
+		}
+	}
+	if s.Err == nil {
+		if st.Successes == 0 || s.Duration < st.Min {
+			st.Min = s.Duration
+		}
+		st.Max = max(st.Max, s.Duration)
+		a.sum += s.Duration
+		a.hist.Record(s.Duration)
+		st.Successes++
+	} else if !a.errs[s.Err.Error()] {
+		a.errs[s.Err.Error()] = true
+		st.Errors = append(st.Errors, s.Err)
+	}
+
+	i := a.seen
+	a.seen++
+	if len(a.kept) < a.Size {
+		a.kept = append(a.kept, s)
+		a.index = append(a.index, i)
+		return
+	}
+	if j := a.rng.IntN(a.seen); j < a.Size {
+		a.kept[j], a.index[j] = s, i
+	}
+}
+
+// Samples returns the kept samples in the order they were added.
+func (a *Accumulator) Samples() []Sample {
+	order := make([]int, len(a.kept))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(x, y int) int { return a.index[x] - a.index[y] })
+	out := make([]Sample, len(order))
+	for i, k := range order {
+		out[i] = a.kept[k]
+	}
+	return out
+}
+
+// Stats returns the statistics of all samples added so far.
+func (a *Accumulator) Stats() Stats {
+	st := a.stats
+	st.Errors = slices.Clone(st.Errors)
+	if st.Responses > 0 {
+		st.AvgSize = float64(a.sizeSum) / float64(st.Responses)
+	}
+	if st.Successes == 0 {
+		return st
+	}
+	st.Avg = a.sum / time.Duration(st.Successes)
+	st.DurationsMs = Summarize(a.kept).DurationsMs
+	hist := a.hist
+	hist.counts = slices.Clone(hist.counts)
+	st.setPercentiles(&hist)
+	return st
+}
@@ -0,0 +1,55 @@
+package bench
+
+import (
+	"slices"
+	"time"
+)
+
+// wireTime narrows s to its time on the wire, from the first write of its
+// query to the last read of a response, both measured from the start of
+// the sample. It keeps the whole duration unless the two moments are in
+// order within it, as monotonic clock readings of one query must be; a
+// transport that reported only one of them, or a failed query, leaves
+// the sample as it was.
+func (s *Sample) wireTime(write, read time.Duration) {
+	if write <= 0 || read < write || read > s.Duration {
+		return
+	}
+	s.Overhead = s.Duration - (read - write)
+	s.Duration = read - write
+	if s.FirstByte > 0 {
+		s.FirstByte = max(s.FirstByte-write, 0)
+	}
+}
+
+// phaseTime records the time s spent packing its queries and parsing its
+// responses, and leaves it out of the duration unless wireTime left out
+// more already. A transport that reported no packing leaves the sample as
+// it was.
+func (s *Sample) phaseTime(build, parse time.Duration) {
+	if build <= 0 || build+parse >= s.Duration+s.Overhead {
+		return
+	}
+	s.Build, s.Parse = build, parse
+	if s.Overhead > 0 {
+		return
+	}
+	s.Duration -= build + parse
+	if s.FirstByte > 0 {
+		s.FirstByte = max(s.FirstByte-build, 0)
+	}
+}
+
+// ClockOverhead returns the median time between two back-to-back readings
+// of the monotonic clock. Every timed sample includes it once, so
+// durations closer than this cannot be told apart.
+func ClockOverhead() time.Duration {
+	const n = 1001
+	ds := make([]time.Duration, n)
+	for i := range ds {
+		t := time.Now()
+		ds[i] = time.Since(t)
+	}
+	slices.Sort(ds)
+	return ds[n/2]
+}
@@ -0,0 +1,186 @@
+package bench
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// zipfOrder draws indexes into a ranked list of n names, choosing rank k
+// (from 1) with weight 1/k^s, as name popularity in real query traffic
+// roughly is. Draws are made as queries need them and kept, so that every
+// resolver of a run gets the same sequence however many queries it sends.
+type zipfOrder struct {
+	cdf   []float64
+	total float64
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	order []int
+}
+
+func newZipfOrder(n int, s float64, rng *rand.Rand) *zipfOrder {
+	z := &zipfOrder{cdf: make([]float64, n), rng: rng}
+	for k := range z.cdf {
+		z.total += 1 / math.Pow(float64(k+1), s)
+		z.cdf[k] = z.total
+	}
+	return z
+}
+
+// at returns the index of query i.
+func (z *zipfOrder) at(i int) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for len(z.order) <= i {
+		z.order = append(z.order, sort.SearchFloat64s(z.cdf, z.rng.Float64()*z.total))
+	}
+	return z.order[i]
+}
+
+// workloadOrder returns the order in which a run draws its names from
+// Domains, or nil when Domains are queried in turn. The order is shared by
+// all resolvers of a run so that every resolver answers the same sequence
+// of names.
+func (r *Runner) workloadOrder() *zipfOrder {
+	if len(r.Domains) == 0 || r.ZipfExponent <= 0 {
+		return nil
+	}
+	return newZipfOrder(len(r.Domains), r.ZipfExponent, r.rng(""))
+}
+
+// QueryNames returns the name of each query a run sends to res. Without a
+// Seed, the names that depend on random choices differ in every call.
+func (r *Runner) QueryNames(res Resolver) []string {
+	names, _, _ := r.queryNames(res, r.workloadOrder())
+	return names
+}
+
+// FirstQueryNames returns the names of the first n queries a run sends to
+// res, also for runs with a Duration, which have no fixed count.
+func (r *Runner) FirstQueryNames(res Resolver, n int) []string {
+	rr := *r
+	rr.Count = n
+	return rr.QueryNames(res)
+}
+
+// queryNames returns the names and types of all Count queries to res, and
+// which got a cache-busting label because of ColdShare.
+func (r *Runner) queryNames(res Resolver, order *zipfOrder) (names []string, qtypes []dnsmsg.Type, busted []bool) {
+	src := r.nameSource(res, order)
+	names = make([]string, r.Count)
+	qtypes = make([]dnsmsg.Type, r.Count)
+	busted = make([]bool, r.Count)
+	for i := range names {
+		names[i], qtypes[i], busted[i] = src.next()
+	}
+	return names, qtypes, busted
+}
+
+// A nameSource yields the names of the queries to one resolver in turn.
+type nameSource struct {
+	r      *Runner
+	res    Resolver
+	order  *zipfOrder
+	labels *rand.Rand
+	i      int
+}
+
+func (r *Runner) nameSource(res Resolver, order *zipfOrder) *nameSource {
+	return &nameSource{r: r, res: res, order: order, labels: r.rng(res.Name)}
+}
+
+// next returns the name and type of the next query and whether it got a
+// cache-busting label because of ColdShare or ColdWarm.
+func (n *nameSource) next() (name string, qtype dnsmsg.Type, busted bool) {
+	r, i := n.r, n.i
+	n.i++
+	if r.ColdWarm {
+		busted = i%2 == 0
+		i /= 2 // both queries of a pair ask for the same name
+	}
+	domain := r.Domain
+	qtype = r.queryType(i)
+	k := -1 // index into Domains
+	switch {
+	case n.order != nil:
+		k = n.order.at(i)
+	case len(r.Domains) > 0:
+		k = i % len(r.Domains)
+	}
+	if k >= 0 {
+		domain = r.Domains[k]
+		if k < len(r.DomainTypes) && r.DomainTypes[k] != 0 {
+			qtype = r.DomainTypes[k]
+		}
+	}
+	if n.res.QName != "" {
+		domain = n.res.QName
+	}
+	if !r.Cold && !r.ColdWarm && r.ColdShare > 0 {
+		busted = n.labels.Float64() < r.ColdShare
+	}
+	if r.Cold && !r.ColdWarm || busted {
+		return seededLabel(n.labels) + "." + domain, qtype, busted
+	}
+	return domain, qtype, busted
+}
+
+// QueryTypes returns the record types the queries of a run ask for: those
+// of BrowserSim, of DomainTypes and for its names without a type QTypeMix
+// or QType, or the address type of Network.
+func (r *Runner) QueryTypes() []dnsmsg.Type {
+	switch {
+	case r.BrowserSim:
+		return BrowserTypes
+	case len(r.DomainTypes) > 0:
+		var types []dnsmsg.Type
+		for _, t := range r.DomainTypes {
+			named := []dnsmsg.Type{t}
+			if t == 0 && len(r.QTypeMix) > 0 {
+				named = r.QTypeMix
+			} else if t == 0 {
+				named[0] = r.queryType(0)
+			}
+			for _, t := range named {
+				if !slices.Contains(types, t) {
+					types = append(types, t)
+				}
+			}
+		}
+		return types
+	case len(r.QTypeMix) > 0:
+		return r.QTypeMix
+	}
+	return []dnsmsg.Type{r.queryType(0)}
+}
+
+// queryType returns the record type of query i.
+func (r *Runner) queryType(i int) dnsmsg.Type {
+	switch {
+	case len(r.QTypeMix) > 0:
+		return r.QTypeMix[i%len(r.QTypeMix)]
+	case r.QType != 0:
+		return r.QType
+	}
+	return QType(r.Network)
+}
+
+// rng returns the random source for one stream of a run: "" for the
+// workload order, a resolver name for its cache-busting labels, or
+// "reservoir/" and the name for its MaxSamples reservoir. With a
+// Seed, a stream draws the same numbers in every run, independent of the
+// order or concurrency in which resolvers are benchmarked.
+func (r *Runner) rng(stream string) *rand.Rand {
+	if r.Seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(stream))
+	return rand.New(rand.NewPCG(r.Seed, h.Sum64()))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// resolveServerHosts looks up the server host name of each resolver entry
+// like NextDNS=dns.nextdns.io or https://dns.nextdns.io/abc once, with the
+// bootstrap resolver, and records the addresses in Resolver.IPs. With pin,
+// every connection to the host for the rest of the run goes to its first
+// address. Entries given as IP addresses, and stamps, which carry their
+// own, are left alone. A failed lookup is reported and the entry kept, so
+// that its queries fail in the results like those of an unreachable server.
+func resolveServerHosts(resolvers []bench.Resolver, pin bool, timeout time.Duration) {
+	boot := transport.Bootstrap()
+	for i, r := range resolvers {
+		host := transport.ServerHost(r.Addr)
+		if ip, _, _ := strings.Cut(host, "%"); host == "" || net.ParseIP(ip) != nil {
+			continue // IPv6 link-local addresses carry a zone
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		ips, err := boot.LookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			slog.Warn("cannot resolve server host name", "resolver", r.Name, "host", host, "err", err)
+			continue
+		}
+		resolvers[i].IPs = ips
+		if pin {
+			transport.Pin(host, ips[0])
+		}
+	}
+}
+
+// printServerIPs lists the addresses resolveServerHosts found.
+func printServerIPs(resolvers []bench.Resolver, pin bool) {
+	for _, r := range resolvers {
+		if len(r.IPs) == 0 {
+			continue
+		}
+		note := ""
+		if pin {
+			note = " (pinned to " + r.IPs[0] + ")"
+		}
+		fmt.Printf("Resolved %s: %s -> %s%s\n", r.Name, transport.ServerHost(r.Addr), strings.Join(r.IPs, ", "), note)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// defaultCNAMEDomains are names served through CDN alias chains.
+const defaultCNAMEDomains = "www.microsoft.com,www.apple.com,www.amazon.com,www.linkedin.com,www.ebay.com"
+
+// maxCNAMEChain bounds chain walking in case of alias loops.
+const maxCNAMEChain = 16
+
+// CNAMESample is one query in the CNAME probe.
+type CNAMESample struct {
+	Domain   string
+	Depth    int
+	Duration time.Duration
+	Err      error
+}
+
+// CNAMEResult is the CNAME probe outcome for one resolver.
+type CNAMEResult struct {
+	Name      string
+	Samples   []CNAMESample
+	Flattened []string // domains answered with a shorter chain than other resolvers returned
+}
+
+// probeCNAME queries each domain count times and records the length of the
+// CNAME chain in every answer.
+func probeCNAME(r bench.Resolver, domains []string, qtype dnsmsg.Type, count int, timeout time.Duration) CNAMEResult {
+	res := CNAMEResult{Name: r.Name}
+	tr, err := transport.New(r.Addr)
+	if err != nil {
+		res.Samples = append(res.Samples, CNAMESample{Err: err})
+		return res
+	}
+	for _, domain := range domains {
+		for i := 0; i < count; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			start := time.Now()
+			resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(domain, qtype))
+			d := time.Since(start)
+			cancel()
+
+			s := CNAMESample{Domain: domain, Duration: d, Err: err}
+			if err == nil {
+				if s.Err = rcodeError(resp); s.Err == nil {
+					s.Depth = cnameDepth(resp, domain)
+				}
+			}
+			res.Samples = append(res.Samples, s)
+		}
+	}
+	return res
+}
+
+// cnameDepth counts the CNAME records linking name to its final target.
+func cnameDepth(resp *dnsmsg.Message, name string) int {
+	depth := 0
+	for depth < maxCNAMEChain {
+		next := ""
+		for _, rr := range resp.Answers {
+			if rr.Type == dnsmsg.TypeCNAME && dnsmsg.EqualNames(rr.Name, name) {
+				next, _ = rr.Target()
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		depth++
+		name = next
+	}
+	return depth
+}
+
+// markFlattened flags, per resolver, the domains whose longest chain is
+// shorter than the longest chain any resolver returned for that domain.
+func markFlattened(results []CNAMEResult) {
+	longest := make(map[string]int)
+	for _, r := range results {
+		for d, depth := range maxDepthByDomain(r) {
+			longest[d] = max(longest[d], depth)
+		}
+	}
+	for i := range results {
+		for d, depth := range maxDepthByDomain(results[i]) {
+			if depth < longest[d] {
+				results[i].Flattened = append(results[i].Flattened, d)
+			}
+		}
+		sort.Strings(results[i].Flattened)
+	}
+}
+
+func maxDepthByDomain(r CNAMEResult) map[string]int {
+	out := make(map[string]int)
+	for _, s := range r.Samples {
+		if s.Err == nil {
+			out[s.Domain] = max(out[s.Domain], s.Depth)
+		}
+	}
+	return out
+}
+
+// depthLatencyCorr returns the Pearson correlation between chain depth and
+// latency over successful samples, or NaN if either does not vary.
+func depthLatencyCorr(samples []CNAMESample) float64 {
+	var xs, ys []float64
+	for _, s := range samples {
+		if s.Err == nil {
+			xs = append(xs, float64(s.Depth))
+			ys = append(ys, float64(s.Duration.Microseconds())/1000.0)
+		}
+	}
+	if len(xs) < 2 {
+		return math.NaN()
+	}
+	n := float64(len(xs))
+	var sx, sy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+	}
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+func printCNAME(results []CNAMEResult) {
+	maxDepth := 0
+	for _, r := range results {
+		for _, s := range r.Samples {
+			maxDepth = max(maxDepth, s.Depth)
+		}
+	}
+
+	fmt.Printf("%-12s  %9s  %9s  %7s  %s\n", "Resolver", "Depth avg", "Depth max", "Corr(r)", "Flattened")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range results {
+		var sum, n, top int
+		var errs []error
+		for _, s := range r.Samples {
+			if s.Err != nil {
+				errs = append(errs, s.Err)
+				continue
+			}
+			sum += s.Depth
+			n++
+			top = max(top, s.Depth)
+		}
+		avg := "--"
+		if n > 0 {
+			avg = fmt.Sprintf("%.1f", float64(sum)/float64(n))
+		}
+		corr := depthLatencyCorr(r.Samples)
+		flattened := "-"
+		if len(r.Flattened) > 0 {
+			flattened = strings.Join(r.Flattened, ", ")
+		}
+		fmt.Printf("%-12s  %9s  %9d  %7s  %s\n", r.Name, avg, top,
+			ternary(math.IsNaN(corr), "--", fmt.Sprintf("%.2f", corr)), flattened)
+		for _, e := range uniqueErrors(errs) {
+			fmt.Printf("  ! %s\n", e)
+		}
+	}
+
+	fmt.Printf("\nMedian latency by CNAME chain depth\n")
+	fmt.Printf("%-12s", "Resolver")
+	for d := 0; d <= maxDepth; d++ {
+		fmt.Printf("  %7s", fmt.Sprintf("d=%d", d))
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 12+9*(maxDepth+1)))
+	for _, r := range results {
+		fmt.Printf("%-12s", r.Name)
+		for d := 0; d <= maxDepth; d++ {
+			var ms []float64
+			for _, s := range r.Samples {
+				if s.Err == nil && s.Depth == d {
+					ms = append(ms, float64(s.Duration.Microseconds())/1000.0)
+				}
+			}
+			sort.Float64s(ms)
+			fmt.Printf("  %7s", durFmt(time.Duration(bench.Percentile(ms, 50)*float64(time.Millisecond))))
+		}
+		fmt.Println()
+	}
+}
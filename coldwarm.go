@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// printColdWarm prints the paired cache benefit of -cold-warm: for each
+// resolver, group and tag, cold minus warm latency over the pairs of a
+// cold query and the warm one after it.
+func printColdWarm(rows []bench.Result) {
+	all := slices.Concat(rows, bench.CombineGroups(rows), bench.CombineTags(rows))
+	fmt.Printf("\nCache benefit (cold minus warm, paired)\n")
+	fmt.Printf("%-12s  %5s  %8s  %8s  %9s  %18s  %11s\n", "Resolver", "Pairs", "Cold med", "Warm med", "Diff med", "Diff mean ±95%", "Warm faster")
+	fmt.Println(strings.Repeat("-", 88))
+	for _, r := range all {
+		st := bench.SummarizePairs(r.Pairs)
+		if st.Pairs == 0 {
+			fmt.Printf("%-12s  %5d  %8s  %8s  %9s  %18s  %11s\n", r.Name, 0, "--", "--", "--", "--", "--")
+			continue
+		}
+		mean := fmt.Sprintf("%s ±%.1fms", deltaFmt(st.Mean), ms(st.CI95))
+		fmt.Printf("%-12s  %5d  %8s  %8s  %9s  %18s  %10.0f%%\n", r.Name, st.Pairs,
+			durFmt(st.Cold), durFmt(st.Warm), deltaFmt(st.Median), mean, 100*float64(st.WarmFaster)/float64(st.Pairs))
+	}
+}
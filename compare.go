@@ -0,0 +1,234 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// ANSI colors of the compare subcommand.
+const (
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorReset = "\033[0m"
+)
+
+// compareMetric is a line of a resolver's block in the compare view.
+type compareMetric struct {
+	name string
+	// value returns the metric of s and whether it has one.
+	value func(s bench.Stats) (float64, bool)
+	// higherBetter is set for metrics where an increase is an improvement.
+	higherBetter bool
+	format       func(v float64) string
+	delta        func(d float64) string
+	// points compares the metric in absolute points rather than percent.
+	points bool
+}
+
+func latencyMetric(name string, pick func(s bench.Stats) time.Duration) compareMetric {
+	return compareMetric{
+		name: name,
+		value: func(s bench.Stats) (float64, bool) {
+			return float64(pick(s)), s.Successes > 0
+		},
+		format: func(v float64) string { return durFmt(time.Duration(v)) },
+		delta:  func(d float64) string { return deltaFmt(time.Duration(d)) },
+	}
+}
+
+var compareMetrics = []compareMetric{
+	latencyMetric("Median", func(s bench.Stats) time.Duration { return s.Median }),
+	latencyMetric("p95", func(s bench.Stats) time.Duration { return s.P95 }),
+	latencyMetric("p99", func(s bench.Stats) time.Duration { return s.P99 }),
+	latencyMetric("Max", func(s bench.Stats) time.Duration { return s.Max }),
+	{
+		name:         "Success%",
+		value:        func(s bench.Stats) (float64, bool) { return successPct(s), s.Count > 0 },
+		higherBetter: true,
+		format:       func(v float64) string { return fmt.Sprintf("%.1f%%", v) },
+		delta:        func(d float64) string { return fmt.Sprintf("%+.1fpt", d) },
+		points:       true,
+	},
+}
+
+// compareView renders the side-by-side view of two sets of results.
+type compareView struct {
+	color     bool
+	threshold float64 // percent (points for Success%) a change must exceed to count
+	better    int
+	worse     int
+}
+
+// mark returns the arrow and color of a change from a to b of m.
+func (v *compareView) mark(m compareMetric, a, b float64) (string, string) {
+	change := b - a
+	if !m.points && a != 0 {
+		change = 100 * (b - a) / a
+	}
+	if math.Abs(change) <= v.threshold {
+		return "=", ""
+	}
+	arrow := ternary(change > 0, "▲", "▼")
+	if (change > 0) == m.higherBetter {
+		v.better++
+		return arrow, colorGreen
+	}
+	v.worse++
+	return arrow, colorRed
+}
+
+func (v *compareView) paint(color, s string) string {
+	if !v.color || color == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// print shows every resolver of before and after with its metrics side by
+// side, the change of each and an arrow, red for a regression and green
+// for an improvement.
+func (v *compareView) print(beforeName, afterName string, before, after []bench.Result) {
+	afterBy := make(map[string]bench.Stats, len(after))
+	for _, r := range after {
+		afterBy[r.Name] = r.Stats
+	}
+	names := make([]string, 0, len(before)+len(after))
+	beforeBy := make(map[string]bench.Stats, len(before))
+	for _, r := range before {
+		beforeBy[r.Name] = r.Stats
+		names = append(names, r.Name)
+	}
+	for _, r := range after {
+		if _, ok := beforeBy[r.Name]; !ok {
+			names = append(names, r.Name)
+		}
+	}
+
+	cw := max(10, len(beforeName), len(afterName))
+	fmt.Printf("%-12s  %-8s  %*s  %*s  %s\n", "Resolver", "Metric", cw, beforeName, cw, afterName, "Change")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, name := range names {
+		sa, okA := beforeBy[name]
+		sb, okB := afterBy[name]
+		if !okA || !okB {
+			fmt.Printf("%-12s  only in %s\n", name, ternary(okA, beforeName, afterName))
+			continue
+		}
+		for i, m := range compareMetrics {
+			a, hasA := m.value(sa)
+			b, hasB := m.value(sb)
+			cellA, cellB, change := "--", "--", ""
+			if hasA {
+				cellA = m.format(a)
+			}
+			if hasB {
+				cellB = m.format(b)
+			}
+			if hasA && hasB {
+				arrow, color := v.mark(m, a, b)
+				change = m.delta(b - a)
+				if !m.points && a != 0 {
+					change += fmt.Sprintf(" (%+.1f%%)", 100*(b-a)/a)
+				}
+				change = v.paint(color, arrow+" "+change)
+			}
+			fmt.Printf("%-12s  %-8s  %*s  %*s  %s\n", ternary(i == 0, name, ""), m.name, cw, cellA, cw, cellB, change)
+		}
+	}
+	fmt.Printf("\n%s, %s; changes within %g%% (%g points for Success%%) count as unchanged.\n",
+		v.paint(ternary(v.worse > 0, colorRed, ""), fmt.Sprintf("%d regression%s", v.worse, ternary(v.worse == 1, "", "s"))),
+		v.paint(ternary(v.better > 0, colorGreen, ""), fmt.Sprintf("%d improvement%s", v.better, ternary(v.better == 1, "", "s"))),
+		v.threshold, v.threshold)
+}
+
+// combineRuns merges the results of saved runs by resolver name, in the
+// order of first appearance.
+func combineRuns(recs []bench.RunRecord) []bench.Result {
+	var out []bench.Result
+	index := make(map[string]int)
+	for _, rec := range recs {
+		for _, r := range rec.Results() {
+			i, ok := index[r.Name]
+			if !ok {
+				i = len(out)
+				index[r.Name] = i
+				out = append(out, bench.Result{Name: r.Name})
+			}
+			out[i].Samples = append(out[i].Samples, r.Samples...)
+		}
+	}
+	for i := range out {
+		out[i].Stats = bench.Summarize(out[i].Samples)
+	}
+	return out
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorOutput reports whether to color the output for a -color mode: auto
+// colors on a terminal unless NO_COLOR is set.
+func colorOutput(mode string) (bool, error) {
+	switch mode {
+	case "auto":
+		return os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout), nil
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	}
+	return false, fmt.Errorf("Unknown -color %q (want auto, always or never)", mode)
+}
+
+// runCompare implements the compare subcommand.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	colorMode := fs.String("color", "auto", "Color regressions red and improvements green: auto (on a terminal, unless NO_COLOR is set), always or never")
+	threshold := fs.Float64("threshold", 5, "Changes up to this many percent, or points of Success%, count as unchanged")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench compare [-color auto|always|never] [-threshold PCT] BEFORE AFTER\n\n"+
+			"Shows the results of runs saved with -save side by side, with the change\n"+
+			"of every metric. BEFORE and AFTER are saved files or directories, whose\n"+
+			"runs are combined per resolver.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	v := &compareView{threshold: *threshold}
+	var err error
+	if v.color, err = colorOutput(*colorMode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var sides [2][]bench.Result
+	for i, path := range fs.Args() {
+		recs, err := loadRecords([]string{path})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(recs) == 0 {
+			fmt.Fprintf(os.Stderr, "No saved runs found in %s.\n", path)
+			return 1
+		}
+		sides[i] = combineRuns(recs)
+	}
+	fmt.Printf("DNS Benchmark Comparison\n")
+	fmt.Printf("Before: %s | After: %s\n", fs.Arg(0), fs.Arg(1))
+	fmt.Println(strings.Repeat("-", 80))
+	v.print("Before", "After", sides[0], sides[1])
+	return 0
+}
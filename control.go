@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// controlKeep is how many finished runs the control server remembers for
+// GET /api/runs/{id}.
+const controlKeep = 50
+
+// controlRequest is the body of POST /api/runs. Omitted fields take the
+// defaults of the command line flags of the same name.
+type controlRequest struct {
+	Resolvers string `json:"resolvers,omitempty"` // as -resolvers
+	Domain    string `json:"domain,omitempty"`
+	Count     int    `json:"count,omitempty"`
+	Duration  string `json:"duration,omitempty"` // e.g. "30s", replaces count
+	Timeout   string `json:"timeout,omitempty"`
+	QType     string `json:"qtype,omitempty"`
+	Network   string `json:"network,omitempty"`
+	Cold      bool   `json:"cold,omitempty"`
+	Seed      uint64 `json:"seed,omitempty"`
+	Label     string `json:"label,omitempty"` // returned with the run, to tie runs of a fleet together
+}
+
+// runner builds the Runner for a request.
+func (req controlRequest) runner() (*bench.Runner, error) {
+	r := &bench.Runner{
+		Domain: "example.com", Count: 10, Timeout: 1500 * time.Millisecond, Network: "ip4",
+		Cold: req.Cold, Seed: req.Seed,
+	}
+	r.Resolvers = bench.ParseResolvers(ternary(req.Resolvers != "", req.Resolvers, defaultResolvers))
+	if len(r.Resolvers) == 0 {
+		return nil, errors.New("no valid resolvers")
+	}
+	if req.Domain != "" {
+		r.Domain = req.Domain
+	}
+	if req.Count < 0 || req.Count > 0 && req.Duration != "" {
+		return nil, errors.New("count must be positive and cannot be combined with duration")
+	}
+	if req.Count > 0 {
+		r.Count = req.Count
+	}
+	var err error
+	if req.Duration != "" {
+		if r.Duration, err = time.ParseDuration(req.Duration); err != nil || r.Duration <= 0 {
+			return nil, fmt.Errorf("invalid duration %q", req.Duration)
+		}
+	}
+	if req.Timeout != "" {
+		if r.Timeout, err = time.ParseDuration(req.Timeout); err != nil || r.Timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", req.Timeout)
+		}
+	}
+	if req.QType != "" {
+		if r.QType, err = dnsmsg.ParseType(req.QType); err != nil {
+			return nil, err
+		}
+	}
+	switch req.Network {
+	case "", "ip4":
+	case "ip6":
+		r.Network = "ip6"
+	default:
+		return nil, fmt.Errorf("invalid network %q (want ip4 or ip6)", req.Network)
+	}
+	return r, nil
+}
+
+// controlSample is one line of the GET /api/runs/{id}/samples stream.
+type controlSample struct {
+	Resolver string  `json:"resolver"`
+	Index    int     `json:"index"`
+	QName    string  `json:"qname"`
+	Ms       float64 `json:"ms"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// controlRun is a run started through the control API.
+type controlRun struct {
+	ID      string
+	Label   string
+	runner  *bench.Runner
+	started time.Time
+
+	mu      sync.Mutex
+	samples []controlSample
+	done    bool
+	err     error
+	record  *bench.RunRecord
+	changed chan struct{} // closed and replaced on every new sample
+}
+
+func (c *controlRun) add(s controlSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = append(c.samples, s)
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *controlRun) finish(rec *bench.RunRecord, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done, c.record, c.err = true, rec, err
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// controlServer implements the control API: the gRPC service of
+// control.proto (see controlgrpc.go) and, for clients without gRPC,
+// StartRun as POST /api/runs, StreamSamples as GET /api/runs/{id}/samples
+// and GetResults as GET /api/runs/{id}. One run goes at a time, so that
+// runs do not skew each other's latency.
+type controlServer struct {
+	token   string
+	saveDir string
+	ctx     context.Context
+
+	mu      sync.Mutex
+	nextID  int
+	current *controlRun
+	runs    []*controlRun // oldest first
+}
+
+// runServeControl implements the serve-control subcommand.
+func runServeControl(args []string) int {
+	fs := flag.NewFlagSet("serve-control", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8054", "Address to listen on")
+	token := fs.String("token", os.Getenv("DNSBENCH_CONTROL_TOKEN"), "Bearer token clients must send (default $DNSBENCH_CONTROL_TOKEN)")
+	saveDir := fs.String("save", "", "Directory to also save each run to as JSON")
+	anonymize := fs.Bool("anonymize", false, "Replace private IP addresses, this host's name and names under -internal-domains with stable pseudonyms in the samples, results, saved runs and hook events")
+	internalDomains := fs.String("internal-domains", defaultInternalDomains, "Comma-separated domain suffixes whose names -anonymize replaces")
+	setHooks := hookFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench serve-control -token TOKEN [-listen addr] [-save dir]\n\n"+
+			"Runs benchmarks on request from orchestration systems and streams their\n"+
+			"samples, over HTTP with JSON and as the gRPC service in control.proto,\n"+
+			"both on the same address.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *token == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	setHooks()
+	if *anonymize {
+		var err error
+		if exportAnonymizer, err = newAnonymizer(splitList(*internalDomains)); err != nil {
+			fmt.Fprintf(os.Stderr, "Anonymize: %v\n", err)
+			return 1
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s := &controlServer{token: *token, saveDir: *saveDir, ctx: ctx}
+	srv := &http.Server{Addr: *listen, Handler: s.handler()}
+	// gRPC clients speak HTTP/2 without TLS, with prior knowledge.
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	fmt.Printf("Control API on http://%s\n", *listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		slog.Error("control server failed", "err", err)
+		return 1
+	}
+	return 0
+}
+
+func (s *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/runs", s.handleStart)
+	mux.HandleFunc("GET /api/runs/{id}", s.handleResults)
+	mux.HandleFunc("GET /api/runs/{id}/samples", s.handleSamples)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPC(r) {
+			s.serveGRPC(w, r)
+			return
+		}
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether r carries the bearer token of the server.
+func (s *controlServer) authorized(r *http.Request) bool {
+	got := []byte(r.Header.Get("Authorization"))
+	return subtle.ConstantTimeCompare(got, []byte("Bearer "+s.token)) == 1
+}
+
+// handleStart starts a run and answers 202 with its ID, or 409 while
+// another run is in progress.
+func (s *controlServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	var req controlRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	runner, err := req.runner()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	run, err := s.start(runner, req.Label)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, map[string]string{"id": run.ID})
+}
+
+// errRunInProgress is returned by start while another run is in progress.
+type errRunInProgress string
+
+func (e errRunInProgress) Error() string { return "run " + string(e) + " is in progress" }
+
+// start starts a run of runner, unless another one is in progress.
+func (s *controlServer) start(runner *bench.Runner, label string) (*controlRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		return nil, errRunInProgress(s.current.ID)
+	}
+	s.nextID++
+	run := &controlRun{
+		ID: strconv.Itoa(s.nextID), Label: label, runner: runner,
+		started: time.Now(), changed: make(chan struct{}),
+	}
+	s.current = run
+	s.runs = append(s.runs, run)
+	if len(s.runs) > controlKeep {
+		s.runs = s.runs[1:]
+	}
+	go s.run(run)
+	return run, nil
+}
+
+func (s *controlServer) run(run *controlRun) {
+	slog.Info("control run started", "id", run.ID, "label", run.Label, "resolvers", len(run.runner.Resolvers))
+	resolveServerHosts(run.runner.Resolvers, false, run.runner.Timeout)
+	rows, err := runHooks.Run(s.ctx, run.runner, func(e bench.Event) {
+		if e.Kind != bench.EventSample {
+			return
+		}
+		a := exportAnonymizer
+		cs := controlSample{Resolver: a.Text(e.Resolver.Name), Index: e.Index, QName: a.Text(e.QName), Ms: ms(e.Sample.Duration)}
+		if e.Sample.Err != nil {
+			cs.Error = a.Text(e.Sample.Err.Error())
+		}
+		run.add(cs)
+	})
+	rec := bench.NewRunRecord(run.runner, run.started, rows)
+	exportAnonymizer.Record(&rec)
+	if err == nil && s.saveDir != "" {
+		_, err = saveRun(s.saveDir, run.runner, run.started, rows)
+	}
+	run.finish(&rec, exportAnonymizer.err(err))
+	slog.Info("control run finished", "id", run.ID, "err", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = nil
+}
+
+func (s *controlServer) lookup(id string) *controlRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs {
+		if run.ID == id {
+			return run
+		}
+	}
+	return nil
+}
+
+// handleResults returns the state of a run and, once it is done, its
+// results in the format of -save.
+func (s *controlServer) handleResults(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(r.PathValue("id"))
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+	state, samples, record, err := run.status()
+	out := map[string]any{
+		"id": run.ID, "label": run.Label, "started": run.started,
+		"state": state, "samples": samples,
+	}
+	if state != "running" {
+		out["run"] = record
+	}
+	if err != nil {
+		out["error"] = err.Error()
+	}
+	writeJSON(w, out)
+}
+
+// status returns the state of the run, "running", "done" or "failed", its
+// sample count so far and, once it is done, its record or error.
+func (c *controlRun) status() (state string, samples int, record *bench.RunRecord, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case !c.done:
+		return "running", len(c.samples), nil, nil
+	case c.err != nil:
+		return "failed", len(c.samples), c.record, c.err
+	}
+	return "done", len(c.samples), c.record, nil
+}
+
+// handleSamples streams the samples of a run as JSON lines, from the first
+// one, as they are measured, and ends when the run is done.
+func (s *controlServer) handleSamples(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(r.PathValue("id"))
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	run.follow(r.Context(), func(cs controlSample) error { return enc.Encode(cs) }, func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+}
+
+// follow calls send with each sample of the run, from the first one, as
+// they are measured, and flush after each batch, until the run is done,
+// send fails or ctx is done.
+func (c *controlRun) follow(ctx context.Context, send func(controlSample) error, flush func()) error {
+	sent := 0
+	for {
+		c.mu.Lock()
+		pending := c.samples[sent:]
+		done, changed := c.done, c.changed
+		c.mu.Unlock()
+		for _, cs := range pending {
+			if err := send(cs); err != nil {
+				return err
+			}
+		}
+		sent += len(pending)
+		flush()
+		if done {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The gRPC service of serve-control, described in control.proto. It is
+// served with the standard library alone: HTTP/2 without TLS, gRPC's
+// length-prefixed framing and just enough Protocol Buffers encoding for
+// the messages of the service.
+
+// grpcService is the path prefix of the methods of the service.
+const grpcService = "/dnsbench.control.v1.Control/"
+
+// gRPC status codes used by the service.
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnauthenticated    = 16
+)
+
+// grpcMaxMessage bounds the request messages the server reads.
+const grpcMaxMessage = 1 << 16
+
+// grpcError is an error with its gRPC status code.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+// isGRPC reports whether r is a gRPC call.
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// serveGRPC answers a gRPC call: StartRun, StreamSamples or GetResults.
+func (s *controlServer) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	err := s.callGRPC(w, r)
+	code, msg := grpcOK, ""
+	if err != nil {
+		code, msg = grpcInternal, err.Error()
+		var ge *grpcError
+		if errors.As(err, &ge) {
+			code = ge.code
+		}
+	}
+	// The status goes in the trailers, or in the headers of a call that
+	// failed before any reply was written.
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(msg))
+	}
+}
+
+func (s *controlServer) callGRPC(w http.ResponseWriter, r *http.Request) error {
+	if !s.authorized(r) {
+		return &grpcError{grpcUnauthenticated, "missing or wrong bearer token"}
+	}
+	method, ok := strings.CutPrefix(r.URL.Path, grpcService)
+	if !ok || r.Method != http.MethodPost {
+		return &grpcError{grpcUnimplemented, "unknown method " + r.URL.Path}
+	}
+	in, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return err
+	}
+	switch method {
+	case "StartRun":
+		var req controlRequest
+		if err := decodeStartRun(in, &req); err != nil {
+			return err
+		}
+		runner, err := req.runner()
+		if err != nil {
+			return &grpcError{grpcInvalidArgument, err.Error()}
+		}
+		run, err := s.start(runner, req.Label)
+		if err != nil {
+			return &grpcError{grpcFailedPrecondition, err.Error()}
+		}
+		return writeGRPCMessage(w, pbString(nil, 1, run.ID))
+	case "StreamSamples":
+		run, err := s.lookupGRPC(in)
+		if err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		return run.follow(r.Context(), func(cs controlSample) error {
+			return writeGRPCMessage(w, encodeSample(cs))
+		}, func() {
+			if flusher != nil {
+				flusher.Flush()
+			}
+		})
+	case "GetResults":
+		run, err := s.lookupGRPC(in)
+		if err != nil {
+			return err
+		}
+		state, samples, record, runErr := run.status()
+		out := pbString(nil, 1, run.ID)
+		out = pbString(out, 2, run.Label)
+		out = pbString(out, 3, state)
+		out = pbVarint(out, 4, uint64(samples))
+		if runErr != nil {
+			out = pbString(out, 5, runErr.Error())
+		}
+		if record != nil {
+			b, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			out = pbString(out, 6, string(b))
+		}
+		out = pbString(out, 7, run.started.Format(time.RFC3339Nano))
+		return writeGRPCMessage(w, out)
+	}
+	return &grpcError{grpcUnimplemented, "unknown method " + r.URL.Path}
+}
+
+// lookupGRPC returns the run named by a StreamSamplesRequest or
+// GetResultsRequest.
+func (s *controlServer) lookupGRPC(in []byte) (*controlRun, error) {
+	var id string
+	err := pbFields(in, func(field int, _ uint64, data []byte) {
+		if field == 1 {
+			id = string(data)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	run := s.lookup(id)
+	if run == nil {
+		return nil, &grpcError{grpcNotFound, "no run " + strconv.Quote(id)}
+	}
+	return run, nil
+}
+
+// decodeStartRun decodes a StartRunRequest into req.
+func decodeStartRun(in []byte, req *controlRequest) error {
+	return pbFields(in, func(field int, v uint64, data []byte) {
+		switch field {
+		case 1:
+			req.Resolvers = string(data)
+		case 2:
+			req.Domain = string(data)
+		case 3:
+			req.Count = int(int32(v))
+		case 4:
+			req.Duration = string(data)
+		case 5:
+			req.Timeout = string(data)
+		case 6:
+			req.QType = string(data)
+		case 7:
+			req.Network = string(data)
+		case 8:
+			req.Cold = v != 0
+		case 9:
+			req.Seed = v
+		case 10:
+			req.Label = string(data)
+		}
+	})
+}
+
+// encodeSample encodes a Sample message.
+func encodeSample(cs controlSample) []byte {
+	b := pbString(nil, 1, cs.Resolver)
+	b = pbVarint(b, 2, uint64(cs.Index))
+	b = pbString(b, 3, cs.QName)
+	if cs.Ms != 0 {
+		b = binary.AppendUvarint(b, 4<<3|pbFixed64)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(cs.Ms))
+	}
+	return pbString(b, 5, cs.Error)
+}
+
+// readGRPCMessage reads the single, uncompressed message of a unary or
+// server streaming call.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading request: " + err.Error()}
+	}
+	if hdr[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed requests are not supported"}
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > grpcMaxMessage {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Sprintf("request of %d bytes is too large", n)}
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading request: " + err.Error()}
+	}
+	return msg, nil
+}
+
+// writeGRPCMessage writes msg with its gRPC length prefix.
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	_, err := w.Write(append(b, msg...))
+	return err
+}
+
+// Protocol Buffers wire types.
+const (
+	pbVarintType = 0
+	pbFixed64    = 1
+	pbBytes      = 2
+	pbFixed32    = 5
+)
+
+// pbVarint appends a varint field, omitted when zero as in proto3.
+func pbVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|pbVarintType)
+	return binary.AppendUvarint(b, v)
+}
+
+// pbString appends a string field, omitted when empty as in proto3.
+func pbString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|pbBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// pbFields calls f with each field of the message in b: its number and
+// either its value, for varint and fixed fields, or its data, for length
+// delimited ones.
+func pbFields(b []byte, f func(field int, v uint64, data []byte)) error {
+	malformed := &grpcError{grpcInvalidArgument, "malformed request message"}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 || tag>>3 == 0 {
+			return malformed
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case pbVarintType:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return malformed
+			}
+			b = b[n:]
+			f(field, v, nil)
+		case pbFixed64:
+			if len(b) < 8 {
+				return malformed
+			}
+			f(field, binary.LittleEndian.Uint64(b), nil)
+			b = b[8:]
+		case pbBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return malformed
+			}
+			f(field, 0, b[n:n+int(l)])
+			b = b[n+int(l):]
+		case pbFixed32:
+			if len(b) < 4 {
+				return malformed
+			}
+			f(field, uint64(binary.LittleEndian.Uint32(b)), nil)
+			b = b[4:]
+		default:
+			return malformed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// CSV layouts of -out: mixed is the summary and sample tables in one file,
+// long a single tidy table with one row per sample, and split the summary
+// and that table in two files.
+const (
+	csvMixed = "mixed"
+	csvLong  = "long"
+	csvSplit = "split"
+)
+
+// writeResults writes the results of a run for -out and returns the files
+// written: an Excel workbook for a .xlsx path, a Parquet file for a
+// .parquet path, else CSV in the given layout.
+func writeResults(path, layout string, runner *bench.Runner, started time.Time, rows []bench.Result) ([]string, error) {
+	if layout == csvMixed && !isXLSX(path) && !isParquet(path) {
+		return []string{path}, writeCSV(path, rows)
+	}
+	rec := bench.NewRunRecord(runner, started, rows)
+	exportAnonymizer.Record(&rec)
+	switch {
+	case isXLSX(path):
+		return []string{path}, writeXLSX(path, rec)
+	case isParquet(path):
+		return []string{path}, writeParquet(path, []bench.RunRecord{rec})
+	}
+	if layout == csvLong {
+		return []string{path}, writeCSVFile(path, func(w *csv.Writer) error { return writeSamplesTable(w, rec) })
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	summary, samples := base+"-summary.csv", base+"-samples.csv"
+	if err := writeCSVFile(summary, func(w *csv.Writer) error { return writeSummaryTable(w, rec) }); err != nil {
+		return nil, err
+	}
+	return []string{summary, samples}, writeCSVFile(samples, func(w *csv.Writer) error { return writeSamplesTable(w, rec) })
+}
+
+func isXLSX(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xlsx")
+}
+
+func writeCSVFile(path string, write func(*csv.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := write(w); err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// runColumns are the columns of the tidy tables that identify the run, so
+// that files of several runs and hosts can be concatenated.
+var runColumns = []string{"started", "host", "domain", "network", "qtype", "cold"}
+
+func runValues(rec bench.RunRecord) []string {
+	return []string{
+		rec.Started.UTC().Format(time.RFC3339),
+		rec.Host,
+		rec.Domain,
+		rec.Network,
+		rec.QType,
+		strconv.FormatBool(rec.Cold),
+	}
+}
+
+// versionColumns close every row of the tidy tables, in place of the
+// version section of the mixed layout.
+var versionColumns = []string{"tool", "schema_version"}
+
+func versionValues() []string {
+	return []string{bench.Tool, strconv.Itoa(bench.RecordVersion)}
+}
+
+// writeSamplesTable writes one row per sample.
+func writeSamplesTable(w *csv.Writer, rec bench.RunRecord) error {
+	header := append(append([]string{}, runColumns...),
+		"resolver", "group", "run_index", "duration_ms", "success", "error", "ttfb_ms", "rtt_ms", "bytes", "queries", "src_port", "id")
+	if err := w.Write(append(header, versionColumns...)); err != nil {
+		return err
+	}
+	run := runValues(rec)
+	for _, rr := range rec.Resolvers {
+		for i, s := range rr.Samples {
+			row := append(append([]string{}, run...),
+				rr.Name,
+				rr.Group,
+				strconv.Itoa(i),
+				fmt.Sprintf("%.3f", s.Ms),
+				strconv.FormatBool(s.Error == ""),
+				s.Error,
+				optionalMs(s.TTFBMs),
+				optionalMs(s.RTTMs),
+				strconv.Itoa(s.Bytes),
+				strconv.Itoa(max(s.Queries, 1)),
+				optionalInt(s.SrcPort),
+				strconv.Itoa(int(s.ID)),
+			)
+			if err := w.Write(append(row, versionValues()...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeSummaryTable writes one row per resolver.
+func writeSummaryTable(w *csv.Writer, rec bench.RunRecord) error {
+	header := append(append([]string{}, runColumns...),
+		"resolver", "group", "count", "successes", "min_ms", "avg_ms", "median_ms", "p95_ms", "max_ms", "errors")
+	if err := w.Write(append(header, versionColumns...)); err != nil {
+		return err
+	}
+	run := runValues(rec)
+	for _, r := range rec.Results() {
+		s := r.Stats
+		row := append(append([]string{}, run...),
+			r.Name,
+			r.Group,
+			strconv.Itoa(s.Count),
+			strconv.Itoa(s.Successes),
+			optionalMs(ms(s.Min)),
+			optionalMs(ms(s.Avg)),
+			optionalMs(ms(s.Median)),
+			optionalMs(ms(s.P95)),
+			optionalMs(ms(s.Max)),
+			strings.Join(errorStrings(uniqueErrors(s.Errors)), " | "),
+		)
+		if err := w.Write(append(row, versionValues()...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionalMs formats milliseconds, leaving zero, which stands for no value,
+// empty so that data frames read it as missing.
+func optionalMs(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.3f", v)
+}
+
+// optionalInt formats a count the same way, empty for zero.
+func optionalInt(v int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
@@ -0,0 +1,115 @@
+package dnscrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// esXChaCha20Poly1305 is the only encryption system implemented here.
+// es-version 1 (XSalsa20-Poly1305) certificates are ignored.
+const esXChaCha20Poly1305 = 0x0002
+
+var certMagic = []byte("DNSC")
+
+// Cert is a verified resolver certificate.
+type Cert struct {
+	ESVersion   uint16
+	ResolverPK  [32]byte
+	ClientMagic [8]byte
+	Serial      uint32
+	NotBefore   time.Time
+	NotAfter    time.Time
+}
+
+// FetchCert queries the provider's certificates (a TXT lookup of the
+// provider name sent in the clear) and returns the newest valid one signed by
+// the provider key that uses a supported encryption system.
+func (c *Client) FetchCert(ctx context.Context) (Cert, error) {
+	wire, err := dnsmsg.NewQuery(c.ProviderName, dnsmsg.TypeTXT).Pack()
+	if err != nil {
+		return Cert{}, err
+	}
+	raw, err := c.roundTrip(ctx, "udp", wire)
+	if err != nil {
+		return Cert{}, fmt.Errorf("dnscrypt: fetching certificate: %w", err)
+	}
+	resp, err := dnsmsg.Unpack(raw)
+	if err != nil {
+		return Cert{}, fmt.Errorf("dnscrypt: fetching certificate: %w", err)
+	}
+	if resp.RCode != dnsmsg.RCodeSuccess {
+		return Cert{}, fmt.Errorf("dnscrypt: fetching certificate: rcode %s", resp.RCode)
+	}
+	var best Cert
+	var found bool
+	var reasons []string
+	now := time.Now()
+	for _, rr := range resp.Answers {
+		if rr.Type != dnsmsg.TypeTXT {
+			continue
+		}
+		parts, err := rr.TXT()
+		if err != nil {
+			continue
+		}
+		cert, err := parseCert([]byte(strings.Join(parts, "")), c.ServerPK, now)
+		if err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		if !found || cert.Serial > best.Serial {
+			best, found = cert, true
+		}
+	}
+	if !found {
+		if len(reasons) == 0 {
+			reasons = append(reasons, "no certificates published")
+		}
+		return Cert{}, fmt.Errorf("dnscrypt: no usable certificate: %s", strings.Join(uniq(reasons), "; "))
+	}
+	return best, nil
+}
+
+func parseCert(b []byte, serverPK ed25519.PublicKey, now time.Time) (Cert, error) {
+	var c Cert
+	if len(b) < 124 || !bytes.Equal(b[:4], certMagic) {
+		return c, errors.New("malformed certificate")
+	}
+	c.ESVersion = binary.BigEndian.Uint16(b[4:])
+	if c.ESVersion != esXChaCha20Poly1305 {
+		return c, fmt.Errorf("unsupported es-version %d (only XChaCha20-Poly1305 is implemented)", c.ESVersion)
+	}
+	sig, signed := b[8:72], b[72:]
+	if !ed25519.Verify(serverPK, signed, sig) {
+		return c, errors.New("bad certificate signature")
+	}
+	copy(c.ResolverPK[:], b[72:104])
+	copy(c.ClientMagic[:], b[104:112])
+	c.Serial = binary.BigEndian.Uint32(b[112:])
+	c.NotBefore = time.Unix(int64(binary.BigEndian.Uint32(b[116:])), 0)
+	c.NotAfter = time.Unix(int64(binary.BigEndian.Uint32(b[120:])), 0)
+	if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+		return c, errors.New("certificate outside its validity period")
+	}
+	return c, nil
+}
+
+func uniq(in []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
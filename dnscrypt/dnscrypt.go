@@ -0,0 +1,324 @@
+// Package dnscrypt implements a DNSCrypt v2 client transport
+// (https://dnscrypt.info/protocol) using the XChaCha20-Poly1305 encryption
+// system. Importing the package registers it with the transport package, so
+// resolvers given as sdns:// DNSCrypt stamps can be benchmarked like any
+// other address. Appending "?relay=" and a relay stamp or host:port routes
+// the queries through an Anonymized DNSCrypt relay.
+package dnscrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/stamp"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+func init() {
+	transport.Register("dnscrypt", func(addr string) (transport.Transport, error) {
+		st, err := stamp.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		if st.Proto != stamp.ProtoDNSCrypt {
+			return nil, errors.New("dnscrypt: not a DNSCrypt stamp")
+		}
+		c, err := New(st.Addr, ed25519.PublicKey(st.ServerPK), st.ProviderName)
+		if err != nil {
+			return nil, err
+		}
+		if _, query, ok := strings.Cut(addr, "?"); ok {
+			params, err := url.ParseQuery(query)
+			if err != nil {
+				return nil, err
+			}
+			if relay := params.Get("relay"); relay != "" {
+				if c.Relay, err = relayAddr(relay); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return c, nil
+	})
+}
+
+const (
+	halfNonceSize = nonceSize / 2
+	minUDPQuery   = 256
+	padBlock      = 64
+)
+
+var (
+	resolverMagic = []byte{0x72, 0x36, 0x66, 0x6e, 0x76, 0x57, 0x6a, 0x38}
+	anonMagic     = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00}
+
+	errShortResponse = errors.New("dnscrypt: response too short")
+	errBadMagic      = errors.New("dnscrypt: bad resolver magic")
+	errNonceMismatch = errors.New("dnscrypt: response nonce mismatch")
+	errBadPadding    = errors.New("dnscrypt: bad response padding")
+)
+
+// Client is a DNSCrypt transport to one resolver. The certificate is
+// fetched on first use and whenever it expires, so the first query of a run
+// includes that extra round trip, much like a TLS handshake. If Relay is
+// set, all packets (certificate fetches included) travel through that
+// Anonymized DNSCrypt relay.
+type Client struct {
+	Addr         string // host:port
+	ServerPK     ed25519.PublicKey
+	ProviderName string
+	Relay        string // optional relay host:port
+
+	key *ecdh.PrivateKey
+
+	mu        sync.Mutex
+	cert      Cert
+	sharedKey [keySize]byte
+}
+
+// relayAddr resolves a relay given as a DNSCrypt relay stamp or host[:port].
+func relayAddr(relay string) (string, error) {
+	if strings.HasPrefix(relay, "sdns://") {
+		st, err := stamp.Parse(relay)
+		if err != nil {
+			return "", err
+		}
+		if st.Proto != stamp.ProtoDNSCryptRelay {
+			return "", fmt.Errorf("dnscrypt: relay stamp is a %s stamp", st.Proto)
+		}
+		return st.Addr, nil
+	}
+	return transport.HostPort(relay, "443"), nil
+}
+
+// New returns a DNSCrypt client with a fresh ephemeral key pair.
+func New(addr string, serverPK ed25519.PublicKey, providerName string) (*Client, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Addr: addr, ServerPK: serverPK, ProviderName: providerName, key: key}, nil
+}
+
+// SendQuery implements transport.Transport. Queries go over UDP and are
+// retried over TCP when the resolver signals truncation.
+func (c *Client) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	cert, shared, err := c.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.exchange(ctx, "udp", cert, &shared, msg)
+	if err == nil && resp.Truncated {
+		resp, err = c.exchange(ctx, "tcp", cert, &shared, msg)
+	}
+	return resp, err
+}
+
+// session returns the current certificate and the shared key derived from
+// it, fetching a new certificate if needed.
+func (c *Client) session(ctx context.Context) (Cert, [keySize]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.cert.NotAfter.IsZero() && time.Now().Before(c.cert.NotAfter) {
+		return c.cert, c.sharedKey, nil
+	}
+	cert, err := c.FetchCert(ctx)
+	if err != nil {
+		return Cert{}, [keySize]byte{}, err
+	}
+	pub, err := ecdh.X25519().NewPublicKey(cert.ResolverPK[:])
+	if err != nil {
+		return Cert{}, [keySize]byte{}, err
+	}
+	dh, err := c.key.ECDH(pub)
+	if err != nil {
+		return Cert{}, [keySize]byte{}, err
+	}
+	var zero [16]byte
+	c.cert = cert
+	c.sharedKey = hchacha20((*[keySize]byte)(dh), &zero)
+	return c.cert, c.sharedKey, nil
+}
+
+func (c *Client) exchange(ctx context.Context, network string, cert Cert, shared *[keySize]byte, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	plain, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:halfNonceSize]); err != nil {
+		return nil, err
+	}
+	minLen := 0
+	if network == "udp" {
+		minLen = minUDPQuery
+	}
+	packet := make([]byte, 0, 8+32+halfNonceSize+tagSize+len(plain)+padBlock)
+	packet = append(packet, cert.ClientMagic[:]...)
+	packet = append(packet, c.key.PublicKey().Bytes()...)
+	packet = append(packet, nonce[:halfNonceSize]...)
+	packet = append(packet, seal(shared, &nonce, pad(plain, minLen))...)
+
+	raw, err := c.roundTrip(ctx, network, packet)
+	if err != nil {
+		return nil, err
+	}
+	respWire, err := decryptResponse(raw, shared, nonce[:halfNonceSize])
+	if err != nil {
+		return nil, err
+	}
+	server := serverAddr(c.Addr)
+	transport.Observe(ctx, nil, server, plain)
+	transport.Observe(ctx, server, nil, respWire)
+	resp, err := dnsmsg.Unpack(respWire)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ID != msg.ID {
+		return nil, errors.New("dnscrypt: response ID mismatch")
+	}
+	trace := transport.ContextTrace(ctx)
+	if trace.WroteQuery != nil {
+		trace.WroteQuery(nil, server, plain)
+	}
+	if trace.GotResponse != nil {
+		trace.GotResponse(respWire)
+	}
+	return resp, nil
+}
+
+// serverAddr returns the server address for transport taps, or nil when it
+// is not a literal IP.
+func serverAddr(hostport string) net.Addr {
+	ap, err := netip.ParseAddrPort(hostport)
+	if err != nil {
+		return nil
+	}
+	return net.UDPAddrFromAddrPort(ap)
+}
+
+// roundTrip sends packet to the server, or through the relay when one is
+// configured, and returns the raw reply.
+func (c *Client) roundTrip(ctx context.Context, network string, packet []byte) ([]byte, error) {
+	target := c.Addr
+	if c.Relay != "" {
+		hdr, err := relayHeader(c.Addr)
+		if err != nil {
+			return nil, err
+		}
+		packet = append(hdr, packet...)
+		target = c.Relay
+	}
+
+	conn, err := transport.DialContext(ctx, network, target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(packet)))
+	if _, err := conn.Write(append(framed, packet...)); err != nil {
+		return nil, err
+	}
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// relayHeader builds the Anonymized DNSCrypt prefix telling a relay which
+// server to forward to: anon magic, the server IP as 16 bytes, and its port.
+func relayHeader(server string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("dnscrypt: relaying needs a server IP, got %q", host)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	hdr := append([]byte{}, anonMagic...)
+	hdr = append(hdr, ip.To16()...)
+	return binary.BigEndian.AppendUint16(hdr, uint16(port)), nil
+}
+
+// decryptResponse opens a response and returns the DNS message it carries.
+func decryptResponse(raw []byte, shared *[keySize]byte, clientNonce []byte) ([]byte, error) {
+	if len(raw) < len(resolverMagic)+nonceSize+tagSize {
+		return nil, errShortResponse
+	}
+	if !bytes.Equal(raw[:len(resolverMagic)], resolverMagic) {
+		return nil, errBadMagic
+	}
+	raw = raw[len(resolverMagic):]
+	var nonce [nonceSize]byte
+	copy(nonce[:], raw[:nonceSize])
+	if !bytes.Equal(nonce[:halfNonceSize], clientNonce) {
+		return nil, errNonceMismatch
+	}
+	padded, err := open(shared, &nonce, raw[nonceSize:])
+	if err != nil {
+		return nil, err
+	}
+	return unpad(padded)
+}
+
+// pad applies ISO/IEC 7816-4 padding up to a multiple of 64 bytes and at
+// least minLen bytes.
+func pad(b []byte, minLen int) []byte {
+	n := (len(b) + 1 + padBlock - 1) / padBlock * padBlock
+	n = max(n, minLen)
+	out := make([]byte, n)
+	copy(out, b)
+	out[len(b)] = 0x80
+	return out
+}
+
+func unpad(b []byte) ([]byte, error) {
+	i := len(b) - 1
+	for i >= 0 && b[i] == 0 {
+		i--
+	}
+	if i < 0 || b[i] != 0x80 {
+		return nil, errBadPadding
+	}
+	return b[:i], nil
+}
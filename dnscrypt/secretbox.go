@@ -0,0 +1,169 @@
+package dnscrypt
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"math/bits"
+)
+
+// This file implements crypto_secretbox_xchacha20poly1305 as used by
+// DNSCrypt es-version 2: HChaCha20 derives a subkey from the first 16
+// nonce bytes, the first 32 bytes of the ChaCha20 keystream become the
+// one-time Poly1305 key, the message is encrypted from keystream offset 32,
+// and the 16-byte tag is prepended to the ciphertext.
+
+const (
+	keySize   = 32
+	nonceSize = 24
+	tagSize   = 16
+)
+
+var errOpen = errors.New("dnscrypt: message authentication failed")
+
+// seal encrypts and authenticates message, returning tag || ciphertext.
+func seal(key *[keySize]byte, nonce *[nonceSize]byte, message []byte) []byte {
+	ks := xchachaKeyStream(key, nonce, 32+len(message))
+	out := make([]byte, tagSize+len(message))
+	ct := out[tagSize:]
+	subtle.XORBytes(ct, message, ks[32:])
+	tag := poly1305(ks[:32], ct)
+	copy(out, tag[:])
+	return out
+}
+
+// open verifies and decrypts a box produced by seal.
+func open(key *[keySize]byte, nonce *[nonceSize]byte, box []byte) ([]byte, error) {
+	if len(box) < tagSize {
+		return nil, errOpen
+	}
+	ct := box[tagSize:]
+	ks := xchachaKeyStream(key, nonce, 32+len(ct))
+	tag := poly1305(ks[:32], ct)
+	if subtle.ConstantTimeCompare(tag[:], box[:tagSize]) != 1 {
+		return nil, errOpen
+	}
+	out := make([]byte, len(ct))
+	subtle.XORBytes(out, ct, ks[32:])
+	return out, nil
+}
+
+// xchachaKeyStream returns n bytes of XChaCha20 keystream (original
+// 64-bit-nonce ChaCha20 keyed with the HChaCha20 subkey, counter from 0).
+func xchachaKeyStream(key *[keySize]byte, nonce *[nonceSize]byte, n int) []byte {
+	subkey := hchacha20(key, (*[16]byte)(nonce[:16]))
+	var state [16]uint32
+	initState(&state, &subkey)
+	state[14] = binary.LittleEndian.Uint32(nonce[16:])
+	state[15] = binary.LittleEndian.Uint32(nonce[20:])
+
+	out := make([]byte, 0, n+64)
+	var block [16]uint32
+	for counter := uint64(0); len(out) < n; counter++ {
+		state[12] = uint32(counter)
+		state[13] = uint32(counter >> 32)
+		block = state
+		chachaRounds(&block)
+		for i := range block {
+			out = binary.LittleEndian.AppendUint32(out, block[i]+state[i])
+		}
+	}
+	return out[:n]
+}
+
+// hchacha20 derives a 256-bit subkey from key and a 128-bit input.
+func hchacha20(key *[keySize]byte, in *[16]byte) [keySize]byte {
+	var state [16]uint32
+	initState(&state, key)
+	for i := 0; i < 4; i++ {
+		state[12+i] = binary.LittleEndian.Uint32(in[4*i:])
+	}
+	chachaRounds(&state)
+	var out [keySize]byte
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(out[4*i:], state[i])
+		binary.LittleEndian.PutUint32(out[16+4*i:], state[12+i])
+	}
+	return out
+}
+
+func initState(s *[16]uint32, key *[keySize]byte) {
+	s[0], s[1], s[2], s[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		s[4+i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+}
+
+// chachaRounds applies the 20 ChaCha rounds in place.
+func chachaRounds(s *[16]uint32) {
+	qr := func(a, b, c, d int) {
+		s[a] += s[b]
+		s[d] = bits.RotateLeft32(s[d]^s[a], 16)
+		s[c] += s[d]
+		s[b] = bits.RotateLeft32(s[b]^s[c], 12)
+		s[a] += s[b]
+		s[d] = bits.RotateLeft32(s[d]^s[a], 8)
+		s[c] += s[d]
+		s[b] = bits.RotateLeft32(s[b]^s[c], 7)
+	}
+	for i := 0; i < 10; i++ {
+		qr(0, 4, 8, 12)
+		qr(1, 5, 9, 13)
+		qr(2, 6, 10, 14)
+		qr(3, 7, 11, 15)
+		qr(0, 5, 10, 15)
+		qr(1, 6, 11, 12)
+		qr(2, 7, 8, 13)
+		qr(3, 4, 9, 14)
+	}
+}
+
+var (
+	poly1305P    = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 130), big.NewInt(5))
+	poly1305Mod  = new(big.Int).Lsh(big.NewInt(1), 128)
+	poly1305Mask = [16]byte{
+		0xff, 0xff, 0xff, 0x0f, 0xfc, 0xff, 0xff, 0x0f,
+		0xfc, 0xff, 0xff, 0x0f, 0xfc, 0xff, 0xff, 0x0f,
+	}
+)
+
+// poly1305 computes the one-time authenticator of msg (RFC 8439 section
+// 2.5). DNS messages are small, so clarity wins over a limb-based
+// implementation.
+func poly1305(key []byte, msg []byte) [tagSize]byte {
+	var rb [16]byte
+	for i := range rb {
+		rb[i] = key[i] & poly1305Mask[i]
+	}
+	r := leInt(rb[:])
+	s := leInt(key[16:32])
+	acc := new(big.Int)
+	for len(msg) > 0 {
+		n := min(16, len(msg))
+		block := make([]byte, n+1)
+		copy(block, msg[:n])
+		block[n] = 1
+		acc.Add(acc, leInt(block))
+		acc.Mul(acc, r)
+		acc.Mod(acc, poly1305P)
+		msg = msg[n:]
+	}
+	acc.Add(acc, s)
+	acc.Mod(acc, poly1305Mod)
+	var tag [tagSize]byte
+	be := acc.FillBytes(make([]byte, tagSize))
+	for i := range tag {
+		tag[i] = be[tagSize-1-i]
+	}
+	return tag
+}
+
+// leInt interprets b as a little-endian unsigned integer.
+func leInt(b []byte) *big.Int {
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
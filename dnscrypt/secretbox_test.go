@@ -0,0 +1,160 @@
+package dnscrypt
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const sunscreen = "Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it."
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// counting returns n bytes counting up from first.
+func counting(first byte, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = first + byte(i)
+	}
+	return b
+}
+
+// ietfKeyStream returns n bytes of the RFC 8439 ChaCha20 keystream for a
+// 96-bit nonce, starting at block counter.
+func ietfKeyStream(key *[keySize]byte, nonce []byte, counter uint32, n int) []byte {
+	var state [16]uint32
+	initState(&state, key)
+	for i := 0; i < 3; i++ {
+		state[13+i] = binary.LittleEndian.Uint32(nonce[4*i:])
+	}
+	var out []byte
+	for ; len(out) < n; counter++ {
+		state[12] = counter
+		block := state
+		chachaRounds(&block)
+		for i := range block {
+			out = binary.LittleEndian.AppendUint32(out, block[i]+state[i])
+		}
+	}
+	return out[:n]
+}
+
+// aeadSeal is the RFC 8439 section 2.8 AEAD, built from the primitives
+// under test.
+func aeadSeal(key *[keySize]byte, nonce, aad, plaintext []byte) (ct []byte, tag [tagSize]byte) {
+	otk := ietfKeyStream(key, nonce, 0, 32)
+	ct = make([]byte, len(plaintext))
+	subtle.XORBytes(ct, plaintext, ietfKeyStream(key, nonce, 1, len(plaintext)))
+	pad := func(b []byte) []byte { return append(b, make([]byte, (16-len(b)%16)%16)...) }
+	mac := pad(append([]byte(nil), aad...))
+	mac = pad(append(mac, ct...))
+	mac = binary.LittleEndian.AppendUint64(mac, uint64(len(aad)))
+	mac = binary.LittleEndian.AppendUint64(mac, uint64(len(ct)))
+	return ct, poly1305(otk, mac)
+}
+
+func TestPoly1305(t *testing.T) {
+	// RFC 8439 section 2.5.2.
+	key := unhex(t, "85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b")
+	tag := poly1305(key, []byte("Cryptographic Forum Research Group"))
+	if want := unhex(t, "a8061dc1305136c6c22b8baf0c0127a9"); !bytes.Equal(tag[:], want) {
+		t.Errorf("tag = %x, want %x", tag, want)
+	}
+}
+
+func TestChaCha20Poly1305(t *testing.T) {
+	// RFC 8439 section 2.8.2.
+	key := [keySize]byte(counting(0x80, keySize))
+	nonce := unhex(t, "070000004041424344454647")
+	aad := unhex(t, "50515253c0c1c2c3c4c5c6c7")
+	ct, tag := aeadSeal(&key, nonce, aad, []byte(sunscreen))
+	wantCT := unhex(t, `
+		d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d6
+		3dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b36
+		92ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc
+		3ff4def08e4b7a9de576d26586cec64b6116`)
+	if !bytes.Equal(ct, wantCT) {
+		t.Errorf("ciphertext = %x, want %x", ct, wantCT)
+	}
+	if want := unhex(t, "1ae10b594f09e26a7e902ecbd0600691"); !bytes.Equal(tag[:], want) {
+		t.Errorf("tag = %x, want %x", tag, want)
+	}
+}
+
+func TestHChaCha20(t *testing.T) {
+	// draft-irtf-cfrg-xchacha-03 section 2.2.1.
+	key := [keySize]byte(counting(0, keySize))
+	in := [16]byte(unhex(t, "000000090000004a0000000031415927"))
+	got := hchacha20(&key, &in)
+	want := unhex(t, "82413b4227b27bfed30e42508a877d73a0f9e4d58a74a853c12ec41326d3ecdc")
+	if !bytes.Equal(got[:], want) {
+		t.Errorf("subkey = %x, want %x", got, want)
+	}
+}
+
+func TestXChaCha20Poly1305(t *testing.T) {
+	// draft-irtf-cfrg-xchacha-03 appendix A.3.1: XChaCha20-Poly1305 is the
+	// RFC 8439 AEAD keyed with the HChaCha20 subkey, whose keystream
+	// xchachaKeyStream produces as well.
+	key := [keySize]byte(counting(0x80, keySize))
+	nonce := [nonceSize]byte(counting(0x40, nonceSize))
+	aad := unhex(t, "50515253c0c1c2c3c4c5c6c7")
+	wantCT := unhex(t, `
+		bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb
+		731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b452
+		2f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff9
+		21f9664c97637da9768812f615c68b13b52e`)
+	wantTag := unhex(t, "c0875924c1c7987947deafd8780acf49")
+
+	subkey := hchacha20(&key, (*[16]byte)(nonce[:16]))
+	ct, tag := aeadSeal(&subkey, append(make([]byte, 4), nonce[16:]...), aad, []byte(sunscreen))
+	if !bytes.Equal(ct, wantCT) {
+		t.Errorf("ciphertext = %x, want %x", ct, wantCT)
+	}
+	if !bytes.Equal(tag[:], wantTag) {
+		t.Errorf("tag = %x, want %x", tag, wantTag)
+	}
+
+	ks := xchachaKeyStream(&key, &nonce, 64+len(sunscreen))
+	got := make([]byte, len(sunscreen))
+	subtle.XORBytes(got, []byte(sunscreen), ks[64:])
+	if !bytes.Equal(got, wantCT) {
+		t.Errorf("xchachaKeyStream ciphertext = %x, want %x", got, wantCT)
+	}
+}
+
+func TestSecretBox(t *testing.T) {
+	key := [keySize]byte(counting(1, keySize))
+	nonce := [nonceSize]byte(counting(0xa0, nonceSize))
+	for _, n := range []int{0, 1, 16, 17, 64, 512} {
+		msg := counting(7, n)
+		box := seal(&key, &nonce, msg)
+		if len(box) != tagSize+n {
+			t.Fatalf("len(seal(%d bytes)) = %d", n, len(box))
+		}
+		got, err := open(&key, &nonce, box)
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Errorf("open(seal(%d bytes)) = %x, %v", n, got, err)
+		}
+		for _, i := range []int{0, tagSize - 1, len(box) - 1} {
+			tampered := bytes.Clone(box)
+			tampered[i] ^= 1
+			if _, err := open(&key, &nonce, tampered); err != errOpen {
+				t.Errorf("open with byte %d of %d flipped: err = %v, want %v", i, len(box), err, errOpen)
+			}
+		}
+	}
+	if _, err := open(&key, &nonce, make([]byte, tagSize-1)); err != errOpen {
+		t.Errorf("open(short box): err = %v, want %v", err, errOpen)
+	}
+}
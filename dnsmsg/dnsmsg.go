@@ -0,0 +1,463 @@
+// Package dnsmsg implements just enough of the DNS wire format (RFC 1035) to
+// build queries and inspect responses: headers, questions, resource records,
+// name compression and EDNS(0).
+package dnsmsg
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Type is a DNS resource record type.
+type Type uint16
+
+const (
+	TypeA      Type = 1
+	TypeNS     Type = 2
+	TypeCNAME  Type = 5
+	TypeSOA    Type = 6
+	TypePTR    Type = 12
+	TypeHINFO  Type = 13
+	TypeMX     Type = 15
+	TypeTXT    Type = 16
+	TypeAAAA   Type = 28
+	TypeSRV    Type = 33
+	TypeNAPTR  Type = 35
+	TypeOPT    Type = 41
+	TypeDS     Type = 43
+	TypeRRSIG  Type = 46
+	TypeDNSKEY Type = 48
+	TypeSVCB   Type = 64
+	TypeHTTPS  Type = 65
+	TypeANY    Type = 255
+)
+
+var typeNames = map[Type]string{
+	TypeA: "A", TypeNS: "NS", TypeCNAME: "CNAME", TypeSOA: "SOA", TypePTR: "PTR",
+	TypeHINFO: "HINFO", TypeMX: "MX", TypeTXT: "TXT", TypeAAAA: "AAAA", TypeSRV: "SRV",
+	TypeNAPTR: "NAPTR", TypeOPT: "OPT", TypeDS: "DS", TypeRRSIG: "RRSIG",
+	TypeDNSKEY: "DNSKEY", TypeSVCB: "SVCB", TypeHTTPS: "HTTPS", TypeANY: "ANY",
+}
+
+func (t Type) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+// ParseType returns the Type for a mnemonic such as "AAAA" or "TYPE65".
+func ParseType(s string) (Type, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for t, name := range typeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	var n uint16
+	if _, err := fmt.Sscanf(s, "TYPE%d", &n); err == nil {
+		return Type(n), nil
+	}
+	return 0, fmt.Errorf("dnsmsg: unknown record type %q", s)
+}
+
+// Class is a DNS class.
+type Class uint16
+
+const (
+	ClassINET  Class = 1
+	ClassCHAOS Class = 3
+)
+
+// RCode is a DNS response code.
+type RCode uint8
+
+const (
+	RCodeSuccess        RCode = 0
+	RCodeFormatError    RCode = 1
+	RCodeServerFailure  RCode = 2
+	RCodeNameError      RCode = 3
+	RCodeNotImplemented RCode = 4
+	RCodeRefused        RCode = 5
+)
+
+var rcodeNames = map[RCode]string{
+	RCodeSuccess: "NOERROR", RCodeFormatError: "FORMERR", RCodeServerFailure: "SERVFAIL",
+	RCodeNameError: "NXDOMAIN", RCodeNotImplemented: "NOTIMP", RCodeRefused: "REFUSED",
+}
+
+func (r RCode) String() string {
+	if s, ok := rcodeNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("RCODE%d", uint8(r))
+}
+
+// ParseRCode returns the RCode for a mnemonic such as "NXDOMAIN" or
+// "RCODE9".
+func ParseRCode(s string) (RCode, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for r, name := range rcodeNames {
+		if name == s {
+			return r, nil
+		}
+	}
+	var n uint8
+	if _, err := fmt.Sscanf(s, "RCODE%d", &n); err == nil {
+		return RCode(n), nil
+	}
+	return 0, fmt.Errorf("dnsmsg: unknown response code %q", s)
+}
+
+// Question is an entry of the question section.
+type Question struct {
+	Name  string
+	Type  Type
+	Class Class
+}
+
+// Resource is a resource record. Data holds the RDATA exactly as received;
+// use the typed accessors to decode it, since RDATA may contain compression
+// pointers into the enclosing message.
+type Resource struct {
+	Name  string
+	Type  Type
+	Class Class
+	TTL   uint32
+	Data  []byte
+
+	msg []byte // enclosing message, for decompressing names in Data
+	off int    // offset of Data within msg
+}
+
+// Message is a DNS message.
+type Message struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticData      bool
+	CheckingDisabled   bool
+	RCode              RCode
+
+	Questions   []Question
+	Answers     []Resource
+	Authorities []Resource
+	Additionals []Resource
+}
+
+var (
+	errShort       = errors.New("dnsmsg: message too short")
+	errLabelLen    = errors.New("dnsmsg: label longer than 63 octets")
+	errNameLen     = errors.New("dnsmsg: name longer than 255 octets")
+	errPointerLoop = errors.New("dnsmsg: too many compression pointers")
+	errBadLabel    = errors.New("dnsmsg: invalid label type")
+)
+
+// NewQuery returns a recursive query for name/t with a random ID.
+func NewQuery(name string, t Type) *Message {
+	return &Message{
+		ID:               RandomID(),
+		RecursionDesired: true,
+		Questions:        []Question{{Name: Fqdn(name), Type: t, Class: ClassINET}},
+	}
+}
+
+// RandomID returns a random message ID.
+func RandomID() uint16 {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// SetEDNS0 adds (or replaces) the OPT pseudo-record advertising udpSize and,
+// if do is set, the DNSSEC OK bit.
+func (m *Message) SetEDNS0(udpSize uint16, do bool) {
+	m.SetEDNS0Options(udpSize, do, nil)
+}
+
+// SetEDNS0Options is like SetEDNS0 but also attaches raw EDNS options
+// (already encoded as code, length, value).
+func (m *Message) SetEDNS0Options(udpSize uint16, do bool, options []byte) {
+	var ttl uint32
+	if do {
+		ttl = 1 << 15
+	}
+	out := m.Additionals[:0]
+	for _, rr := range m.Additionals {
+		if rr.Type != TypeOPT {
+			out = append(out, rr)
+		}
+	}
+	m.Additionals = append(out, Resource{Name: ".", Type: TypeOPT, Class: Class(udpSize), TTL: ttl, Data: options})
+}
+
+// OPT returns the EDNS(0) pseudo-record, if present.
+func (m *Message) OPT() (Resource, bool) {
+	for _, rr := range m.Additionals {
+		if rr.Type == TypeOPT {
+			return rr, true
+		}
+	}
+	return Resource{}, false
+}
+
+// OptionPadding is the EDNS(0) Padding option code (RFC 7830).
+const OptionPadding = 12
+
+// EDNSOption returns the value of the first EDNS(0) option with code, if
+// the message carries it.
+func (m *Message) EDNSOption(code uint16) ([]byte, bool) {
+	opt, ok := m.OPT()
+	if !ok {
+		return nil, false
+	}
+	for d := opt.Data; len(d) >= 4; {
+		c, n := binary.BigEndian.Uint16(d), int(binary.BigEndian.Uint16(d[2:]))
+		if 4+n > len(d) {
+			break
+		}
+		if c == code {
+			return d[4 : 4+n], true
+		}
+		d = d[4+n:]
+	}
+	return nil, false
+}
+
+// Pack encodes the message. Names are written without compression.
+func (m *Message) Pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xf) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	if m.AuthenticData {
+		flags |= 1 << 5
+	}
+	if m.CheckingDisabled {
+		flags |= 1 << 4
+	}
+	flags |= uint16(m.RCode & 0xf)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authorities)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additionals)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, uint16(q.Type))
+		b = binary.BigEndian.AppendUint16(b, uint16(q.Class))
+	}
+	for _, sec := range [][]Resource{m.Answers, m.Authorities, m.Additionals} {
+		for _, rr := range sec {
+			if b, err = appendName(b, rr.Name); err != nil {
+				return nil, err
+			}
+			b = binary.BigEndian.AppendUint16(b, uint16(rr.Type))
+			b = binary.BigEndian.AppendUint16(b, uint16(rr.Class))
+			b = binary.BigEndian.AppendUint32(b, rr.TTL)
+			b = binary.BigEndian.AppendUint16(b, uint16(len(rr.Data)))
+			b = append(b, rr.Data...)
+		}
+	}
+	return b, nil
+}
+
+// Unpack decodes a DNS message.
+func Unpack(b []byte) (*Message, error) {
+	if len(b) < 12 {
+		return nil, errShort
+	}
+	flags := binary.BigEndian.Uint16(b[2:])
+	m := &Message{
+		ID:                 binary.BigEndian.Uint16(b[0:]),
+		Response:           flags&(1<<15) != 0,
+		Opcode:             uint8(flags>>11) & 0xf,
+		Authoritative:      flags&(1<<10) != 0,
+		Truncated:          flags&(1<<9) != 0,
+		RecursionDesired:   flags&(1<<8) != 0,
+		RecursionAvailable: flags&(1<<7) != 0,
+		AuthenticData:      flags&(1<<5) != 0,
+		CheckingDisabled:   flags&(1<<4) != 0,
+		RCode:              RCode(flags & 0xf),
+	}
+	qd := int(binary.BigEndian.Uint16(b[4:]))
+	an := int(binary.BigEndian.Uint16(b[6:]))
+	ns := int(binary.BigEndian.Uint16(b[8:]))
+	ar := int(binary.BigEndian.Uint16(b[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, n, err := readName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(b) {
+			return nil, errShort
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  Type(binary.BigEndian.Uint16(b[off:])),
+			Class: Class(binary.BigEndian.Uint16(b[off+2:])),
+		})
+		off += 4
+	}
+	var err error
+	if m.Answers, off, err = readResources(b, off, an); err != nil {
+		return nil, err
+	}
+	if m.Authorities, off, err = readResources(b, off, ns); err != nil {
+		return nil, err
+	}
+	if m.Additionals, _, err = readResources(b, off, ar); err != nil {
+		return nil, err
+	}
+	if opt, ok := m.OPT(); ok {
+		// Extended RCODE: upper 8 bits live in the OPT TTL.
+		m.RCode |= RCode(uint8(opt.TTL>>24) << 4)
+	}
+	return m, nil
+}
+
+func readResources(b []byte, off, n int) ([]Resource, int, error) {
+	var out []Resource
+	for i := 0; i < n; i++ {
+		name, next, err := readName(b, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		off = next
+		if off+10 > len(b) {
+			return nil, 0, errShort
+		}
+		rr := Resource{
+			Name:  name,
+			Type:  Type(binary.BigEndian.Uint16(b[off:])),
+			Class: Class(binary.BigEndian.Uint16(b[off+2:])),
+			TTL:   binary.BigEndian.Uint32(b[off+4:]),
+		}
+		rdlen := int(binary.BigEndian.Uint16(b[off+8:]))
+		off += 10
+		if off+rdlen > len(b) {
+			return nil, 0, errShort
+		}
+		rr.Data = b[off : off+rdlen]
+		rr.msg = b
+		rr.off = off
+		off += rdlen
+		out = append(out, rr)
+	}
+	return out, off, nil
+}
+
+// Fqdn returns name with a trailing dot.
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// EqualNames reports whether two names are equal, ignoring case and the
+// trailing dot.
+func EqualNames(a, b string) bool {
+	return strings.EqualFold(Fqdn(a), Fqdn(b))
+}
+
+// AppendName appends name to b in wire format, without compression, for
+// building RDATA that holds names.
+func AppendName(b []byte, name string) ([]byte, error) {
+	return appendName(b, name)
+}
+
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	start := len(b)
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, errLabelLen
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	b = append(b, 0)
+	if len(b)-start > 255 {
+		return nil, errNameLen
+	}
+	return b, nil
+}
+
+// readName decodes the (possibly compressed) name at off and returns it
+// along with the offset just past it.
+func readName(b []byte, off int) (string, int, error) {
+	var sb strings.Builder
+	next := -1
+	for ptrs := 0; ; {
+		if off >= len(b) {
+			return "", 0, errShort
+		}
+		c := int(b[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				if sb.Len() == 0 {
+					return ".", next, nil
+				}
+				if sb.Len() > 255 {
+					return "", 0, errNameLen
+				}
+				return sb.String(), next, nil
+			}
+			if off+1+c > len(b) {
+				return "", 0, errShort
+			}
+			sb.Write(b[off+1 : off+1+c])
+			sb.WriteByte('.')
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, errShort
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			if ptrs++; ptrs > 64 {
+				return "", 0, errPointerLoop
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+		default:
+			return "", 0, errBadLabel
+		}
+	}
+}
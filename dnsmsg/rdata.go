@@ -0,0 +1,290 @@
+package dnsmsg
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errRData = errors.New("dnsmsg: malformed rdata")
+
+// SOA is the decoded RDATA of an SOA record.
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+// IP returns the address carried by an A or AAAA record.
+func (rr Resource) IP() (net.IP, error) {
+	switch {
+	case rr.Type == TypeA && len(rr.Data) == net.IPv4len:
+		return net.IP(rr.Data).To16(), nil
+	case rr.Type == TypeAAAA && len(rr.Data) == net.IPv6len:
+		return net.IP(rr.Data), nil
+	}
+	return nil, errRData
+}
+
+// Target returns the domain name carried by a CNAME, NS or PTR record.
+func (rr Resource) Target() (string, error) {
+	name, _, err := rr.name(0)
+	return name, err
+}
+
+// SOA decodes the RDATA of an SOA record.
+func (rr Resource) SOA() (SOA, error) {
+	var s SOA
+	var off int
+	var err error
+	if s.MName, off, err = rr.name(0); err != nil {
+		return s, err
+	}
+	if s.RName, off, err = rr.name(off); err != nil {
+		return s, err
+	}
+	if off+20 > len(rr.Data) {
+		return s, errRData
+	}
+	d := rr.Data[off:]
+	s.Serial = binary.BigEndian.Uint32(d[0:])
+	s.Refresh = binary.BigEndian.Uint32(d[4:])
+	s.Retry = binary.BigEndian.Uint32(d[8:])
+	s.Expire = binary.BigEndian.Uint32(d[12:])
+	s.Minimum = binary.BigEndian.Uint32(d[16:])
+	return s, nil
+}
+
+// SRV is the decoded RDATA of an SRV record.
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// SRV decodes the RDATA of an SRV record.
+func (rr Resource) SRV() (SRV, error) {
+	var s SRV
+	if len(rr.Data) < 7 {
+		return s, errRData
+	}
+	s.Priority = binary.BigEndian.Uint16(rr.Data[0:])
+	s.Weight = binary.BigEndian.Uint16(rr.Data[2:])
+	s.Port = binary.BigEndian.Uint16(rr.Data[4:])
+	var err error
+	s.Target, _, err = rr.name(6)
+	return s, err
+}
+
+// NAPTR is the decoded RDATA of a NAPTR record (RFC 3403).
+type NAPTR struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string // "S": look up SRV at Replacement, "A": address records, "U": Regexp yields a URI
+	Services    string // e.g. "SIP+D2U"
+	Regexp      string
+	Replacement string
+}
+
+// NAPTR decodes the RDATA of a NAPTR record.
+func (rr Resource) NAPTR() (NAPTR, error) {
+	var n NAPTR
+	if len(rr.Data) < 4 {
+		return n, errRData
+	}
+	n.Order = binary.BigEndian.Uint16(rr.Data[0:])
+	n.Preference = binary.BigEndian.Uint16(rr.Data[2:])
+	off := 4
+	for _, dst := range []*string{&n.Flags, &n.Services, &n.Regexp} {
+		if off >= len(rr.Data) || off+1+int(rr.Data[off]) > len(rr.Data) {
+			return n, errRData
+		}
+		l := int(rr.Data[off])
+		*dst = string(rr.Data[off+1 : off+1+l])
+		off += 1 + l
+	}
+	var err error
+	n.Replacement, _, err = rr.name(off)
+	return n, err
+}
+
+// TXT returns the character strings of a TXT record.
+func (rr Resource) TXT() ([]string, error) {
+	return characterStrings(rr.Data)
+}
+
+func characterStrings(d []byte) ([]string, error) {
+	var out []string
+	for len(d) > 0 {
+		n := int(d[0])
+		if 1+n > len(d) {
+			return nil, errRData
+		}
+		out = append(out, string(d[1:1+n]))
+		d = d[1+n:]
+	}
+	return out, nil
+}
+
+// name decodes a domain name at off within Data, following compression
+// pointers into the enclosing message. It returns the offset within Data
+// just past the name.
+func (rr Resource) name(off int) (string, int, error) {
+	if rr.msg == nil {
+		// Not unpacked from the wire: Data cannot contain pointers.
+		name, next, err := readName(rr.Data, off)
+		return name, next, err
+	}
+	name, next, err := readName(rr.msg, rr.off+off)
+	if err != nil {
+		return "", 0, err
+	}
+	if next-rr.off > len(rr.Data) {
+		return "", 0, errRData
+	}
+	return name, next - rr.off, nil
+}
+
+// SvcParamKey is the key of an SVCB/HTTPS service parameter (RFC 9460).
+type SvcParamKey uint16
+
+const (
+	SvcMandatory     SvcParamKey = 0
+	SvcALPN          SvcParamKey = 1
+	SvcNoDefaultALPN SvcParamKey = 2
+	SvcPort          SvcParamKey = 3
+	SvcIPv4Hint      SvcParamKey = 4
+	SvcECH           SvcParamKey = 5
+	SvcIPv6Hint      SvcParamKey = 6
+)
+
+var svcParamNames = map[SvcParamKey]string{
+	SvcMandatory: "mandatory", SvcALPN: "alpn", SvcNoDefaultALPN: "no-default-alpn", SvcPort: "port",
+	SvcIPv4Hint: "ipv4hint", SvcECH: "ech", SvcIPv6Hint: "ipv6hint",
+}
+
+func (k SvcParamKey) String() string {
+	if s, ok := svcParamNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("key%d", uint16(k))
+}
+
+// SVCB is the decoded RDATA of an SVCB or HTTPS record. Priority 0 is
+// AliasMode, where Target names another service and Params is empty.
+type SVCB struct {
+	Priority uint16
+	Target   string
+	Params   map[SvcParamKey][]byte // raw values, in wire format
+}
+
+// SVCB decodes the RDATA of an SVCB or HTTPS record.
+func (rr Resource) SVCB() (SVCB, error) {
+	var s SVCB
+	if len(rr.Data) < 3 {
+		return s, errRData
+	}
+	s.Priority = binary.BigEndian.Uint16(rr.Data)
+	target, off, err := readName(rr.Data, 2) // the target is never compressed
+	if err != nil {
+		return s, err
+	}
+	s.Target = target
+	s.Params = make(map[SvcParamKey][]byte)
+	prev := -1
+	for d := rr.Data[off:]; len(d) > 0; {
+		if len(d) < 4 {
+			return s, errRData
+		}
+		key := int(binary.BigEndian.Uint16(d))
+		n := int(binary.BigEndian.Uint16(d[2:]))
+		if key <= prev || 4+n > len(d) {
+			return s, errRData // keys must be unique and ascending
+		}
+		s.Params[SvcParamKey(key)] = d[4 : 4+n]
+		prev, d = key, d[4+n:]
+	}
+	return s, nil
+}
+
+// ALPN returns the alpn protocol IDs, such as "h3" and "h2".
+func (s SVCB) ALPN() []string {
+	var out []string
+	for d := s.Params[SvcALPN]; len(d) > 0 && 1+int(d[0]) <= len(d); d = d[1+int(d[0]):] {
+		out = append(out, string(d[1:1+int(d[0])]))
+	}
+	return out
+}
+
+// IPv4Hint returns the ipv4hint addresses.
+func (s SVCB) IPv4Hint() []net.IP { return ipHints(s.Params[SvcIPv4Hint], net.IPv4len) }
+
+// IPv6Hint returns the ipv6hint addresses.
+func (s SVCB) IPv6Hint() []net.IP { return ipHints(s.Params[SvcIPv6Hint], net.IPv6len) }
+
+// ECH returns the Encrypted ClientHello configuration list, or nil.
+func (s SVCB) ECH() []byte { return s.Params[SvcECH] }
+
+func ipHints(d []byte, n int) []net.IP {
+	var out []net.IP
+	for ; len(d) >= n; d = d[n:] {
+		out = append(out, net.IP(append([]byte(nil), d[:n]...)))
+	}
+	return out
+}
+
+// String formats the record data in presentation form, with the ech value
+// base64-encoded.
+func (s SVCB) String() string {
+	parts := []string{strconv.Itoa(int(s.Priority)), s.Target}
+	keys := make([]int, 0, len(s.Params))
+	for k := range s.Params {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		key := SvcParamKey(k)
+		v := s.Params[key]
+		var val string
+		switch key {
+		case SvcALPN:
+			val = strings.Join(s.ALPN(), ",")
+		case SvcNoDefaultALPN:
+			parts = append(parts, key.String())
+			continue
+		case SvcPort:
+			if len(v) == 2 {
+				val = strconv.Itoa(int(binary.BigEndian.Uint16(v)))
+			}
+		case SvcIPv4Hint, SvcIPv6Hint:
+			var ips []net.IP
+			if key == SvcIPv4Hint {
+				ips = s.IPv4Hint()
+			} else {
+				ips = s.IPv6Hint()
+			}
+			strs := make([]string, len(ips))
+			for i, ip := range ips {
+				strs[i] = ip.String()
+			}
+			val = strings.Join(strs, ",")
+		case SvcECH:
+			val = base64.StdEncoding.EncodeToString(v)
+		default:
+			val = hex.EncodeToString(v)
+		}
+		parts = append(parts, key.String()+"="+val)
+	}
+	return strings.Join(parts, " ")
+}
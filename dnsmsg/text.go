@@ -0,0 +1,121 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// String formats the message in the presentation style of dig: a header
+// line, the flags, the EDNS(0) pseudo-section and the four sections with one
+// record per line.
+func (m *Message) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ";; opcode: %d, status: %s, id: %d\n", m.Opcode, m.RCode, m.ID)
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{m.Response, "qr"}, {m.Authoritative, "aa"}, {m.Truncated, "tc"}, {m.RecursionDesired, "rd"},
+		{m.RecursionAvailable, "ra"}, {m.AuthenticData, "ad"}, {m.CheckingDisabled, "cd"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	fmt.Fprintf(&b, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		strings.Join(flags, " "), len(m.Questions), len(m.Answers), len(m.Authorities), len(m.Additionals))
+	if opt, ok := m.OPT(); ok {
+		do := ""
+		if opt.TTL&(1<<15) != 0 {
+			do = " do"
+		}
+		fmt.Fprintf(&b, "\n;; OPT PSEUDOSECTION:\n; EDNS: version: %d, flags:%s; udp: %d\n", opt.TTL>>16&0xff, do, opt.Class)
+		if len(opt.Data) > 0 {
+			fmt.Fprintf(&b, "; OPTIONS: %s\n", hex.EncodeToString(opt.Data))
+		}
+	}
+	b.WriteString("\n;; QUESTION SECTION:\n")
+	for _, q := range m.Questions {
+		fmt.Fprintf(&b, ";%s\t\t%s\t%s\n", q.Name, classString(q.Class), q.Type)
+	}
+	for _, sec := range []struct {
+		name string
+		rrs  []Resource
+	}{{"ANSWER", m.Answers}, {"AUTHORITY", m.Authorities}, {"ADDITIONAL", m.Additionals}} {
+		var lines []string
+		for _, rr := range sec.rrs {
+			if rr.Type != TypeOPT {
+				lines = append(lines, rr.String())
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "\n;; %s SECTION:\n%s\n", sec.name, strings.Join(lines, "\n"))
+		}
+	}
+	return b.String()
+}
+
+// String formats the record as a zone file line. RDATA of types without a
+// decoder is written in the generic form of RFC 3597.
+func (rr Resource) String() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", rr.Name, rr.TTL, classString(rr.Class), rr.Type, rr.rdataString())
+}
+
+func (rr Resource) rdataString() string {
+	generic := fmt.Sprintf("\\# %d %s", len(rr.Data), hex.EncodeToString(rr.Data))
+	switch rr.Type {
+	case TypeA, TypeAAAA:
+		if ip, err := rr.IP(); err == nil {
+			return ip.String()
+		}
+	case TypeCNAME, TypeNS, TypePTR:
+		if t, err := rr.Target(); err == nil {
+			return t
+		}
+	case TypeMX:
+		if len(rr.Data) > 2 {
+			if t, _, err := rr.name(2); err == nil {
+				return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(rr.Data), t)
+			}
+		}
+	case TypeSOA:
+		if s, err := rr.SOA(); err == nil {
+			return fmt.Sprintf("%s %s %d %d %d %d %d", s.MName, s.RName, s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum)
+		}
+	case TypeSRV:
+		if srv, err := rr.SRV(); err == nil {
+			return fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target)
+		}
+	case TypeNAPTR:
+		if n, err := rr.NAPTR(); err == nil {
+			return fmt.Sprintf("%d %d %q %q %q %s", n.Order, n.Preference, n.Flags, n.Services, n.Regexp, n.Replacement)
+		}
+	case TypeSVCB, TypeHTTPS:
+		if svcb, err := rr.SVCB(); err == nil {
+			return svcb.String()
+		}
+	case TypeTXT:
+		if txt, err := rr.TXT(); err == nil {
+			q := make([]string, len(txt))
+			for i, t := range txt {
+				q[i] = strconv.Quote(t)
+			}
+			return strings.Join(q, " ")
+		}
+	}
+	return generic
+}
+
+func classString(c Class) string {
+	switch c {
+	case ClassINET:
+		return "IN"
+	case ClassCHAOS:
+		return "CH"
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// writeDnsperf writes the run as dnsperf would report it: a status block
+// and a "Statistics:" block per resolver, with the same labels and number
+// formats, so that scripts parsing dnsperf output read dnsbench runs too.
+// A query counts as completed when it got a response of any RCODE, and as
+// lost otherwise, like in dnsperf; latencies are those of completed queries.
+func writeDnsperf(w io.Writer, resolvers []bench.Resolver, rows []bench.Result, started time.Time) error {
+	addrs := make(map[string]string, len(resolvers))
+	for _, r := range resolvers {
+		addrs[r.Name] = r.Addr
+	}
+	cmdline := exportAnonymizer.Text(strings.Join(append([]string{"dnsbench"}, os.Args[1:]...), " "))
+	var b strings.Builder
+	fmt.Fprintf(&b, "DNS Performance Testing Tool\nVersion %s\n\n", bench.Tool)
+	for _, r := range rows {
+		var completed, reqBytes, reqs, respBytes int
+		var sum, sumSq float64
+		lo, hi := math.Inf(1), 0.0
+		rcodes := make(map[dnsmsg.RCode]int)
+		for _, s := range r.Samples {
+			if s.QuerySize > 0 {
+				reqBytes += s.QuerySize
+				reqs++
+			}
+			if s.Response == nil {
+				continue
+			}
+			completed++
+			rcodes[s.Response.RCode]++
+			respBytes += s.Size
+			v := s.Duration.Seconds()
+			sum += v
+			sumSq += v * v
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		sent := len(r.Samples)
+		elapsed := r.Elapsed
+		if elapsed <= 0 {
+			elapsed = time.Since(started)
+		}
+
+		fmt.Fprintf(&b, "[Status] Command line: %s\n", cmdline)
+		fmt.Fprintf(&b, "[Status] Sending queries (to %s)\n", addrs[r.Name])
+		fmt.Fprintf(&b, "[Status] Started at: %s\n", started.Format(time.ANSIC))
+		fmt.Fprintf(&b, "[Status] Stopping after %d queries\n", sent)
+		fmt.Fprintf(&b, "[Status] Testing complete (%s)\n\n", ternary(r.Aborted, "aborted", "end of queries"))
+		fmt.Fprintf(&b, "Statistics:\n\n")
+		fmt.Fprintf(&b, "  Queries sent:         %d\n", sent)
+		fmt.Fprintf(&b, "  Queries completed:    %d (%.2f%%)\n", completed, pct(completed, sent))
+		fmt.Fprintf(&b, "  Queries lost:         %d (%.2f%%)\n\n", sent-completed, pct(sent-completed, sent))
+
+		codes := make([]dnsmsg.RCode, 0, len(rcodes))
+		for c := range rcodes {
+			codes = append(codes, c)
+		}
+		slices.Sort(codes)
+		parts := make([]string, len(codes))
+		for i, c := range codes {
+			parts[i] = fmt.Sprintf("%s %d (%.2f%%)", c, rcodes[c], pct(rcodes[c], completed))
+		}
+		fmt.Fprintf(&b, "%s\n", strings.TrimSpace("  Response codes:       "+strings.Join(parts, ", ")))
+		fmt.Fprintf(&b, "  Average packet size:  request %d, response %d\n", avgInt(reqBytes, reqs), avgInt(respBytes, completed))
+		fmt.Fprintf(&b, "  Run time (s):         %.6f\n", elapsed.Seconds())
+		fmt.Fprintf(&b, "  Queries per second:   %.6f\n\n", float64(completed)/elapsed.Seconds())
+
+		var avg, stddev float64
+		if completed > 0 {
+			avg = sum / float64(completed)
+		} else {
+			lo = 0
+		}
+		if completed > 1 {
+			// The sample standard deviation, as dnsperf computes it.
+			stddev = math.Sqrt(max(0, (sumSq-sum*sum/float64(completed))/float64(completed-1)))
+		}
+		fmt.Fprintf(&b, "  Average Latency (s):  %.6f (min %.6f, max %.6f)\n", avg, lo, hi)
+		fmt.Fprintf(&b, "  Latency StdDev (s):   %.6f\n\n", stddev)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// pct returns n as a percentage of total, zero for no total.
+func pct(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// avgInt returns the rounded down average of count values summing to sum.
+func avgInt(sum, count int) int {
+	if count == 0 {
+		return 0
+	}
+	return sum / count
+}
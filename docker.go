@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// dockerDNSAddr is where Docker's embedded DNS server answers containers on
+// user-defined networks.
+const dockerDNSAddr = "127.0.0.11"
+
+// dockerResolvers returns the DNS paths of a container: Docker's embedded
+// DNS server, if the container's resolv.conf uses it, and the host's
+// resolvers, which the embedded server forwards to. Docker lists those in
+// an "ExtServers" comment of the container's resolv.conf; a container on
+// the default bridge network gets the host's servers as name servers
+// instead. The embedded server is paired with each host resolver for the
+// overhead report, which then shows what the container path adds.
+func dockerResolvers(o presetOptions) ([]bench.Resolver, []OverheadPair, error) {
+	path := ternary(o.Source != "", o.Source, "/etc/resolv.conf")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rs, hosts []bench.Resolver
+	embedded := false
+	for _, s := range parseResolvConf(string(b)) {
+		if s.Addr == dockerDNSAddr {
+			embedded = true
+			continue
+		}
+		hosts = append(hosts, s)
+	}
+	if embedded {
+		rs = append(rs, bench.Resolver{Name: "DockerDNS", Addr: dockerDNSAddr})
+		ext := parseDockerExtServers(string(b))
+		if len(ext) == 0 {
+			slog.Warn("no reachable host resolvers in the ExtServers comment", "path", path)
+		}
+		hosts = append(hosts, ext...)
+	}
+	if len(hosts) == 0 && !embedded {
+		return nil, nil, fmt.Errorf("no name servers in %s", path)
+	}
+	var pairs []OverheadPair
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if seen[h.Addr] {
+			continue
+		}
+		seen[h.Addr] = true
+		h.Name = fmt.Sprintf("Host#%d", len(seen))
+		rs = append(rs, h)
+		if embedded {
+			pairs = append(pairs, OverheadPair{Name: "DockerDNS", Baseline: h.Name})
+		}
+	}
+	return rs, pairs, nil
+}
+
+// parseDockerExtServers returns the servers of the "# ExtServers: [...]"
+// comment Docker writes into the resolv.conf of containers on user-defined
+// networks. Servers in the host's network namespace are written as
+// host(IP); loopback addresses, such as systemd-resolved's stub, cannot be
+// reached from the container and are skipped.
+func parseDockerExtServers(conf string) []bench.Resolver {
+	var res []bench.Resolver
+	sc := bufio.NewScanner(strings.NewReader(conf))
+	for sc.Scan() {
+		v, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "# ExtServers:")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(strings.Trim(strings.TrimSpace(v), "[]")) {
+			addr := strings.TrimSuffix(strings.TrimPrefix(f, "host("), ")")
+			if ip := net.ParseIP(addr); ip == nil || ip.IsLoopback() {
+				continue
+			}
+			res = append(res, bench.Resolver{Addr: addr})
+		}
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// cdnCacheHeaders are the response headers in which CDNs and HTTP caches
+// tell whether they answered from cache, in the order they are read: the
+// standard Cache-Status (RFC 9211), then Cloudflare's, then the X-Cache
+// of CloudFront, Fastly, Varnish and others, and nginx's.
+var cdnCacheHeaders = []string{"Cache-Status", "CF-Cache-Status", "X-Cache", "X-Cache-Status"}
+
+// DoHCacheResult is the outcome of the DoH HTTP caching probe for one
+// resolver.
+type DoHCacheResult struct {
+	Name         string
+	NotDoH       bool
+	Statuses     map[int]int // HTTP status codes and how often they came
+	CacheControl string      // Cache-Control of the last response
+	MaxAge       int         // largest Age header seen, in seconds; -1 without one
+	CDNHeader    string      // the last cdnCacheHeaders header seen, as "Name: value"
+	Hits         int         // responses a cache answered, by Age or CDN header
+	First        time.Duration
+	Repeat       time.Duration // median of the repeated queries
+	Samples      []bench.Sample
+}
+
+// cacheHit reports whether the CDN header value v says the response came
+// from a cache: "HIT", "Hit from cloudfront", "TCP_HIT" or "cdn; hit".
+func cacheHit(v string) bool {
+	v = strings.ToLower(v)
+	return strings.Contains(v, "hit") && !strings.Contains(v, "fwd=")
+}
+
+// probeDoHCache sends the same query as a DoH GET request count times,
+// which makes the same URL each time since DoH queries carry ID 0. Caches
+// and CDNs in front of the server may answer the repeats themselves, which
+// shows in an Age header or a CDN cache status, and in their latency.
+func probeDoHCache(r bench.Resolver, name string, qtype dnsmsg.Type, count int, interval, timeout time.Duration) DoHCacheResult {
+	res := DoHCacheResult{Name: r.Name, Statuses: make(map[int]int), MaxAge: -1}
+	tr, err := transport.New(r.Addr)
+	if err != nil {
+		res.Samples = append(res.Samples, bench.Sample{Err: err})
+		return res
+	}
+	doh, ok := tr.(*transport.HTTPS)
+	if !ok {
+		res.NotDoH = true
+		return res
+	}
+	doh.Method = http.MethodGet
+
+	var repeats []float64
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		hit := false
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		ctx = transport.WithTrace(ctx, &transport.Trace{
+			GotHTTPResponse: func(resp *http.Response) {
+				res.Statuses[resp.StatusCode]++
+				res.CacheControl = resp.Header.Get("Cache-Control")
+				if age, err := strconv.Atoi(resp.Header.Get("Age")); err == nil {
+					res.MaxAge = max(res.MaxAge, age)
+					hit = hit || age > 0
+				}
+				for _, h := range cdnCacheHeaders {
+					if v := resp.Header.Get(h); v != "" {
+						res.CDNHeader = h + ": " + v
+						hit = hit || cacheHit(v)
+						break
+					}
+				}
+			},
+		})
+		start := time.Now()
+		resp, err := doh.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+		d := time.Since(start)
+		cancel()
+		if err == nil {
+			err = rcodeError(resp)
+		}
+		if hit {
+			res.Hits++
+		}
+		res.Samples = append(res.Samples, bench.Sample{Duration: d, Err: err})
+		if err != nil {
+			continue
+		}
+		if i == 0 {
+			res.First = d
+		} else {
+			repeats = append(repeats, ms(d))
+		}
+	}
+	if len(repeats) > 0 {
+		sort.Float64s(repeats)
+		res.Repeat = time.Duration(bench.Percentile(repeats, 50) * float64(time.Millisecond))
+	}
+	return res
+}
+
+// verdict sums up how the endpoint treats identical GET queries.
+func (r DoHCacheResult) verdict() string {
+	cc := strings.ToLower(r.CacheControl)
+	switch {
+	case r.NotDoH:
+		return "not DoH"
+	case len(r.Statuses) == 0:
+		return "--"
+	case r.Hits > 0:
+		return "served from HTTP cache"
+	case strings.Contains(cc, "no-store"), strings.Contains(cc, "no-cache"), strings.Contains(cc, "private"), strings.Contains(cc, "max-age=0"):
+		return "not cacheable"
+	case strings.Contains(cc, "max-age"):
+		return "cacheable, no cache hit"
+	}
+	return "no cache headers"
+}
+
+func printDoHCache(results []DoHCacheResult) {
+	fmt.Printf("%-12s  %-8s  %-20s  %5s  %5s  %7s  %7s  %s\n",
+		"Resolver", "Status", "Cache-Control", "Age", "Hits", "First", "Repeat", "Verdict")
+	fmt.Println(strings.Repeat("-", 96))
+	for _, r := range results {
+		codes := make([]int, 0, len(r.Statuses))
+		for c := range r.Statuses {
+			codes = append(codes, c)
+		}
+		sort.Ints(codes)
+		status := make([]string, len(codes))
+		for i, c := range codes {
+			status[i] = strconv.Itoa(c)
+		}
+		age := "--"
+		if r.MaxAge >= 0 {
+			age = fmt.Sprintf("%ds", r.MaxAge)
+		}
+		cc := r.CacheControl
+		if len(cc) > 20 {
+			cc = cc[:19] + "…"
+		}
+		hits := "--"
+		if len(r.Statuses) > 0 {
+			hits = fmt.Sprintf("%d/%d", r.Hits, len(r.Samples))
+		}
+		fmt.Printf("%-12s  %-8s  %-20s  %5s  %5s  %7s  %7s  %s\n",
+			r.Name, orDash(strings.Join(status, ",")), orDash(cc), age, hits, durFmt(r.First), durFmt(r.Repeat), r.verdict())
+		if r.CDNHeader != "" {
+			fmt.Printf("  %s\n", r.CDNHeader)
+		}
+		for _, e := range uniqueErrors(bench.Summarize(r.Samples).Errors) {
+			fmt.Printf("  ! %s\n", e)
+		}
+	}
+}
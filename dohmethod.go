@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// DoH methods of -doh-method.
+const (
+	dohPost    = "post"
+	dohGet     = "get"
+	dohCompare = "compare"
+)
+
+// runDoHMethods runs the benchmark with DoH POST requests and then with
+// GET requests, prints the results of each and then both side by side.
+// GET requests can be answered by HTTP caches and CDNs in front of the
+// server, and some servers treat the two differently, which the
+// difference shows. Each run is saved on its own.
+func runDoHMethods(ctx context.Context, runner *bench.Runner, saveDir string) {
+	results := make([][]bench.Result, 2)
+	for i, method := range []string{http.MethodPost, http.MethodGet} {
+		r := *runner
+		r.DoHMethod = method
+		fmt.Printf("\nDoH %s\n", method)
+		started := time.Now()
+		rows, err := runHooks.Run(ctx, &r, nil)
+		if err != nil {
+			slog.Warn("run interrupted, showing partial results", "doh_method", method, "err", err)
+		}
+		results[i] = rows
+		printTable(rows)
+		if saveDir != "" && err == nil {
+			path, err := saveRun(saveDir, &r, started, rows)
+			if err != nil {
+				slog.Error("saving run failed", "dir", saveDir, "err", err)
+			} else {
+				fmt.Printf("Run saved to: %s\n", path)
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	printComparison("DoH methods", http.MethodPost, http.MethodGet, results)
+	fmt.Println("Only DoH queries are affected; other transports serve as a control.")
+}
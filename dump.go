@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// responseDumper is a transport tap that writes every response to a
+// benchmark query to dir, as NAME-RUN.bin (the raw message) and NAME-RUN.txt
+// (decoded). A sample that took several queries, such as a DNS64 check,
+// gets NAME-RUN.2.bin and so on for the later responses. The files are
+// written by the goroutine of a transport.AsyncTap, so that decoding and
+// disk writes stay out of the timing of the queries.
+type responseDumper struct {
+	dir string
+	tap *transport.AsyncTap
+
+	// Of the tap's goroutine, and of Close once it is done.
+	seen map[string]int
+	err  error
+}
+
+func newResponseDumper(dir string) (*responseDumper, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &responseDumper{dir: dir, seen: make(map[string]int)}
+	d.tap = transport.NewAsyncTap(d.write)
+	return d, nil
+}
+
+func (d *responseDumper) DNSMessage(ctx context.Context, t time.Time, src, dst net.Addr, msg []byte) {
+	if len(msg) < 3 || msg[2]&0x80 == 0 {
+		return // a query
+	}
+	if _, ok := bench.QueryInfoFrom(ctx); !ok {
+		return
+	}
+	d.tap.DNSMessage(ctx, t, src, dst, msg)
+}
+
+// write writes a queued response.
+func (d *responseDumper) write(m transport.TapMessage) {
+	qi, _ := bench.QueryInfoFrom(m.Ctx)
+	base := fmt.Sprintf("%s-%03d", fileSafe(qi.Resolver.Name), qi.Index+1)
+	if d.seen[base]++; d.seen[base] > 1 {
+		base += fmt.Sprintf(".%d", d.seen[base])
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, ";; resolver: %s (%s)\n;; run: %d\n;; received: %s\n",
+		qi.Resolver.Name, qi.Resolver.Addr, qi.Index+1, m.Time.Format(time.RFC3339Nano))
+	if m.Src != nil {
+		fmt.Fprintf(&text, ";; from: %s\n", m.Src)
+	}
+	if msg, err := dnsmsg.Unpack(m.Msg); err != nil {
+		fmt.Fprintf(&text, ";; undecodable: %v\n", err)
+	} else {
+		text.WriteString(msg.String())
+	}
+	for _, f := range []struct {
+		ext  string
+		data []byte
+	}{{".bin", m.Msg}, {".txt", []byte(text.String())}} {
+		if err := os.WriteFile(filepath.Join(d.dir, base+f.ext), f.data, 0o644); err != nil && d.err == nil {
+			d.err = err
+		}
+	}
+}
+
+// Close writes the responses still queued, drops those that arrive later
+// and returns the first write error.
+func (d *responseDumper) Close() error {
+	d.tap.Close()
+	return d.err
+}
+
+// fileSafe replaces the characters of a resolver name that are not safe in
+// file names.
+func fileSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
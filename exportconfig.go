@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// runExportConfig implements the export-config subcommand: rank the
+// resolvers of saved runs and print forwarder configuration for the best.
+func runExportConfig(args []string) int {
+	fs := flag.NewFlagSet("export-config", flag.ExitOnError)
+	format := fs.String("format", selectUnbound, "Configuration to write: "+strings.Join(selectFormats, ", "))
+	top := fs.Int("top", 3, "Number of resolvers to forward to, best first")
+	configPath := fs.String("config", "", "Optional JSON config with a scoring profile used for ranking")
+	timeout := fs.Duration("timeout", 1500*time.Millisecond, "Per-query timeout of the feature probe, for scoring profiles that weigh DNSSEC or filtering")
+	out := fs.String("out", "", "Write the configuration to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench export-config [-format FORMAT] [-top N] [-config file.json] [-out FILE] FILE|DIR...\n\n"+
+			"Ranks the resolvers of runs saved with -save, combined per resolver, and\n"+
+			"writes forwarder configuration for the best plain DNS resolvers.\n\n")
+		fs.PrintDefaults()
+	}
+	logLevelFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 || *top < 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := writeSelection(io.Discard, *format, nil, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "-format:", err)
+		return 2
+	}
+	var cfg Config
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	recs, err := loadRecords(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(recs) == 0 {
+		fmt.Fprintln(os.Stderr, "No saved runs found.")
+		return 1
+	}
+
+	// The addresses of the latest run win for resolvers renamed or moved.
+	var resolvers []bench.Resolver
+	index := make(map[string]int)
+	for _, rec := range recs {
+		for _, rr := range rec.Resolvers {
+			r := bench.Resolver{Name: rr.Name, Addr: rr.Addr}
+			if i, ok := index[rr.Name]; ok {
+				resolvers[i] = r
+				continue
+			}
+			index[rr.Name] = len(resolvers)
+			resolvers = append(resolvers, r)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ranked, _ := rankResults(ctx, combineRuns(recs), resolvers, cfg, *timeout)
+	names, servers := selectResolvers(ranked, resolvers, *top, *format)
+	if len(servers) == 0 {
+		fmt.Fprintf(os.Stderr, "No working plain DNS resolver in the saved runs to configure for %s.\n", *format)
+		return 1
+	}
+	if len(servers) < *top {
+		slog.Warn("fewer working plain DNS resolvers than requested", "format", *format, "selected", len(servers), "requested", *top)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	err = writeSelection(w, *format, names, servers)
+	if *out != "" {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		slog.Error("config write failed", "path", *out, "err", err)
+		return 1
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "%s configuration for %s written to: %s\n", *format, strings.Join(names, ", "), *out)
+	}
+	return 0
+}
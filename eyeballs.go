@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// EyeballsResult is the outcome of the Happy Eyeballs probe for one
+// resolver: the races of its connections and the errors of the queries.
+type EyeballsResult struct {
+	Name      string
+	Transport string // "" for transports without TCP connections
+	Host      bool   // the server is a host name, so there is a race
+	Races     []transport.Race
+	Samples   []bench.Sample
+}
+
+// probeEyeballs sends count queries to a TCP, DoT or DoH resolver given by
+// host name, each over a new connection made with Happy Eyeballs, and has
+// every race connect to the losing family as well to measure the margin.
+func probeEyeballs(r bench.Resolver, name string, qtype dnsmsg.Type, count int, interval, timeout time.Duration) EyeballsResult {
+	res := EyeballsResult{Name: r.Name}
+	host := transport.ServerHost(r.Addr)
+	if _, err := netip.ParseAddr(host); host != "" && err != nil {
+		res.Host = true
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		// A new transport each time, so that DoH does not reuse its
+		// connection.
+		tr, err := transport.New(r.Addr)
+		if err != nil {
+			res.Samples = append(res.Samples, bench.Sample{Err: err})
+			return res
+		}
+		switch tr.(type) {
+		case *transport.TCP:
+			res.Transport = "TCP"
+		case *transport.TLS:
+			res.Transport = "DoT"
+		case *transport.HTTPS:
+			res.Transport = "DoH"
+		default:
+			return res
+		}
+		if !res.Host {
+			return res
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		ctx = transport.WithTrace(transport.WithFamilyRace(ctx), &transport.Trace{
+			GotRace: func(race transport.Race) { res.Races = append(res.Races, race) },
+		})
+		start := time.Now()
+		resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+		d := time.Since(start)
+		cancel()
+		if err == nil {
+			err = rcodeError(resp)
+		}
+		res.Samples = append(res.Samples, bench.Sample{Duration: d, Err: err})
+		if c, ok := tr.(interface{ CloseIdleConnections() }); ok {
+			c.CloseIdleConnections()
+		}
+	}
+	return res
+}
+
+// wins6 returns how many races IPv6 won.
+func (r EyeballsResult) wins6() int {
+	n := 0
+	for _, race := range r.Races {
+		if race.Addr.Addr().Is6() {
+			n++
+		}
+	}
+	return n
+}
+
+// connects returns the median time to connect over IPv6 and over IPv4,
+// from the winning attempts and the measured losing ones.
+func (r EyeballsResult) connects() (v6, v4 time.Duration) {
+	var d6, d4 []float64
+	for _, race := range r.Races {
+		win, other := &d4, &d6
+		if race.Addr.Addr().Is6() {
+			win, other = &d6, &d4
+		}
+		*win = append(*win, ms(race.Connect))
+		if race.Other > 0 {
+			*other = append(*other, ms(race.Other))
+		}
+	}
+	median := func(v []float64) time.Duration {
+		if len(v) == 0 {
+			return 0
+		}
+		sort.Float64s(v)
+		return time.Duration(bench.Percentile(v, 50) * float64(time.Millisecond))
+	}
+	return median(d6), median(d4)
+}
+
+// verdict sums up which family won and by how much.
+func (r EyeballsResult) verdict() string {
+	switch {
+	case r.Transport == "":
+		return "no TCP connections"
+	case !r.Host:
+		return "server given by address, no race"
+	case len(r.Races) == 0:
+		return "--"
+	}
+	last := r.Races[len(r.Races)-1]
+	switch {
+	case last.IPv6 == 0:
+		return "IPv4 only"
+	case last.IPv4 == 0:
+		return "IPv6 only"
+	}
+	v6, v4 := r.connects()
+	winner, margin := "IPv6", v4-v6
+	if r.wins6()*2 < len(r.Races) {
+		winner, margin = "IPv4", v6-v4
+	}
+	switch {
+	case v6 == 0 || v4 == 0:
+		return winner + " wins, the other family fails"
+	case margin < 0:
+		return fmt.Sprintf("%s wins, though %.1fms slower", winner, -ms(margin))
+	}
+	return fmt.Sprintf("%s wins by %.1fms", winner, ms(margin))
+}
+
+func printEyeballs(results []EyeballsResult) {
+	fmt.Printf("%-12s  %-9s  %-9s  %9s  %8s  %8s  %s\n", "Resolver", "Transport", "Addrs 6/4", "IPv6 won", "IPv6", "IPv4", "Verdict")
+	fmt.Println(strings.Repeat("-", 96))
+	for _, r := range results {
+		addrs, won := "--", "--"
+		if len(r.Races) > 0 {
+			last := r.Races[len(r.Races)-1]
+			addrs = fmt.Sprintf("%d/%d", last.IPv6, last.IPv4)
+			won = fmt.Sprintf("%d/%d", r.wins6(), len(r.Races))
+		}
+		v6, v4 := r.connects()
+		fmt.Printf("%-12s  %-9s  %-9s  %9s  %8s  %8s  %s\n",
+			r.Name, orDash(r.Transport), addrs, won, durFmt(v6), durFmt(v4), r.verdict())
+		for _, e := range uniqueErrors(bench.Summarize(r.Samples).Errors) {
+			fmt.Printf("  ! %s\n", e)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// anyNotes explains the ANY classes in the feature matrix.
+var anyNotes = map[bench.AnyBehavior]string{
+	bench.AnyHINFO:   "RFC 8482 minimal answer",
+	bench.AnyFull:    "full answer (amplification risk)",
+	bench.AnySubset:  "records of one type",
+	bench.AnyEmpty:   "empty NOERROR",
+	bench.AnyRefused: "refused / not implemented",
+	bench.AnyError:   "error response code",
+	bench.AnyDropped: "dropped or timed out",
+}
+
+// probeRefresh runs the prefetch and serve-stale probe against every
+// resolver at the same time, since each spends most of it waiting for the
+// test records to expire, and adds the results to feats.
+func probeRefresh(ctx context.Context, resolvers []bench.Resolver, zone string, timeout time.Duration, feats map[string]bench.Features) map[string]error {
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, r := range resolvers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr, err := transport.New(r.Addr)
+			var cr bench.CacheRefresh
+			if err == nil {
+				cr, err = bench.ProbeCacheRefresh(ctx, tr, zone, timeout)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[r.Name] = err
+				return
+			}
+			f := feats[r.Name]
+			f.Refresh = &cr
+			feats[r.Name] = f
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// refreshCells returns the Prefetch and Stale cells of the feature matrix.
+func refreshCells(cr *bench.CacheRefresh) (prefetch, stale string) {
+	if cr == nil {
+		return "--", "--"
+	}
+	stale = "no"
+	if cr.ServeStale {
+		stale = fmt.Sprintf("yes (TTL %d)", cr.StaleTTL)
+	}
+	return ternary(cr.Prefetch, "yes", "no"), stale
+}
+
+func printFeatures(resolvers []bench.Resolver, feats map[string]bench.Features, errs, refreshErrs map[string]error) {
+	refresh := refreshErrs != nil
+	if refresh {
+		fmt.Printf("%-12s  %6s  %9s  %8s  %-12s  %s\n", "Resolver", "DNSSEC", "Filtering", "Prefetch", "Serve-stale", "ANY")
+	} else {
+		fmt.Printf("%-12s  %6s  %9s  %s\n", "Resolver", "DNSSEC", "Filtering", "ANY")
+	}
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range resolvers {
+		f := feats[r.Name]
+		prefetch, stale := refreshCells(f.Refresh)
+		switch err := errs[r.Name]; {
+		case err != nil && refresh:
+			fmt.Printf("%-12s  %6s  %9s  %8s  %-12s  %s\n  ! %v\n", r.Name, "--", "--", prefetch, stale, "--", err)
+		case err != nil:
+			fmt.Printf("%-12s  %6s  %9s  %s\n  ! %v\n", r.Name, "--", "--", "--", err)
+		case refresh:
+			fmt.Printf("%-12s  %6s  %9s  %8s  %-12s  %-8s  %s\n", r.Name, ternary(f.DNSSEC, "yes", "no"),
+				ternary(f.Filtering, "yes", "no"), prefetch, stale, f.ANY, anyNotes[f.ANY])
+		default:
+			fmt.Printf("%-12s  %6s  %9s  %-8s  %s\n", r.Name, ternary(f.DNSSEC, "yes", "no"),
+				ternary(f.Filtering, "yes", "no"), f.ANY, anyNotes[f.ANY])
+		}
+		if err := refreshErrs[r.Name]; err != nil {
+			fmt.Printf("  ! prefetch/serve-stale probe: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// printGroups reports combined statistics for resolvers given as several
+// addresses (Quad9=9.9.9.9|149.112.112.112), whose addresses have their own
+// rows in the main table, and the range of their medians.
+func printGroups(rows []bench.Result) {
+	groups := bench.CombineGroups(rows)
+	if len(groups) == 0 {
+		return
+	}
+	fmt.Printf("\nCombined over all addresses\n")
+	printTable(groups)
+	for _, g := range groups {
+		var fast, slow *bench.Result
+		for i := range rows {
+			r := &rows[i]
+			if r.Group != g.Name || r.Stats.Successes == 0 {
+				continue
+			}
+			if fast == nil || r.Stats.Median < fast.Stats.Median {
+				fast = r
+			}
+			if slow == nil || r.Stats.Median > slow.Stats.Median {
+				slow = r
+			}
+		}
+		if fast != nil && fast != slow {
+			fmt.Printf("%s: median %s (%s) to %s (%s)\n", g.Name,
+				durFmt(fast.Stats.Median), fast.Name, durFmt(slow.Stats.Median), slow.Name)
+		}
+	}
+}
+
+// printTags reports combined statistics per tag of the resolvers, such as
+// all "isp" resolvers against all "public" ones, and the members of each.
+func printTags(rows []bench.Result) {
+	tags := bench.CombineTags(rows)
+	if len(tags) == 0 {
+		return
+	}
+	fmt.Printf("\nCombined by tag\n")
+	printTable(tags)
+	for _, t := range tags {
+		var members []string
+		for _, r := range rows {
+			if slices.Contains(r.Tags, t.Name) {
+				members = append(members, r.Name)
+			}
+		}
+		fmt.Printf("%s: %s\n", t.Name, strings.Join(members, ", "))
+	}
+}
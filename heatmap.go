@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// heatShades are the cells of a terminal heat map, from fastest to slowest.
+var heatShades = []string{"░", "▒", "▓", "█"}
+
+// heatColors are the 256-color ANSI backgrounds of the same levels as
+// heatShades, from green to red.
+var heatColors = []int{34, 148, 214, 196}
+
+// heatScale maps median latencies onto levels between the fastest and the
+// slowest cell of a heat map, on a logarithmic scale, so that a resolver
+// twice as slow at some hour is the same step up whether it answers in 5ms
+// or 50ms.
+type heatScale struct {
+	lo, hi float64 // log of the fastest and slowest median
+}
+
+func newHeatScale(agg *HourlyAggregate) heatScale {
+	s := heatScale{lo: math.Inf(1), hi: math.Inf(-1)}
+	for _, name := range agg.Names {
+		for h := 0; h < 24; h++ {
+			if m := agg.Stats(name, h).Median; m > 0 {
+				v := math.Log(float64(m))
+				s.lo, s.hi = min(s.lo, v), max(s.hi, v)
+			}
+		}
+	}
+	return s
+}
+
+// at returns the position of median m on the scale, from 0 to 1.
+func (s heatScale) at(m time.Duration) float64 {
+	if s.hi <= s.lo {
+		return 0
+	}
+	return (math.Log(float64(m)) - s.lo) / (s.hi - s.lo)
+}
+
+// level returns the index into heatShades of median m.
+func (s heatScale) level(m time.Duration) int {
+	return min(int(s.at(m)*float64(len(heatShades))), len(heatShades)-1)
+}
+
+// printHeatMap prints a resolver × hour-of-day grid of median latency,
+// two characters per hour, shaded and, with color, colored from green for
+// the fastest to red for the slowest medians. Hours without runs are
+// blank, hours without answers marked with "x".
+func printHeatMap(agg *HourlyAggregate, color bool) {
+	scale := newHeatScale(agg)
+	fmt.Printf("\nMedian latency heat map by hour of day\n")
+	fmt.Printf("%-12s  ", "Resolver")
+	for h := 0; h < 24; h += 3 {
+		fmt.Printf("%-6s", fmt.Sprintf("%02d", h))
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 14+2*24))
+	for _, name := range agg.Names {
+		fmt.Printf("%-12s  ", name)
+		for h := 0; h < 24; h++ {
+			m := agg.Stats(name, h).Median
+			switch {
+			case agg.Runs[h] == 0:
+				fmt.Print("  ")
+			case m <= 0:
+				fmt.Print("xx")
+			case color:
+				fmt.Printf("\033[48;5;%dm%s\033[0m", heatColors[scale.level(m)], "  ")
+			default:
+				fmt.Print(strings.Repeat(heatShades[scale.level(m)], 2))
+			}
+		}
+		fmt.Println()
+	}
+	if math.IsInf(scale.lo, 0) {
+		return
+	}
+	fmt.Printf("\n%-12s  ", "Legend")
+	for i := range heatShades {
+		lo := time.Duration(math.Exp(scale.lo + (scale.hi-scale.lo)*float64(i)/float64(len(heatShades))))
+		cell := strings.Repeat(heatShades[i], 2)
+		if color {
+			cell = fmt.Sprintf("\033[48;5;%dm  \033[0m", heatColors[i])
+		}
+		fmt.Printf("%s %s+  ", cell, durFmt(lo))
+	}
+	fmt.Println()
+}
+
+var heatMapHTML = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>DNS latency by hour of day</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 0.5em; text-align: center; font-size: 0.85em; }
+th.name { text-align: left; }
+td { min-width: 3.2em; border: 1px solid #fff; }
+td.none { background: #eee; color: #999; }
+</style>
+</head>
+<body>
+<h1>DNS latency by hour of day</h1>
+<p>{{.Runs}} runs from {{.From}} to {{.To}}. Cells show the median latency in each local hour of day, from green for the fastest to red for the slowest.</p>
+<table>
+<tr><th class="name">Resolver</th>{{range .Hours}}<th>{{printf "%02d" .}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th class="name">{{.Name}}</th>{{range .Cells}}{{if .Text}}<td style="background: {{.Color}}" title="{{.Title}}">{{.Text}}</td>{{else}}<td class="none">{{.Title}}</td>{{end}}{{end}}</tr>
+{{end}}</table>
+<footer><p>Written by {{.Tool}}, schema version {{.Schema}}.</p></footer>
+</body>
+</html>
+`))
+
+type heatCell struct {
+	Text  string // the median, empty without one
+	Title string
+	Color template.CSS
+}
+
+// writeHeatMapHTML writes the heat map of printHeatMap to path as a
+// standalone HTML page, with a continuous color scale.
+func writeHeatMapHTML(path string, agg *HourlyAggregate, runs int, from, to time.Time) error {
+	scale := newHeatScale(agg)
+	type row struct {
+		Name  string
+		Cells []heatCell
+	}
+	data := struct {
+		Runs     int
+		From, To string
+		Hours    []int
+		Rows     []row
+		Tool     string
+		Schema   int
+	}{
+		Runs: runs, From: from.Local().Format("2006-01-02 15:04"), To: to.Local().Format("2006-01-02 15:04"),
+		Tool: bench.Tool, Schema: bench.RecordVersion,
+	}
+	for h := 0; h < 24; h++ {
+		data.Hours = append(data.Hours, h)
+	}
+	for _, name := range agg.Names {
+		r := row{Name: exportAnonymizer.Text(name)}
+		for h := 0; h < 24; h++ {
+			s := agg.Stats(name, h)
+			var c heatCell
+			switch {
+			case agg.Runs[h] == 0:
+			case s.Successes == 0:
+				c.Title = "x"
+			default:
+				// Hue 120 (green) for the fastest median to 0 (red) for the slowest.
+				c.Text = durFmt(s.Median)
+				c.Title = fmt.Sprintf("%02d:00, %d runs, median %s, p95 %s, %.1f%% answered",
+					h, agg.Runs[h], durFmt(s.Median), durFmt(s.P95), successPct(s))
+				c.Color = template.CSS(fmt.Sprintf("hsl(%.0f, 75%%, 60%%)", 120*(1-scale.at(s.Median))))
+			}
+			r.Cells = append(r.Cells, c)
+		}
+		data.Rows = append(data.Rows, r)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := heatMapHTML.Execute(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// runHooks, when set by -hook-start, -hook-end or -hook-failure, runs
+// commands around every benchmark run of the command line tool, including
+// those of apply and serve-control.
+var runHooks *hooks
+
+// hookTimeout bounds each hook command. Hooks still run when the benchmark
+// is interrupted, so that the end hook learns of the incomplete run.
+const hookTimeout = 30 * time.Second
+
+// hookQueue is the number of failure hooks waiting to run before further
+// failures are dropped, so that a dead resolver cannot start thousands of
+// commands.
+const hookQueue = 100
+
+// HookEvent is the JSON document a hook command receives on stdin. Event
+// is "start", "failure" or "end"; the other fields are set as they apply.
+type HookEvent struct {
+	Event     string         `json:"event"`
+	Time      time.Time      `json:"time"`
+	Started   time.Time      `json:"started"`
+	Host      string         `json:"host,omitempty"`
+	Domain    string         `json:"domain"`
+	Network   string         `json:"network"`
+	QType     string         `json:"qtype,omitempty"`
+	Resolvers []hookResolver `json:"resolvers,omitempty"` // start
+	Sample    *hookSample    `json:"sample,omitempty"`    // failure
+	Complete  *bool          `json:"complete,omitempty"`  // end: false if the run was interrupted
+	ElapsedMs float64        `json:"elapsed_ms,omitempty"`
+	Results   []hookResult   `json:"results,omitempty"`          // end
+	Dropped   int            `json:"dropped_failures,omitempty"` // end: failures without a hook
+}
+
+type hookResolver struct {
+	Name string `json:"name"`
+	Addr string `json:"addr"`
+}
+
+type hookSample struct {
+	Resolver string  `json:"resolver"`
+	Addr     string  `json:"addr"`
+	Index    int     `json:"index"`
+	QName    string  `json:"qname"`
+	Ms       float64 `json:"ms"`
+	Error    string  `json:"error"`
+	SrcPort  int     `json:"src_port,omitempty"`
+	ID       uint16  `json:"id,omitempty"`
+}
+
+type hookResult struct {
+	Resolver   string  `json:"resolver"`
+	Count      int     `json:"count"`
+	Successes  int     `json:"successes"`
+	SuccessPct float64 `json:"success_pct"`
+	MedianMs   float64 `json:"median_ms,omitempty"`
+	P95Ms      float64 `json:"p95_ms,omitempty"`
+	Aborted    bool    `json:"aborted,omitempty"`
+}
+
+// hooks runs shell commands at the start and end of a run and for every
+// failed sample, with a HookEvent as JSON on stdin and its event in
+// DNSBENCH_EVENT. Failure hooks run one at a time in the background, so
+// that they do not hold up the queries; the end hook runs after them.
+type hooks struct {
+	Start, End, Failure string
+}
+
+func newHooks(start, end, failure string) *hooks {
+	if start == "" && end == "" && failure == "" {
+		return nil
+	}
+	return &hooks{Start: start, End: end, Failure: failure}
+}
+
+// hookFlags defines -hook-start, -hook-end and -hook-failure on the flag
+// set of a subcommand and returns a function that sets runHooks from them,
+// to call once fs is parsed.
+func hookFlags(fs *flag.FlagSet) func() {
+	start := fs.String("hook-start", "", "Shell command run before every benchmark run, with the run as JSON on stdin")
+	end := fs.String("hook-end", "", "Shell command run after every benchmark run, with the results as JSON on stdin")
+	failure := fs.String("hook-failure", "", "Shell command run for every failed query, with the sample as JSON on stdin")
+	return func() { runHooks = newHooks(*start, *end, *failure) }
+}
+
+// Run benchmarks with runner, passing its events to onProgress, and runs
+// the hooks; for nil hooks it only runs the benchmark.
+func (h *hooks) Run(ctx context.Context, runner *bench.Runner, onProgress func(bench.Event)) ([]bench.Result, error) {
+	if h == nil {
+		return runner.Run(ctx, onProgress)
+	}
+	started := time.Now()
+	base := HookEvent{Started: started, Host: bench.Host, Domain: runner.Domain, Network: runner.Network}
+	if base.Host == "" {
+		base.Host, _ = os.Hostname()
+	}
+	if runner.QType != 0 {
+		base.QType = runner.QType.String()
+	}
+
+	if h.Start != "" {
+		ev := base
+		ev.Event, ev.Time = "start", started
+		for _, r := range runner.Resolvers {
+			ev.Resolvers = append(ev.Resolvers, hookResolver{Name: r.Name, Addr: r.Addr})
+		}
+		h.exec(ctx, h.Start, ev)
+	}
+
+	queue := make(chan HookEvent, hookQueue)
+	done := make(chan struct{})
+	dropped := 0
+	go func() {
+		defer close(done)
+		for ev := range queue {
+			h.exec(ctx, h.Failure, ev)
+		}
+	}()
+	if h.Failure != "" {
+		next := onProgress
+		onProgress = func(e bench.Event) {
+			if next != nil {
+				next(e)
+			}
+			if e.Kind != bench.EventSample || e.Sample.Err == nil {
+				return
+			}
+			ev := base
+			ev.Event, ev.Time = "failure", time.Now()
+			ev.Sample = &hookSample{
+				Resolver: e.Resolver.Name, Addr: e.Resolver.Addr, Index: e.Index, QName: e.QName,
+				Ms: ms(e.Sample.Duration), Error: e.Sample.Err.Error(), SrcPort: e.Sample.SrcPort, ID: e.Sample.ID,
+			}
+			select {
+			case queue <- ev:
+			default:
+				dropped++
+			}
+		}
+	}
+	rows, err := runner.Run(ctx, onProgress)
+	close(queue)
+	<-done
+	if dropped > 0 {
+		slog.Warn("failure hook skipped for failures beyond its queue", "dropped", dropped)
+	}
+
+	if h.End != "" {
+		ev := base
+		ev.Event, ev.Time = "end", time.Now()
+		complete := err == nil
+		ev.Complete, ev.ElapsedMs, ev.Dropped = &complete, ms(time.Since(started)), dropped
+		for _, r := range rows {
+			s := r.Stats
+			res := hookResult{Resolver: r.Name, Count: s.Count, Successes: s.Successes, SuccessPct: successPct(s), Aborted: r.Aborted}
+			if s.Successes > 0 {
+				res.MedianMs, res.P95Ms = ms(s.Median), ms(s.P95)
+			}
+			ev.Results = append(ev.Results, res)
+		}
+		h.exec(ctx, h.End, ev)
+	}
+	return rows, err
+}
+
+// shellCommand returns the command that runs a command line of the user
+// with sh, or cmd on Windows.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// exec runs command with ev on stdin, with sh, or cmd on Windows. Its
+// output goes to stderr, so that it does not mix with machine-readable
+// results. Failures are logged, not fatal: a broken hook does not stop the
+// benchmark.
+func (h *hooks) exec(ctx context.Context, command string, ev HookEvent) {
+	exportAnonymizer.HookEvent(&ev)
+	body, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("hook event encoding failed", "event", ev.Event, "err", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), hookTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), "DNSBENCH_EVENT="+ev.Event)
+	cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		slog.Error("hook command failed", "event", ev.Event, "err", err)
+	}
+}
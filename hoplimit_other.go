@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// setHopLimit is not implemented here; -trace-on-slow runs the system's
+// traceroute instead.
+func setHopLimit(net.PacketConn, bool, int) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,31 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// setHopLimit sets the IPv4 TTL or IPv6 hop limit of the packets conn sends.
+func setHopLimit(conn net.PacketConn, v6 bool, hops int) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return syscall.EINVAL
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	level, opt := syscall.IPPROTO_IP, syscall.IP_TTL
+	if v6 {
+		level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), level, opt, hops)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
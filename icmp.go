@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"sync/atomic"
+)
+
+// ICMP echo requests of -rtt and -trace-on-slow carry the process ID and a
+// sequence number unique across both, to match replies on raw sockets,
+// which receive every ICMP message of the host.
+var (
+	icmpID  = uint16(os.Getpid())
+	icmpSeq atomic.Uint32
+)
+
+// icmpKind classifies the ICMP messages parseICMP understands.
+type icmpKind int
+
+const (
+	icmpEchoReply    icmpKind = iota + 1
+	icmpTimeExceeded          // from a router on the path, for a hop limit of 0
+	icmpUnreachable
+)
+
+// icmpReply is the echo request an ICMP message answers.
+type icmpReply struct {
+	kind icmpKind
+	seq  uint16
+}
+
+func icmpNetwork(ip netip.Addr) string {
+	if ip.Is6() {
+		return "ip6:ipv6-icmp"
+	}
+	return "ip4:icmp"
+}
+
+// echoRequest returns a new echo request to ip and its sequence number.
+func echoRequest(ip netip.Addr) ([]byte, uint16) {
+	typ := byte(8)
+	if ip.Is6() {
+		typ = 128
+	}
+	seq := uint16(icmpSeq.Add(1))
+	msg := []byte{typ, 0, 0, 0, byte(icmpID >> 8), byte(icmpID), byte(seq >> 8), byte(seq), 'd', 'n', 's', 'b', 'e', 'n', 'c', 'h'}
+	if ip.Is4() {
+		// The kernel fills in the ICMPv6 checksum, but not this one.
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+	return msg, seq
+}
+
+// parseICMP returns the echo request of this process that an ICMP message,
+// as read from a raw socket without the IP header, answers. Errors carry
+// the start of the request that caused them after the IP header.
+func parseICMP(b []byte, v6 bool) (icmpReply, bool) {
+	if len(b) < 8 {
+		return icmpReply{}, false
+	}
+	echoReply, timeExceeded, unreachable := byte(0), byte(11), byte(3)
+	if v6 {
+		echoReply, timeExceeded, unreachable = 129, 3, 1
+	}
+	var kind icmpKind
+	switch b[0] {
+	case echoReply:
+		return echoID(icmpEchoReply, b)
+	case timeExceeded:
+		kind = icmpTimeExceeded
+	case unreachable:
+		kind = icmpUnreachable
+	default:
+		return icmpReply{}, false
+	}
+	inner := b[8:]
+	if v6 {
+		if len(inner) < 40 {
+			return icmpReply{}, false
+		}
+		inner = inner[40:]
+	} else {
+		if len(inner) < 20 || len(inner) < int(inner[0]&0x0f)*4 {
+			return icmpReply{}, false
+		}
+		inner = inner[int(inner[0]&0x0f)*4:]
+	}
+	return echoID(kind, inner)
+}
+
+func echoID(kind icmpKind, b []byte) (icmpReply, bool) {
+	if len(b) < 8 || binary.BigEndian.Uint16(b[4:]) != icmpID {
+		return icmpReply{}, false
+	}
+	return icmpReply{kind: kind, seq: binary.BigEndian.Uint16(b[6:])}, true
+}
+
+// icmpChecksum is the Internet checksum of RFC 1071.
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+func sameIP(a net.Addr, ip netip.Addr) bool {
+	src, ok := a.(*net.IPAddr)
+	return ok && src.IP.Equal(ip.AsSlice())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// idleBisections is how many gaps the idle probe tries between the longest
+// gap a connection survived and the shortest it did not.
+const idleBisections = 3
+
+// IdleProbeResult is the outcome of the idle timeout probe for one
+// resolver: the server kept a connection open over an idle gap of KeptOpen
+// and closed it within ClosedBy, zero if no gap up to the maximum did.
+type IdleProbeResult struct {
+	Name      string
+	Transport string // "" for transports without connections
+	KeptOpen  time.Duration
+	ClosedBy  time.Duration
+	Gaps      int // gaps tried
+	Err       error
+}
+
+// idleGaps returns the idle gaps of the probe: 1s, 2s, 4s, ... up to and
+// including max.
+func idleGaps(max time.Duration) []time.Duration {
+	var gaps []time.Duration
+	for g := time.Second; g < max; g *= 2 {
+		gaps = append(gaps, g)
+	}
+	return append(gaps, max)
+}
+
+// probeIdleTimeout finds how long the server of a TCP, DoT or DoH resolver
+// keeps an idle connection open. It sends a query, waits for a gap and
+// sends another over the same connection, with the gap doubling until the
+// server closes the connection in between, then bisects between the last
+// gap the connection survived and that one. This is the longest a
+// forwarder can leave a connection to the server unused and still reuse it.
+func probeIdleTimeout(r bench.Resolver, name string, qtype dnsmsg.Type, max, timeout time.Duration) IdleProbeResult {
+	res := IdleProbeResult{Name: r.Name}
+	tr, err := transport.New(r.Addr)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	switch t := tr.(type) {
+	case *transport.TCP:
+		t.Pool, res.Transport = 1, "TCP"
+	case *transport.TLS:
+		t.Pool, res.Transport = 1, "DoT"
+	case *transport.HTTPS:
+		t.LimitConns(1)
+		if ht, ok := t.Client.Transport.(*http.Transport); ok {
+			ht.IdleConnTimeout = 0 // the client must not close it first
+		}
+		res.Transport = "DoH"
+	default:
+		return res
+	}
+	defer func() {
+		if c, ok := tr.(interface{ CloseIdleConnections() }); ok {
+			c.CloseIdleConnections()
+		}
+	}()
+
+	// query reports whether the query went over a connection kept open
+	// from the one before.
+	query := func() (bool, error) {
+		var reused bool
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		ctx = transport.WithTrace(ctx, &transport.Trace{GotConn: func(r bool) { reused = r }})
+		resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+		if err == nil {
+			err = rcodeError(resp)
+		}
+		return reused, err
+	}
+	// survives reports whether a connection stays open over an idle gap.
+	survives := func(gap time.Duration) (bool, error) {
+		res.Gaps++
+		if _, err := query(); err != nil {
+			return false, err
+		}
+		time.Sleep(gap)
+		return query()
+	}
+
+	for _, gap := range idleGaps(max) {
+		ok, err := survives(gap)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		if !ok {
+			res.ClosedBy = gap
+			break
+		}
+		res.KeptOpen = gap
+	}
+	if res.ClosedBy == 0 {
+		return res
+	}
+	for range idleBisections {
+		gap := (res.KeptOpen + res.ClosedBy) / 2
+		if res.ClosedBy-res.KeptOpen < time.Second {
+			break
+		}
+		ok, err := survives(gap)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		if ok {
+			res.KeptOpen = gap
+		} else {
+			res.ClosedBy = gap
+		}
+	}
+	return res
+}
+
+// probeIdleTimeouts probes the resolvers at the same time, since each
+// spends most of the probe waiting.
+func probeIdleTimeouts(resolvers []bench.Resolver, name string, qtype dnsmsg.Type, max, timeout time.Duration) []IdleProbeResult {
+	results := make([]IdleProbeResult, len(resolvers))
+	var wg sync.WaitGroup
+	for i, r := range resolvers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probeIdleTimeout(r, name, qtype, max, timeout)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func printIdleProbe(results []IdleProbeResult, max time.Duration) {
+	fmt.Printf("%-12s  %-9s  %9s  %9s  %s\n", "Resolver", "Transport", "Kept open", "Closed by", "Idle timeout")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range results {
+		kept, closed, verdict := "--", "--", "--"
+		switch {
+		case r.Transport == "":
+			verdict = "no connections (plain DNS over UDP)"
+		case r.Err != nil:
+		case r.ClosedBy == 0:
+			kept = r.KeptOpen.String()
+			verdict = fmt.Sprintf("over %v", max)
+		default:
+			if r.KeptOpen > 0 {
+				kept = r.KeptOpen.String()
+			}
+			closed = r.ClosedBy.String()
+			verdict = fmt.Sprintf("%v to %v", r.KeptOpen, r.ClosedBy)
+			if r.KeptOpen == 0 {
+				verdict = "under " + r.ClosedBy.String()
+			}
+		}
+		fmt.Printf("%-12s  %-9s  %9s  %9s  %s\n", r.Name, orDash(r.Transport), kept, closed, verdict)
+		if r.Err != nil {
+			fmt.Printf("  ! %s\n", r.Err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/idna"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// idnTestSet are registered internationalized names that exercise the
+// Punycode cases resolvers and their upstream paths most often get wrong.
+var idnTestSet = []struct {
+	Name string
+	Note string
+}{
+	{"münchen.de", "Latin letter with umlaut"},
+	{"faß.de", "sharp s, distinct from fass.de since IDNA2008"},
+	{"правительство.рф", "Cyrillic label under a Cyrillic TLD"},
+	{"中国互联网络信息中心.中国", "long CJK label under a CJK TLD"},
+	{"i❤.ws", "emoji, registered before IDNA2008 disallowed them"},
+	{"XN--MNCHEN-3YA.DE", "upper-case ACE label"},
+}
+
+// IDNResult is how one resolver answered each name of idnTestSet.
+type IDNResult struct {
+	Name   string
+	Status []string // per test name: "ok", "nodata", "nxdomain", another rcode, or "error"
+}
+
+// probeIDN sends an A query for the ASCII form of each test name.
+func probeIDN(resolvers []bench.Resolver, names []string, timeout time.Duration) []IDNResult {
+	var results []IDNResult
+	for _, r := range resolvers {
+		res := IDNResult{Name: r.Name}
+		tr, err := transport.New(r.Addr)
+		for _, name := range names {
+			if err != nil {
+				res.Status = append(res.Status, "error")
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			resp, qerr := tr.SendQuery(ctx, dnsmsg.NewQuery(name, dnsmsg.TypeA))
+			cancel()
+			res.Status = append(res.Status, idnStatus(resp, qerr))
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func idnStatus(resp *dnsmsg.Message, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case resp.RCode == dnsmsg.RCodeSuccess && len(resp.Answers) > 0:
+		return "ok"
+	case resp.RCode == dnsmsg.RCodeSuccess:
+		return "nodata"
+	}
+	return strings.ToLower(resp.RCode.String())
+}
+
+// idnNames returns the ASCII form of each test name.
+func idnNames() ([]string, error) {
+	names := make([]string, len(idnTestSet))
+	for i, t := range idnTestSet {
+		var err error
+		if names[i], err = idna.ToASCII(t.Name); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// printIDN lists the test names and each resolver's answers. A resolver
+// agrees on a name when it answered like most resolvers did.
+func printIDN(results []IDNResult, names []string) {
+	for i, t := range idnTestSet {
+		fmt.Printf("#%d  %s -> %s (%s)\n", i+1, t.Name, names[i], t.Note)
+	}
+	fmt.Println()
+
+	majority := make([]string, len(names))
+	for i := range names {
+		counts := make(map[string]int)
+		for _, r := range results {
+			if counts[r.Status[i]]++; counts[r.Status[i]] > counts[majority[i]] {
+				majority[i] = r.Status[i]
+			}
+		}
+	}
+
+	fmt.Printf("%-12s", "Resolver")
+	for i := range names {
+		fmt.Printf("  %-9s", fmt.Sprintf("#%d", i+1))
+	}
+	fmt.Printf("  %s\n", "Agree")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range results {
+		agree := 0
+		fmt.Printf("%-12s", r.Name)
+		for i, s := range r.Status {
+			mark := " "
+			if s == majority[i] {
+				agree++
+			} else {
+				mark = "*"
+			}
+			fmt.Printf("  %-9s", s+mark)
+		}
+		fmt.Printf("  %d/%d\n", agree, len(names))
+	}
+	fmt.Printf("\n* differs from the majority answer.\n")
+}
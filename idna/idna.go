@@ -0,0 +1,230 @@
+// Package idna converts internationalized domain names between their
+// Unicode form and the ASCII form sent in queries, where each non-ASCII
+// label is Punycode-encoded (RFC 3492) behind the "xn--" prefix.
+//
+// Labels are lower-cased but not otherwise normalized or checked against
+// the IDNA2008 rules, so that names a registry should reject can still be
+// sent to resolvers as given.
+package idna
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const acePrefix = "xn--"
+
+// Punycode parameters (RFC 3492, section 5).
+const (
+	base        = 36
+	tmin        = 1
+	tmax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+)
+
+var errOverflow = errors.New("idna: punycode overflow")
+
+// dots are the label separators IDNA recognizes besides ".".
+var dots = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCII returns the ASCII form of a domain name. ASCII labels are kept
+// as they are, apart from lower-casing non-ASCII ones before encoding.
+func ToASCII(name string) (string, error) {
+	labels := strings.Split(dots.Replace(name), ".")
+	for i, l := range labels {
+		if isASCII(l) {
+			continue
+		}
+		enc, err := encode(strings.ToLower(l))
+		if err != nil {
+			return "", fmt.Errorf("idna: label %q: %w", l, err)
+		}
+		if len(acePrefix)+len(enc) > 63 {
+			return "", fmt.Errorf("idna: label %q is longer than 63 bytes when encoded", l)
+		}
+		labels[i] = acePrefix + enc
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// ToUnicode returns the Unicode form of a domain name, decoding every
+// label with the (case-insensitive) "xn--" prefix.
+func ToUnicode(name string) (string, error) {
+	labels := strings.Split(name, ".")
+	for i, l := range labels {
+		if len(l) < len(acePrefix) || !strings.EqualFold(l[:len(acePrefix)], acePrefix) {
+			continue
+		}
+		dec, err := decode(strings.ToLower(l[len(acePrefix):]))
+		if err != nil {
+			return "", fmt.Errorf("idna: label %q: %w", l, err)
+		}
+		labels[i] = dec
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// encode is the Punycode encoding procedure of RFC 3492, section 6.3.
+func encode(s string) (string, error) {
+	input := []rune(s)
+	var out []byte
+	for _, r := range input {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	b := len(out)
+	h := b
+	if b > 0 {
+		out = append(out, '-')
+	}
+	n, delta, bias := rune(initialN), 0, initialBias
+	for h < len(input) {
+		m := rune(unicode.MaxRune + 1)
+		for _, r := range input {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (maxInt-delta)/(h+1) {
+			return "", errOverflow
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := base; ; k += base {
+				t := threshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, digit(t+(q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out = append(out, digit(q))
+			bias = adapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+// decode is the Punycode decoding procedure of RFC 3492, section 6.2.
+func decode(s string) (string, error) {
+	var out []rune
+	pos := 0
+	if b := strings.LastIndexByte(s, '-'); b >= 0 {
+		for i := 0; i < b; i++ {
+			if s[i] >= utf8.RuneSelf {
+				return "", errors.New("idna: non-ASCII in punycode")
+			}
+			out = append(out, rune(s[i]))
+		}
+		pos = b + 1
+	}
+	n, i, bias := rune(initialN), 0, initialBias
+	for pos < len(s) {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos == len(s) {
+				return "", errors.New("idna: truncated punycode")
+			}
+			d, ok := digitValue(s[pos])
+			pos++
+			if !ok {
+				return "", fmt.Errorf("idna: invalid punycode digit %q", s[pos-1])
+			}
+			if d > (maxInt-i)/w {
+				return "", errOverflow
+			}
+			i += d * w
+			t := threshold(k, bias)
+			if d < t {
+				break
+			}
+			if w > maxInt/(base-t) {
+				return "", errOverflow
+			}
+			w *= base - t
+		}
+		bias = adapt(i-oldi, len(out)+1, oldi == 0)
+		if i/(len(out)+1) > unicode.MaxRune-int(n) {
+			return "", errOverflow
+		}
+		n += rune(i / (len(out) + 1))
+		i %= len(out) + 1
+		out = append(out[:i], append([]rune{n}, out[i:]...)...)
+		i++
+	}
+	return string(out), nil
+}
+
+const maxInt = int(^uint32(0) >> 1) // bound used for overflow checks, as in RFC 3492
+
+func threshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return tmin
+	case k >= bias+tmax:
+		return tmax
+	}
+	return k - bias
+}
+
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > (base-tmin)*tmax/2 {
+		delta /= base - tmin
+		k += base
+	}
+	return k + (base-tmin+1)*delta/(delta+skew)
+}
+
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func digitValue(c byte) (int, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
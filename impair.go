@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// parseImpairment parses an -impair value such as
+// "loss=5%,delay=50ms,jitter=10ms". Loss is a percentage or a fraction.
+func parseImpairment(s string) (transport.Impairment, error) {
+	var imp transport.Impairment
+	for _, part := range splitList(s) {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return imp, fmt.Errorf("-impair %q: want key=value, e.g. loss=5%%,delay=50ms,jitter=10ms", part)
+		}
+		var err error
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "loss":
+			val = strings.TrimSpace(val)
+			if pct, ok := strings.CutSuffix(val, "%"); ok {
+				imp.Loss, err = strconv.ParseFloat(pct, 64)
+				imp.Loss /= 100
+			} else {
+				imp.Loss, err = strconv.ParseFloat(val, 64)
+			}
+		case "delay":
+			imp.Delay, err = time.ParseDuration(strings.TrimSpace(val))
+		case "jitter":
+			imp.Jitter, err = time.ParseDuration(strings.TrimSpace(val))
+		default:
+			return imp, fmt.Errorf("-impair: unknown key %q (want loss, delay or jitter)", key)
+		}
+		if err != nil {
+			return imp, fmt.Errorf("-impair %s: %v", key, err)
+		}
+	}
+	return imp, nil
+}
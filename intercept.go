@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// interceptBogusServers are documentation addresses (RFC 5737) on which no
+// DNS server answers. An answer from one of them was made up by a device on
+// the path that redirects all DNS traffic.
+var interceptBogusServers = []string{"192.0.2.53", "198.51.100.53", "203.0.113.53"}
+
+// interceptEgressName answers with the address of the resolver that asks
+// Akamai's name servers for it: the egress address of the resolver.
+const interceptEgressName = "whoami.akamai.net"
+
+// interceptResult is the outcome of -intercept-check.
+type interceptResult struct {
+	Bogus  []string                    // bogus servers that answered
+	Egress map[string][]bench.Resolver // egress address -> resolvers that used it
+	Failed []string                    // resolvers whose egress is unknown
+}
+
+// intercepted reports a device on the path answering DNS queries itself.
+func (r interceptResult) intercepted() bool { return len(r.Bogus) > 0 }
+
+// sharedEgress returns the egress addresses used by more than one service,
+// which distinct services do not share, in a stable order. The addresses
+// of one group, such as Quad9=9.9.9.9|149.112.112.112, are one service.
+func (r interceptResult) sharedEgress() []string {
+	var out []string
+	for addr, rs := range r.Egress {
+		services := make(map[string]bool)
+		for _, res := range rs {
+			services[ternary(res.Group != "", res.Group, res.Name)] = true
+		}
+		if len(services) > 1 {
+			out = append(out, addr)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// checkInterception sends queries to the interceptBogusServers and asks
+// each plain DNS resolver for its egress address. Encrypted resolvers are
+// skipped, since a device on the path cannot answer for them.
+func checkInterception(ctx context.Context, resolvers []bench.Resolver, timeout time.Duration) interceptResult {
+	res := interceptResult{Egress: make(map[string][]bench.Resolver)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, addr := range interceptBogusServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr := &transport.UDP{Addr: addr + ":53", NoTCPFallback: true}
+			qctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			if _, err := tr.SendQuery(qctx, dnsmsg.NewQuery("example.com", dnsmsg.TypeA)); err == nil {
+				mu.Lock()
+				res.Bogus = append(res.Bogus, addr)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, r := range resolvers {
+		if s := transport.Scheme(r.Addr); s != "udp" && s != "tcp" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			egress := ""
+			if tr, err := transport.New(r.Addr); err == nil {
+				qctx, cancel := context.WithTimeout(ctx, timeout)
+				if ips, err := bench.LookupIP(qctx, tr, interceptEgressName, dnsmsg.TypeA); err == nil {
+					egress = ips[0].String()
+				}
+				cancel()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if egress == "" {
+				res.Failed = append(res.Failed, r.Name)
+			} else {
+				res.Egress[egress] = append(res.Egress[egress], r)
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Strings(res.Bogus)
+	sort.Strings(res.Failed)
+	for _, rs := range res.Egress {
+		sort.Slice(rs, func(i, j int) bool { return rs[i].Name < rs[j].Name })
+	}
+	return res
+}
+
+// printInterception reports the interception check to w and warns when
+// the results may measure an interceptor instead of the configured
+// resolvers.
+func printInterception(w io.Writer, r interceptResult) {
+	fmt.Fprintf(w, "DNS interception check\n")
+	if r.intercepted() {
+		fmt.Fprintf(w, "! Answers came from %s, where no DNS server runs: the network intercepts DNS\n", strings.Join(r.Bogus, ", "))
+		fmt.Fprintf(w, "! and answers itself. Plain DNS results below measure the interceptor, not the\n")
+		fmt.Fprintf(w, "! configured resolvers. Use tls:// or https:// resolvers to get past it.\n")
+	} else {
+		fmt.Fprintf(w, "No answers from %d addresses where no DNS server runs.\n", len(interceptBogusServers))
+	}
+	shared := r.sharedEgress()
+	for _, addr := range shared {
+		names := make([]string, len(r.Egress[addr]))
+		for i, res := range r.Egress[addr] {
+			names[i] = res.Name
+		}
+		fmt.Fprintf(w, "! %s reach the internet from the same address, %s: one resolver may answer for all.\n",
+			strings.Join(names, ", "), addr)
+	}
+	if len(shared) == 0 && len(r.Egress) > 1 {
+		fmt.Fprintf(w, "Each resolver queried the internet from its own address.\n")
+	}
+	if len(r.Failed) > 0 {
+		fmt.Fprintf(w, "Egress address unknown for %s (no answer to %s).\n", strings.Join(r.Failed, ", "), interceptEgressName)
+	}
+	fmt.Fprintln(w, strings.Repeat("-", 80))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+const (
+	// nodeLocalDNSAddr is the link-local address NodeLocal DNSCache
+	// listens on by default.
+	nodeLocalDNSAddr = "169.254.20.10"
+	// kubeDefaultName is the name -preset kubernetes queries by default:
+	// the API server's service, which exists in every cluster, in the short
+	// form pods use.
+	kubeDefaultName = "kubernetes.default"
+)
+
+// kubeDNSServices are the names the cluster DNS service goes by, in
+// kube-system: kube-dns, kept by CoreDNS for compatibility, and coredns.
+var kubeDNSServices = []string{"kube-dns", "coredns"}
+
+// kubeResolvers returns the name servers of a pod's resolv.conf, named
+// after what they are: the cluster DNS service, whose ClusterIP it looks up
+// as kube-dns.kube-system.svc.<cluster domain>, or NodeLocal DNSCache. If
+// the pod uses a node-local cache, the cluster DNS service is benchmarked
+// too and paired with the cache for the overhead report.
+func kubeResolvers(o presetOptions) ([]bench.Resolver, []OverheadPair, error) {
+	path := ternary(o.Source != "", o.Source, "/etc/resolv.conf")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	servers := parseResolvConf(string(b))
+	search, _ := parseResolvSearch(string(b))
+	domain, ok := kubeClusterDomain(search)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s has no svc.<cluster domain> search domain; run inside a pod", path)
+	}
+	if len(servers) == 0 {
+		return nil, nil, fmt.Errorf("no name servers in %s", path)
+	}
+	var clusterIP string
+	if !o.DryRun {
+		if clusterIP, err = kubeDNSClusterIP(servers[0].Addr, domain); err != nil {
+			slog.Warn("cannot look up the cluster DNS service", "err", err)
+		}
+	}
+	var rs []bench.Resolver
+	var pairs []OverheadPair
+	for i, s := range servers {
+		switch s.Addr {
+		case clusterIP:
+			s.Name = "kube-dns"
+		case nodeLocalDNSAddr:
+			s.Name = "NodeLocalDNS"
+		default:
+			s.Name = fmt.Sprintf("ClusterDNS#%d", i+1)
+		}
+		rs = append(rs, s)
+	}
+	if clusterIP != "" && !hasResolver(rs, "kube-dns") {
+		for _, s := range rs {
+			pairs = append(pairs, OverheadPair{Name: s.Name, Baseline: "kube-dns"})
+		}
+		rs = append(rs, bench.Resolver{Name: "kube-dns", Addr: clusterIP})
+	}
+	return rs, pairs, nil
+}
+
+func hasResolver(rs []bench.Resolver, name string) bool {
+	for _, r := range rs {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// kubeClusterDomain returns the cluster domain from the search list of a
+// pod, which kubelet writes as <namespace>.svc.<domain> svc.<domain>
+// <domain>.
+func kubeClusterDomain(search []string) (string, bool) {
+	for _, s := range search {
+		if d, ok := strings.CutPrefix(strings.Trim(s, "."), "svc."); ok && d != "" {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// kubeDNSClusterIP asks server for the ClusterIP of the cluster DNS
+// service.
+func kubeDNSClusterIP(server, domain string) (string, error) {
+	tr, err := transport.New(server)
+	if err != nil {
+		return "", err
+	}
+	for _, svc := range kubeDNSServices {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		ips, lerr := bench.LookupIP(ctx, tr, svc+".kube-system.svc."+domain+".", bench.QType("ip4"))
+		cancel()
+		if lerr == nil {
+			return ips[0].String(), nil
+		}
+		err = lerr
+	}
+	return "", err
+}
+
+// kubeNodeName returns the node a pod runs on, from $NODE_NAME, which a
+// DaemonSet sets from spec.nodeName, or "" outside one.
+func kubeNodeName() string {
+	return os.Getenv("NODE_NAME")
+}
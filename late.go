@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// printLate splits each resolver's answers at the soft timeout: answers
+// within it are on time, later ones are late successes that a client with
+// that timeout would have given up on and retried, and the rest failed
+// within the hard timeout. Latency percentiles are given for both kinds.
+func printLate(rows []bench.Result, soft, hard time.Duration) {
+	fmt.Printf("\nOn-time and late answers (soft timeout %v, hard timeout %v)\n", soft, hard)
+	fmt.Printf("%-12s  %8s  %6s  %7s  %8s  %8s  %8s  %8s\n",
+		"Resolver", "On time", "Late", "Failed", "On med", "On p95", "Late med", "Late p95")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, r := range rows {
+		var onTime, late []float64
+		for _, s := range r.Samples {
+			switch {
+			case s.Err != nil:
+			case s.Duration <= soft:
+				onTime = append(onTime, ms(s.Duration))
+			default:
+				late = append(late, ms(s.Duration))
+			}
+		}
+		n := len(r.Samples)
+		if n == 0 {
+			fmt.Printf("%-12s  %8s  %6s  %7s\n", r.Name, "--", "--", "--")
+			continue
+		}
+		pct := func(k int) string { return fmt.Sprintf("%.1f%%", 100*float64(k)/float64(n)) }
+		failed := n - len(onTime) - len(late)
+		line := fmt.Sprintf("%-12s  %8s  %6s  %7s  %8s  %8s  %8s  %8s", r.Name,
+			pct(len(onTime)), pct(len(late)), pct(failed),
+			pctl(onTime, 50), pctl(onTime, 95), pctl(late, 50), pctl(late, 95))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	fmt.Printf("\nLate answers arrived after %v: a client with that timeout would already have retried.\n", soft)
+}
+
+// pctl returns the p-th percentile of the millisecond values, or "--".
+func pctl(v []float64, p float64) string {
+	if len(v) == 0 {
+		return "--"
+	}
+	sorted := append([]float64(nil), v...)
+	sort.Float64s(sorted)
+	return durFmt(time.Duration(bench.Percentile(sorted, p) * float64(time.Millisecond)))
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+)
+
+// logLevel is the level of the default logger. Logs go to stderr, so they
+// never mix with the tables and machine-readable output on stdout.
+var logLevel slog.LevelVar
+
+func setupLogging() {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel})))
+}
+
+// logLevelFlag adds -log-level to fs.
+func logLevelFlag(fs *flag.FlagSet) {
+	fs.TextVar(&logLevel, "log-level", &logLevel, "Log level: debug (every query, connection and ignored response), info, warn or error")
+}
@@ -2,227 +2,1272 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/csv"
 	"flag"
 	"fmt"
-	"math"
-	"net"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
-	"sort"
+	"os/signal"
+	"runtime"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
-)
 
-type Sample struct {
-	Duration time.Duration
-	Err      error
-}
+	"github.com/ohidurbappy/dns-bench/bench"
+	_ "github.com/ohidurbappy/dns-bench/dnscrypt"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/idna"
+	_ "github.com/ohidurbappy/dns-bench/odoh"
+	"github.com/ohidurbappy/dns-bench/pcap"
+	"github.com/ohidurbappy/dns-bench/schedule"
+	"github.com/ohidurbappy/dns-bench/stamp"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
 
-type Stats struct {
-	Count       int
-	Successes   int
-	Min         time.Duration
-	Max         time.Duration
-	Avg         time.Duration
-	Median      time.Duration
-	P95         time.Duration
-	Errors      []error
-	DurationsMs []float64
-}
+// selfResolverName names the local iterative resolution of -recursive-self.
+const selfResolverName = "Self"
 
-type ResolverCfg struct {
-	Name string
-	Addr string // host or host:port (port defaults to 53 if omitted)
-}
+// defaultResolvers are benchmarked when -resolvers is not given.
+const defaultResolvers = "Cloudflare=1.1.1.1,Google=8.8.8.8,Quad9=9.9.9.9,OpenDNS=208.67.222.222,AdGuard=94.140.14.14"
 
-type Row struct {
-	Name    string
-	Stats   Stats
-	Samples []Sample
+func main() {
+	setupLogging()
+	bench.Tool = "dnsbench " + version()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version", "-version", "--version":
+			os.Exit(runVersion(os.Args[2:]))
+		case "aggregate":
+			os.Exit(runAggregate(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "export-config":
+			os.Exit(runExportConfig(os.Args[2:]))
+		case "serve-api":
+			os.Exit(runServeAPI(os.Args[2:]))
+		case "serve-control":
+			os.Exit(runServeControl(os.Args[2:]))
+		case "apply":
+			os.Exit(runApply(os.Args[2:]))
+		case "scaling":
+			os.Exit(runScaling(os.Args[2:]))
+		case "selftest":
+			os.Exit(runSelfTest(os.Args[2:]))
+		}
+	}
+	os.Exit(runBenchmark())
 }
 
-func main() {
+// runBenchmark is the command without a subcommand: it returns the exit
+// code for main, once the deferred pcap and dump writers are closed, which
+// os.Exit would skip.
+func runBenchmark() int {
 	domain := flag.String("domain", "example.com", "Domain to resolve")
 	count := flag.Int("count", 10, "Number of queries per resolver")
+	duration := flag.Duration("duration", 0, "Query each resolver for this long, e.g. 30s, instead of -count times")
+	tail := flag.Bool("tail", false, "Also print p99, p99.9 and p99.99 latency per resolver, for long runs")
+	maxSamples := flag.Int("max-samples", 0, "Keep at most N samples per resolver in memory, a random subset for exports and sample-based reports, while the statistics cover every query (for long -duration runs)")
+	rttMethod := flag.String("rtt", "", "Measure the network round trip to each server before every query, with a tcp handshake or icmp echo (needs root), and report resolver time without it")
+	traceOnSlow := flag.Duration("trace-on-slow", 0, "Trace the network path to every resolver with a median above this (e.g. 100ms) or no answers, for reporting to the network operator")
+	dohMethod := flag.String("doh-method", dohPost, "HTTP method of DoH queries: post, get (cacheable by HTTP caches and CDNs) or compare (run both and show the difference)")
+	udpSockets := flag.String("udp-sockets", socketsFresh, "UDP sockets for plain DNS queries: fresh (a new socket and port per query), reuse (one per resolver, as stub resolvers do) or compare (run both and show the difference)")
+	pathsSpec := flag.String("paths", "", "Run the benchmark through two network paths and compare them, as Name=interface or Name=mark:N for a routing mark, e.g. tunnel=wg0,direct=eth0 (Linux)")
+	impair := flag.String("impair", "", "Simulate a degraded network on this program's own sockets, e.g. loss=5%,delay=50ms,jitter=10ms")
+	transportSpec := flag.String("transport", "", "Answer queries without the network: mock:FILE benchmarks the resolvers of a scenario file, with its scripted latencies and response codes, for demos and offline runs. The file is a subset of YAML: block maps and lists, and flow lists only for script; flow maps such as rcodes: {SERVFAIL: 2%} are not supported")
+	interceptCheck := flag.Bool("intercept-check", false, "Before the benchmark, check whether the network intercepts DNS and answers itself, which plain DNS results would then measure")
+	spoofCheck := flag.Bool("spoof-check", false, "Report UDP responses that do not match their query: wrong ID, question or source address, or a second, different answer")
+	osResolver := flag.Bool("os-resolver", false, "Also look names up through this machine's resolver library, getaddrinfo (OS-libc) and Go's built-in resolver (OS-Go), and compare them with direct queries to the first system resolver")
+	recursiveSelf := flag.Bool("recursive-self", false, "Also resolve every query locally from the root servers, as a baseline for what the resolvers save")
+	browserSim := flag.Bool("browser-sim", false, "Send A, AAAA and HTTPS queries in parallel for every sample, as browsers do, and time the bundle until all are answered")
+	pageLoad := flag.Bool("page-load", false, "Estimate how the measured latency affects loading a web page")
+	pageDomains := flag.Int("page-domains", defaultPageDomains, "Host names per page for -page-load")
+	profileName := flag.String("profile", "", "Scenario preset for -count, -timeout, -concurrency and the mix of query types and uncached names: "+profileNames())
+	dryRun := flag.Bool("dry-run", false, "Print the resolvers, transports, query names and schedule of the run without sending any query")
+	seed := flag.Uint64("seed", 0, "Seed for cache-busting labels and workload sampling, so runs with the same seed send the same names (0 = random)")
+	distribution := flag.String("distribution", "", "How -workload names are picked: in turn (default), or zipf[:S] for a power-law popularity with exponent S (default 1)")
+	workload := flag.String("workload", "", "Query many domains in turn instead of -domain: tranco[:N] or umbrella[:N] for a top-sites list (downloaded and cached), file:PATH[:N], or dnsperf:PATH[:N] for a dnsperf query file of names and types; -count defaults to N")
 	timeout := flag.Duration("timeout", 1500*time.Millisecond, "Per-query timeout (e.g. 1500ms, 2s)")
+	softTimeout := flag.Duration("soft-timeout", 0, "Report answers slower than this but within -timeout separately, as late successes")
 	network := flag.String("network", "ip4", "Network: ip4 or ip6 (A vs AAAA)")
+	qtypeName := flag.String("qtype", "", "Record type to query instead of A/AAAA, e.g. HTTPS or SVCB (reports the decoded answers)")
+	searchList := flag.String("search", "", "Resolve names through this comma-separated search list, or that of /etc/resolv.conf with \"system\", as stub resolvers do, and report the extra queries")
+	ndots := flag.Int("ndots", 1, "Dots a name needs to be tried as is before the -search domains (resolv.conf ndots option)")
 	cold := flag.Bool("cold", false, "Cold mode: use random subdomain each query to bust resolver cache")
-	resolversCSV := flag.String("resolvers", "Cloudflare=1.1.1.1,Google=8.8.8.8,Quad9=9.9.9.9,OpenDNS=208.67.222.222,AdGuard=94.140.14.14", "Resolvers as Name=IP[,Name=IP...]")
-	outCSV := flag.String("out", "", "Optional path to write CSV results")
+	coldWarm := flag.Bool("cold-warm", false, "Alternate cold and warm queries for the same name and report the paired difference, the cache benefit, per resolver")
+	resolversCSV := flag.String("resolvers", defaultResolvers, "Resolvers as Name=Addr[,Name=Addr...], or Name=Addr|Addr for several addresses of one service; Addr is IP[:port] (UDP) or tcp://, tls://, quic://, https://, odoh:// URL, or sdns:// stamp")
+	presetName := flag.String("preset", "", "Resolver preset: pihole or adguardhome (local proxy vs. its upstreams), root or tld (authoritative servers), kubernetes (cluster DNS from a pod), docker (container DNS vs. the host's and -resolvers)")
+	localAddr := flag.String("local", "127.0.0.1", "Address of the local DNS proxy for -preset pihole/adguardhome")
+	tlds := flag.String("tlds", "com,net,org", "Comma-separated zones whose name servers -preset tld benchmarks")
+	localConfig := flag.String("local-config", "", "Config file or API URL the -preset reads upstreams from, resolv.conf for kubernetes and docker (default: the usual install path)")
+	bootstrapAddr := flag.String("bootstrap", "", "Plain DNS server (IP[:port]) used to resolve resolver host names like dns.nextdns.io (default: system resolver)")
+	operators := flag.String("operators", operatorsBuiltin, "Report who runs each resolver (ASN, operator, country): builtin from a table of public resolvers, online to also look others up at Team Cymru's IP to ASN service over DNS, or off")
+	flag.BoolVar(&privacyColumn, "privacy", false, "Add the logging policy, filtering and jurisdiction of known public resolvers to the results table")
+	pin := flag.Bool("pin", false, "Resolve resolver host names once at startup and connect to the same address for the whole run")
+	system := flag.Bool("system", false, "Also benchmark the system's configured resolvers (per adapter on Windows, else /etc/resolv.conf and, on Linux, the per-link servers of systemd-resolved or NetworkManager)")
+	siteCheck := flag.Int("site-check", 0, "Ask each resolver for its anycast site (CHAOS id.server) before the first and then every N queries, flagging site changes")
+	concurrency := flag.Int("concurrency", 1, "Number of resolvers to benchmark at the same time")
+	rate := flag.Float64("rate", 0, "Send each resolver at most N queries per second (0 = as fast as answered)")
+	tfo := flag.Bool("tfo", false, "Open TCP and DoT connections with TCP Fast Open (Linux only); the query rides in the SYN once the kernel holds the server's cookie")
+	wireTiming := flag.Bool("wire-timing", false, "Time each query from writing it to the socket to reading its response, leaving out packing, connection setup and parsing, and report that overhead, for sub-millisecond comparisons")
+	phases := flag.Bool("phases", false, "Split each sample into packing the query, the network and parsing the response, and rank resolvers by the network time alone")
+	busyPoll := flag.Bool("busy-poll", false, "Wait for UDP and TCP answers by polling the socket instead of sleeping, keeping the scheduler's wakeup out of the timing at the cost of a CPU per query in flight (Unix)")
+	cpuBusy := flag.Float64("cpu-busy", 0, "Warn when other processes keep the host's CPUs more than this percentage busy, which inflates latencies, and count the queries sent meanwhile (Linux)")
+	cpuPause := flag.Bool("cpu-pause", false, "With -cpu-busy, pause the queries while the host's CPUs are busy")
+	pinCPU := flag.Bool("pin-cpu", false, "Lock the goroutine sending each resolver's queries to a thread of its own, bound to one CPU on Linux, for steadier timing on busy machines")
+	gomaxprocs := flag.Int("gomaxprocs", 0, "Run the benchmark on at most N threads at a time, as GOMAXPROCS does (0 = one per CPU)")
+	connsPerResolver := flag.Int("conns-per-resolver", 0, "Keep up to N TCP, DoT or DoH connections to each resolver open and reuse them, as forwarders do (0 = a new TCP or DoT connection per query)")
+	retries := flag.Int("retries", 0, "Resend a query that timed out or failed on the network up to N times, counting all attempts in its time")
+	abortAfter := flag.Int("abort-after-errors", 0, "Stop querying a resolver after N consecutive failures (0 = never)")
+	format := flag.String("format", "text", "Output format: text, nagios for a monitoring plugin status line with perfdata and exit code, zabbix for zabbix_sender input with discovery data, or dnsperf for dnsperf's statistics block per resolver")
+	zabbixHost := flag.String("zabbix-host", "-", "Host name for -format zabbix items (\"-\" uses the zabbix_sender configuration)")
+	warnP95 := flag.Duration("warn-p95", 0, "With -format nagios, WARNING when a resolver's p95 reaches this latency")
+	critP95 := flag.Duration("crit-p95", 0, "With -format nagios, CRITICAL when a resolver's p95 reaches this latency")
+	warnSuccess := flag.Float64("warn-success", 0, "With -format nagios, WARNING when a resolver's success rate falls below this percentage")
+	critSuccess := flag.Float64("crit-success", 0, "With -format nagios, CRITICAL when a resolver's success rate falls below this percentage")
+	selectN := flag.Int("select", 0, "Print only the best N plain DNS resolvers, ranked by the score profile of -config if it has one, for provisioning scripts")
+	selectFormat := flag.String("select-format", selectIPs, "Output of -select: ips (one per line), resolv.conf, dnsmasq, unbound (forward-zone) or coredns (forward plugin)")
+	tmplText := flag.String("template", "", "Print the results with this Go text/template (or @file) instead of the tables, e.g. for monitoring plugins or chat messages")
+	outCSV := flag.String("out", "", "Optional path to write CSV results, an Excel workbook for a .xlsx path, or a Parquet file of the samples for a .parquet path")
+	csvLayout := flag.String("csv-layout", csvMixed, "Layout of the -out CSV: mixed (summary and samples in one file), long (one tidy table, a row per sample with run columns) or split (NAME-summary.csv and NAME-samples.csv)")
+	dns64 := flag.Bool("dns64", false, "DNS64 mode: detect the NAT64 prefix and benchmark synthesized AAAA answers for an IPv4-only domain")
+	mtuProbe := flag.Bool("mtu-probe", false, "Probe UDP fragmentation: query a large answer with EDNS buffer sizes from 512 to 4096 and report the largest response size that reliably arrives")
+	mtuQuery := flag.String("mtu-query", defaultMTUQuery, "Name and type whose large answer -mtu-probe queries, with DNSSEC records")
+	negCache := flag.Bool("negcache", false, "Probe negative caching: repeat an NXDOMAIN query and report each resolver's negative-cache TTL")
+	dohCache := flag.Bool("doh-cache", false, "Probe HTTP caching of DoH resolvers: repeat -domain as identical GET requests and report the HTTP status, Cache-Control and Age headers and CDN cache hits")
+	tfoProbe := flag.Bool("tfo-probe", false, "Probe TCP Fast Open (Linux only): query TCP and DoT resolvers over new connections with and without it, and report whether each accepts data in the SYN and the latency saved")
+	eyeballs := flag.Bool("happy-eyeballs", false, "Probe Happy Eyeballs: connect to TCP, DoT and DoH resolvers given by host name racing IPv6 and IPv4 (RFC 8305), and report which family won and by how much")
+	idleProbe := flag.Bool("idle-probe", false, "Probe how long each TCP, DoT or DoH server keeps an idle connection open, with idle gaps doubling from 1s up to -idle-max")
+	idleMax := flag.Duration("idle-max", 2*time.Minute, "Longest idle gap -idle-probe tries")
+	ttlProbe := flag.Bool("ttlprobe", false, "Probe cache-duration behavior: follow the answer TTL of -domain and classify each resolver as honoring TTL, prefetching or serving stale")
+	cnameProbe := flag.Bool("cname", false, "Measure CNAME chain depth per resolver, its latency correlation, and flag resolvers that flatten chains")
+	cnameDomains := flag.String("cname-domains", defaultCNAMEDomains, "Comma-separated CNAME-heavy domains used by -cname")
+	featureMatrix := flag.Bool("features", false, "Probe resolver features (DNSSEC validation, filtering, ANY query handling) and print a matrix")
+	testZoneName := flag.String("test-zone", "", "Zone you operate with the record layout of the README's Test Zone section; cold queries, -features, -stale-zone, -mtu-probe, -negcache and -ttlprobe then use its names")
+	staleZone := flag.String("stale-zone", "", "Zone with a wildcard A record of a short TTL (20s to 5m, not 30s) for -features to detect prefetching and serve-stale with names below it")
+	idnProbe := flag.Bool("idn", false, "Probe how resolvers answer internationalized (Punycode) names and print a comparison")
+	naptrDomains := flag.String("naptr", "", "Benchmark SIP service discovery: resolve the NAPTR -> SRV -> A chain of these comma-separated domains")
+	overhead := flag.String("overhead", "", "Report latency overhead of resolvers over baselines as Name=Baseline[,...] (e.g. ODoH=DoH)")
+	proxyOverhead := flag.String("proxy-overhead", "", "Send identical cold queries to a forwarder and its upstream at once and report the paired difference, as local=ADDR,upstream=ADDR")
+	probeInterval := flag.Duration("probe-interval", time.Second, "Delay between repeated queries in probe modes")
+	anonymize := flag.Bool("anonymize", false, "Replace private IP addresses, this host's name and names under -internal-domains with stable pseudonyms in CSV files, saved runs, -template and -format output and hook events")
+	internalDomains := flag.String("internal-domains", defaultInternalDomains, "Comma-separated domain suffixes whose names -anonymize replaces")
+	saveDir := flag.String("save", "", "Directory to save each run to as JSON, for the aggregate subcommand")
+	configPath := flag.String("config", "", "Optional JSON config file (e.g. a scoring profile)")
+	scoreOut := flag.String("score-out", "", "Write composite scores as \"score<TAB>name\" lines, best first, to this file (needs a score profile)")
+	webAddr := flag.String("web", "", "Serve the results web UI on this address (e.g. :8080) instead of running once")
+	watch := flag.Duration("watch", 0, "Watch mode: rerun the benchmark at this interval (e.g. 1m) until interrupted")
+	trendRuns := flag.Int("trend", 20, "In -watch and -schedule mode, show a sparkline of each resolver's last N medians in the results table (0 = off)")
+	hookStart := flag.String("hook-start", "", "Shell command run before every benchmark run, with the run as JSON on stdin")
+	hookEnd := flag.String("hook-end", "", "Shell command run after every benchmark run, with the results as JSON on stdin")
+	filterExpr := flag.String("filter", "", `Count only the samples matching this expression toward the results, e.g. 'duration_ms < 500 && rcode == "NOERROR"'`)
+	hookFailure := flag.String("hook-failure", "", "Shell command run for every failed query, with the sample as JSON on stdin")
+	alertP95 := flag.Duration("alert-p95", 0, "In -watch/-schedule mode, alert when a resolver's p95 exceeds this latency")
+	alertSuccess := flag.Float64("alert-success", 0, "In -watch/-schedule mode, alert when a resolver's success rate falls below this percentage")
+	alertAfter := flag.Int("alert-after", 3, "Consecutive breaching runs before an alert fires")
+	alertExec := flag.String("alert-exec", "", "Shell command run on alert; details are in DNSBENCH_* environment variables")
+	alertWebhook := flag.String("alert-webhook", "", "URL to POST alerts to as JSON")
+	pcapPath := flag.String("pcap", "", "Write every DNS query and response to this pcap file for Wireshark (encrypted transports in plaintext)")
+	dumpDir := flag.String("dump-responses", "", "Write every response to a benchmark query to this directory, raw and decoded, named by resolver and run index")
+	scheduleSpec := flag.String("schedule", "", "Cron expression (e.g. \"*/30 * * * *\") to rerun the benchmark on; results are aggregated by hour of day until interrupted")
+	logLevelFlag(flag.CommandLine)
 	flag.Parse()
 
-	resolvers := parseResolvers(*resolversCSV)
+	profile, ok := profiles[*profileName]
+	if *profileName != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Unknown profile %q (want %s)\n", *profileName, profileNames())
+		return 1
+	}
+	if ok {
+		if !flagSet("count") {
+			*count = profile.count
+		}
+		if !flagSet("timeout") {
+			*timeout = profile.timeout
+		}
+		if !flagSet("concurrency") {
+			*concurrency = profile.concurrency
+		}
+		if profile.domain != "" && !flagSet("domain") {
+			*domain = profile.domain
+		}
+	}
+	if *browserSim && (*qtypeName != "" || *dns64) {
+		fmt.Fprintln(os.Stderr, "-browser-sim sends its own query types and cannot be combined with -qtype or -dns64")
+		return 1
+	}
+	var qtypeMix []dnsmsg.Type
+	if *qtypeName == "" && !*dns64 && !*browserSim {
+		qtypeMix = profile.qtypes
+	}
+
+	mode := ternary(*cold, "COLD", "WARM")
+	if !*cold && profile.coldShare > 0 {
+		mode = fmt.Sprintf("%.0f%% COLD", profile.coldShare*100)
+	}
+	if *coldWarm {
+		if *cold || profile.coldShare > 0 {
+			fmt.Fprintln(os.Stderr, "-cold-warm alternates cold and warm queries itself and cannot be combined with -cold or a -profile with uncached names")
+			return 1
+		}
+		mode = "COLD/WARM"
+	}
+	if *browserSim {
+		mode += "+BROWSER"
+	}
+	if *dns64 {
+		*network = "ip6"
+		mode += "+DNS64"
+		if !flagSet("domain") {
+			*domain = bench.IPv4OnlyName
+		}
+	}
+	zone := parseTestZone(*testZoneName)
+	zoneNames := zone != "" && !flagSet("domain") && profile.domain == "" && !*dns64
+	if zone != "" {
+		if zoneNames {
+			*domain = zone.name(zoneWild)
+		}
+		if !flagSet("stale-zone") {
+			*staleZone = zone.name(zoneTTL)
+		}
+		if !flagSet("mtu-query") {
+			*mtuQuery = zone.name(zoneLarge) + " TXT"
+		}
+		featureNames.Signed, featureNames.BadSigned = zone.name(""), zone.name(zoneBogus)
+	}
+
+	var qtype dnsmsg.Type
+	if *qtypeName != "" {
+		var err error
+		if qtype, err = dnsmsg.ParseType(*qtypeName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if qtype == dnsmsg.TypeHTTPS && !flagSet("domain") {
+			*domain = defaultHTTPSDomain
+		}
+	}
+
+	if *bootstrapAddr != "" {
+		transport.SetBootstrap(*bootstrapAddr)
+	}
+	if *impair != "" {
+		imp, err := parseImpairment(*impair)
+		if err == nil {
+			err = transport.SetImpairment(imp)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	var scenario *transport.Scenario
+	if *transportSpec != "" {
+		path, ok := strings.CutPrefix(*transportSpec, "mock:")
+		if !ok {
+			fmt.Fprintln(os.Stderr, "-transport: want mock:FILE")
+			return 1
+		}
+		var err error
+		if scenario, err = transport.LoadScenario(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		transport.UseScenario(scenario)
+	}
+	probeMode := *proxyOverhead != "" || *featureMatrix || *naptrDomains != "" || *idnProbe || *negCache || *ttlProbe || *dohCache || *idleProbe || *tfoProbe || *eyeballs || *cnameProbe || *mtuProbe
+	if flagSet("stale-zone") && !*featureMatrix {
+		fmt.Fprintln(os.Stderr, "-stale-zone applies to -features")
+		return 1
+	}
+	if *dryRun && probeMode {
+		fmt.Fprintln(os.Stderr, "-dry-run plans benchmark runs and cannot be combined with probe modes")
+		return 1
+	}
+	if (*tfo || *tfoProbe) && runtime.GOOS != "linux" {
+		fmt.Fprintln(os.Stderr, "-tfo and -tfo-probe need Linux")
+		return 1
+	}
+	if *softTimeout < 0 || *softTimeout > 0 && *softTimeout >= *timeout {
+		fmt.Fprintln(os.Stderr, "-soft-timeout must be shorter than -timeout, which is the hard timeout")
+		return 1
+	}
+	if *cpuBusy < 0 || *cpuBusy >= 100 {
+		fmt.Fprintln(os.Stderr, "-cpu-busy wants a percentage from 0 up to 100")
+		return 1
+	}
+	if *cpuPause && *cpuBusy == 0 {
+		fmt.Fprintln(os.Stderr, "-cpu-pause needs -cpu-busy")
+		return 1
+	}
+	if *gomaxprocs > 0 {
+		runtime.GOMAXPROCS(*gomaxprocs)
+	}
+	if *duration > 0 && (probeMode || flagSet("count")) {
+		fmt.Fprintln(os.Stderr, "-duration replaces -count in benchmark runs and cannot be combined with -count or probe modes")
+		return 1
+	}
+
+	// Unicode names are queried in their ASCII (Punycode) form.
+	for _, p := range []*string{domain, cnameDomains, naptrDomains} {
+		names := strings.Split(*p, ",")
+		for i, n := range names {
+			var err error
+			if names[i], err = idna.ToASCII(strings.TrimSpace(n)); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		*p = strings.Join(names, ",")
+	}
+	// The probes of a name that must not exist or must have a known TTL
+	// query below these, which a test zone has, rather than -domain.
+	negDomain, ttlDomain := *domain, *domain
+	if zoneNames {
+		negDomain, ttlDomain = zone.name(""), bench.RandomLabel()+"."+zone.name(zoneTTL)
+	}
+
+	resolvers := bench.ParseResolvers(*resolversCSV)
+	if scenario != nil && !flagSet("resolvers") {
+		resolvers = mockResolvers(scenario)
+	}
+	overheadPairs := parseOverheadPairs(*overhead)
+	if *presetName != "" {
+		p, ok := presets[*presetName]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown preset %q\n", *presetName)
+			return 1
+		}
+		rs, pairs, err := p.build(presetOptions{Local: *localAddr, Source: *localConfig, TLDs: splitList(*tlds), DryRun: *dryRun})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Preset %s: %v\n", *presetName, err)
+			return 1
+		}
+		switch {
+		case p.withResolvers:
+			resolvers = append(rs, resolvers...)
+		case flagSet("resolvers"):
+			resolvers = append(resolvers, rs...)
+		default:
+			resolvers = rs
+		}
+		overheadPairs = append(overheadPairs, pairs...)
+		if p.nonRecursive {
+			mode += "+NORECURSE"
+		}
+		if p.domain != "" && !flagSet("domain") {
+			*domain = p.domain
+		}
+		if p.perNode && kubeNodeName() != "" {
+			bench.Host = kubeNodeName()
+		}
+	}
+	var systemLinks []string
+	if *system {
+		sys, links, err := systemResolvers()
+		if err != nil {
+			slog.Warn("cannot read system resolvers", "err", err)
+		}
+		resolvers = append(resolvers, sys...)
+		systemLinks = links
+	}
+	var osBaseline bench.Resolver
+	if *osResolver {
+		sys, _, err := systemResolvers()
+		if err != nil || len(sys) == 0 {
+			slog.Warn("no system resolver to compare the OS resolver with", "err", err)
+		} else {
+			osBaseline = sys[0]
+			if !*system {
+				resolvers = append(resolvers, osBaseline)
+			}
+		}
+		for _, r := range osResolvers {
+			resolvers = append(resolvers, r)
+			if osBaseline.Name != "" {
+				overheadPairs = append(overheadPairs, OverheadPair{Name: r.Name, Baseline: osBaseline.Name})
+			}
+		}
+	}
+	if *recursiveSelf {
+		for _, r := range resolvers {
+			overheadPairs = append(overheadPairs, OverheadPair{Name: r.Name, Baseline: selfResolverName})
+		}
+		resolvers = append(resolvers, bench.Resolver{Name: selfResolverName, Addr: "iterative://"})
+	}
 	if len(resolvers) == 0 {
 		fmt.Println("No resolvers provided.")
-		os.Exit(1)
+		return 1
+	}
+	if !*dryRun {
+		resolveServerHosts(resolvers, *pin, *timeout)
+	}
+	switch *operators {
+	case operatorsOff, operatorsBuiltin, operatorsOnline:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown -operators %q (want builtin, online or off)\n", *operators)
+		return 1
+	}
+	// A dry run sends no queries, so it only reads the builtin table, which
+	// also holds the policies of -privacy.
+	opMode := *operators
+	if (*dryRun && opMode == operatorsOnline) || (privacyColumn && opMode == operatorsOff) {
+		opMode = operatorsBuiltin
 	}
+	findOperators(context.Background(), resolvers, opMode, *timeout)
 
-	fmt.Printf("DNS Benchmark\n")
-	fmt.Printf("Target: %s | Runs: %d | Timeout: %v | Network: %s | Mode: %s\n",
-		*domain, *count, *timeout, *network, ternary(*cold, "COLD", "WARM"))
-	fmt.Println(strings.Repeat("-", 80))
+	var cfg Config
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
 
-	rows := make([]Row, 0, len(resolvers))
+	switch *csvLayout {
+	case csvMixed, csvLong, csvSplit:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown CSV layout %q (want mixed, long or split)\n", *csvLayout)
+		return 1
+	}
 
-	for _, r := range resolvers {
-		samples := make([]Sample, 0, *count)
-		for i := 0; i < *count; i++ {
-			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
-			qname := *domain
-			if *cold {
-				qname = randomLabel() + "." + *domain
+	if (isXLSX(*outCSV) || isParquet(*outCSV)) && flagSet("csv-layout") {
+		fmt.Fprintln(os.Stderr, "-csv-layout applies to CSV files, not to .xlsx or .parquet files")
+		return 1
+	}
+
+	switch *format {
+	case "text", "nagios", "zabbix", "dnsperf":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q\n", *format)
+		return 1
+	}
+	if *format == "dnsperf" && (*maxSamples > 0 || *filterExpr != "") {
+		// dnsperf counts every query sent, which needs all the samples.
+		fmt.Fprintln(os.Stderr, "-format dnsperf counts every query and cannot be combined with -max-samples or -filter")
+		return 1
+	}
+
+	var tmpl *template.Template
+	if *tmplText != "" {
+		var err error
+		if tmpl, err = parseTemplate(*tmplText); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if *anonymize {
+		var err error
+		if exportAnonymizer, err = newAnonymizer(splitList(*internalDomains)); err != nil {
+			fmt.Fprintf(os.Stderr, "Anonymize: %v\n", err)
+			return 1
+		}
+	}
+
+	runHooks = newHooks(*hookStart, *hookEnd, *hookFailure)
+
+	var paths []namedPath
+	if *pathsSpec != "" {
+		var err error
+		if paths, err = parsePaths(*pathsSpec); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	var sched *schedule.Schedule
+	if *scheduleSpec != "" {
+		var err error
+		if sched, err = schedule.Parse(*scheduleSpec); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if isXLSX(*outCSV) || isParquet(*outCSV) {
+			fmt.Fprintln(os.Stderr, "-schedule writes its hour-of-day table to -out as CSV, not as .xlsx or .parquet")
+			return 1
+		}
+		if *csvLayout != csvMixed {
+			fmt.Fprintln(os.Stderr, "-csv-layout applies to the CSV of a single run, not to the hour-of-day CSV of -schedule")
+			return 1
+		}
+	}
+
+	if *anonymize && (*pcapPath != "" || *dumpDir != "") {
+		fmt.Fprintln(os.Stderr, "-pcap and -dump-responses write the packets as they are and cannot be combined with -anonymize")
+		return 1
+	}
+	if *pcapPath != "" && !*dryRun {
+		f, err := os.Create(*pcapPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		pw, err := pcap.NewWriter(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pcap: %v\n", err)
+			return 1
+		}
+		transport.AddTap(pw)
+		defer func() {
+			if err := pw.Close(); err != nil {
+				slog.Error("pcap write failed", "path", *pcapPath, "err", err)
 			}
-			start := time.Now()
-			err := lookup(ctx, r.Addr, qname, *network)
-			d := time.Since(start)
-			cancel()
+		}()
+	}
 
-			samples = append(samples, Sample{Duration: d, Err: err})
+	if *dumpDir != "" && !*dryRun {
+		d, err := newResponseDumper(*dumpDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-		stats := summarize(samples)
-		rows = append(rows, Row{Name: r.Name, Stats: stats, Samples: samples})
+		transport.AddTap(d)
+		defer func() {
+			if err := d.Close(); err != nil {
+				slog.Error("response dump failed", "dir", *dumpDir, "err", err)
+			}
+		}()
 	}
 
-	printTable(rows)
+	var suspects *suspectLog
+	if *spoofCheck && !*dryRun {
+		transport.SetSpoofCheck(true)
+		suspects = newSuspectLog()
+	}
 
-	if *outCSV != "" {
-		if err := writeCSV(*outCSV, rows); err != nil {
-			fmt.Fprintf(os.Stderr, "CSV write error: %v\n", err)
-			os.Exit(1)
+	if *proxyOverhead != "" {
+		local, upstream, err := parseProxyOverhead(*proxyOverhead)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-		fmt.Printf("\nCSV written to: %s\n", *outCSV)
+		fmt.Printf("DNS Forwarder Overhead\n")
+		fmt.Printf("Local: %s | Upstream: %s | Target: <random>.%s | Pairs: %d | Timeout: %v\n",
+			local.Addr, upstream.Addr, *domain, *count, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		printProxyOverhead(probeProxyOverhead(local, upstream, *domain, *network, *count, *timeout))
+		return 0
 	}
-}
 
-func parseResolvers(s string) []ResolverCfg {
-	parts := strings.Split(s, ",")
-	var out []ResolverCfg
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
+	if *featureMatrix {
+		fmt.Printf("DNS Resolver Features\n")
+		fmt.Printf("DNSSEC: %s, %s | Filtering: %s | ANY: %s | Timeout: %v per query\n",
+			featureNames.Signed, featureNames.BadSigned, featureNames.Block, featureNames.Any, *timeout)
+		if *staleZone != "" {
+			fmt.Printf("Prefetch and serve-stale: random names below %s, taking about their TTL\n", *staleZone)
 		}
-		kv := strings.SplitN(p, "=", 2)
-		if len(kv) != 2 {
-			continue
+		fmt.Println(strings.Repeat("-", 80))
+		feats, errs := probeFeatures(context.Background(), resolvers, *timeout)
+		var refreshErrs map[string]error
+		if *staleZone != "" {
+			refreshErrs = probeRefresh(context.Background(), resolvers, strings.TrimSuffix(*staleZone, "."), *timeout, feats)
 		}
-		name := strings.TrimSpace(kv[0])
-		addr := strings.TrimSpace(kv[1])
-		out = append(out, ResolverCfg{Name: name, Addr: addr})
+		printFeatures(resolvers, feats, errs, refreshErrs)
+		return 0
 	}
-	return out
-}
 
-// lookup performs a single A/AAAA lookup against a specific resolver using net.Resolver.
-func lookup(ctx context.Context, resolverAddr, name, network string) error {
-	host, port, ok := strings.Cut(resolverAddr, ":")
-	if !ok {
-		host = resolverAddr
-		port = "53"
+	if *naptrDomains != "" {
+		domains := splitList(*naptrDomains)
+		fmt.Printf("DNS Service Discovery Chain (NAPTR -> SRV -> %s)\n", bench.QType(*network))
+		fmt.Printf("Domains: %s | Runs: %d | Timeout: %v per query\n", strings.Join(domains, ","), *count, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]ChainResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeNAPTR(r, domains, bench.QType(*network), *count, *timeout))
+		}
+		printNAPTR(results)
+		return 0
 	}
-	r := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, n, address string) (net.Conn, error) {
-			d := &net.Dialer{}
-			return d.DialContext(ctx, "udp", net.JoinHostPort(host, port))
-		},
+
+	if *idnProbe {
+		names, err := idnNames()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("IDN Handling\n")
+		fmt.Printf("Names: %d | Query: A | Timeout: %v\n", len(names), *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		printIDN(probeIDN(resolvers, names, *timeout), names)
+		return 0
 	}
 
-	switch strings.ToLower(network) {
-	case "ip4", "ipv4":
-		_, err := r.LookupIP(ctx, "ip4", name)
-		return err
-	case "ip6", "ipv6":
-		_, err := r.LookupIP(ctx, "ip6", name)
-		return err
-	default:
-		_, err := r.LookupIP(ctx, "ip4", name)
-		return err
+	if *mtuProbe {
+		name, qtype, err := parseMTUQuery(*mtuQuery)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("UDP Fragmentation / MTU Probe\n")
+		fmt.Printf("Query: %s %s +dnssec | Queries: %d per size | Timeout: %v\n", name, qtype, *count, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]MTUResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeMTU(r, name, qtype, *count, *timeout))
+		}
+		printMTU(results)
+		return 0
 	}
-}
 
-func summarize(samples []Sample) Stats {
-	var stats Stats
-	stats.Count = len(samples)
-	stats.Min = time.Duration(math.MaxInt64)
-	for _, s := range samples {
-		if s.Err == nil {
-			stats.Successes++
-			if s.Duration < stats.Min {
-				stats.Min = s.Duration
-			}
-			if s.Duration > stats.Max {
-				stats.Max = s.Duration
+	if *negCache {
+		fmt.Printf("DNS Negative Caching Probe\n")
+		fmt.Printf("Target: <random>.%s | Queries: %d | Interval: %v | Timeout: %v\n",
+			negDomain, *count, *probeInterval, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]NegCacheResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeNegCache(r, negDomain, *count, *probeInterval, *timeout))
+		}
+		printNegCache(results)
+		return 0
+	}
+
+	if *ttlProbe {
+		fmt.Printf("DNS Cache Duration Probe\n")
+		fmt.Printf("Target: %s | Queries: %d | Interval: %v | Window: %v | Timeout: %v\n",
+			ttlDomain, *count, *probeInterval, time.Duration(max(*count-1, 0))*(*probeInterval), *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]TTLProbeResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeTTL(r, ttlDomain, bench.QType(*network), *count, *probeInterval, *timeout))
+		}
+		printTTLProbe(results)
+		return 0
+	}
+
+	if *dohCache {
+		fmt.Printf("DoH HTTP Caching Probe\n")
+		fmt.Printf("Target: %s | GET requests: %d | Interval: %v | Timeout: %v\n",
+			*domain, *count, *probeInterval, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]DoHCacheResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeDoHCache(r, *domain, bench.QType(*network), *count, *probeInterval, *timeout))
+		}
+		printDoHCache(results)
+		return 0
+	}
+
+	if *idleProbe {
+		if *idleMax < time.Second {
+			fmt.Fprintln(os.Stderr, "-idle-max must be at least 1s")
+			return 1
+		}
+		fmt.Printf("Connection Idle Timeout Probe\n")
+		fmt.Printf("Target: %s | Idle gaps: 1s to %v | Timeout: %v\n", *domain, *idleMax, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		printIdleProbe(probeIdleTimeouts(resolvers, *domain, bench.QType(*network), *idleMax, *timeout), *idleMax)
+		return 0
+	}
+
+	if *tfoProbe {
+		fmt.Printf("TCP Fast Open Probe\n")
+		fmt.Printf("Target: %s | Queries: %d with and %d without | Interval: %v | Timeout: %v\n",
+			*domain, *count, *count, *probeInterval, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]FastOpenResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeFastOpen(r, *domain, bench.QType(*network), *count, *probeInterval, *timeout))
+		}
+		printFastOpen(results)
+		return 0
+	}
+
+	if *eyeballs {
+		fmt.Printf("Happy Eyeballs Probe\n")
+		fmt.Printf("Target: %s | Connections: %d | Interval: %v | Timeout: %v\n",
+			*domain, *count, *probeInterval, *timeout)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]EyeballsResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeEyeballs(r, *domain, bench.QType(*network), *count, *probeInterval, *timeout))
+		}
+		printEyeballs(results)
+		return 0
+	}
+
+	if *cnameProbe {
+		domains := splitList(*cnameDomains)
+		fmt.Printf("DNS CNAME Chain Probe\n")
+		fmt.Printf("Domains: %s | Runs: %d | Timeout: %v | Network: %s\n",
+			strings.Join(domains, ","), *count, *timeout, *network)
+		fmt.Println(strings.Repeat("-", 80))
+		results := make([]CNAMEResult, 0, len(resolvers))
+		for _, r := range resolvers {
+			results = append(results, probeCNAME(r, domains, bench.QType(*network), *count, *timeout))
+		}
+		markFlattened(results)
+		printCNAME(results)
+		return 0
+	}
+
+	var domains []string
+	var domainTypes []dnsmsg.Type
+	if *workload != "" {
+		var err error
+		if domains, domainTypes, err = loadWorkload(*workload, time.Minute, *dryRun); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		*domain = *workload
+		if !flagSet("count") && *duration == 0 {
+			*count = len(domains)
+		}
+	}
+	zipf, err := parseDistribution(*distribution)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	runner := &bench.Runner{
+		Resolvers: resolvers,
+		Domain:    *domain,
+		Count:     *count,
+		Duration:  *duration,
+		Timeout:   *timeout,
+		Network:   *network,
+		Cold:      *cold,
+		ColdWarm:  *coldWarm,
+		DNS64:     *dns64,
+		QType:     qtype,
+		QTypeMix:  qtypeMix,
+		ColdShare: profile.coldShare,
+		Domains:   domains,
+
+		DomainTypes:      domainTypes,
+		BrowserSim:       *browserSim,
+		ZipfExponent:     zipf,
+		Seed:             *seed,
+		Concurrency:      *concurrency,
+		AbortAfterErrors: *abortAfter,
+		NonRecursive:     presets[*presetName].nonRecursive,
+		SiteCheckEvery:   *siteCheck,
+		MaxSamples:       *maxSamples,
+		Rate:             *rate,
+		Retries:          *retries,
+		ConnsPerResolver: *connsPerResolver,
+		FastOpen:         *tfo,
+		WireTiming:       *wireTiming,
+		BusyPoll:         *busyPoll,
+		Phases:           *phases,
+		BusyCPU:          *cpuBusy / 100,
+		PauseWhenBusy:    *cpuPause,
+		PinCPU:           *pinCPU,
+	}
+	if *searchList != "" || presets[*presetName].search {
+		conf := ""
+		switch {
+		case *searchList == "system":
+			conf = "/etc/resolv.conf"
+		case *searchList == "":
+			conf = ternary(*localConfig != "", *localConfig, "/etc/resolv.conf")
+		}
+		if runner.Search, runner.Ndots, err = searchConfig(*searchList, conf); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if flagSet("ndots") {
+			runner.Ndots = *ndots
+		}
+		if *browserSim || *dns64 {
+			fmt.Fprintln(os.Stderr, "Queries through a search list cannot be combined with -browser-sim or -dns64")
+			return 1
+		}
+	} else if flagSet("ndots") {
+		fmt.Fprintln(os.Stderr, "-ndots applies to a search list; set one with -search")
+		return 1
+	}
+	if *filterExpr != "" {
+		if runner.Filter, err = bench.ParseFilter(*filterExpr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *rttMethod != "" {
+		if runner.RTT, err = rttProbe(*rttMethod); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *dryRun {
+		printPlan(runner, planOptions{
+			Mode: mode, Pin: *pin, Bootstrap: *bootstrapAddr,
+			Schedule: sched, Watch: *watch, Web: *webAddr,
+			Outputs: dryRunOutputs(map[string]string{
+				"CSV": *outCSV, "saved runs": *saveDir, "pcap": *pcapPath, "response dumps": *dumpDir,
+				"template": *tmplText, "format": ternary(*format == "text", "", *format),
+				"selection": ternary(*selectN > 0, fmt.Sprintf("best %d as %s", *selectN, *selectFormat), ""),
+			}),
+		})
+		return 0
+	}
+
+	if *selectN > 0 && (tmpl != nil || *format != "text") {
+		fmt.Fprintln(os.Stderr, "-select prints its own output and cannot be combined with -template or -format")
+		return 1
+	}
+	if err := writeSelection(io.Discard, *selectFormat, nil, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "-select-format:", err)
+		return 1
+	}
+	quiet := tmpl != nil || *format != "text" || *selectN > 0
+	if quiet && (sched != nil || *watch > 0 || *webAddr != "") {
+		fmt.Fprintln(os.Stderr, "-template, -format and -select apply to single runs and cannot be combined with -schedule, -watch or -web")
+		return 1
+	}
+	if len(paths) > 0 && (quiet || sched != nil || *watch > 0 || *webAddr != "") {
+		fmt.Fprintln(os.Stderr, "-paths prints its own comparison and cannot be combined with -template, -format, -select, -schedule, -watch or -web")
+		return 1
+	}
+	if *osResolver && (qtype != 0 && qtype != dnsmsg.TypeA && qtype != dnsmsg.TypeAAAA || len(qtypeMix) > 0 || *browserSim || !addressTypes(domainTypes)) {
+		fmt.Fprintln(os.Stderr, "-os-resolver looks up addresses only and cannot be combined with -qtype other than A or AAAA, a query type mix, -browser-sim or a dnsperf workload with other types")
+		return 1
+	}
+	switch *udpSockets {
+	case socketsFresh:
+	case socketsReuse:
+		runner.ReuseSockets = true
+	case socketsCompare:
+		if len(paths) > 0 || quiet || sched != nil || *watch > 0 || *webAddr != "" {
+			fmt.Fprintln(os.Stderr, "-udp-sockets compare prints its own comparison and cannot be combined with -paths, -template, -format, -select, -schedule, -watch or -web")
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown -udp-sockets %q (want fresh, reuse or compare)\n", *udpSockets)
+		return 1
+	}
+	switch *dohMethod {
+	case dohPost:
+	case dohGet:
+		runner.DoHMethod = http.MethodGet
+	case dohCompare:
+		if len(paths) > 0 || quiet || sched != nil || *watch > 0 || *webAddr != "" || *udpSockets == socketsCompare {
+			fmt.Fprintln(os.Stderr, "-doh-method compare prints its own comparison and cannot be combined with -paths, -udp-sockets compare, -template, -format, -select, -schedule, -watch or -web")
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown -doh-method %q (want post, get or compare)\n", *dohMethod)
+		return 1
+	}
+	if !quiet {
+		fmt.Printf("DNS Benchmark\n")
+		fmt.Printf("Target: %s | Runs: %s | Timeout: %v | Network: %s | Mode: %s\n",
+			*domain, runsText(runner), *timeout, *network, mode)
+		if qtype != 0 {
+			fmt.Printf("Query type: %s\n", qtype)
+		}
+		if len(domains) > 0 {
+			fmt.Printf("Workload: %d domains%s, %s\n", len(domains), ternary(len(domainTypes) > 0, " with their record types", ""),
+				ternary(zipf > 0, fmt.Sprintf("Zipf distribution (s=%g)", zipf), "queried in turn"))
+		}
+		if p, ok := presets[*presetName]; ok {
+			fmt.Printf("Preset: %s, %s\n", *presetName, p.describe)
+		}
+		if *profileName != "" {
+			fmt.Printf("Profile: %s, %s\n", *profileName, profile.describe)
+		}
+		if len(qtypeMix) > 0 {
+			fmt.Printf("Query types: %s, in turn\n", joinTypes(qtypeMix))
+		}
+		if *browserSim {
+			fmt.Printf("Samples: %s in parallel per name, timed until all are answered\n", joinTypes(bench.BrowserTypes))
+		}
+		if len(runner.Search) > 0 {
+			fmt.Printf("Search: %s, ndots:%d\n", strings.Join(runner.Search, " "), runner.Ndots)
+		}
+		if presets[*presetName].perNode && bench.Host != "" {
+			fmt.Printf("Node: %s\n", bench.Host)
+		}
+		for _, l := range systemLinks {
+			fmt.Printf("System link %s\n", l)
+		}
+		if *seed != 0 {
+			fmt.Printf("Seed: %d\n", *seed)
+		}
+		for _, p := range paths {
+			fmt.Printf("Path %s: %s\n", p.Name, p.Path)
+		}
+		if *osResolver {
+			fmt.Printf("OS resolver: OS-libc through %s, OS-Go through Go's resolver", transport.OSLibrary())
+			if osBaseline.Name != "" {
+				fmt.Printf(", vs. %s at %s", osBaseline.Name, osBaseline.Addr)
 			}
-			stats.DurationsMs = append(stats.DurationsMs, float64(s.Duration.Microseconds())/1000.0)
-		} else {
-			stats.Errors = append(stats.Errors, s.Err)
+			fmt.Println()
+		}
+		if *udpSockets != socketsFresh {
+			fmt.Printf("UDP sockets: %s\n", ternary(*udpSockets == socketsReuse, "reused per resolver", "fresh, then reused per resolver"))
 		}
+		if *connsPerResolver > 0 {
+			fmt.Printf("Connections: up to %d kept open per TCP, DoT or DoH resolver\n", *connsPerResolver)
+		}
+		if *tfo {
+			fmt.Printf("Fast open: TCP Fast Open for TCP and DoT connections\n")
+		}
+		if *wireTiming {
+			fmt.Printf("Timing: on the wire, from writing each query to reading its response; a clock reading takes %v\n", bench.ClockOverhead())
+		}
+		if *busyPoll {
+			fmt.Printf("Busy poll: UDP and TCP answers, a CPU per query in flight\n")
+		}
+		if *phases {
+			fmt.Printf("Phases: latencies are network time only, without packing queries and parsing responses on this host\n")
+		}
+		if *cpuBusy > 0 {
+			fmt.Printf("CPU watch: %s while other processes keep the host's CPUs over %g%% busy\n", ternary(*cpuPause, "pause", "warn"), *cpuBusy)
+		}
+		if *pinCPU || *gomaxprocs > 0 {
+			fmt.Printf("Threads: %s\n", strings.Join(slices.DeleteFunc([]string{
+				ternary(*pinCPU, "a thread of its own per resolver, bound to one CPU", ""),
+				ternary(*gomaxprocs > 0, fmt.Sprintf("at most %d at a time", runtime.GOMAXPROCS(0)), ""),
+			}, func(s string) bool { return s == "" }), ", "))
+		}
+		if *dohMethod != dohPost {
+			fmt.Printf("DoH method: %s\n", ternary(*dohMethod == dohGet, "GET", "POST, then GET"))
+		}
+		if runner.Filter != nil {
+			fmt.Printf("Filter: %s\n", runner.Filter)
+		}
+		if *impair != "" {
+			fmt.Printf("Impairment: %s, simulated on this program's sockets\n", transport.CurrentImpairment())
+		}
+		if scenario != nil {
+			fmt.Printf("Transport: %s, scripted answers without the network\n", *transportSpec)
+		}
+		if sched != nil {
+			fmt.Printf("Schedule: %s (local time)\n", sched)
+		} else if *watch > 0 {
+			fmt.Printf("Watch: every %v\n", *watch)
+		}
+		printStamps(resolvers)
+		printServerIPs(resolvers, *pin)
+		fmt.Println(strings.Repeat("-", 80))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *interceptCheck {
+		// Beside -template, -format and -select, whose output is for other
+		// programs, the check goes to stderr.
+		printInterception(ternary[io.Writer](quiet, os.Stderr, os.Stdout), checkInterception(ctx, resolvers, *timeout))
+	}
+	if len(paths) > 0 {
+		runPaths(ctx, runner, paths, *saveDir)
+		return 0
+	}
+	if *udpSockets == socketsCompare {
+		runSocketModes(ctx, runner, *saveDir)
+		return 0
+	}
+	if *dohMethod == dohCompare {
+		runDoHMethods(ctx, runner, *saveDir)
+		return 0
+	}
+	if *webAddr != "" {
+		if err := serveWeb(ctx, *webAddr, runner, *saveDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if sched != nil || *watch > 0 {
+		opts := repeatOptions{
+			Trend:   *trendRuns,
+			SaveDir: *saveDir,
+			Alerts:  newAlerter(*alertP95, *alertSuccess, *alertAfter, *alertExec, *alertWebhook),
+		}
+		next := everyInterval(*watch)
+		if sched != nil {
+			next = sched.Next
+			opts.Hourly, opts.OutCSV = true, *outCSV
+		}
+		runRepeated(ctx, runner, next, opts)
+		return 0
+	}
+	started := time.Now()
+	rows, err := runHooks.Run(ctx, runner, nil)
+	if err != nil {
+		slog.Warn("run interrupted, showing partial results", "err", err)
+	}
+
+	exported := exportAnonymizer.Results(rows)
+	if *format == "nagios" {
+		line, code := nagiosCheck(exported, nagiosThresholds{
+			WarnP95: *warnP95, CritP95: *critP95, WarnSuccess: *warnSuccess, CritSuccess: *critSuccess,
+		}, err == nil)
+		fmt.Println(line)
+		if !writeFiles(*outCSV, *csvLayout, *saveDir, runner, started, rows, err == nil) {
+			return nagiosUnknown
+		}
+		return code
+	}
+	if *format == "zabbix" {
+		if err := writeZabbix(os.Stdout, *zabbixHost, exportAnonymizer.Resolvers(resolvers), exported, started); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !writeFiles(*outCSV, *csvLayout, *saveDir, runner, started, rows, err == nil) {
+			return 1
+		}
+		return 0
+	}
+	if *format == "dnsperf" {
+		if err := writeDnsperf(os.Stdout, exportAnonymizer.Resolvers(resolvers), exported, started); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !writeFiles(*outCSV, *csvLayout, *saveDir, runner, started, rows, err == nil) {
+			return 1
+		}
+		return 0
 	}
-	if stats.Successes == 0 {
-		stats.Min = 0
-		stats.Max = 0
-		return stats
+	if *selectN > 0 {
+		if err != nil {
+			// A partial run would rank resolvers on too few queries.
+			return 1
+		}
+		ranked, _ := rankResults(ctx, rows, resolvers, cfg, *timeout)
+		names, servers := selectResolvers(ranked, resolvers, *selectN, *selectFormat)
+		if len(servers) == 0 {
+			fmt.Fprintf(os.Stderr, "No working plain DNS resolver to select for %s.\n", *selectFormat)
+			return 1
+		}
+		if len(servers) < *selectN {
+			slog.Warn("fewer working plain DNS resolvers than requested", "format", *selectFormat, "selected", len(servers), "requested", *selectN)
+		}
+		if err := writeSelection(os.Stdout, *selectFormat, names, servers); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
 	}
-	// avg
-	var sum float64
-	for _, v := range stats.DurationsMs {
-		sum += v
+	if tmpl != nil {
+		data := templateData{
+			Domain: exportAnonymizer.Text(*domain), Network: *network, Mode: mode, Count: *count, Duration: *duration,
+			Started: started, Elapsed: time.Since(started), Complete: err == nil,
+			Results: exported, Groups: bench.CombineGroups(exported), Tags: bench.CombineTags(exported),
+			Tool: bench.Tool, Schema: bench.RecordVersion,
+		}
+		if qtype != 0 {
+			data.QType = qtype.String()
+		}
+		if err := writeTemplate(tmpl, data); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !writeFiles(*outCSV, *csvLayout, *saveDir, runner, started, rows, err == nil) {
+			return 1
+		}
+		return 0
 	}
-	avgMs := sum / float64(stats.Successes)
-	stats.Avg = time.Duration(avgMs * float64(time.Millisecond))
 
-	// median & p95
-	ms := make([]float64, len(stats.DurationsMs))
-	copy(ms, stats.DurationsMs)
-	sort.Float64s(ms)
-	stats.Median = time.Duration(percentile(ms, 50) * float64(time.Millisecond))
-	stats.P95 = time.Duration(percentile(ms, 95) * float64(time.Millisecond))
+	printTable(rows)
+	printGroups(rows)
+	printTags(rows)
+	printOperators(resolvers, *operators)
+	printSites(rows)
+	printSizes(rows)
+	printFirstByte(rows)
+	if *wireTiming {
+		printWireTiming(rows)
+	}
+	if *phases {
+		printPhases(rows)
+	}
+	if suspects != nil {
+		time.Sleep(transport.SpoofCheckLinger) // for late answers to the last queries
+		suspects.print(rows)
+	}
+	if runner.RTT != nil {
+		printRTT(rows, *rttMethod)
+	}
+	if *tail {
+		printTail(rows)
+	}
+	if *softTimeout > 0 {
+		printLate(rows, *softTimeout, *timeout)
+	}
+	if len(runner.Search) > 0 {
+		printSearch(rows, runner)
+	}
+	if *coldWarm {
+		printColdWarm(rows)
+	}
+	if *pageLoad {
+		printPageLoad(rows, *pageDomains, *timeout, *cold || profile.coldShare > 0)
+	}
+	if qtype == dnsmsg.TypeSVCB || qtype == dnsmsg.TypeHTTPS {
+		printSVCB(probeSVCB(resolvers, *domain, qtype, *timeout), *domain, qtype)
+	}
+	if *traceOnSlow > 0 {
+		printTraces(ctx, rows, resolvers, *traceOnSlow)
+	}
+	if len(overheadPairs) > 0 {
+		printOverhead(slices.Concat(rows, bench.CombineGroups(rows), bench.CombineTags(rows)), overheadPairs)
+	}
+	if cfg.Score != nil {
+		var feats map[string]bench.Features
+		var featErrs map[string]error
+		if cfg.Score.NeedsFeatures() {
+			feats, featErrs = probeFeatures(ctx, resolvers, *timeout)
+		}
+		scores := scoreResults(rows, *cfg.Score, feats, featErrs)
+		printScores(scores, *cfg.Score)
+		if *scoreOut != "" {
+			if err := writeScores(*scoreOut, scores); err != nil {
+				slog.Error("score write failed", "path", *scoreOut, "err", err)
+				return 1
+			}
+		}
+	}
 
-	return stats
+	if *outCSV != "" {
+		paths, err := writeResults(*outCSV, *csvLayout, runner, started, rows)
+		if err != nil {
+			slog.Error("CSV write failed", "path", *outCSV, "err", err)
+			return 1
+		}
+		fmt.Printf("\nResults written to: %s\n", strings.Join(paths, ", "))
+	}
+	if *saveDir != "" && err == nil {
+		path, err := saveRun(*saveDir, runner, started, rows)
+		if err != nil {
+			slog.Error("saving run failed", "dir", *saveDir, "err", err)
+			return 1
+		}
+		fmt.Printf("\nRun saved to: %s\n", path)
+	}
+	return 0
 }
 
-func percentile(sorted []float64, p float64) float64 {
-	if len(sorted) == 0 {
-		return 0
+// writeFiles writes the -out CSV and, for a complete run, the -save copy
+// for the output formats that keep stdout to themselves, so unlike the
+// table it does not print their paths. It reports whether both succeeded.
+func writeFiles(outCSV, layout, saveDir string, runner *bench.Runner, started time.Time, rows []bench.Result, complete bool) bool {
+	if outCSV != "" {
+		if _, err := writeResults(outCSV, layout, runner, started, rows); err != nil {
+			slog.Error("CSV write failed", "path", outCSV, "err", err)
+			return false
+		}
 	}
-	if p <= 0 {
-		return sorted[0]
+	if saveDir != "" && complete {
+		if _, err := saveRun(saveDir, runner, started, rows); err != nil {
+			slog.Error("saving run failed", "dir", saveDir, "err", err)
+			return false
+		}
 	}
-	if p >= 100 {
-		return sorted[len(sorted)-1]
+	return true
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
 	}
-	pos := (p / 100) * float64(len(sorted)-1)
-	l := int(math.Floor(pos))
-	u := int(math.Ceil(pos))
-	if l == u {
-		return sorted[l]
+	return out
+}
+
+// printStamps lists what each sdns:// resolver entry decodes to.
+func printStamps(resolvers []bench.Resolver) {
+	for _, r := range resolvers {
+		if !strings.HasPrefix(r.Addr, "sdns://") {
+			continue
+		}
+		if st, err := stamp.Parse(r.Addr); err == nil {
+			fmt.Printf("Stamp %s: %s\n", r.Name, st)
+		} else {
+			fmt.Printf("Stamp %s: %v\n", r.Name, err)
+		}
 	}
-	frac := pos - float64(l)
-	return sorted[l]*(1-frac) + sorted[u]*frac
 }
 
-func printTable(rows []Row) {
-	fmt.Printf("%-12s  %6s  %6s  %6s  %6s  %6s  %9s\n",
+// rcodeError converts a non-success response code into an error.
+func rcodeError(resp *dnsmsg.Message) error {
+	if resp.RCode == dnsmsg.RCodeSuccess {
+		return nil
+	}
+	return fmt.Errorf("rcode %s", resp.RCode)
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func printTable(rows []bench.Result) {
+	printTableTrend(rows, nil)
+}
+
+// printTableTrend prints the results table and, with a trend, a sparkline
+// of each resolver's recent medians after its success rate.
+func printTableTrend(rows []bench.Result, trend *MedianTrend) {
+	fmt.Printf("%-12s  %6s  %6s  %6s  %6s  %6s  %9s",
 		"Resolver", "Min", "Avg", "Med", "p95", "Max", "Success%")
-	fmt.Println(strings.Repeat("-", 72))
+	privacy := printPrivacyHeader(rows)
+	if trend != nil {
+		fmt.Printf("  Trend")
+	}
+	fmt.Println()
+	width := 72
+	if privacy {
+		width = 112
+	}
+	if trend != nil {
+		width = max(width, ternary(privacy, 116, 67)+trend.N)
+	}
+	fmt.Println(strings.Repeat("-", width))
 
 	for _, r := range rows {
 		s := r.Stats
-		successPct := 0.0
-		if s.Count > 0 {
-			successPct = 100.0 * float64(s.Successes) / float64(s.Count)
-		}
-		fmt.Printf("%-12s  %6s  %6s  %6s  %6s  %6s  %8.1f%%\n",
+		fmt.Printf("%-12s  %6s  %6s  %6s  %6s  %6s  %8.1f%%",
 			r.Name,
 			durFmt(s.Min),
 			durFmt(s.Avg),
 			durFmt(s.Median),
 			durFmt(s.P95),
 			durFmt(s.Max),
-			successPct,
+			successPct(s),
 		)
+		if privacy {
+			logging, filtering, jurisdiction := privacyCells(r.Operator)
+			fmt.Printf("  %-11s  %-20s  %s", logging, filtering, jurisdiction)
+			if trend != nil {
+				fmt.Print(strings.Repeat(" ", max(0, 12-len(jurisdiction))))
+			}
+		}
+		if trend != nil {
+			fmt.Printf("  %s", trend.Sparkline(r.Name))
+		}
+		fmt.Println()
+		if r.NAT64Prefix != "" {
+			fmt.Printf("  NAT64 prefix: %s\n", r.NAT64Prefix)
+		}
+		if r.Aborted {
+			fmt.Printf("  ! aborted after %d consecutive failures\n", r.Failures)
+		}
+		if r.Filtered > 0 {
+			fmt.Printf("  %d samples left out by the filter\n", r.Filtered)
+		}
+		if r.Busy > 0 {
+			fmt.Printf("  ! %d queries sent while the host's CPUs were busy\n", r.Busy)
+		}
+		if r.Paused > 0 {
+			fmt.Printf("  paused %s for the host's CPUs\n", r.Paused.Round(100*time.Millisecond))
+		}
 		if len(s.Errors) > 0 {
 			uniq := uniqueErrors(s.Errors)
 			for _, e := range uniq {
@@ -232,7 +1277,18 @@ func printTable(rows []Row) {
 	}
 }
 
-func writeCSV(path string, rows []Row) error {
+// addressTypes reports whether types holds only A, AAAA and zero.
+func addressTypes(types []dnsmsg.Type) bool {
+	for _, t := range types {
+		if t != 0 && t != dnsmsg.TypeA && t != dnsmsg.TypeAAAA {
+			return false
+		}
+	}
+	return true
+}
+
+func writeCSV(path string, rows []bench.Result) error {
+	rows = exportAnonymizer.Results(rows)
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -290,6 +1346,17 @@ func writeCSV(path string, rows []Row) error {
 			}
 		}
 	}
+	return writeCSVVersion(w)
+}
+
+// writeCSVVersion ends a CSV export with a section naming the program and
+// the results schema version, for readers that support several versions.
+func writeCSVVersion(w *csv.Writer) error {
+	for _, row := range [][]string{{}, {"tool", "schema_version"}, {bench.Tool, fmt.Sprint(bench.RecordVersion)}} {
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -324,23 +1391,9 @@ func errorStrings(errs []error) []string {
 	return out
 }
 
-func randomLabel() string {
-	b := make([]byte, 8)
-	_, _ = rand.Read(b)
-	hex := make([]byte, len(b)*2)
-	const hexdigits = "0123456789abcdef"
-	for i, v := range b {
-		hex[i*2] = hexdigits[v>>4]
-		hex[i*2+1] = hexdigits[v&0x0f]
-	}
-	return string(hex)
-}
-
 func ternary[T any](cond bool, a, b T) T {
 	if cond {
 		return a
 	}
 	return b
 }
-
-
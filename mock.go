@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// mockResolvers returns the resolvers of a -transport mock: scenario, which
+// replace the default -resolvers. Given -resolvers, they can name them as
+// mock://NAME.
+func mockResolvers(sc *transport.Scenario) []bench.Resolver {
+	out := make([]bench.Resolver, len(sc.Resolvers))
+	for i, r := range sc.Resolvers {
+		out[i] = bench.Resolver{Name: r.Name, Addr: "mock://" + r.Name}
+	}
+	return out
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// mtuBufferSizes are the EDNS(0) UDP buffer sizes the MTU probe advertises:
+// the classic limit, the DNS Flag Day 2020 default, the largest payloads
+// that fit an Ethernet frame over IPv6 and IPv4, and two that need
+// fragmentation.
+var mtuBufferSizes = []uint16{512, 1232, 1452, 1472, 2048, 4096}
+
+// defaultMTUQuery is queried with the DO bit, which adds the signatures:
+// the root's keys make a response of well over 1 KB.
+const defaultMTUQuery = ". DNSKEY"
+
+// MTUStep is what came back for the queries with one buffer size.
+type MTUStep struct {
+	Buffer    uint16
+	Sent      int
+	Received  int
+	Truncated int
+	MaxSize   int // bytes of the largest response
+	Errors    []error
+}
+
+// MTUResult is the outcome of the MTU probe for one resolver.
+type MTUResult struct {
+	Name  string
+	Steps []MTUStep
+	Err   error // the resolver cannot be probed
+}
+
+// parseMTUQuery splits a -mtu-query value of the form "name TYPE".
+func parseMTUQuery(s string) (string, dnsmsg.Type, error) {
+	name, typ, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return "", 0, fmt.Errorf("-mtu-query %q: want a name and a type, e.g. %q", s, defaultMTUQuery)
+	}
+	qtype, err := dnsmsg.ParseType(strings.TrimSpace(typ))
+	if err != nil {
+		return "", 0, fmt.Errorf("-mtu-query %q: %v", s, err)
+	}
+	return name, qtype, nil
+}
+
+// probeMTU sends count queries for name with each of mtuBufferSizes over
+// plain UDP, without retrying truncated answers over TCP. A buffer size
+// whose responses get lost when smaller sizes get through shows responses
+// too large for the path: their fragments are dropped somewhere.
+func probeMTU(r bench.Resolver, name string, qtype dnsmsg.Type, count int, timeout time.Duration) MTUResult {
+	res := MTUResult{Name: r.Name}
+	if s := transport.Scheme(r.Addr); s != "udp" {
+		res.Err = fmt.Errorf("%s:// is not probed, only plain UDP fragments", s)
+		return res
+	}
+	tr := &transport.UDP{Addr: transport.HostPort(r.Addr, "53"), NoTCPFallback: true}
+	for _, size := range mtuBufferSizes {
+		step := MTUStep{Buffer: size}
+		for range count {
+			var got int
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			ctx = transport.WithTrace(ctx, &transport.Trace{GotResponse: func(msg []byte) { got = len(msg) }})
+			q := dnsmsg.NewQuery(name, qtype)
+			q.SetEDNS0(size, true)
+			resp, err := tr.SendQuery(ctx, q)
+			cancel()
+			step.Sent++
+			if err != nil {
+				step.Errors = append(step.Errors, err)
+				continue
+			}
+			step.Received++
+			step.MaxSize = max(step.MaxSize, got)
+			if resp.Truncated {
+				step.Truncated++
+			}
+		}
+		res.Steps = append(res.Steps, step)
+	}
+	return res
+}
+
+// mtuVerdict returns the largest response size that arrived for every
+// query of its buffer size, and the smallest buffer size above it that lost
+// responses, or 0 if none did.
+func mtuVerdict(steps []MTUStep) (reliable int, lossAt uint16) {
+	for _, s := range steps {
+		if s.Received == s.Sent {
+			if lossAt == 0 {
+				reliable = max(reliable, s.MaxSize)
+			}
+		} else if lossAt == 0 {
+			lossAt = s.Buffer
+		}
+	}
+	return reliable, lossAt
+}
+
+func printMTU(results []MTUResult) {
+	fmt.Printf("%-12s", "Resolver")
+	for _, size := range mtuBufferSizes {
+		fmt.Printf("  %9d", size)
+	}
+	fmt.Printf("  %s\n", "Max reliable")
+	fmt.Println(strings.Repeat("-", 80))
+	complete := 0 // size of an untruncated answer at the largest buffer size
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("%-12s  %v\n", r.Name, r.Err)
+			continue
+		}
+		fmt.Printf("%-12s", r.Name)
+		var errs []error
+		for _, s := range r.Steps {
+			if s.Buffer == mtuBufferSizes[len(mtuBufferSizes)-1] && s.Received > 0 && s.Truncated == 0 {
+				complete = max(complete, s.MaxSize)
+			}
+			cell := "lost"
+			switch {
+			case s.Received == 0:
+			case s.Received < s.Sent:
+				cell = fmt.Sprintf("%d %d/%d", s.MaxSize, s.Received, s.Sent)
+			case s.Truncated > 0:
+				cell = fmt.Sprintf("%d TC", s.MaxSize)
+			default:
+				cell = fmt.Sprint(s.MaxSize)
+			}
+			fmt.Printf("  %9s", cell)
+			errs = append(errs, s.Errors...)
+		}
+		reliable, lossAt := mtuVerdict(r.Steps)
+		verdict := fmt.Sprintf("%d bytes", reliable)
+		switch {
+		case reliable == 0:
+			verdict = "--"
+		case lossAt > 0:
+			verdict += fmt.Sprintf(", loss from %d", lossAt)
+		}
+		fmt.Printf("  %s\n", verdict)
+		// Lost responses all fail alike; one error tells why.
+		if errs := uniqueErrors(errs); len(errs) > 0 {
+			fmt.Printf("  ! %s\n", errs[0])
+		}
+	}
+	fmt.Printf("\nCells show the largest response in bytes per EDNS buffer size: TC if truncated, with\n")
+	fmt.Printf("the share received if some were lost. Responses over 1472 bytes (1452 over IPv6) are\n")
+	fmt.Printf("fragmented; losing them when smaller ones arrive points to a PMTU black hole.\n")
+	if complete > 0 {
+		fmt.Printf("The whole answer is %d bytes; use -mtu-query with a larger one to test bigger sizes.\n", complete)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// Nagios plugin exit codes.
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+var nagiosStates = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosThresholds are the -warn-*/-crit-* flags; zero disables one.
+type nagiosThresholds struct {
+	WarnP95, CritP95         time.Duration
+	WarnSuccess, CritSuccess float64 // percent
+}
+
+// nagiosCheck turns a run into a plugin status line with performance data
+// and its exit code. A resolver without any answer is always critical; an
+// interrupted run is unknown.
+func nagiosCheck(rows []bench.Result, th nagiosThresholds, complete bool) (string, int) {
+	if !complete || len(rows) == 0 {
+		return "DNS UNKNOWN - run interrupted", nagiosUnknown
+	}
+	state := nagiosOK
+	var problems, perf []string
+	var best, worst *bench.Result
+	for i := range rows {
+		r := &rows[i]
+		s, pct := r.Stats, successPct(r.Stats)
+		rs, problem := nagiosOK, ""
+		switch {
+		case s.Successes == 0:
+			rs, problem = nagiosCritical, "no answers"
+		case th.CritP95 > 0 && s.P95 >= th.CritP95:
+			rs, problem = nagiosCritical, "p95 "+durFmt(s.P95)
+		case th.CritSuccess > 0 && pct < th.CritSuccess:
+			rs, problem = nagiosCritical, fmt.Sprintf("success %.1f%%", pct)
+		case th.WarnP95 > 0 && s.P95 >= th.WarnP95:
+			rs, problem = nagiosWarning, "p95 "+durFmt(s.P95)
+		case th.WarnSuccess > 0 && pct < th.WarnSuccess:
+			rs, problem = nagiosWarning, fmt.Sprintf("success %.1f%%", pct)
+		}
+		if rs != nagiosOK {
+			problems = append(problems, r.Name+" "+problem)
+		}
+		state = max(state, rs)
+		if s.Successes > 0 {
+			if best == nil || s.Median < best.Stats.Median {
+				best = r
+			}
+			if worst == nil || s.P95 > worst.Stats.P95 {
+				worst = r
+			}
+		}
+
+		label := perfLabel(r.Name)
+		perf = append(perf,
+			fmt.Sprintf("'%s_median'=%.1fms;;;0", label, ms(s.Median)),
+			fmt.Sprintf("'%s_p95'=%.1fms;%s;%s;0", label, ms(s.P95), perfDur(th.WarnP95), perfDur(th.CritP95)),
+			fmt.Sprintf("'%s_success'=%.1f%%;%s;%s;0;100", label, pct, perfMin(th.WarnSuccess), perfMin(th.CritSuccess)),
+		)
+	}
+
+	summary := strings.Join(problems, ", ")
+	if state == nagiosOK {
+		summary = fmt.Sprintf("%d resolvers, best median %s (%s), worst p95 %s (%s)", len(rows),
+			durFmt(best.Stats.Median), best.Name, durFmt(worst.Stats.P95), worst.Name)
+	}
+	return fmt.Sprintf("DNS %s - %s | %s", nagiosStates[state], summary, strings.Join(perf, " ")), state
+}
+
+// perfLabel makes a resolver name usable as a quoted perfdata label.
+func perfLabel(name string) string {
+	return strings.NewReplacer("'", "", "=", "_", " ", "_").Replace(name)
+}
+
+func perfDur(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", ms(d))
+}
+
+// perfMin formats a lower bound as a Nagios range ("95:" alerts below 95).
+func perfMin(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%g:", v)
+}
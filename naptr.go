@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// Steps of a NAPTR service discovery chain.
+const (
+	stepNAPTR = iota
+	stepSRV
+	stepAddr
+	numSteps
+)
+
+// ChainSample is one end-to-end NAPTR → SRV → address resolution.
+type ChainSample struct {
+	Domain  string
+	Steps   [numSteps]time.Duration // zero for a step that was not needed
+	Total   time.Duration
+	Service string // NAPTR service field, or "SRV" when the domain has no NAPTR
+	Target  string // host:port the chain ended at
+	Err     error
+}
+
+// ChainResult is the service discovery probe outcome for one resolver.
+type ChainResult struct {
+	Name    string
+	Samples []ChainSample
+}
+
+// probeNAPTR resolves the service chain of each domain count times.
+func probeNAPTR(r bench.Resolver, domains []string, qtype dnsmsg.Type, count int, timeout time.Duration) ChainResult {
+	res := ChainResult{Name: r.Name}
+	tr, err := transport.New(r.Addr)
+	if err != nil {
+		res.Samples = append(res.Samples, ChainSample{Err: err})
+		return res
+	}
+	for _, domain := range domains {
+		for i := 0; i < count; i++ {
+			res.Samples = append(res.Samples, resolveChain(tr, domain, qtype, timeout))
+		}
+	}
+	return res
+}
+
+// resolveChain follows the lookups a SIP client makes (RFC 3263): the
+// NAPTR records of domain, the SRV records of the most preferred "S"
+// record, and the addresses of the best SRV target. A domain without NAPTR
+// records falls back to the SRV records of _sip._udp.domain. Each query gets
+// its own timeout.
+func resolveChain(tr transport.Transport, domain string, qtype dnsmsg.Type, timeout time.Duration) ChainSample {
+	s := ChainSample{Domain: domain}
+	start := time.Now()
+	query := func(step int, name string, t dnsmsg.Type) ([]dnsmsg.Resource, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		qs := time.Now()
+		resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, t))
+		s.Steps[step] = time.Since(qs)
+		if err != nil {
+			return nil, err
+		}
+		if err := rcodeError(resp); err != nil {
+			return nil, err
+		}
+		var rrs []dnsmsg.Resource
+		for _, rr := range resp.Answers {
+			if rr.Type == t {
+				rrs = append(rrs, rr)
+			}
+		}
+		return rrs, nil
+	}
+	fail := func(err error) ChainSample {
+		s.Total, s.Err = time.Since(start), err
+		return s
+	}
+
+	rrs, err := query(stepNAPTR, domain, dnsmsg.TypeNAPTR)
+	if err != nil {
+		return fail(fmt.Errorf("NAPTR %s: %w", domain, err))
+	}
+	flag, next, port := "S", "_sip._udp."+domain, 5060
+	s.Service = "SRV"
+	if best, ok := bestNAPTR(rrs); ok {
+		flag, next, s.Service = strings.ToUpper(best.Flags), best.Replacement, best.Services
+	}
+
+	host := next
+	if flag == "S" {
+		rrs, err := query(stepSRV, next, dnsmsg.TypeSRV)
+		if err != nil {
+			return fail(fmt.Errorf("SRV %s: %w", next, err))
+		}
+		srv, ok := bestSRV(rrs)
+		if !ok {
+			return fail(fmt.Errorf("SRV %s: no records", next))
+		}
+		host, port = srv.Target, int(srv.Port)
+	}
+
+	rrs, err = query(stepAddr, host, qtype)
+	if err != nil {
+		return fail(fmt.Errorf("%s %s: %w", qtype, host, err))
+	}
+	if len(rrs) == 0 {
+		return fail(fmt.Errorf("%s %s: no records", qtype, host))
+	}
+	s.Target = net.JoinHostPort(strings.TrimSuffix(host, "."), strconv.Itoa(port))
+	s.Total = time.Since(start)
+	return s
+}
+
+// bestNAPTR returns the lowest order, then lowest preference, record that
+// leads to an SRV or address lookup.
+func bestNAPTR(rrs []dnsmsg.Resource) (dnsmsg.NAPTR, bool) {
+	var cands []dnsmsg.NAPTR
+	for _, rr := range rrs {
+		n, err := rr.NAPTR()
+		if err != nil {
+			continue
+		}
+		if f := strings.ToUpper(n.Flags); f == "S" || f == "A" {
+			cands = append(cands, n)
+		}
+	}
+	if len(cands) == 0 {
+		return dnsmsg.NAPTR{}, false
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].Order != cands[j].Order {
+			return cands[i].Order < cands[j].Order
+		}
+		return cands[i].Preference < cands[j].Preference
+	})
+	return cands[0], true
+}
+
+// bestSRV returns the lowest priority, then highest weight, target. A
+// target of "." means the service is not offered.
+func bestSRV(rrs []dnsmsg.Resource) (dnsmsg.SRV, bool) {
+	var best dnsmsg.SRV
+	found := false
+	for _, rr := range rrs {
+		s, err := rr.SRV()
+		if err != nil || s.Target == "." {
+			continue
+		}
+		if !found || s.Priority < best.Priority || (s.Priority == best.Priority && s.Weight > best.Weight) {
+			best, found = s, true
+		}
+	}
+	return best, found
+}
+
+func printNAPTR(results []ChainResult) {
+	fmt.Printf("%-12s  %7s  %7s  %7s  %7s  %7s  %9s\n", "Resolver", "NAPTR", "SRV", "Addr", "Total", "p95", "Success%")
+	fmt.Println(strings.Repeat("-", 72))
+	targets := make(map[string]map[string][]string) // domain -> "target via service" -> resolvers
+	var domains []string
+	for _, r := range results {
+		var steps [numSteps][]float64
+		var totals []float64
+		var errs []error
+		seen := make(map[string]bool)
+		for _, s := range r.Samples {
+			if s.Err != nil {
+				errs = append(errs, s.Err)
+				continue
+			}
+			for i, d := range s.Steps {
+				if d > 0 {
+					steps[i] = append(steps[i], ms(d))
+				}
+			}
+			totals = append(totals, ms(s.Total))
+			key := s.Target + " via " + s.Service
+			if seen[s.Domain+key] {
+				continue
+			}
+			seen[s.Domain+key] = true
+			if targets[s.Domain] == nil {
+				targets[s.Domain] = make(map[string][]string)
+				domains = append(domains, s.Domain)
+			}
+			targets[s.Domain][key] = append(targets[s.Domain][key], r.Name)
+		}
+		med := func(v []float64) string {
+			if len(v) == 0 {
+				return "--"
+			}
+			sort.Float64s(v)
+			return durFmt(time.Duration(bench.Percentile(v, 50) * float64(time.Millisecond)))
+		}
+		p95 := "--"
+		if len(totals) > 0 {
+			sort.Float64s(totals)
+			p95 = durFmt(time.Duration(bench.Percentile(totals, 95) * float64(time.Millisecond)))
+		}
+		pct := 0.0
+		if len(r.Samples) > 0 {
+			pct = 100 * float64(len(totals)) / float64(len(r.Samples))
+		}
+		fmt.Printf("%-12s  %7s  %7s  %7s  %7s  %7s  %8.1f%%\n", r.Name,
+			med(steps[stepNAPTR]), med(steps[stepSRV]), med(steps[stepAddr]), med(totals), p95, pct)
+		for _, e := range uniqueErrors(errs) {
+			fmt.Printf("  ! %s\n", e)
+		}
+	}
+
+	sort.Strings(domains)
+	for _, d := range domains {
+		fmt.Printf("\n%s\n", d)
+		keys := make([]string, 0, len(targets[d]))
+		for k := range targets[d] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("  -> %s (%s)\n", k, strings.Join(targets[d][k], ", "))
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+var errNoSOA = errors.New("NXDOMAIN without SOA in authority section")
+
+// NegCacheResult is the outcome of the negative caching probe for one resolver.
+type NegCacheResult struct {
+	Name       string
+	QName      string
+	FirstTTL   uint32 // negative TTL on the first (uncached) answer
+	LastTTL    uint32 // negative TTL on the last repeat query
+	SOAMinimum uint32 // MINIMUM field of the zone's SOA (RFC 2308 upper bound)
+	Decays     bool   // TTL counted down between queries, i.e. the answer was cached
+	Miss       time.Duration
+	HitAvg     time.Duration
+	Samples    []bench.Sample
+}
+
+// probeNegCache repeatedly queries a random non-existent name below domain
+// and tracks the SOA TTL in the NXDOMAIN answers. The TTL on the first
+// answer is the negative-cache lifetime the resolver applied; a decaying TTL
+// on later answers shows the answer is being served from cache.
+func probeNegCache(r bench.Resolver, domain string, count int, interval, timeout time.Duration) NegCacheResult {
+	res := NegCacheResult{Name: r.Name, QName: bench.RandomLabel() + "." + domain}
+	tr, err := transport.New(r.Addr)
+	if err != nil {
+		res.Samples = append(res.Samples, bench.Sample{Err: err})
+		return res
+	}
+	var ttls []uint32
+	var hitSum time.Duration
+	var hits int
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(res.QName, dnsmsg.TypeA))
+		d := time.Since(start)
+		cancel()
+
+		if err == nil {
+			var ttl uint32
+			ttl, err = negativeTTL(resp, &res.SOAMinimum)
+			if err == nil {
+				ttls = append(ttls, ttl)
+				if i == 0 {
+					res.Miss = d
+				} else {
+					hitSum += d
+					hits++
+				}
+			}
+		}
+		res.Samples = append(res.Samples, bench.Sample{Duration: d, Err: err})
+	}
+	if len(ttls) > 0 {
+		res.FirstTTL = ttls[0]
+		res.LastTTL = ttls[len(ttls)-1]
+		res.Decays = len(ttls) > 1 && res.LastTTL < res.FirstTTL
+	}
+	if hits > 0 {
+		res.HitAvg = hitSum / time.Duration(hits)
+	}
+	return res
+}
+
+// negativeTTL returns the TTL of the SOA record in an NXDOMAIN response and
+// records the SOA MINIMUM field in minimum.
+func negativeTTL(resp *dnsmsg.Message, minimum *uint32) (uint32, error) {
+	if resp.RCode != dnsmsg.RCodeNameError {
+		return 0, fmt.Errorf("expected NXDOMAIN, got %s", resp.RCode)
+	}
+	for _, rr := range resp.Authorities {
+		if rr.Type != dnsmsg.TypeSOA {
+			continue
+		}
+		if soa, err := rr.SOA(); err == nil {
+			*minimum = soa.Minimum
+		}
+		return rr.TTL, nil
+	}
+	return 0, errNoSOA
+}
+
+func printNegCache(results []NegCacheResult) {
+	fmt.Printf("%-12s  %8s  %8s  %9s  %8s  %8s\n",
+		"Resolver", "NegTTL", "SOA min", "TTL decay", "Miss", "Hit avg")
+	fmt.Println(strings.Repeat("-", 64))
+	for _, r := range results {
+		s := bench.Summarize(r.Samples)
+		if s.Successes == 0 {
+			fmt.Printf("%-12s  %8s  %8s  %9s  %8s  %8s\n", r.Name, "--", "--", "--", "--", "--")
+		} else {
+			fmt.Printf("%-12s  %7ds  %7ds  %9s  %8s  %8s\n",
+				r.Name, r.FirstTTL, r.SOAMinimum, ternary(r.Decays, "yes", "no"),
+				durFmt(r.Miss), durFmt(r.HitAvg))
+		}
+		for _, e := range uniqueErrors(s.Errors) {
+			fmt.Printf("  ! %s\n", e)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package odoh
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Minimal HPKE (RFC 9180) sender in base mode for the one suite ODoH
+// deployments use: DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM.
+
+const (
+	kemX25519HKDFSHA256 = 0x0020
+	kdfHKDFSHA256       = 0x0001
+	aeadAES128GCM       = 0x0001
+
+	hpkeNk = 16 // AES-128-GCM key size
+	hpkeNn = 12 // AES-128-GCM nonce size
+	hpkeNh = 32 // SHA-256 output size
+)
+
+// hpkeSender is a sender context after SetupBaseS.
+type hpkeSender struct {
+	aead           cipher.AEAD
+	baseNonce      []byte
+	seq            uint64
+	exporterSecret []byte
+	suiteID        []byte
+}
+
+// setupBaseS encapsulates a fresh shared secret to pkR and derives the
+// sender context. It returns the encapsulated key and the context.
+func setupBaseS(pkR []byte, info []byte) ([]byte, *hpkeSender, error) {
+	skE, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return setupBaseSWithKey(skE, pkR, info)
+}
+
+// setupBaseSWithKey is setupBaseS with the ephemeral key skE, which the
+// RFC 9180 test vectors fix.
+func setupBaseSWithKey(skE *ecdh.PrivateKey, pkR []byte, info []byte) ([]byte, *hpkeSender, error) {
+	shared, enc, err := encap(skE, pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, baseNonce, exporter, err := keySchedule(shared, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, &hpkeSender{aead: aead, baseNonce: baseNonce, exporterSecret: exporter, suiteID: hpkeSuiteID()}, nil
+}
+
+// encap is DHKEM(X25519, HKDF-SHA256) Encap with the ephemeral key skE.
+// It returns the shared secret and the encapsulated key.
+func encap(skE *ecdh.PrivateKey, pkR []byte) (shared, enc []byte, err error) {
+	pub, err := ecdh.X25519().NewPublicKey(pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+	dh, err := skE.ECDH(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc = skE.PublicKey().Bytes()
+
+	kemSuite := binary.BigEndian.AppendUint16([]byte("KEM"), kemX25519HKDFSHA256)
+	eaePRK, err := labeledExtract(kemSuite, nil, "eae_prk", dh)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err = labeledExpand(kemSuite, eaePRK, "shared_secret", append(append([]byte{}, enc...), pkR...), 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	return shared, enc, nil
+}
+
+// keySchedule derives the base mode key, base nonce and exporter secret
+// from the shared secret (RFC 9180 section 5.1).
+func keySchedule(shared, info []byte) (key, baseNonce, exporter []byte, err error) {
+	suite := hpkeSuiteID()
+	pskIDHash, err := labeledExtract(suite, nil, "psk_id_hash", nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	infoHash, err := labeledExtract(suite, nil, "info_hash", info)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ksContext := append([]byte{0x00}, pskIDHash...) // mode_base
+	ksContext = append(ksContext, infoHash...)
+	secret, err := labeledExtract(suite, shared, "secret", nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if key, err = labeledExpand(suite, secret, "key", ksContext, hpkeNk); err != nil {
+		return nil, nil, nil, err
+	}
+	if baseNonce, err = labeledExpand(suite, secret, "base_nonce", ksContext, hpkeNn); err != nil {
+		return nil, nil, nil, err
+	}
+	if exporter, err = labeledExpand(suite, secret, "exp", ksContext, hpkeNh); err != nil {
+		return nil, nil, nil, err
+	}
+	return key, baseNonce, exporter, nil
+}
+
+func hpkeSuiteID() []byte {
+	suite := []byte("HPKE")
+	suite = binary.BigEndian.AppendUint16(suite, kemX25519HKDFSHA256)
+	suite = binary.BigEndian.AppendUint16(suite, kdfHKDFSHA256)
+	return binary.BigEndian.AppendUint16(suite, aeadAES128GCM)
+}
+
+// seal encrypts the next message of the context; ODoH sends only one.
+func (s *hpkeSender) seal(aad, plaintext []byte) []byte {
+	nonce := bytes.Clone(s.baseNonce)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(s.seq >> (8 * i))
+	}
+	s.seq++
+	return s.aead.Seal(nil, nonce, plaintext, aad)
+}
+
+// export derives a secret from the context (RFC 9180 section 5.3).
+func (s *hpkeSender) export(exporterContext string, length int) ([]byte, error) {
+	return labeledExpand(s.suiteID, s.exporterSecret, "sec", []byte(exporterContext), length)
+}
+
+func labeledExtract(suiteID, salt []byte, label string, ikm []byte) ([]byte, error) {
+	labeled := append([]byte("HPKE-v1"), suiteID...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, ikm...)
+	return hkdf.Extract(sha256.New, labeled, salt)
+}
+
+func labeledExpand(suiteID, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	labeled := binary.BigEndian.AppendUint16(nil, uint16(length))
+	labeled = append(labeled, "HPKE-v1"...)
+	labeled = append(labeled, suiteID...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, info...)
+	return hkdf.Expand(sha256.New, prk, string(labeled), length)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
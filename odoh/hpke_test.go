@@ -0,0 +1,89 @@
+package odoh
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestHPKEVectors checks the sender against RFC 9180 appendix A.1.1,
+// DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM in base mode.
+func TestHPKEVectors(t *testing.T) {
+	info := unhex(t, "4f6465206f6e2061204772656369616e2055726e")
+	skEm := unhex(t, "52c4a758a802cd8b936eceea314432798d5baf2d7e9235dc084ab1b9cfa2f736")
+	pkRm := unhex(t, "3948cfe0ad1ddb695d780e59077195da6c56506b027329794ab02bca80815c4d")
+	wantEnc := unhex(t, "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431")
+	wantShared := unhex(t, "fe0e18c9f024ce43799ae393c7e8fe8fce9d218875e8227b0187c04e7d2ea1fc")
+	wantKey := unhex(t, "4531685d41d65f03dc48f6b8302c05b0")
+	wantNonce := unhex(t, "56d890e5accaaf011cff4b7d")
+	wantExporter := unhex(t, "45ff1c2e220db587171952c0592d5f5ebe103f1561a2614e38f2ffd47e99e3f8")
+
+	skE, err := ecdh.X25519().NewPrivateKey(skEm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, enc, err := encap(skE, pkRm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc, wantEnc) {
+		t.Errorf("enc = %x, want %x", enc, wantEnc)
+	}
+	if !bytes.Equal(shared, wantShared) {
+		t.Errorf("shared_secret = %x, want %x", shared, wantShared)
+	}
+	key, baseNonce, exporter, err := keySchedule(shared, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, wantKey) {
+		t.Errorf("key = %x, want %x", key, wantKey)
+	}
+	if !bytes.Equal(baseNonce, wantNonce) {
+		t.Errorf("base_nonce = %x, want %x", baseNonce, wantNonce)
+	}
+	if !bytes.Equal(exporter, wantExporter) {
+		t.Errorf("exporter_secret = %x, want %x", exporter, wantExporter)
+	}
+
+	_, sender, err := setupBaseSWithKey(skE, pkRm, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := []byte("Beauty is truth, truth beauty")
+	for seq, want := range []string{
+		"f938558b5d72f1a23810b4be2ab4f84331acc02fc97babc53a52ae8218a355a96d8770ac83d07bea87e13c512a",
+		"af2d7e9ac9ae7e270f46ba1f975be53c09f8d875bdc8535458c2494e8a6eab251c03d0c22a56b8ca42c2063b84",
+		"498dfcabd92e8acedc281e85af1cb4e3e31c7dc394a1ca20e173cb72516491588d96a19ad4a683518973dcc180",
+	} {
+		ct := sender.seal(fmt.Appendf(nil, "Count-%d", seq), pt)
+		if !bytes.Equal(ct, unhex(t, want)) {
+			t.Errorf("sequence number %d: ciphertext = %x, want %s", seq, ct, want)
+		}
+	}
+
+	for _, tt := range []struct{ context, want string }{
+		{"", "3853fe2b4035195a573ffc53856e77058e15d9ea064de3e59f4961d0095250ee"},
+		{"\x00", "2e8f0b54673c7029649d4eb9d5e33bf1872cf76d623ff164ac185da9e88c21a5"},
+		{"TestContext", "e9e43065102c3836401bed8c3c3c75ae46be1639869391d62c61f1ec7af54931"},
+	} {
+		got, err := sender.export(tt.context, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, unhex(t, tt.want)) {
+			t.Errorf("export(%q) = %x, want %s", tt.context, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package odoh implements an Oblivious DNS-over-HTTPS client transport
+// (RFC 9230). Queries are HPKE-encrypted to the target resolver and, when a
+// relay is configured, sent through that relay so neither party sees both
+// the client address and the query. Importing the package registers the
+// "odoh" scheme with the transport package:
+//
+//	odoh://odoh.cloudflare-dns.com/dns-query
+//	odoh://odoh.cloudflare-dns.com/dns-query?relay=https://relay.example/proxy
+package odoh
+
+import (
+	"bytes"
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+func init() {
+	transport.Register("odoh", func(addr string) (transport.Transport, error) {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		c := &Client{
+			Target: &url.URL{Scheme: "https", Host: u.Host, Path: u.Path},
+			HTTP:   transport.NewHTTPClient(),
+		}
+		if c.Target.Path == "" {
+			c.Target.Path = "/dns-query"
+		}
+		if relay := u.Query().Get("relay"); relay != "" {
+			if c.Relay, err = url.Parse(relay); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	})
+}
+
+const (
+	contentType      = "application/oblivious-dns-message"
+	configVersion    = 0x0001
+	msgTypeQuery     = 0x01
+	msgTypeResponse  = 0x02
+	queryPadBlock    = 128
+	maxResponseBytes = 65535
+)
+
+var errNoConfig = errors.New("odoh: target publishes no supported config (need X25519/HKDF-SHA256/AES-128-GCM)")
+
+// Client is an ODoH transport to one target, optionally through a relay.
+// The target's HPKE config is fetched from /.well-known/odohconfigs on
+// first use, so the first query of a run includes that extra request.
+type Client struct {
+	Target *url.URL // https://host/path of the target resolver
+	Relay  *url.URL // optional oblivious relay (proxy)
+	HTTP   *http.Client
+
+	mu     sync.Mutex
+	config *targetConfig
+}
+
+type targetConfig struct {
+	publicKey []byte
+	keyID     []byte
+}
+
+// SendQuery implements transport.Transport.
+func (c *Client) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	cfg, err := c.targetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := *msg
+	q.ID = 0
+	wire, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	plain := appendOpaque(nil, wire)
+	plain = appendOpaque(plain, make([]byte, (queryPadBlock-len(wire)%queryPadBlock)%queryPadBlock))
+
+	enc, sender, err := setupBaseS(cfg.publicKey, []byte("odoh query"))
+	if err != nil {
+		return nil, err
+	}
+	aad := appendOpaque([]byte{msgTypeQuery}, cfg.keyID)
+	body := appendOpaque([]byte{msgTypeQuery}, cfg.keyID)
+	body = appendOpaque(body, append(enc, sender.seal(aad, plain)...))
+
+	raw, remote, err := c.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	respWire, err := decryptResponse(sender, plain, raw)
+	if err != nil {
+		return nil, err
+	}
+	transport.Observe(ctx, nil, remote, wire)
+	transport.Observe(ctx, remote, nil, respWire)
+	resp, err := dnsmsg.Unpack(respWire)
+	if err != nil {
+		return nil, err
+	}
+	trace := transport.ContextTrace(ctx)
+	if trace.WroteQuery != nil {
+		trace.WroteQuery(nil, remote, wire)
+	}
+	if trace.GotResponse != nil {
+		trace.GotResponse(respWire)
+	}
+	resp.ID = msg.ID
+	return resp, nil
+}
+
+// post sends body to the target, through the relay when one is configured,
+// and returns the reply and the address of the server it came from.
+func (c *Client) post(ctx context.Context, body []byte) ([]byte, net.Addr, error) {
+	endpoint := c.Target.String()
+	if c.Relay != nil {
+		u := *c.Relay
+		qs := u.Query()
+		qs.Set("targethost", c.Target.Host)
+		qs.Set("targetpath", c.Target.Path)
+		u.RawQuery = qs.Encode()
+		endpoint = u.String()
+	}
+	var remote net.Addr
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { remote = info.Conn.RemoteAddr() },
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("odoh: status %s", resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	return raw, remote, err
+}
+
+// targetConfig returns the cached target config, fetching it if needed.
+func (c *Client) targetConfig(ctx context.Context) (*targetConfig, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config != nil {
+		return c.config, nil
+	}
+	u := url.URL{Scheme: "https", Host: c.Target.Host, Path: "/.well-known/odohconfigs"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("odoh: fetching config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("odoh: fetching config: status %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfigs(b)
+	if err != nil {
+		return nil, err
+	}
+	c.config = cfg
+	return cfg, nil
+}
+
+// parseConfigs picks the first supported ObliviousDoHConfig and derives its
+// key ID (RFC 9230 section 6).
+func parseConfigs(b []byte) (*targetConfig, error) {
+	configs, _, err := readOpaque(b)
+	if err != nil {
+		return nil, err
+	}
+	for len(configs) >= 4 {
+		version := binary.BigEndian.Uint16(configs)
+		contents, rest, err := readOpaque(configs[2:])
+		if err != nil {
+			return nil, err
+		}
+		configs = rest
+		if version != configVersion || len(contents) < 6 {
+			continue
+		}
+		kem := binary.BigEndian.Uint16(contents[0:])
+		kdf := binary.BigEndian.Uint16(contents[2:])
+		aead := binary.BigEndian.Uint16(contents[4:])
+		pk, _, err := readOpaque(contents[6:])
+		if err != nil || kem != kemX25519HKDFSHA256 || kdf != kdfHKDFSHA256 || aead != aeadAES128GCM {
+			continue
+		}
+		prk, err := hkdf.Extract(sha256.New, contents, nil)
+		if err != nil {
+			return nil, err
+		}
+		keyID, err := hkdf.Expand(sha256.New, prk, "odoh key id", hpkeNh)
+		if err != nil {
+			return nil, err
+		}
+		return &targetConfig{publicKey: pk, keyID: keyID}, nil
+	}
+	return nil, errNoConfig
+}
+
+// decryptResponse opens an ObliviousDoHMessage response using keys derived
+// from the query's HPKE context (RFC 9230 section 6.4).
+func decryptResponse(sender *hpkeSender, queryPlain, raw []byte) ([]byte, error) {
+	if len(raw) < 1 || raw[0] != msgTypeResponse {
+		return nil, errors.New("odoh: not a response message")
+	}
+	nonce, rest, err := readOpaque(raw[1:])
+	if err != nil {
+		return nil, err
+	}
+	ct, _, err := readOpaque(rest)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := sender.export("odoh response", hpkeNk)
+	if err != nil {
+		return nil, err
+	}
+	salt := appendOpaque(append([]byte{}, queryPlain...), nonce)
+	prk, err := hkdf.Extract(sha256.New, secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Expand(sha256.New, prk, "odoh key", hpkeNk)
+	if err != nil {
+		return nil, err
+	}
+	aeadNonce, err := hkdf.Expand(sha256.New, prk, "odoh nonce", hpkeNn)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, aeadNonce, ct, appendOpaque([]byte{msgTypeResponse}, nonce))
+	if err != nil {
+		return nil, fmt.Errorf("odoh: decrypting response: %w", err)
+	}
+	dnsWire, _, err := readOpaque(plain)
+	return dnsWire, err
+}
+
+// appendOpaque appends b with a 16-bit length prefix.
+func appendOpaque(dst, b []byte) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(b)))
+	return append(dst, b...)
+}
+
+// readOpaque reads a 16-bit length-prefixed field.
+func readOpaque(b []byte) (field, rest []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("odoh: truncated message")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, errors.New("odoh: truncated message")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
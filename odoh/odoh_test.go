@@ -0,0 +1,194 @@
+package odoh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// target is an ODoH target for tests: it decrypts queries sent to its
+// config, answers them with an empty NOERROR response and encrypts that
+// as RFC 9230 section 6.4 describes.
+type target struct {
+	t      *testing.T
+	sk     *ecdh.PrivateKey
+	config []byte // ObliviousDoHConfigContents
+	keyID  []byte
+}
+
+func newTarget(t *testing.T) *target {
+	sk, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := binary.BigEndian.AppendUint16(nil, kemX25519HKDFSHA256)
+	config = binary.BigEndian.AppendUint16(config, kdfHKDFSHA256)
+	config = binary.BigEndian.AppendUint16(config, aeadAES128GCM)
+	config = appendOpaque(config, sk.PublicKey().Bytes())
+	prk, err := hkdf.Extract(sha256.New, config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := hkdf.Expand(sha256.New, prk, "odoh key id", hpkeNh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &target{t: t, sk: sk, config: config, keyID: keyID}
+}
+
+func (tg *target) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := tg.answer(w, r); err != nil {
+		tg.t.Error(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func (tg *target) answer(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/.well-known/odohconfigs" {
+		unsupported := appendOpaque(binary.BigEndian.AppendUint16(nil, 0xff00), []byte("future"))
+		configs := append(unsupported, appendOpaque(binary.BigEndian.AppendUint16(nil, configVersion), tg.config)...)
+		_, err := w.Write(appendOpaque(nil, configs))
+		return err
+	}
+	if ct := r.Header.Get("Content-Type"); ct != contentType {
+		return fmt.Errorf("query Content-Type = %q", ct)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) < 1 || body[0] != msgTypeQuery {
+		return fmt.Errorf("not a query message: %x", body)
+	}
+	keyID, rest, err := readOpaque(body[1:])
+	if err != nil || !bytes.Equal(keyID, tg.keyID) {
+		return fmt.Errorf("key ID = %x, %v; want %x", keyID, err, tg.keyID)
+	}
+	encrypted, _, err := readOpaque(rest)
+	if err != nil || len(encrypted) < 32 {
+		return fmt.Errorf("encrypted message = %x, %v", encrypted, err)
+	}
+
+	// SetupBaseR: the DHKEM Decap mirrors encap.
+	enc := encrypted[:32]
+	pkE, err := ecdh.X25519().NewPublicKey(enc)
+	if err != nil {
+		return err
+	}
+	dh, err := tg.sk.ECDH(pkE)
+	if err != nil {
+		return err
+	}
+	kemSuite := binary.BigEndian.AppendUint16([]byte("KEM"), kemX25519HKDFSHA256)
+	eaePRK, err := labeledExtract(kemSuite, nil, "eae_prk", dh)
+	if err != nil {
+		return err
+	}
+	shared, err := labeledExpand(kemSuite, eaePRK, "shared_secret", append(bytes.Clone(enc), tg.sk.PublicKey().Bytes()...), 32)
+	if err != nil {
+		return err
+	}
+	key, baseNonce, exporter, err := keySchedule(shared, []byte("odoh query"))
+	if err != nil {
+		return err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return err
+	}
+	queryPlain, err := aead.Open(nil, baseNonce, encrypted[32:], appendOpaque([]byte{msgTypeQuery}, keyID))
+	if err != nil {
+		return fmt.Errorf("decrypting query: %w", err)
+	}
+	wire, rest, err := readOpaque(queryPlain)
+	if err != nil {
+		return err
+	}
+	padding, _, err := readOpaque(rest)
+	if err != nil || (len(wire)+len(padding))%queryPadBlock != 0 || bytes.Count(padding, []byte{0}) != len(padding) {
+		return fmt.Errorf("query padding = %x, %v", padding, err)
+	}
+	q, err := dnsmsg.Unpack(wire)
+	if err != nil {
+		return err
+	}
+	if q.ID != 0 {
+		return fmt.Errorf("query ID = %d, want 0", q.ID)
+	}
+	q.Response = true
+	respWire, err := q.Pack()
+	if err != nil {
+		return err
+	}
+
+	secret, err := labeledExpand(hpkeSuiteID(), exporter, "sec", []byte("odoh response"), hpkeNk)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, hpkeNk)
+	rand.Read(nonce)
+	prk, err := hkdf.Extract(sha256.New, secret, appendOpaque(bytes.Clone(queryPlain), nonce))
+	if err != nil {
+		return err
+	}
+	respKey, err := hkdf.Expand(sha256.New, prk, "odoh key", hpkeNk)
+	if err != nil {
+		return err
+	}
+	respNonce, err := hkdf.Expand(sha256.New, prk, "odoh nonce", hpkeNn)
+	if err != nil {
+		return err
+	}
+	respAEAD, err := newAESGCM(respKey)
+	if err != nil {
+		return err
+	}
+	plain := appendOpaque(appendOpaque(nil, respWire), make([]byte, 7))
+	sealed := respAEAD.Seal(nil, respNonce, plain, appendOpaque([]byte{msgTypeResponse}, nonce))
+	w.Header().Set("Content-Type", contentType)
+	_, err = w.Write(appendOpaque(appendOpaque([]byte{msgTypeResponse}, nonce), sealed))
+	return err
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	srv := httptest.NewTLSServer(newTarget(t))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{Target: &url.URL{Scheme: "https", Host: u.Host, Path: "/dns-query"}, HTTP: srv.Client()}
+	for range 2 { // the second query reuses the fetched config
+		q := dnsmsg.NewQuery("example.com", dnsmsg.TypeA)
+		resp, err := c.SendQuery(context.Background(), q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.Response || resp.ID != q.ID || len(resp.Questions) != 1 || resp.Questions[0] != q.Questions[0] {
+			t.Errorf("response = %+v, want the answer to %+v", resp, q)
+		}
+	}
+}
+
+func TestDecryptResponseTampered(t *testing.T) {
+	_, sender, err := setupBaseS(newTarget(t).sk.PublicKey().Bytes(), []byte("odoh query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := appendOpaque(appendOpaque([]byte{msgTypeResponse}, make([]byte, hpkeNk)), make([]byte, 40))
+	if _, err := decryptResponse(sender, []byte("query"), raw); err == nil {
+		t.Error("decryptResponse accepted a response not sealed for the query")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// Values of -operators.
+const (
+	operatorsOff     = "off"
+	operatorsBuiltin = "builtin"
+	operatorsOnline  = "online"
+)
+
+// knownOperator lists the addresses and server host names of a public
+// resolver service.
+type knownOperator struct {
+	op       bench.Operator
+	prefixes []string
+	hosts    []string // host names, matching subdomains too
+}
+
+// knownOperators is the builtin table of -operators. It covers the large
+// public resolvers only; -operators online finds the others.
+var knownOperators = []knownOperator{
+	{bench.Operator{ASN: 13335, Name: "Cloudflare", Country: "US"},
+		[]string{"1.1.1.0/24", "1.0.0.0/24", "2606:4700:4700::/48"},
+		[]string{"cloudflare-dns.com", "one.one.one.one"}},
+	{bench.Operator{ASN: 15169, Name: "Google", Country: "US"},
+		[]string{"8.8.8.0/24", "8.8.4.0/24", "2001:4860:4860::/48"},
+		[]string{"dns.google"}},
+	{bench.Operator{ASN: 19281, Name: "Quad9", Country: "CH"},
+		[]string{"9.9.9.0/24", "149.112.112.0/24", "2620:fe::/48"},
+		[]string{"quad9.net"}},
+	{bench.Operator{ASN: 36692, Name: "Cisco OpenDNS", Country: "US"},
+		[]string{"208.67.216.0/21", "2620:119:35::/48", "2620:119:53::/48"},
+		[]string{"opendns.com"}},
+	{bench.Operator{ASN: 212772, Name: "AdGuard", Country: "CY"},
+		[]string{"94.140.14.0/23", "2a10:50c0::/32"},
+		[]string{"adguard-dns.com", "adguard-dns.io"}},
+	{bench.Operator{ASN: 34939, Name: "NextDNS", Country: "US"},
+		[]string{"45.90.28.0/22"},
+		[]string{"nextdns.io"}},
+	{bench.Operator{ASN: 3356, Name: "Lumen (Level 3)", Country: "US"},
+		[]string{"4.2.2.0/24"}, nil},
+	{bench.Operator{ASN: 13238, Name: "Yandex", Country: "RU"},
+		[]string{"77.88.8.0/24"}, nil},
+	{bench.Operator{ASN: 37963, Name: "Alibaba Cloud", Country: "CN"},
+		[]string{"223.5.5.0/24", "223.6.6.0/24"},
+		[]string{"alidns.com"}},
+	{bench.Operator{ASN: 45090, Name: "Tencent DNSPod", Country: "CN"},
+		[]string{"119.29.29.0/24"},
+		[]string{"doh.pub", "dot.pub"}},
+}
+
+// privateNetwork stands for servers in the local network or on this host,
+// whose operator is whoever runs the network.
+var privateNetwork = bench.Operator{Name: "private network"}
+
+// resolverIPs returns the addresses a resolver's queries go to: its IP
+// address, or those its host name resolved to at startup.
+func resolverIPs(r bench.Resolver) []netip.Addr {
+	hosts := r.IPs
+	if h := transport.ServerHost(r.Addr); h != "" && len(hosts) == 0 {
+		hosts = []string{h}
+	}
+	var ips []netip.Addr
+	for _, h := range hosts {
+		if ip, err := netip.ParseAddr(h); err == nil {
+			ips = append(ips, ip.Unmap().WithZone(""))
+		}
+	}
+	return ips
+}
+
+// builtinOperator looks the resolver up in knownOperators, by address and
+// then by server host name, or returns nil.
+func builtinOperator(r bench.Resolver) *bench.Operator {
+	for _, ip := range resolverIPs(r) {
+		if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			op := privateNetwork
+			op.Source = operatorsBuiltin
+			return &op
+		}
+		for _, k := range knownOperators {
+			for _, p := range k.prefixes {
+				if netip.MustParsePrefix(p).Contains(ip) {
+					return withPolicy(r, k.op)
+				}
+			}
+		}
+	}
+	host := strings.ToLower(strings.TrimSuffix(transport.ServerHost(r.Addr), "."))
+	for _, k := range knownOperators {
+		for _, h := range k.hosts {
+			if host == h || strings.HasSuffix(host, "."+h) {
+				return withPolicy(r, k.op)
+			}
+		}
+	}
+	return nil
+}
+
+// withPolicy returns a builtin op with the policy of the resolver's
+// service, if knownPolicies has it.
+func withPolicy(r bench.Resolver, op bench.Operator) *bench.Operator {
+	op.Source = operatorsBuiltin
+	if p := policyOf(r); p != nil {
+		op.Logging, op.Filtering = p.logging, p.filtering
+	}
+	return &op
+}
+
+// cymruOrigin returns the name of the TXT record at Team Cymru's IP to ASN
+// service mapping ip to the AS announcing it.
+func cymruOrigin(ip netip.Addr) string {
+	var labels []string
+	if ip.Is4() {
+		b := ip.As4()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+		return strings.Join(labels, ".") + ".origin.asn.cymru.com"
+	}
+	b := ip.As16()
+	for i := len(b) - 1; i >= 0; i-- {
+		labels = append(labels, strconv.FormatUint(uint64(b[i]&0xf), 16), strconv.FormatUint(uint64(b[i]>>4), 16))
+	}
+	return strings.Join(labels, ".") + ".origin6.asn.cymru.com"
+}
+
+// cymruFields splits a Team Cymru TXT answer like
+// "13335 | US | arin | 2010-07-14 | CLOUDFLARENET - Cloudflare, Inc., US".
+func cymruFields(txt string) []string {
+	f := strings.Split(txt, "|")
+	for i := range f {
+		f[i] = strings.TrimSpace(f[i])
+	}
+	return f
+}
+
+// onlineOperator looks ip up at Team Cymru's IP to ASN service, with DNS
+// queries through the bootstrap resolver: first the AS announcing ip, then
+// the name and country the AS is registered with.
+func onlineOperator(ctx context.Context, ip netip.Addr, timeout time.Duration) (*bench.Operator, error) {
+	boot := transport.Bootstrap()
+	lookup := func(name string) ([]string, error) {
+		qctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		txts, err := boot.LookupTXT(qctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(txts) == 0 {
+			return nil, fmt.Errorf("%s: no TXT record", name)
+		}
+		return cymruFields(txts[0]), nil
+	}
+	origin, err := lookup(cymruOrigin(ip))
+	if err != nil {
+		return nil, err
+	}
+	// Prefixes announced by several ASes list them all; take the first.
+	asns := strings.Fields(origin[0])
+	if len(asns) == 0 {
+		return nil, fmt.Errorf("%s: no AS announces the address", ip)
+	}
+	asn, err := strconv.ParseUint(asns[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad AS number %q", ip, asns[0])
+	}
+	op := &bench.Operator{ASN: uint32(asn), Source: operatorsOnline}
+	as, err := lookup("AS" + asns[0] + ".asn.cymru.com")
+	if err != nil || len(as) < 5 {
+		// The origin answer carries the country of the address block.
+		op.Name = "AS" + asns[0]
+		if len(origin) > 2 {
+			op.Country = origin[2]
+		}
+		return op, nil
+	}
+	// The description is the AS handle, then the organisation and its
+	// country: "CLOUDFLARENET - Cloudflare, Inc., US".
+	name := as[4]
+	if cc := ", " + as[1]; strings.HasSuffix(name, cc) {
+		name = strings.TrimSuffix(name, cc)
+	}
+	if _, org, ok := strings.Cut(name, " - "); ok {
+		name = org
+	}
+	op.Name, op.Country = name, as[1]
+	return op, nil
+}
+
+// findOperators sets Resolver.Operator of the resolvers from the builtin
+// table and, for mode online, from Team Cymru's service for the others.
+// A failed online lookup is logged and the operator left unknown.
+func findOperators(ctx context.Context, resolvers []bench.Resolver, mode string, timeout time.Duration) {
+	if mode == operatorsOff {
+		return
+	}
+	cache := make(map[netip.Addr]*bench.Operator)
+	for i, r := range resolvers {
+		if resolvers[i].Operator = builtinOperator(r); resolvers[i].Operator != nil || mode != operatorsOnline {
+			continue
+		}
+		ips := resolverIPs(r)
+		if len(ips) == 0 {
+			continue // stamps and transports without a server address
+		}
+		op, ok := cache[ips[0]]
+		if !ok {
+			var err error
+			if op, err = onlineOperator(ctx, ips[0], timeout); err != nil {
+				slog.Warn("operator lookup failed", "resolver", r.Name, "ip", ips[0], "err", err)
+			}
+			cache[ips[0]] = op
+		}
+		resolvers[i].Operator = op
+	}
+}
+
+// printOperators lists who runs each resolver, if -operators found any.
+func printOperators(resolvers []bench.Resolver, mode string) {
+	if mode == operatorsOff {
+		return // -privacy may have read the builtin table anyway
+	}
+	found := false
+	for _, r := range resolvers {
+		found = found || r.Operator != nil
+	}
+	if !found {
+		return
+	}
+	fmt.Printf("\nOperators (%s)\n", ternary(mode == operatorsOnline, "builtin table and Team Cymru IP to ASN", "builtin table"))
+	fmt.Printf("%-12s  %-8s  %-7s  %s\n", "Resolver", "ASN", "Country", "Operator")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range resolvers {
+		op := r.Operator
+		if op == nil {
+			fmt.Printf("%-12s  %-8s  %-7s  %s\n", r.Name, "-", "-", ternary(mode == operatorsOnline, "unknown", "unknown (-operators online looks it up)"))
+			continue
+		}
+		asn := "-"
+		if op.ASN != 0 {
+			asn = "AS" + strconv.FormatUint(uint64(op.ASN), 10)
+		}
+		fmt.Printf("%-12s  %-8s  %-7s  %s\n", r.Name, asn, orDash(op.Country), op.Name)
+	}
+}
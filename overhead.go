@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// OverheadPair compares a resolver path against a baseline path to the same
+// provider, e.g. ODoH through a relay versus direct DoH.
+type OverheadPair struct {
+	Name     string
+	Baseline string
+}
+
+// parseOverheadPairs parses "Name=Baseline[,Name=Baseline...]".
+func parseOverheadPairs(s string) []OverheadPair {
+	var out []OverheadPair
+	for _, p := range splitList(s) {
+		name, baseline, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+		out = append(out, OverheadPair{Name: strings.TrimSpace(name), Baseline: strings.TrimSpace(baseline)})
+	}
+	return out
+}
+
+// printOverhead reports how much slower each resolver is than its baseline.
+func printOverhead(rows []bench.Result, pairs []OverheadPair) {
+	byName := make(map[string]bench.Stats, len(rows))
+	for _, r := range rows {
+		byName[r.Name] = r.Stats
+	}
+	fmt.Printf("\nOverhead vs. baseline\n")
+	fmt.Printf("%-12s  %-12s  %8s  %8s  %8s  %7s\n", "Resolver", "Baseline", "+Min", "+Med", "+p95", "x Med")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, p := range pairs {
+		s, ok1 := byName[p.Name]
+		b, ok2 := byName[p.Baseline]
+		if !ok1 || !ok2 || s.Successes == 0 || b.Successes == 0 {
+			fmt.Printf("%-12s  %-12s  %8s  %8s  %8s  %7s\n", p.Name, p.Baseline, "--", "--", "--", "--")
+			continue
+		}
+		fmt.Printf("%-12s  %-12s  %8s  %8s  %8s  %6.2fx\n", p.Name, p.Baseline,
+			deltaFmt(s.Min-b.Min), deltaFmt(s.Median-b.Median), deltaFmt(s.P95-b.P95),
+			float64(s.Median)/float64(b.Median))
+	}
+}
+
+// deltaFmt formats a signed latency difference.
+func deltaFmt(d time.Duration) string {
+	return fmt.Sprintf("%+.1fms", float64(d.Microseconds())/1000.0)
+}
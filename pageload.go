@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// defaultPageDomains is the number of distinct host names a page loads
+// from, roughly the median of HTTP Archive crawls.
+const defaultPageDomains = 20
+
+// pageDepth is how many lookups of a page load happen one after another:
+// the page's own host, then a host its HTML references (such as a CDN),
+// then one a script on that host loads. The other lookups overlap them.
+const pageDepth = 3
+
+// lookupCost is the expected time of one lookup: the mean of the
+// successful queries, with each failed query costing the full timeout a
+// client waits before retrying elsewhere. It reports false without samples.
+func lookupCost(s bench.Stats, timeout time.Duration) (time.Duration, bool) {
+	if s.Count == 0 || s.Successes == 0 {
+		return 0, false
+	}
+	failed := s.Count - s.Successes
+	total := s.Avg*time.Duration(s.Successes) + timeout*time.Duration(failed)
+	return total / time.Duration(s.Count), true
+}
+
+// printPageLoad translates lookup latency into what it means for loading a
+// web page with pageDomains host names: the DNS wait on the critical path,
+// the lookup time summed over all names, and how much slower both are than
+// with the fastest resolver. cold reports whether the run bypassed caches.
+func printPageLoad(rows []bench.Result, pageDomains int, timeout time.Duration, cold bool) {
+	best := time.Duration(math.MaxInt64)
+	for _, r := range rows {
+		if c, ok := lookupCost(r.Stats, timeout); ok {
+			best = min(best, c)
+		}
+	}
+	if best == math.MaxInt64 {
+		return
+	}
+
+	fmt.Printf("\nEstimated page-load impact (%d host names per page, %d lookups in sequence)\n", pageDomains, pageDepth)
+	fmt.Printf("%-12s  %8s  %10s  %10s  %12s\n", "Resolver", "Lookup", "Page wait", "All names", "Slower by")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range rows {
+		c, ok := lookupCost(r.Stats, timeout)
+		if !ok {
+			fmt.Printf("%-12s  %8s  %10s  %10s  %12s\n", r.Name, "--", "--", "--", "no answers")
+			continue
+		}
+		slower := "fastest"
+		if c > best {
+			slower = fmt.Sprintf("+%s/page", durFmt(time.Duration(pageDepth)*(c-best)))
+		}
+		fmt.Printf("%-12s  %8s  %10s  %10s  %12s\n", r.Name, durFmt(c),
+			durFmt(time.Duration(pageDepth)*c), durFmt(time.Duration(pageDomains)*c), slower)
+	}
+	fmt.Printf("\nLookup is the mean latency, counting each failed query as a %v timeout.\n", timeout)
+	fmt.Printf("Page wait is the DNS delay of a page load, whose first %d lookups happen one after another.\n", pageDepth)
+	fmt.Printf("All names is the lookup time summed over every host name of the page.\n")
+	if !cold {
+		fmt.Printf("Measured with cached answers: first visits to a site are slower, see -cold.\n")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/parquet"
+)
+
+// parquetColumns are the columns of a Parquet export: the tidy sample table
+// of -csv-layout long, with typed values and nulls for missing ones. The
+// tool and schema version are file metadata.
+var parquetColumns = []parquet.Column{
+	{Name: "started", Type: parquet.Timestamp},
+	{Name: "host", Type: parquet.String},
+	{Name: "domain", Type: parquet.String},
+	{Name: "network", Type: parquet.String},
+	{Name: "qtype", Type: parquet.String},
+	{Name: "cold", Type: parquet.Boolean},
+	{Name: "resolver", Type: parquet.String},
+	{Name: "group", Type: parquet.String, Optional: true},
+	{Name: "run_index", Type: parquet.Int32},
+	{Name: "duration_ms", Type: parquet.Double},
+	{Name: "success", Type: parquet.Boolean},
+	{Name: "error", Type: parquet.String, Optional: true},
+	{Name: "ttfb_ms", Type: parquet.Double, Optional: true},
+	{Name: "rtt_ms", Type: parquet.Double, Optional: true},
+	{Name: "bytes", Type: parquet.Int32},
+	{Name: "queries", Type: parquet.Int32},
+	{Name: "src_port", Type: parquet.Int32, Optional: true},
+	{Name: "id", Type: parquet.Int32},
+}
+
+func isParquet(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".parquet")
+}
+
+// writeParquet writes the samples of recs to a Parquet file, a row per
+// sample.
+func writeParquet(path string, recs []bench.RunRecord) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := parquet.NewWriter(f, parquetColumns)
+	if err != nil {
+		return err
+	}
+	w.SetMetadata("tool", bench.Tool)
+	w.SetMetadata("schema_version", strconv.Itoa(bench.RecordVersion))
+	for _, rec := range recs {
+		started := rec.Started.UTC()
+		for _, rr := range rec.Resolvers {
+			for i, s := range rr.Samples {
+				err := w.Write(started, rec.Host, rec.Domain, rec.Network, rec.QType, rec.Cold,
+					rr.Name, parquetOptional(rr.Group), i, s.Ms, s.Error == "", parquetOptional(s.Error),
+					parquetOptional(s.TTFBMs), parquetOptional(s.RTTMs), s.Bytes, max(s.Queries, 1),
+					parquetOptional(s.SrcPort), int(s.ID))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// parquetOptional returns nil for the zero value, which stands for no
+// value, so that it is stored as null.
+func parquetOptional[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
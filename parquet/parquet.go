@@ -0,0 +1,385 @@
+// Package parquet writes flat tables to Apache Parquet files, which
+// DuckDB, Spark, pandas and other analysis tools load column by column.
+// Rows are buffered into row groups of RowGroupSize rows, each stored as
+// one gzip-compressed, plain-encoded data page per column, so memory use
+// stays bounded however many rows are written.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	Boolean   Type = iota
+	Int32          // int
+	Int64          // int64
+	Double         // float64
+	String         // UTF-8 string
+	Timestamp      // time.Time, stored as microseconds since the Unix epoch in UTC
+)
+
+// Column describes a column of the table. Optional columns take nil values
+// for missing data.
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool
+}
+
+// RowGroupSize is the number of rows buffered before a row group is
+// written.
+const RowGroupSize = 128 * 1024
+
+// Parquet enum values.
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	convertedUTF8      = 0
+	convertedTimestamp = 10 // TIMESTAMP_MICROS
+
+	repRequired = 0
+	repOptional = 1
+
+	encodingPlain = 0
+	encodingRLE   = 3
+	codecGzip     = 2
+	pageData      = 0
+)
+
+var magic = []byte("PAR1")
+
+func (t Type) physical() int32 {
+	switch t {
+	case Boolean:
+		return typeBoolean
+	case Int32:
+		return typeInt32
+	case Int64, Timestamp:
+		return typeInt64
+	case Double:
+		return typeDouble
+	}
+	return typeByteArray
+}
+
+// Writer writes a Parquet file. It is not safe for concurrent use.
+type Writer struct {
+	w        io.Writer
+	off      int64
+	cols     []Column
+	chunks   []columnChunk
+	rows     int // rows in the current row group
+	groups   []rowGroup
+	total    int64
+	metadata [][2]string
+	err      error
+}
+
+// columnChunk buffers the values of one column of the current row group.
+type columnChunk struct {
+	values  bytes.Buffer // plain-encoded non-null values
+	bools   []bool       // Boolean values, bit-packed when the page is written
+	defined []bool       // definition levels of an optional column
+}
+
+type rowGroup struct {
+	rows    int64
+	size    int64
+	columns []chunkMeta
+}
+
+type chunkMeta struct {
+	offset             int64
+	values             int64
+	uncompressed, size int64
+}
+
+// NewWriter writes the file header to w and returns a Writer for a table of
+// the given columns.
+func NewWriter(w io.Writer, cols []Column) (*Writer, error) {
+	if len(cols) == 0 {
+		return nil, errors.New("parquet: no columns")
+	}
+	pw := &Writer{w: w, cols: cols, chunks: make([]columnChunk, len(cols))}
+	pw.write(magic)
+	return pw, pw.err
+}
+
+// SetMetadata adds a key-value pair to the file metadata.
+func (pw *Writer) SetMetadata(key, value string) {
+	pw.metadata = append(pw.metadata, [2]string{key, value})
+}
+
+// Write appends a row with a value for each column: bool, int, int64,
+// float64, string or time.Time as the column type requires, or nil in an
+// optional column.
+func (pw *Writer) Write(row ...any) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(row) != len(pw.cols) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(pw.cols))
+	}
+	for i, v := range row {
+		if err := pw.append(i, v); err != nil {
+			return err
+		}
+	}
+	pw.rows++
+	if pw.rows == RowGroupSize {
+		pw.flush()
+	}
+	return pw.err
+}
+
+func (pw *Writer) append(i int, v any) error {
+	col, c := pw.cols[i], &pw.chunks[i]
+	if v == nil {
+		if !col.Optional {
+			return fmt.Errorf("parquet: nil value in required column %s", col.Name)
+		}
+		c.defined = append(c.defined, false)
+		return nil
+	}
+	var le [8]byte
+	switch v := v.(type) {
+	case bool:
+		if col.Type != Boolean {
+			return typeError(col, v)
+		}
+		c.bools = append(c.bools, v)
+	case int:
+		if col.Type != Int32 {
+			return typeError(col, v)
+		}
+		binary.LittleEndian.PutUint32(le[:], uint32(int32(v)))
+		c.values.Write(le[:4])
+	case int64:
+		if col.Type != Int64 {
+			return typeError(col, v)
+		}
+		binary.LittleEndian.PutUint64(le[:], uint64(v))
+		c.values.Write(le[:])
+	case float64:
+		if col.Type != Double {
+			return typeError(col, v)
+		}
+		binary.LittleEndian.PutUint64(le[:], math.Float64bits(v))
+		c.values.Write(le[:])
+	case string:
+		if col.Type != String {
+			return typeError(col, v)
+		}
+		binary.LittleEndian.PutUint32(le[:], uint32(len(v)))
+		c.values.Write(le[:4])
+		c.values.WriteString(v)
+	case time.Time:
+		if col.Type != Timestamp {
+			return typeError(col, v)
+		}
+		binary.LittleEndian.PutUint64(le[:], uint64(v.UnixMicro()))
+		c.values.Write(le[:])
+	default:
+		return typeError(col, v)
+	}
+	if col.Optional {
+		c.defined = append(c.defined, true)
+	}
+	return nil
+}
+
+func typeError(col Column, v any) error {
+	return fmt.Errorf("parquet: %T value for column %s", v, col.Name)
+}
+
+// Close writes the buffered rows and the file footer. It does not close the
+// underlying writer.
+func (pw *Writer) Close() error {
+	if pw.rows > 0 {
+		pw.flush()
+	}
+	if pw.err != nil {
+		return pw.err
+	}
+	footer := pw.footer()
+	pw.write(footer)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(footer)))
+	pw.write(n[:])
+	pw.write(magic)
+	return pw.err
+}
+
+func (pw *Writer) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.off += int64(n)
+	pw.err = err
+}
+
+// flush writes the buffered rows as a row group with a data page per
+// column.
+func (pw *Writer) flush() {
+	g := rowGroup{rows: int64(pw.rows)}
+	for i := range pw.chunks {
+		c := &pw.chunks[i]
+		var page bytes.Buffer
+		if pw.cols[i].Optional {
+			levels := rleBits(c.defined)
+			var n [4]byte
+			binary.LittleEndian.PutUint32(n[:], uint32(len(levels)))
+			page.Write(n[:])
+			page.Write(levels)
+		}
+		if pw.cols[i].Type == Boolean {
+			page.Write(packBits(c.bools))
+		} else {
+			page.Write(c.values.Bytes())
+		}
+
+		var zipped bytes.Buffer
+		zw := gzip.NewWriter(&zipped)
+		zw.Write(page.Bytes())
+		zw.Close()
+
+		var h compact
+		h.begin(0)
+		h.i32(1, pageData)
+		h.i32(2, int32(page.Len()))
+		h.i32(3, int32(zipped.Len()))
+		h.begin(5) // DataPageHeader
+		h.i32(1, int32(pw.rows))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.end()
+		h.end()
+
+		m := chunkMeta{offset: pw.off, values: int64(pw.rows)}
+		pw.write(h.buf.Bytes())
+		pw.write(zipped.Bytes())
+		m.uncompressed = int64(h.buf.Len() + page.Len())
+		m.size = int64(h.buf.Len() + zipped.Len())
+		g.size += m.uncompressed
+		g.columns = append(g.columns, m)
+		*c = columnChunk{}
+	}
+	pw.groups = append(pw.groups, g)
+	pw.total += int64(pw.rows)
+	pw.rows = 0
+}
+
+// footer encodes the FileMetaData.
+func (pw *Writer) footer() []byte {
+	var c compact
+	c.begin(0)
+	c.i32(1, 1)
+	c.list(2, ctStruct, len(pw.cols)+1)
+	c.beginElem() // the root of the schema
+	c.str(4, "schema")
+	c.i32(5, int32(len(pw.cols)))
+	c.end()
+	for _, col := range pw.cols {
+		c.beginElem()
+		c.i32(1, col.Type.physical())
+		c.i32(3, int32(ternary(col.Optional, repOptional, repRequired)))
+		c.str(4, col.Name)
+		switch col.Type {
+		case String:
+			c.i32(6, convertedUTF8)
+		case Timestamp:
+			c.i32(6, convertedTimestamp)
+		}
+		c.end()
+	}
+	c.i64(3, pw.total)
+	c.list(4, ctStruct, len(pw.groups))
+	for _, g := range pw.groups {
+		c.beginElem()
+		c.list(1, ctStruct, len(g.columns))
+		for i, m := range g.columns {
+			c.beginElem()
+			c.i64(2, m.offset)
+			c.begin(3) // ColumnMetaData
+			c.i32(1, pw.cols[i].Type.physical())
+			c.list(2, ctI32, 2)
+			c.zigzag(encodingPlain)
+			c.zigzag(encodingRLE)
+			c.list(3, ctBinary, 1)
+			c.rawStr(pw.cols[i].Name)
+			c.i32(4, codecGzip)
+			c.i64(5, m.values)
+			c.i64(6, m.uncompressed)
+			c.i64(7, m.size)
+			c.i64(9, m.offset)
+			c.end()
+			c.end()
+		}
+		c.i64(2, g.size)
+		c.i64(3, g.rows)
+		c.end()
+	}
+	if len(pw.metadata) > 0 {
+		c.list(5, ctStruct, len(pw.metadata))
+		for _, kv := range pw.metadata {
+			c.beginElem()
+			c.str(1, kv[0])
+			c.str(2, kv[1])
+			c.end()
+		}
+	}
+	c.str(6, "dnsbench parquet writer")
+	c.end()
+	return c.buf.Bytes()
+}
+
+// rleBits encodes levels of bit width 1 in the RLE/bit-packing hybrid
+// encoding, as runs of equal values.
+func rleBits(levels []bool) []byte {
+	var out []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		out = append(out, byte(ternary(levels[i], 1, 0)))
+		i = j
+	}
+	return out
+}
+
+// packBits bit-packs booleans, least significant bit first, as the plain
+// encoding of Boolean columns does.
+func packBits(v []bool) []byte {
+	out := make([]byte, (len(v)+7)/8)
+	for i, b := range v {
+		if b {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+func ternary[T any](cond bool, a, b T) T {
+	if cond {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,101 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol types.
+const (
+	ctBoolTrue  = 1
+	ctBoolFalse = 2
+	ctI32       = 5
+	ctI64       = 6
+	ctBinary    = 8
+	ctList      = 9
+	ctStruct    = 12
+)
+
+// compact encodes the Thrift compact protocol, which the Parquet footer and
+// page headers use. Structs are written field by field in increasing field
+// order; end closes the innermost struct.
+type compact struct {
+	buf  bytes.Buffer
+	last []int16 // last field id of each open struct
+}
+
+func (c *compact) varint(v uint64) {
+	c.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (c *compact) zigzag(v int64) {
+	c.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (c *compact) field(id int16, typ byte) {
+	top := len(c.last) - 1
+	if d := id - c.last[top]; d > 0 && d <= 15 {
+		c.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		c.buf.WriteByte(typ)
+		c.zigzag(int64(id))
+	}
+	c.last[top] = id
+}
+
+// begin opens a struct: the top-level one with id 0, else a struct field.
+func (c *compact) begin(id int16) {
+	if id != 0 {
+		c.field(id, ctStruct)
+	}
+	c.last = append(c.last, 0)
+}
+
+// beginElem opens a struct that is an element of a list.
+func (c *compact) beginElem() {
+	c.last = append(c.last, 0)
+}
+
+func (c *compact) end() {
+	c.buf.WriteByte(0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, ctI32)
+	c.zigzag(int64(v))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, ctI64)
+	c.zigzag(v)
+}
+
+func (c *compact) bool(id int16, v bool) {
+	if v {
+		c.field(id, ctBoolTrue)
+	} else {
+		c.field(id, ctBoolFalse)
+	}
+}
+
+func (c *compact) str(id int16, s string) {
+	c.field(id, ctBinary)
+	c.rawStr(s)
+}
+
+func (c *compact) rawStr(s string) {
+	c.varint(uint64(len(s)))
+	c.buf.WriteString(s)
+}
+
+// list starts a list field of n elements of type elem, which follow.
+func (c *compact) list(id int16, elem byte, n int) {
+	c.field(id, ctList)
+	if n < 15 {
+		c.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	c.buf.WriteByte(0xf0 | elem)
+	c.varint(uint64(n))
+}
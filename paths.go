@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// namedPath is a network path of -paths.
+type namedPath struct {
+	Name string
+	Path transport.Path
+}
+
+// parsePaths parses -paths: two Name=Spec entries, where Spec is an
+// interface name, such as wg0, or mark:N for a routing mark, which policy
+// routing rules such as those of wg-quick match on.
+func parsePaths(s string) ([]namedPath, error) {
+	var out []namedPath
+	for _, e := range splitList(s) {
+		name, spec, ok := strings.Cut(e, "=")
+		if !ok || name == "" || spec == "" {
+			return nil, fmt.Errorf("bad path %q (want Name=interface or Name=mark:N)", e)
+		}
+		var p transport.Path
+		if v, ok := strings.CutPrefix(spec, "mark:"); ok {
+			mark, err := strconv.ParseUint(v, 0, 32)
+			if err != nil || mark == 0 {
+				return nil, fmt.Errorf("bad routing mark in path %q", e)
+			}
+			p.Mark = uint32(mark)
+		} else {
+			p.Device = spec
+		}
+		out = append(out, namedPath{Name: name, Path: p})
+	}
+	if len(out) != 2 {
+		return nil, fmt.Errorf("-paths needs two paths to compare, got %d", len(out))
+	}
+	if out[0].Name == out[1].Name {
+		return nil, fmt.Errorf("duplicate path name %q", out[0].Name)
+	}
+	return out, nil
+}
+
+// runPaths runs the benchmark once through each path, one after the other,
+// prints the results of each and then both side by side. Each run is saved
+// on its own, with its path in the record.
+func runPaths(ctx context.Context, runner *bench.Runner, paths []namedPath, saveDir string) {
+	results := make([][]bench.Result, len(paths))
+	for i, p := range paths {
+		r := *runner
+		r.Path = p.Path
+		fmt.Printf("\nPath %s (%s)\n", p.Name, p.Path)
+		started := time.Now()
+		rows, err := runHooks.Run(ctx, &r, nil)
+		if err != nil {
+			slog.Warn("run interrupted, showing partial results", "path", p.Name, "err", err)
+		}
+		results[i] = rows
+		printTable(rows)
+		if saveDir != "" && err == nil {
+			path, err := saveRun(saveDir, &r, started, rows)
+			if err != nil {
+				slog.Error("saving run failed", "dir", saveDir, "err", err)
+			} else {
+				fmt.Printf("Run saved to: %s\n", path)
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	printComparison("Paths", paths[0].Name, paths[1].Name, results)
+}
+
+// printComparison shows the median latency and success rate of each
+// resolver in two runs, a and b, and how much slower b is.
+func printComparison(title, a, b string, results [][]bench.Result) {
+	byName := make(map[string]bench.Stats)
+	for _, r := range results[1] {
+		byName[r.Name] = r.Stats
+	}
+	fmt.Printf("\n%s side by side (%s vs. %s)\n", title, a, b)
+	mw := max(10, len("Med "+a), len("Med "+b))
+	ow := max(8, len("OK "+a), len("OK "+b))
+	fmt.Printf("%-12s  %*s  %*s  %10s  %*s  %*s\n", "Resolver", mw, "Med "+a, mw, "Med "+b, "Diff", ow, "OK "+a, ow, "OK "+b)
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range results[0] {
+		sa := r.Stats
+		sb, ok := byName[r.Name]
+		medA, medB, diff, okB := "--", "--", "--", "--"
+		if sa.Successes > 0 {
+			medA = durFmt(sa.Median)
+		}
+		if ok {
+			okB = fmt.Sprintf("%.1f%%", successPct(sb))
+			if sb.Successes > 0 {
+				medB = durFmt(sb.Median)
+			}
+			if sa.Successes > 0 && sb.Successes > 0 {
+				diff = deltaFmt(sb.Median - sa.Median)
+			}
+		}
+		fmt.Printf("%-12s  %*s  %*s  %10s  %*s  %*s\n", r.Name, mw, medA, mw, medB, diff, ow, fmt.Sprintf("%.1f%%", successPct(sa)), ow, okB)
+	}
+	fmt.Printf("\nDiff is the median of %s minus that of %s.\n", b, a)
+}
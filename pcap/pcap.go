@@ -0,0 +1,181 @@
+// Package pcap writes DNS messages to a libpcap capture file for offline
+// analysis in Wireshark or tcpdump. Each message is stored as a synthetic
+// IPv4 or IPv6 UDP datagram (link type RAW) between the endpoints the
+// transport reported, with the server side on port 53 so dissectors decode
+// it as DNS regardless of the transport that carried it.
+package pcap
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+const (
+	linkTypeRaw = 101
+	snapLen     = 65535
+	maxPayload  = 65535 - 40 - 8 // largest message that fits in an IPv6 datagram
+)
+
+// Writer writes a capture file. It implements transport.Tap and is safe for
+// concurrent use. The packets are built and written by the goroutine of a
+// transport.AsyncTap, so that DNSMessage returns at once, within the
+// timing of a query.
+type Writer struct {
+	tap *transport.AsyncTap
+
+	// Of the tap's goroutine, and of Close once it is done.
+	w   *bufio.Writer
+	c   io.Closer
+	err error
+}
+
+// NewWriter writes the capture file header to w and returns a Writer for the
+// packets. If w is an io.Closer, Close closes it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	pw := &Writer{w: bufio.NewWriter(w)}
+	pw.c, _ = w.(io.Closer)
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], snapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeRaw)
+	if _, err := pw.w.Write(hdr); err != nil {
+		return nil, err
+	}
+	pw.tap = transport.NewAsyncTap(pw.write)
+	return pw, nil
+}
+
+// DNSMessage records msg as a datagram from src to dst. A nil address is
+// written as the unspecified address. The server port is set to 53, chosen
+// by the QR bit of the message. Messages that arrive after Close are
+// dropped.
+func (pw *Writer) DNSMessage(ctx context.Context, t time.Time, src, dst net.Addr, msg []byte) {
+	if len(msg) < 3 || len(msg) > maxPayload {
+		return
+	}
+	pw.tap.DNSMessage(ctx, t, src, dst, msg)
+}
+
+// write writes a queued message as a packet.
+func (pw *Writer) write(m transport.TapMessage) {
+	srcIP, srcPort := addrParts(m.Src)
+	dstIP, dstPort := addrParts(m.Dst)
+	if m.Msg[2]&0x80 == 0 {
+		dstPort = 53
+	} else {
+		srcPort = 53
+	}
+	pkt := datagram(srcIP, dstIP, srcPort, dstPort, m.Msg)
+
+	rec := make([]byte, 16, 16+len(pkt))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(m.Time.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(m.Time.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+	rec = append(rec, pkt...)
+	if pw.err == nil {
+		_, pw.err = pw.w.Write(rec)
+	}
+}
+
+// Close writes the queued packets and flushes them, closes the underlying
+// writer when it is an io.Closer and returns the first error encountered.
+func (pw *Writer) Close() error {
+	pw.tap.Close()
+	if pw.err == nil {
+		pw.err = pw.w.Flush()
+	}
+	if pw.c != nil {
+		if err := pw.c.Close(); pw.err == nil {
+			pw.err = err
+		}
+	}
+	return pw.err
+}
+
+func addrParts(a net.Addr) (net.IP, uint16) {
+	switch a := a.(type) {
+	case *net.UDPAddr:
+		return a.IP, uint16(a.Port)
+	case *net.TCPAddr:
+		return a.IP, uint16(a.Port)
+	}
+	return nil, 0
+}
+
+// datagram builds an IP packet carrying payload in a UDP datagram. It is
+// IPv6 when either address is, and unknown addresses are unspecified.
+func datagram(src, dst net.IP, srcPort, dstPort uint16, payload []byte) []byte {
+	v6 := (src != nil && src.To4() == nil) || (dst != nil && dst.To4() == nil)
+	udpLen := 8 + len(payload)
+	var pkt, pseudo []byte
+	if v6 {
+		src, dst = ipOr(src.To16(), net.IPv6unspecified), ipOr(dst.To16(), net.IPv6unspecified)
+		pkt = make([]byte, 40, 40+udpLen)
+		pkt[0] = 6 << 4
+		binary.BigEndian.PutUint16(pkt[4:], uint16(udpLen))
+		pkt[6] = 17 // UDP
+		pkt[7] = 64
+		copy(pkt[8:], src)
+		copy(pkt[24:], dst)
+		pseudo = append(append(pseudo, src...), dst...)
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(udpLen))
+		pseudo = append(pseudo, 0, 0, 0, 17)
+	} else {
+		src, dst = ipOr(src.To4(), net.IPv4zero.To4()), ipOr(dst.To4(), net.IPv4zero.To4())
+		pkt = make([]byte, 20, 20+udpLen)
+		pkt[0] = 4<<4 | 5
+		binary.BigEndian.PutUint16(pkt[2:], uint16(20+udpLen))
+		pkt[8] = 64
+		pkt[9] = 17
+		copy(pkt[12:], src)
+		copy(pkt[16:], dst)
+		binary.BigEndian.PutUint16(pkt[10:], checksum(pkt, 0))
+		pseudo = append(append(pseudo, src...), dst...)
+		pseudo = append(pseudo, 0, 17)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(udpLen))
+	}
+	off := len(pkt)
+	pkt = binary.BigEndian.AppendUint16(pkt, srcPort)
+	pkt = binary.BigEndian.AppendUint16(pkt, dstPort)
+	pkt = binary.BigEndian.AppendUint16(pkt, uint16(udpLen))
+	pkt = append(pkt, 0, 0)
+	pkt = append(pkt, payload...)
+	sum := checksum(pkt[off:], checksum(pseudo, 0)^0xffff)
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(pkt[off+6:], sum)
+	return pkt
+}
+
+func ipOr(ip, def net.IP) net.IP {
+	if ip == nil {
+		return def
+	}
+	return ip
+}
+
+// checksum returns the Internet checksum of b, continuing from the
+// uncomplemented partial sum initial.
+func checksum(b []byte, initial uint16) uint16 {
+	sum := uint32(initial)
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
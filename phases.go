@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// printPhases splits the time of each resolver's successful samples into
+// packing the queries, the network and parsing the responses, for -phases.
+// The main table counts the network alone; the share shows how much of the
+// whole time was this host's CPU.
+func printPhases(rows []bench.Result) {
+	fmt.Printf("\nWhere the time goes (-phases)\n")
+	fmt.Printf("%-12s  %7s  %10s  %11s  %10s  %11s\n", "Resolver", "Split", "Pack med", "Network med", "Parse med", "Local share")
+	fmt.Println(strings.Repeat("-", 80))
+	unsplit := false
+	for _, r := range rows {
+		var build, network, parse []float64 // in microseconds
+		var local, whole float64
+		ok := 0
+		for _, s := range r.Samples {
+			if s.Err != nil {
+				continue
+			}
+			ok++
+			if s.Build <= 0 {
+				continue
+			}
+			build = append(build, microseconds(s.Build))
+			network = append(network, microseconds(s.Duration))
+			parse = append(parse, microseconds(s.Parse))
+			local += microseconds(s.Build + s.Parse)
+			// With -wire-timing the overhead holds packing and parsing.
+			whole += microseconds(s.Duration + max(s.Overhead, s.Build+s.Parse))
+		}
+		unsplit = unsplit || len(build) < ok
+		share := "--"
+		if whole > 0 {
+			share = fmt.Sprintf("%.2f%%", 100*local/whole)
+		}
+		fmt.Printf("%-12s  %7s  %10s  %11s  %10s  %11s\n", r.Name, fmt.Sprintf("%d/%d", len(build), ok),
+			fineDur(finePercentile(build, 50)), fineDur(finePercentile(network, 50)), fineDur(finePercentile(parse, 50)), share)
+	}
+	if unsplit {
+		fmt.Println("Samples not split keep their whole time in the main table: those whose transport does not report packing and parsing (OS, iterative, DNSCrypt, ODoH).")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/schedule"
+	"github.com/ohidurbappy/dns-bench/stamp"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// planOptions are the settings printPlan reports besides the Runner.
+type planOptions struct {
+	Mode      string
+	Pin       bool
+	Bootstrap string
+	Schedule  *schedule.Schedule
+	Watch     time.Duration
+	Web       string
+	Outputs   []string
+}
+
+// transportNames are the protocol names of the registered schemes.
+var transportNames = map[string]string{
+	"udp": "UDP", "tcp": "TCP", "tls": "DoT", "quic": "DoQ", "https": "DoH", "odoh": "ODoH",
+	"iterative": "Iterative",
+}
+
+// planNames is how many query names of each resolver printPlan shows.
+const planNames = 3
+
+// printPlan describes what a run of r would do for -dry-run: the query
+// settings, each resolver with its transport and first query names, the
+// worst-case duration and when runs happen. Creating a transport does not
+// send anything, so invalid addresses are reported here too.
+func printPlan(r *bench.Runner, o planOptions) {
+	fmt.Printf("DNS Benchmark Plan (dry run, no queries are sent)\n")
+	qtype := joinTypes(r.QueryTypes())
+	switch {
+	case r.BrowserSim:
+		qtype += " in parallel"
+	case len(r.DomainTypes) > 0:
+		qtype += " per workload name"
+	}
+	fmt.Printf("Target: %s | Runs: %s | Timeout: %v | Query type: %s | Mode: %s\n",
+		r.Domain, runsText(r), r.Timeout, qtype, o.Mode)
+	fmt.Println(strings.Repeat("-", 80))
+
+	switch {
+	case len(r.Domains) > 0 && r.ZipfExponent > 0:
+		fmt.Printf("Names:       %d workload domains, drawn with Zipf exponent %g\n", len(r.Domains), r.ZipfExponent)
+	case len(r.Domains) > 0:
+		fmt.Printf("Names:       %d workload domains, in turn\n", len(r.Domains))
+	default:
+		fmt.Printf("Names:       %s\n", r.Domain)
+	}
+	if len(r.Search) > 0 {
+		fmt.Printf("Search:      %s, ndots:%d\n", strings.Join(r.Search, " "), r.Ndots)
+		fmt.Printf("Tried:       %s, in order until one has records\n", strings.Join(bench.SearchNames(r.Domain, r.Search, r.Ndots), ", "))
+	}
+	if r.Cold {
+		fmt.Printf("Cold:        a random label before every name\n")
+	} else if r.ColdShare > 0 {
+		fmt.Printf("Cold:        a random label before %.0f%% of the names, at random\n", r.ColdShare*100)
+	}
+	if r.Seed != 0 {
+		fmt.Printf("Seed:        %d (the names below are exactly those sent)\n", r.Seed)
+	} else if r.Cold || r.ColdShare > 0 || r.ZipfExponent > 0 {
+		fmt.Printf("Seed:        none (random names differ in every run)\n")
+	}
+	if imp := transport.CurrentImpairment(); imp != (transport.Impairment{}) {
+		fmt.Printf("Impairment:  %s, simulated in userspace\n", imp)
+	}
+	fmt.Printf("Recursion:   %s\n", ternary(r.NonRecursive, "not desired (authoritative servers)", "desired"))
+	if o.Bootstrap != "" || o.Pin {
+		fmt.Printf("Host names:  resolved via %s%s\n", ternary(o.Bootstrap != "", o.Bootstrap, "the system resolver"),
+			ternary(o.Pin, ", pinned for the run", ""))
+	}
+
+	fmt.Printf("\n%-12s  %-9s  %-34s  %s\n", "Resolver", "Transport", "Address", "First queries")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, res := range r.Resolvers {
+		proto, addr := "", res.Addr
+		switch {
+		case res.Addr == "":
+			proto, addr = "-", "(looked up at run time)"
+		case strings.HasPrefix(res.Addr, "sdns://"):
+			if st, err := stamp.Parse(res.Addr); err == nil {
+				proto, addr = st.Proto.String(), st.Name()
+			}
+		default:
+			proto = transportNames[transport.Scheme(res.Addr)]
+		}
+		if _, err := transport.New(res.Addr); err != nil && res.Addr != "" {
+			fmt.Printf("%-12s  %-9s  %-34s  ! %v\n", res.Name, orDash(proto), addr, err)
+			continue
+		}
+		names := r.FirstQueryNames(res, planNames+1)
+		if r.Duration <= 0 {
+			names = names[:min(len(names), r.Count)]
+		}
+		more := ""
+		if len(names) > planNames {
+			names, more = names[:planNames], ", ..."
+		}
+		fmt.Printf("%-12s  %-9s  %-34s  %s%s\n", res.Name, orDash(proto), addr, strings.Join(names, ", "), more)
+	}
+
+	conc := max(r.Concurrency, 1)
+	rounds := (len(r.Resolvers) + conc - 1) / conc
+	if r.Duration > 0 {
+		fmt.Printf("\nQueries:     as many as answered in %v per resolver, %d resolver%s at a time\n",
+			r.Duration, min(conc, len(r.Resolvers)), ternary(conc > 1, "s", ""))
+		fmt.Printf("Run time:    %v per run, up to %v more for the last queries\n",
+			time.Duration(rounds)*r.Duration, time.Duration(rounds)*r.Timeout)
+	} else {
+		fmt.Printf("\nQueries:     %d (%d per resolver, %d resolver%s at a time)\n",
+			r.Count*len(r.Resolvers), r.Count, min(conc, len(r.Resolvers)), ternary(conc > 1, "s", ""))
+		if r.Timeout > 0 {
+			fmt.Printf("Worst case:  %v per run, if every query times out\n", time.Duration(rounds*r.Count)*r.Timeout)
+		}
+	}
+	if r.SiteCheckEvery > 0 {
+		fmt.Printf("Site checks: every %d queries\n", r.SiteCheckEvery)
+	}
+	if r.Rate > 0 {
+		fmt.Printf("Rate:        at most %g queries per second per resolver\n", r.Rate)
+	}
+	if r.Retries > 0 {
+		fmt.Printf("Retries:     up to %d per query without an answer\n", r.Retries)
+	}
+	if r.ConnsPerResolver > 0 {
+		fmt.Printf("Connections: up to %d kept open per TCP, DoT or DoH resolver\n", r.ConnsPerResolver)
+	}
+	if r.FastOpen {
+		fmt.Printf("Fast open:   TCP Fast Open for TCP and DoT connections\n")
+	}
+	if r.WireTiming {
+		fmt.Printf("Timing:      on the wire, from writing each query to reading its response\n")
+	}
+	if r.BusyPoll {
+		fmt.Printf("Busy poll:   UDP and TCP answers, a CPU per query in flight\n")
+	}
+	if r.Phases {
+		fmt.Printf("Phases:      network time only, packing and parsing left out\n")
+	}
+	if r.BusyCPU > 0 {
+		fmt.Printf("CPU watch:   %s while other processes keep the CPUs over %g%% busy\n", ternary(r.PauseWhenBusy, "pause", "warn"), 100*r.BusyCPU)
+	}
+	if r.PinCPU {
+		fmt.Printf("Threads:     one per resolver, bound to a CPU\n")
+	}
+	if r.Filter != nil {
+		fmt.Printf("Filter:      count samples matching %s\n", r.Filter)
+	}
+	if r.AbortAfterErrors > 0 {
+		fmt.Printf("Abort:       after %d consecutive failures\n", r.AbortAfterErrors)
+	}
+	switch {
+	case o.Web != "":
+		fmt.Printf("Runs:        on demand from the web UI at %s\n", o.Web)
+	case o.Schedule != nil:
+		fmt.Printf("Runs:        on schedule %s (local time), next at", o.Schedule)
+		at := time.Now()
+		for i := 0; i < 3; i++ {
+			if at = o.Schedule.Next(at); at.IsZero() {
+				break
+			}
+			fmt.Printf("%s %s", ternary(i > 0, ",", ""), at.Format("2006-01-02 15:04"))
+		}
+		fmt.Println()
+	case o.Watch > 0:
+		fmt.Printf("Runs:        every %v until interrupted\n", o.Watch)
+	default:
+		fmt.Printf("Runs:        once\n")
+	}
+	if len(o.Outputs) > 0 {
+		fmt.Printf("Outputs:     %s\n", strings.Join(o.Outputs, "; "))
+	}
+}
+
+// dryRunOutputs lists the outputs that are set, as "kind: value".
+func dryRunOutputs(outputs map[string]string) []string {
+	var out []string
+	for kind, v := range outputs {
+		if v != "" {
+			out = append(out, kind+": "+v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// runsText describes how many queries each resolver gets: Count, or for
+// how long with Duration.
+func runsText(r *bench.Runner) string {
+	if r.Duration > 0 {
+		return "for " + r.Duration.String()
+	}
+	return fmt.Sprint(r.Count)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// privacyColumn, when set by -privacy, adds the logging policy, filtering
+// and jurisdiction of each resolver to the results table.
+var privacyColumn bool
+
+// knownPolicy is the published logging and filtering policy of the
+// services at some addresses and host names.
+type knownPolicy struct {
+	addrs     []string
+	hosts     []string // host names, matching subdomains too
+	logging   string
+	filtering string
+}
+
+// knownPolicies summarize the privacy policies of the public resolvers in
+// knownOperators, per service: operators filter differently on different
+// addresses. Logging is what is kept about the client address.
+var knownPolicies = []knownPolicy{
+	{[]string{"1.1.1.1", "1.0.0.1", "2606:4700:4700::1111", "2606:4700:4700::1001"},
+		[]string{"cloudflare-dns.com", "one.one.one.one"}, "IP 25h", "none"},
+	{[]string{"1.1.1.2", "1.0.0.2", "2606:4700:4700::1112", "2606:4700:4700::1002"},
+		[]string{"security.cloudflare-dns.com"}, "IP 25h", "malware"},
+	{[]string{"1.1.1.3", "1.0.0.3", "2606:4700:4700::1113", "2606:4700:4700::1003"},
+		[]string{"family.cloudflare-dns.com"}, "IP 25h", "malware, adult"},
+	{[]string{"8.8.8.8", "8.8.4.4", "2001:4860:4860::8888", "2001:4860:4860::8844"},
+		[]string{"dns.google"}, "IP 24-48h", "none"},
+	{[]string{"9.9.9.9", "149.112.112.112", "2620:fe::fe", "2620:fe::9"},
+		[]string{"dns.quad9.net", "dns9.quad9.net"}, "no IP logs", "malware"},
+	{[]string{"9.9.9.10", "149.112.112.10", "2620:fe::10", "2620:fe::fe:10"},
+		[]string{"dns10.quad9.net"}, "no IP logs", "none"},
+	{[]string{"9.9.9.11", "149.112.112.11", "2620:fe::11", "2620:fe::fe:11"},
+		[]string{"dns11.quad9.net"}, "no IP logs", "malware"},
+	{[]string{"208.67.222.222", "208.67.220.220", "2620:119:35::35", "2620:119:53::53"},
+		[]string{"doh.opendns.com"}, "logged", "phishing"},
+	{[]string{"208.67.222.123", "208.67.220.123"},
+		[]string{"doh.familyshield.opendns.com"}, "logged", "adult"},
+	{[]string{"94.140.14.14", "94.140.15.15", "2a10:50c0::ad1:ff", "2a10:50c0::ad2:ff"},
+		[]string{"dns.adguard-dns.com"}, "no IP logs", "ads, trackers"},
+	{[]string{"94.140.14.140", "94.140.14.141", "2a10:50c0::1:ff", "2a10:50c0::2:ff"},
+		[]string{"unfiltered.adguard-dns.com"}, "no IP logs", "none"},
+	{[]string{"94.140.14.15", "94.140.15.16", "2a10:50c0::bad1:ff", "2a10:50c0::bad2:ff"},
+		[]string{"family.adguard-dns.com"}, "no IP logs", "ads, trackers, adult"},
+	{nil, []string{"nextdns.io"}, "per profile", "per profile"},
+}
+
+// policyOf returns the knownPolicies entry of the resolver, by address and
+// then by server host name, or nil.
+func policyOf(r bench.Resolver) *knownPolicy {
+	ips := resolverIPs(r)
+	for i := range knownPolicies {
+		for _, a := range knownPolicies[i].addrs {
+			for _, ip := range ips {
+				if ip.String() == a {
+					return &knownPolicies[i]
+				}
+			}
+		}
+	}
+	// The longest match wins: family.cloudflare-dns.com is not the service
+	// of cloudflare-dns.com.
+	host := strings.ToLower(strings.TrimSuffix(transport.ServerHost(r.Addr), "."))
+	var best *knownPolicy
+	matched := 0
+	for i := range knownPolicies {
+		for _, h := range knownPolicies[i].hosts {
+			if (host == h || strings.HasSuffix(host, "."+h)) && len(h) > matched {
+				best, matched = &knownPolicies[i], len(h)
+			}
+		}
+	}
+	return best
+}
+
+// privacyCells returns the logging, filtering and jurisdiction cells of
+// the -privacy column for op.
+func privacyCells(op *bench.Operator) (logging, filtering, jurisdiction string) {
+	if op == nil {
+		return "-", "-", "-"
+	}
+	if op.ASN == 0 && op.Name == privateNetwork.Name {
+		return "-", "-", "local"
+	}
+	return orDash(op.Logging), orDash(op.Filtering), orDash(op.Country)
+}
+
+// printPrivacyHeader prints the -privacy column titles, if rows have it.
+func printPrivacyHeader(rows []bench.Result) bool {
+	if !hasPrivacy(rows) {
+		return false
+	}
+	fmt.Printf("  %-11s  %-20s  %s", "Logs", "Filtering", "Jurisdiction")
+	return true
+}
+
+// hasPrivacy reports whether the results table shows the -privacy column:
+// with -privacy, for rows of resolvers rather than combined groups.
+func hasPrivacy(rows []bench.Result) bool {
+	if !privacyColumn {
+		return false
+	}
+	for _, r := range rows {
+		if r.Operator != nil {
+			return true
+		}
+	}
+	return false
+}
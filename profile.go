@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// benchProfile presets the query settings of a common scenario for -profile.
+// Flags given explicitly override the profile.
+type benchProfile struct {
+	describe    string
+	count       int
+	timeout     time.Duration
+	qtypes      []dnsmsg.Type // cycled through as bench.Runner.QTypeMix; nil for A or AAAA by -network
+	coldShare   float64       // fraction of uncached names
+	concurrency int
+	domain      string // default -domain, if the qtypes need a particular one
+}
+
+var profiles = map[string]benchProfile{
+	"gaming": {
+		describe: "a few mostly cached address lookups at launch and matchmaking, where the slow tail matters",
+		count:    50, timeout: time.Second,
+		coldShare: 0.1, concurrency: 1,
+	},
+	"browsing": {
+		describe: "A, AAAA and HTTPS for every name as browsers ask, a third of the names uncached",
+		count:    60, timeout: 1500 * time.Millisecond,
+		qtypes:    []dnsmsg.Type{dnsmsg.TypeA, dnsmsg.TypeAAAA, dnsmsg.TypeHTTPS},
+		coldShare: 0.3, concurrency: 2,
+		domain: defaultHTTPSDomain,
+	},
+	"enterprise": {
+		describe: "address, mail and TXT (SPF, verification) lookups of offices and servers, half of the names uncached",
+		count:    100, timeout: 2 * time.Second,
+		qtypes:    []dnsmsg.Type{dnsmsg.TypeA, dnsmsg.TypeAAAA, dnsmsg.TypeMX, dnsmsg.TypeTXT},
+		coldShare: 0.5, concurrency: 4,
+	},
+}
+
+// profileNames lists the profiles for the -profile usage text.
+func profileNames() string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// joinTypes formats a query type mix as "A+AAAA+HTTPS".
+func joinTypes(types []dnsmsg.Type) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// ProxyOverheadResult pairs the timings of identical cold queries sent at
+// the same moment to a local forwarder and to its upstream.
+type ProxyOverheadResult struct {
+	Local, Upstream bench.Resolver
+	LocalSamples    []bench.Sample
+	UpSamples       []bench.Sample
+	Deltas          []float64 // local - upstream in ms, for pairs where both succeeded
+}
+
+// parseProxyOverhead parses "local=ADDR,upstream=ADDR".
+func parseProxyOverhead(s string) (local, upstream bench.Resolver, err error) {
+	for _, p := range splitList(s) {
+		k, v, _ := strings.Cut(p, "=")
+		switch strings.TrimSpace(k) {
+		case "local":
+			local = bench.Resolver{Name: "Local", Addr: strings.TrimSpace(v)}
+		case "upstream":
+			upstream = bench.Resolver{Name: "Upstream", Addr: strings.TrimSpace(v)}
+		default:
+			return local, upstream, fmt.Errorf("-proxy-overhead: unknown key %q", k)
+		}
+	}
+	if local.Addr == "" || upstream.Addr == "" {
+		return local, upstream, fmt.Errorf("-proxy-overhead: want local=ADDR,upstream=ADDR")
+	}
+	return local, upstream, nil
+}
+
+// probeProxyOverhead sends count random-label queries below domain to both
+// resolvers concurrently. Because every name is new, the forwarder has to
+// ask its upstream, so the paired difference isolates its own processing
+// cost (plus the local hop) from upstream latency swings.
+func probeProxyOverhead(local, upstream bench.Resolver, domain, network string, count int, timeout time.Duration) ProxyOverheadResult {
+	res := ProxyOverheadResult{Local: local, Upstream: upstream}
+	ltr, lerr := transport.New(local.Addr)
+	utr, uerr := transport.New(upstream.Addr)
+	qtype := bench.QType(network)
+	query := func(tr transport.Transport, trErr error, name string) bench.Sample {
+		if trErr != nil {
+			return bench.Sample{Err: trErr}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		start := time.Now()
+		_, err := bench.LookupIP(ctx, tr, name, qtype)
+		return bench.Sample{Duration: time.Since(start), Err: err}
+	}
+
+	for i := 0; i < count; i++ {
+		name := bench.RandomLabel() + "." + domain
+		var ls, us bench.Sample
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); ls = query(ltr, lerr, name) }()
+		go func() { defer wg.Done(); us = query(utr, uerr, name) }()
+		wg.Wait()
+		res.LocalSamples = append(res.LocalSamples, ls)
+		res.UpSamples = append(res.UpSamples, us)
+		if ls.Err == nil && us.Err == nil {
+			res.Deltas = append(res.Deltas, ms(ls.Duration)-ms(us.Duration))
+		}
+	}
+	return res
+}
+
+func printProxyOverhead(r ProxyOverheadResult) {
+	printTable([]bench.Result{
+		{Name: r.Local.Name, Stats: bench.Summarize(r.LocalSamples), Samples: r.LocalSamples},
+		{Name: r.Upstream.Name, Stats: bench.Summarize(r.UpSamples), Samples: r.UpSamples},
+	})
+
+	fmt.Printf("\nPaired difference (local - upstream), %d pairs\n", len(r.Deltas))
+	fmt.Printf("%8s  %8s  %8s  %8s  %8s  %8s  %11s\n", "Min", "p5", "Mean", "Median", "p95", "Max", "Local slower")
+	fmt.Println(strings.Repeat("-", 72))
+	if len(r.Deltas) == 0 {
+		fmt.Println("  no pair where both queries succeeded")
+		return
+	}
+	d := append([]float64(nil), r.Deltas...)
+	sort.Float64s(d)
+	var sum float64
+	slower := 0
+	for _, v := range d {
+		sum += v
+		if v > 0 {
+			slower++
+		}
+	}
+	f := func(v float64) string { return deltaFmt(time.Duration(v * float64(time.Millisecond))) }
+	fmt.Printf("%8s  %8s  %8s  %8s  %8s  %8s  %10.1f%%\n",
+		f(d[0]), f(bench.Percentile(d, 5)), f(sum/float64(len(d))), f(bench.Percentile(d, 50)),
+		f(bench.Percentile(d, 95)), f(d[len(d)-1]), 100*float64(slower)/float64(len(d)))
+	fmt.Printf("\nForwarder processing cost (median): %s per query\n", f(bench.Percentile(d, 50)))
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// resolvedLink is the DNS configuration systemd-resolved or NetworkManager
+// has for one network link.
+type resolvedLink struct {
+	Name       string // interface name; "global" for systemd-resolved's own servers
+	Servers    []resolvedServer
+	DNSSEC     string // systemd-resolved only: yes, no or allow-downgrade
+	DNSOverTLS string // systemd-resolved only: yes, no or opportunistic
+}
+
+type resolvedServer struct {
+	IP   netip.Addr
+	Port uint16 // zero for the default
+	Name string // TLS server name, if configured
+}
+
+// resolvers returns the servers of the link, named Link#N. With
+// DNS-over-TLS enforced they are queried over TLS, as systemd-resolved
+// does; in opportunistic mode it falls back to plain DNS, which is what is
+// benchmarked then.
+func (l resolvedLink) resolvers() []bench.Resolver {
+	var rs []bench.Resolver
+	for i, s := range l.Servers {
+		port := ternary(l.DNSOverTLS == "yes", "853", "53")
+		if s.Port != 0 {
+			port = strconv.Itoa(int(s.Port))
+		}
+		ip := s.IP
+		if ip.IsLinkLocalUnicast() && ip.Zone() == "" && l.Name != "global" {
+			ip = ip.WithZone(l.Name)
+		}
+		addr := net.JoinHostPort(ip.String(), port)
+		if l.DNSOverTLS == "yes" {
+			addr = "tls://" + net.JoinHostPort(ternary(s.Name != "", s.Name, ip.String()), port)
+		}
+		rs = append(rs, bench.Resolver{Name: fmt.Sprintf("%s#%d", l.Name, i+1), Addr: addr})
+	}
+	return rs
+}
+
+// describe returns the settings of the link for the run header.
+func (l resolvedLink) describe() string {
+	addrs := make([]string, len(l.Servers))
+	for i, s := range l.Servers {
+		addrs[i] = s.IP.String()
+	}
+	out := fmt.Sprintf("%s: %s", l.Name, strings.Join(addrs, ", "))
+	if l.DNSSEC != "" || l.DNSOverTLS != "" {
+		out += fmt.Sprintf(" (DNSSEC %s, DNS-over-TLS %s)", orDash(l.DNSSEC), orDash(l.DNSOverTLS))
+	}
+	return out
+}
+
+const (
+	resolvedService = "org.freedesktop.resolve1"
+	resolvedPath    = "/org/freedesktop/resolve1"
+)
+
+// resolvedLinks asks systemd-resolved over D-Bus, with busctl, for the DNS
+// servers of each link and its DNSSEC and DNS-over-TLS modes. Links without
+// servers are left out.
+func resolvedLinks() ([]resolvedLink, error) {
+	var entries [][]json.RawMessage
+	if err := resolvedProperty(resolvedPath, "Manager", "DNSEx", &entries); err != nil {
+		// DNSEx, with ports and server names, is new in systemd 246.
+		if err := resolvedProperty(resolvedPath, "Manager", "DNS", &entries); err != nil {
+			return nil, err
+		}
+	}
+	var global resolvedLink
+	_ = resolvedProperty(resolvedPath, "Manager", "DNSSEC", &global.DNSSEC)
+	_ = resolvedProperty(resolvedPath, "Manager", "DNSOverTLS", &global.DNSOverTLS)
+
+	var links []resolvedLink
+	byIndex := make(map[int]int)
+	for _, e := range entries {
+		index, s, err := parseResolvedServer(e)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := byIndex[index]
+		if !ok {
+			l := global
+			l.Name = "global"
+			if index != 0 {
+				l.Name = fmt.Sprintf("link%d", index)
+				if ifi, err := net.InterfaceByIndex(index); err == nil {
+					l.Name = ifi.Name
+				}
+				path := resolvedPath + "/link/" + busPathEscape(strconv.Itoa(index))
+				var mode string
+				if resolvedProperty(path, "Link", "DNSSEC", &mode) == nil && mode != "" {
+					l.DNSSEC = mode
+				}
+				if resolvedProperty(path, "Link", "DNSOverTLS", &mode) == nil && mode != "" {
+					l.DNSOverTLS = mode
+				}
+			}
+			i = len(links)
+			byIndex[index] = i
+			links = append(links, l)
+		}
+		links[i].Servers = append(links[i].Servers, s)
+	}
+	return links, nil
+}
+
+// parseResolvedServer decodes one entry of the DNS (iiay) or DNSEx
+// (iiayqs) property: link index, address family, address, port and server
+// name.
+func parseResolvedServer(e []json.RawMessage) (int, resolvedServer, error) {
+	var s resolvedServer
+	var index int
+	var ip []byte
+	if len(e) < 3 {
+		return 0, s, fmt.Errorf("systemd-resolved: unexpected DNS entry %s", e)
+	}
+	if err := json.Unmarshal(e[0], &index); err != nil {
+		return 0, s, err
+	}
+	if err := json.Unmarshal(e[2], &ip); err != nil {
+		return 0, s, err
+	}
+	var ok bool
+	if s.IP, ok = netip.AddrFromSlice(ip); !ok {
+		return 0, s, fmt.Errorf("systemd-resolved: bad address %v", ip)
+	}
+	if len(e) >= 5 {
+		_ = json.Unmarshal(e[3], &s.Port)
+		_ = json.Unmarshal(e[4], &s.Name)
+	}
+	return index, s, nil
+}
+
+// resolvedProperty reads a property of a systemd-resolved object into v.
+func resolvedProperty(path, iface, name string, v any) error {
+	out, err := exec.Command("busctl", "--json=short", "get-property",
+		resolvedService, path, resolvedService+"."+iface, name).Output()
+	if err != nil {
+		return fmt.Errorf("busctl: %w", err)
+	}
+	var prop struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(out, &prop); err != nil {
+		return fmt.Errorf("busctl: %w", err)
+	}
+	return json.Unmarshal(prop.Data, v)
+}
+
+// busPathEscape escapes a D-Bus object path element as sd-bus does: bytes
+// other than ASCII letters and digits, and a leading digit, become _XX.
+func busPathEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		alnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !alnum || i == 0 && c >= '0' && c <= '9' {
+			fmt.Fprintf(&b, "_%02x", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// networkManagerLinks asks NetworkManager, with nmcli, for the DNS servers
+// of each device.
+func networkManagerLinks() ([]resolvedLink, error) {
+	out, err := exec.Command("nmcli", "-t", "-f", "GENERAL.DEVICE,IP4.DNS,IP6.DNS", "device", "show").Output()
+	if err != nil {
+		return nil, fmt.Errorf("nmcli: %w", err)
+	}
+	return parseNmcliDNS(string(out)), nil
+}
+
+// parseNmcliDNS reads the terse output of "nmcli -t -f
+// GENERAL.DEVICE,IP4.DNS,IP6.DNS device show", which escapes the colons of
+// IPv6 addresses with backslashes.
+func parseNmcliDNS(out string) []resolvedLink {
+	var links []resolvedLink
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		v = strings.ReplaceAll(v, `\:`, ":")
+		switch {
+		case k == "GENERAL.DEVICE":
+			links = append(links, resolvedLink{Name: v})
+		case len(links) > 0 && (strings.HasPrefix(k, "IP4.DNS") || strings.HasPrefix(k, "IP6.DNS")):
+			if ip, err := netip.ParseAddr(v); err == nil {
+				l := &links[len(links)-1]
+				l.Servers = append(l.Servers, resolvedServer{IP: ip})
+			}
+		}
+	}
+	kept := links[:0]
+	for _, l := range links {
+		if len(l.Servers) > 0 {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// linkResolvers returns the per-link DNS servers of systemd-resolved, if
+// it runs, else of NetworkManager, and a description of each link.
+func linkResolvers() ([]bench.Resolver, []string, error) {
+	var links []resolvedLink
+	var err error
+	if _, serr := os.Stat("/run/systemd/resolve"); serr == nil {
+		links, err = resolvedLinks()
+	} else {
+		links, err = networkManagerLinks()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var rs []bench.Resolver
+	var notes []string
+	for _, l := range links {
+		rs = append(rs, l.resolvers()...)
+		notes = append(notes, l.describe())
+	}
+	return rs, notes, nil
+}
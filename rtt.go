@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// rttPorts are the ports -rtt tcp connects to, by transport scheme.
+var rttPorts = map[string]string{"udp": "53", "tcp": "53", "tls": "853", "quic": "853", "https": "443"}
+
+// rttProbe returns the measurement of -rtt: "tcp" times a TCP handshake
+// with the server's DNS port, "icmp" an ICMP echo, which needs raw socket
+// privileges (root or CAP_NET_RAW).
+func rttProbe(method string) (func(context.Context, bench.Resolver) (time.Duration, error), error) {
+	switch method {
+	case "tcp":
+		return func(ctx context.Context, res bench.Resolver) (time.Duration, error) {
+			target, err := rttTarget(ctx, res)
+			if err != nil {
+				return 0, err
+			}
+			var d net.Dialer
+			start := time.Now()
+			conn, err := d.DialContext(ctx, "tcp", target.String())
+			if err != nil {
+				return 0, err
+			}
+			rtt := time.Since(start)
+			conn.Close()
+			return rtt, nil
+		}, nil
+	case "icmp":
+		return func(ctx context.Context, res bench.Resolver) (time.Duration, error) {
+			target, err := rttTarget(ctx, res)
+			if err != nil {
+				return 0, err
+			}
+			return icmpEcho(ctx, target.Addr())
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown RTT probe %q (want tcp or icmp)", method)
+}
+
+// rttTarget returns the address of the server a resolver connects to, using
+// the addresses resolveServerHosts found for host names.
+func rttTarget(ctx context.Context, res bench.Resolver) (netip.AddrPort, error) {
+	port, ok := rttPorts[transport.Scheme(res.Addr)]
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("no RTT probe for %s:// resolvers", transport.Scheme(res.Addr))
+	}
+	host, portStr, err := net.SplitHostPort(transport.HostPort(res.Addr, port))
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	if len(res.IPs) > 0 {
+		host = res.IPs[0]
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		ips, err := transport.Bootstrap().LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		ip = ips[0]
+	}
+	p, err := net.LookupPort("tcp", portStr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(p)), nil
+}
+
+// icmpEcho sends one ICMP echo request to ip and waits for the reply.
+func icmpEcho(ctx context.Context, ip netip.Addr) (time.Duration, error) {
+	conn, err := net.ListenPacket(icmpNetwork(ip), "")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	msg, seq := echoRequest(ip)
+	start := time.Now()
+	if _, err := conn.WriteTo(msg, &net.IPAddr{IP: ip.AsSlice()}); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		if r, ok := parseICMP(buf[:n], ip.Is6()); ok && r.kind == icmpEchoReply && r.seq == seq && sameIP(from, ip) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// printRTT splits each resolver's latency into the network round trip and
+// the rest, the time the resolver took to answer, from the samples that
+// have both. Resolver time is the query time minus the RTT measured just
+// before it, per sample.
+func printRTT(rows []bench.Result, method string) {
+	fmt.Printf("\nNetwork RTT vs. resolver time (%s probe before every query)\n", method)
+	fmt.Printf("%-12s  %8s  %8s  %9s  %9s  %s\n", "Resolver", "RTT med", "DNS med", "Resolve", "Resolve", "Probes")
+	fmt.Printf("%-12s  %8s  %8s  %9s  %9s\n", "", "", "", "med", "p95")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range rows {
+		var rtts, dns, rest []float64
+		for _, s := range r.Samples {
+			if s.Err != nil || s.RTT <= 0 {
+				continue
+			}
+			rtts = append(rtts, ms(s.RTT))
+			dns = append(dns, ms(s.Duration))
+			rest = append(rest, ms(max(s.Duration-s.RTT, 0)))
+		}
+		probes := fmt.Sprintf("%d/%d", len(rtts), len(r.Samples))
+		if len(rtts) == 0 {
+			fmt.Printf("%-12s  %8s  %8s  %9s  %9s  %s\n", r.Name, "--", "--", "--", "--", probes)
+			continue
+		}
+		fmt.Printf("%-12s  %8s  %8s  %9s  %9s  %s\n", r.Name, pctl(rtts, 50), pctl(dns, 50), pctl(rest, 50), pctl(rest, 95), probes)
+	}
+	fmt.Printf("\nProbes counts the successful queries with an RTT measurement.\n")
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// scalingSlowdown is how much the median may grow over the unloaded one
+// before a concurrency level counts as too many queries in flight.
+const scalingSlowdown = 2
+
+// concurrencyLevels returns 1, 2, 4, ... up to and including max.
+func concurrencyLevels(max int) []int {
+	var levels []int
+	for c := 1; c < max; c *= 2 {
+		levels = append(levels, c)
+	}
+	return append(levels, max)
+}
+
+// parseResolverArgs turns subcommand arguments, each Name=Addr or a bare
+// address, into resolvers.
+func parseResolverArgs(args []string) []bench.Resolver {
+	var out []bench.Resolver
+	for _, a := range args {
+		if strings.Contains(a, "=") || strings.HasPrefix(a, "sdns://") {
+			out = append(out, bench.ParseResolvers(a)...)
+		} else {
+			out = append(out, bench.Resolver{Name: a, Addr: a})
+		}
+	}
+	return out
+}
+
+// runScaling implements the scaling subcommand.
+func runScaling(args []string) int {
+	fs := flag.NewFlagSet("scaling", flag.ExitOnError)
+	domain := fs.String("domain", "example.com", "Domain to resolve")
+	count := fs.Int("count", 200, "Number of queries per concurrency level")
+	maxConc := fs.Int("max", 64, "Highest number of queries in flight; the levels double from 1 up to it")
+	timeout := fs.Duration("timeout", 2*time.Second, "Timeout per query")
+	qtypeName := fs.String("qtype", "", "Record type to query (default A)")
+	cold := fs.Bool("cold", false, "Prefix a random label to every name to bypass resolver caches")
+	ramp := fs.Bool("ramp", false, "Ramp up the query rate instead of the queries in flight, and find the rate where p99 latency or errors exceed the limits")
+	rampStart := fs.Float64("ramp-start", 50, "First query rate of -ramp, in queries per second")
+	rampMax := fs.Float64("ramp-max", 20000, "Highest query rate of -ramp")
+	stepDur := fs.Duration("step", 5*time.Second, "How long -ramp sends at each rate")
+	maxP99 := fs.Duration("max-p99", 100*time.Millisecond, "p99 latency above which a -ramp rate is not sustainable")
+	maxErrors := fs.Float64("max-errors", 1, "Percentage of failed queries above which a -ramp rate is not sustainable")
+	conns := fs.Int("conns-per-resolver", 0, "Sweep the TCP, DoT or DoH connection pool size from 1 up to N at -max queries in flight, instead of the queries in flight")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench scaling [flags] RESOLVER...\n\n"+
+			"Sends queries to each resolver with 1, 2, 4, ... queries in flight and reports\n"+
+			"throughput and latency per level, for sizing stub resolver pools.\n"+
+			"With -ramp, sends at rising query rates instead and reports the highest rate\n"+
+			"each resolver sustains within -max-p99 and -max-errors.\n"+
+			"With -conns-per-resolver N, keeps -max queries in flight over a pool of 1, 2,\n"+
+			"4, ... N persistent connections instead, as forwarders configured with that\n"+
+			"many connections per upstream do.\n"+
+			"RESOLVER is Name=Addr or an address, e.g. 1.1.1.1 or tls://dns.google.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	resolvers := parseResolverArgs(fs.Args())
+	if len(resolvers) == 0 || *count < 1 || *maxConc < 1 || *conns < 0 || *rampStart <= 0 || *rampMax < *rampStart || *stepDur <= 0 {
+		fs.Usage()
+		return 2
+	}
+	qtype := dnsmsg.TypeA
+	if *qtypeName != "" {
+		var err error
+		if qtype, err = dnsmsg.ParseType(*qtypeName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	resolveServerHosts(resolvers, true, *timeout)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runner := &bench.Runner{Domain: *domain, Count: *count, Timeout: *timeout, QType: qtype, Cold: *cold}
+	if *ramp {
+		limits := rampLimits{maxP99: *maxP99, maxErrors: *maxErrors}
+		fmt.Printf("DNS Query Rate Ramp\n")
+		fmt.Printf("Target: %s %s | Rates: %g to %g QPS, %v each | Limits: p99 %v, errors %g%% | Mode: %s\n",
+			*domain, qtype, *rampStart, *rampMax, *stepDur, *maxP99, *maxErrors, ternary(*cold, "COLD", "WARM"))
+		fmt.Println(strings.Repeat("-", 80))
+		knees := make([]rampResult, 0, len(resolvers))
+		for _, res := range resolvers {
+			runner.Resolvers = []bench.Resolver{res}
+			knees = append(knees, runRamp(ctx, runner, res, *rampStart, *rampMax, *stepDur, limits))
+			if ctx.Err() != nil {
+				return 1
+			}
+		}
+		printRampSummary(knees, *rampStart, *rampMax)
+		return 0
+	}
+	if *conns > 0 {
+		fmt.Printf("DNS Connection Pool Scaling\n")
+		fmt.Printf("Target: %s %s | Queries: %d per pool size | In flight: %d | Timeout: %v | Mode: %s\n",
+			*domain, qtype, *count, *maxConc, *timeout, ternary(*cold, "COLD", "WARM"))
+		fmt.Println(strings.Repeat("-", 80))
+		for _, res := range resolvers {
+			runner.Resolvers = []bench.Resolver{res}
+			runPoolSizes(ctx, runner, res, *maxConc, *conns)
+			if ctx.Err() != nil {
+				return 1
+			}
+		}
+		fmt.Println("\nPlain DNS over UDP has no connections; its rows show the pool size does not apply.")
+		return 0
+	}
+	fmt.Printf("DNS Concurrency Scaling\n")
+	fmt.Printf("Target: %s %s | Queries: %d per level | Timeout: %v | Mode: %s\n",
+		*domain, qtype, *count, *timeout, ternary(*cold, "COLD", "WARM"))
+	fmt.Println(strings.Repeat("-", 80))
+	for _, res := range resolvers {
+		runner.Resolvers = []bench.Resolver{res}
+		var steps []bench.LoadStep
+		fmt.Printf("\n%s\n", ternary(res.Name == res.Addr, res.Name, res.Name+" ("+res.Addr+")"))
+		fmt.Printf("%9s  %8s  %8s  %8s  %8s  %9s\n", "In flight", "QPS", "Med", "p95", "p99", "Success%")
+		fmt.Println(strings.Repeat("-", 72))
+		for _, c := range concurrencyLevels(*maxConc) {
+			step := runner.RunConcurrent(ctx, res, c)
+			if ctx.Err() != nil {
+				break
+			}
+			steps = append(steps, step)
+			s := bench.Summarize(step.Samples)
+			if s.Successes == 0 {
+				fmt.Printf("%9d  %8.0f  %8s  %8s  %8s  %8.1f%%\n", c, step.QPS(), "--", "--", "--", successPct(s))
+				if errs := uniqueErrors(s.Errors); len(errs) > 0 {
+					fmt.Printf("  ! %s\n", errs[0])
+				}
+				break // more load will not help
+			}
+			fmt.Printf("%9d  %8.0f  %8s  %8s  %8s  %8.1f%%\n", c, step.QPS(),
+				durFmt(s.Median), durFmt(s.P95), durFmt(s.P99), successPct(s))
+		}
+		printScalingSummary(steps)
+		if ctx.Err() != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+// runPoolSizes sends queries to res with inFlight of them in flight over
+// connection pools of 1, 2, 4, ... up to conns connections, and prints the
+// latency at each size. Queries beyond the pool size wait for a free
+// connection, which shows in the latency of small pools; the first query
+// over each connection pays its handshakes.
+func runPoolSizes(ctx context.Context, runner *bench.Runner, res bench.Resolver, inFlight, conns int) {
+	fmt.Printf("\n%s\n", ternary(res.Name == res.Addr, res.Name, res.Name+" ("+res.Addr+")"))
+	fmt.Printf("%9s  %8s  %8s  %8s  %8s  %9s\n", "Conns", "QPS", "Med", "p95", "p99", "Success%")
+	fmt.Println(strings.Repeat("-", 72))
+	var best bench.LoadStep
+	bestConns := 0
+	for _, n := range concurrencyLevels(conns) {
+		r := *runner
+		r.ConnsPerResolver = n
+		step := r.RunConcurrent(ctx, res, inFlight)
+		if ctx.Err() != nil {
+			return
+		}
+		s := bench.Summarize(step.Samples)
+		if s.Successes == 0 {
+			fmt.Printf("%9d  %8.0f  %8s  %8s  %8s  %8.1f%%\n", n, step.QPS(), "--", "--", "--", successPct(s))
+			if errs := uniqueErrors(s.Errors); len(errs) > 0 {
+				fmt.Printf("  ! %s\n", errs[0])
+			}
+			continue
+		}
+		fmt.Printf("%9d  %8.0f  %8s  %8s  %8s  %8.1f%%\n", n, step.QPS(),
+			durFmt(s.Median), durFmt(s.P95), durFmt(s.P99), successPct(s))
+		if bestConns == 0 || step.QPS() > best.QPS() {
+			best, bestConns = step, n
+		}
+	}
+	if bestConns > 0 {
+		fmt.Printf("Peak: %.0f QPS with %d connection%s for %d in flight.\n", best.QPS(), bestConns, ternary(bestConns == 1, "", "s"), inFlight)
+	}
+}
+
+// printScalingSummary names the level with the highest throughput and the
+// most queries in flight that keep the median within scalingSlowdown of
+// the unloaded median and lose no more answers than one at a time.
+func printScalingSummary(steps []bench.LoadStep) {
+	if len(steps) == 0 {
+		return
+	}
+	base := bench.Summarize(steps[0].Samples)
+	if base.Successes == 0 {
+		return
+	}
+	best, pool := steps[0], steps[0]
+	for _, st := range steps[1:] {
+		if st.QPS() > best.QPS() {
+			best = st
+		}
+		s := bench.Summarize(st.Samples)
+		if s.Successes > 0 && s.Median <= scalingSlowdown*base.Median && successPct(s) >= successPct(base)-1 {
+			pool = st
+		}
+	}
+	fmt.Printf("Peak: %.0f QPS with %d in flight. Up to %d in flight keep the median within %dx of %s.\n",
+		best.QPS(), best.Concurrency, pool.Concurrency, scalingSlowdown, durFmt(base.Median))
+}
+
+// rampBisections is how many rates -ramp tries between the last sustained
+// rate and the first that was not, to narrow down the knee.
+const rampBisections = 3
+
+// rampLimits are the limits a sustainable query rate stays within.
+type rampLimits struct {
+	maxP99    time.Duration
+	maxErrors float64 // percent
+}
+
+// exceeded returns which limit a step broke, or "".
+func (l rampLimits) exceeded(s bench.Stats) string {
+	if errs := 100 - successPct(s); errs > l.maxErrors {
+		return fmt.Sprintf("errors %.1f%%", errs)
+	}
+	if s.P99 > l.maxP99 {
+		return "p99 " + durFmt(s.P99)
+	}
+	return ""
+}
+
+// rampResult is the outcome of -ramp for one resolver.
+type rampResult struct {
+	name      string
+	sustained float64 // highest rate within the limits, 0 if none
+	limitedBy string  // limit broken by the next rate
+}
+
+// runRamp doubles the query rate from start until a rate breaks the limits
+// or max is reached, then bisects between the last good rate and the bad
+// one.
+func runRamp(ctx context.Context, runner *bench.Runner, res bench.Resolver, start, max float64, d time.Duration, limits rampLimits) rampResult {
+	result := rampResult{name: res.Name}
+	fmt.Printf("\n%s\n", ternary(res.Name == res.Addr, res.Name, res.Name+" ("+res.Addr+")"))
+	fmt.Printf("%9s  %9s  %8s  %8s  %8s  %s\n", "Rate", "Answered", "Med", "p99", "Errors", "Knee")
+	fmt.Println(strings.Repeat("-", 72))
+	try := func(rate float64) bool {
+		step := runner.RunRate(ctx, res, rate, d)
+		if ctx.Err() != nil {
+			return false
+		}
+		s := bench.Summarize(step.Samples)
+		broken := limits.exceeded(s)
+		med, p99 := "--", "--"
+		if s.Successes > 0 {
+			med, p99 = durFmt(s.Median), durFmt(s.P99)
+		}
+		line := fmt.Sprintf("%9.0f  %9.0f  %8s  %8s  %7.1f%%  %s", rate, step.QPS(), med, p99, 100-successPct(s), broken)
+		fmt.Println(strings.TrimRight(line, " "))
+		if broken != "" {
+			result.limitedBy = broken
+			return false
+		}
+		result.sustained = rate
+		return true
+	}
+	bad := 0.0
+	for rate := start; ; rate = min(rate*2, max) {
+		if !try(rate) {
+			bad = rate
+			break
+		}
+		if rate >= max {
+			return result
+		}
+	}
+	if ctx.Err() != nil || result.sustained == 0 {
+		return result
+	}
+	good := result.sustained
+	for range rampBisections {
+		mid := (good + bad) / 2
+		if try(mid) {
+			good = mid
+		} else {
+			bad = mid
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return result
+}
+
+func printRampSummary(results []rampResult, start, max float64) {
+	fmt.Printf("\nSustainable query rate\n")
+	fmt.Printf("%-12s  %12s  %s\n", "Resolver", "QPS", "Limited by")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range results {
+		switch {
+		case r.sustained == 0:
+			fmt.Printf("%-12s  %12s  %s\n", r.name, fmt.Sprintf("< %.0f", start), r.limitedBy)
+		case r.limitedBy == "":
+			fmt.Printf("%-12s  %12s  %s\n", r.name, fmt.Sprintf(">= %.0f", max), "nothing up to -ramp-max")
+		default:
+			fmt.Printf("%-12s  %12.0f  %s\n", r.name, r.sustained, r.limitedBy)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// HourlyAggregate pools the results of scheduled runs by the local hour
+// of day in which each run started, so that peak-hour congestion stands
+// out. It keeps counts and a histogram per resolver and hour rather than
+// the samples, so a schedule can run for months.
+type HourlyAggregate struct {
+	Names []string // resolver order of the first run
+	Runs  [24]int
+	Hours map[string]*[24]hourCell
+}
+
+// hourCell pools the queries of one resolver in one hour of day.
+type hourCell struct {
+	count, successes int
+	min, max         time.Duration
+	hist             bench.Histogram // durations of the successes
+}
+
+// add pools the queries of one run into c.
+func (c *hourCell) add(s bench.Stats) {
+	run := hourCell{count: s.Count, successes: s.Successes, min: s.Min, max: s.Max}
+	run.hist.Merge(s.Histogram)
+	c.merge(&run)
+}
+
+// merge pools the queries of o into c.
+func (c *hourCell) merge(o *hourCell) {
+	c.count += o.count
+	if o.successes == 0 {
+		return
+	}
+	if c.successes == 0 || o.min < c.min {
+		c.min = o.min
+	}
+	c.max = max(c.max, o.max)
+	c.successes += o.successes
+	c.hist.Merge(&o.hist)
+}
+
+// median returns the median duration of the successes, or zero for none.
+func (c *hourCell) median() time.Duration {
+	return c.percentile(50)
+}
+
+// percentile reads the p-th percentile from the histogram, within the
+// extremes: a bucket's midpoint can lie beyond the durations it holds.
+func (c *hourCell) percentile(p float64) time.Duration {
+	if c.successes == 0 {
+		return 0
+	}
+	return min(max(c.hist.Percentile(p), c.min), c.max)
+}
+
+func newHourlyAggregate() *HourlyAggregate {
+	return &HourlyAggregate{Hours: make(map[string]*[24]hourCell)}
+}
+
+// Add records one run that started at the given time.
+func (a *HourlyAggregate) Add(at time.Time, rows []bench.Result) {
+	h := at.Hour()
+	a.Runs[h]++
+	for _, r := range rows {
+		byHour, ok := a.Hours[r.Name]
+		if !ok {
+			byHour = new([24]hourCell)
+			a.Hours[r.Name] = byHour
+			a.Names = append(a.Names, r.Name)
+		}
+		byHour[h].add(r.Stats)
+	}
+}
+
+// Stats summarizes the pooled queries of a resolver for one hour: the
+// counts, extremes, median and p95.
+func (a *HourlyAggregate) Stats(name string, hour int) bench.Stats {
+	byHour, ok := a.Hours[name]
+	if !ok {
+		return bench.Stats{}
+	}
+	c := &byHour[hour]
+	return bench.Stats{
+		Count: c.count, Successes: c.successes, Min: c.min, Max: c.max,
+		Median: c.median(), P95: c.percentile(95),
+	}
+}
+
+// repeatOptions configures runRepeated.
+type repeatOptions struct {
+	Hourly  bool   // print and write the hour-of-day aggregate (-schedule)
+	OutCSV  string // hour-of-day CSV, rewritten after every run
+	Trend   int    // runs in the median sparkline; zero for none
+	SaveDir string // save every completed run here
+	Alerts  *alerter
+}
+
+// runRepeated runs the benchmark at every time returned by next (given the
+// current time) until ctx is cancelled, printing each run as it completes
+// and, from the second run on, the availability SLA since the first.
+// It backs both -schedule, which follows a cron expression and aggregates
+// by hour of day, and -watch, which reruns at a fixed interval.
+func runRepeated(ctx context.Context, runner *bench.Runner, next func(time.Time) time.Time, opts repeatOptions) {
+	agg := newHourlyAggregate()
+	sla := newSLAAggregate()
+	var trend *MedianTrend
+	if opts.Trend > 0 {
+		trend = newMedianTrend(opts.Trend)
+	}
+	var first time.Time
+	for run := 1; ; run++ {
+		at := next(time.Now())
+		if at.IsZero() {
+			slog.Error("schedule never fires")
+			return
+		}
+		if wait := time.Until(at); wait > 0 {
+			fmt.Printf("\nNext run at %s\n", at.Format("2006-01-02 15:04:05 MST"))
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		start := time.Now()
+		rows, err := runHooks.Run(ctx, runner, nil)
+		if err != nil {
+			// An interrupted run is incomplete and would skew the aggregate.
+			return
+		}
+		fmt.Printf("\nRun %d at %s\n", run, start.Format("2006-01-02 15:04:05"))
+		if trend != nil {
+			trend.Add(rows)
+		}
+		printTableTrend(rows, trend)
+		printGroups(rows)
+		printTags(rows)
+		printSites(rows)
+
+		if run == 1 {
+			first = start
+		}
+		sla.Add(start, rows)
+		if run > 1 {
+			printSLA(sla.SLAs(), first, start)
+		}
+		if opts.Hourly {
+			agg.Add(start, rows)
+			printHourly(agg)
+			if opts.OutCSV != "" {
+				if err := writeHourlyCSV(opts.OutCSV, agg); err != nil {
+					slog.Error("CSV write failed", "path", opts.OutCSV, "err", err)
+				}
+			}
+		}
+		if opts.SaveDir != "" {
+			if _, err := saveRun(opts.SaveDir, runner, start, rows); err != nil {
+				slog.Error("saving run failed", "dir", opts.SaveDir, "err", err)
+			}
+		}
+		if opts.Alerts != nil {
+			opts.Alerts.Check(ctx, start, rows)
+		}
+	}
+}
+
+// everyInterval returns a next function for runRepeated that fires
+// immediately and then every interval after the previous start.
+func everyInterval(interval time.Duration) func(time.Time) time.Time {
+	var last time.Time
+	return func(now time.Time) time.Time {
+		if last.IsZero() {
+			last = now
+		} else {
+			last = last.Add(interval)
+			if last.Before(now) {
+				last = now // the run took longer than the interval
+			}
+		}
+		return last
+	}
+}
+
+// printHourly prints the median latency per resolver for every hour that
+// has runs, followed by each resolver's slowest hour relative to its
+// overall median.
+func printHourly(agg *HourlyAggregate) {
+	fmt.Printf("\nMedian latency by hour of day\n")
+	fmt.Printf("%-5s  %4s", "Hour", "Runs")
+	for _, name := range agg.Names {
+		fmt.Printf("  %10s", name)
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 11+12*len(agg.Names)))
+	for h := 0; h < 24; h++ {
+		if agg.Runs[h] == 0 {
+			continue
+		}
+		fmt.Printf("%02d:00  %4d", h, agg.Runs[h])
+		for _, name := range agg.Names {
+			fmt.Printf("  %10s", durFmt(agg.Stats(name, h).Median))
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("%-11s", "Peak")
+	for _, name := range agg.Names {
+		var all hourCell
+		peakHour, peak := -1, time.Duration(0)
+		for h := range agg.Hours[name] {
+			c := &agg.Hours[name][h]
+			all.merge(c)
+			if m := c.median(); m > peak {
+				peakHour, peak = h, m
+			}
+		}
+		overall := all.median()
+		if peakHour < 0 || overall <= 0 {
+			fmt.Printf("  %10s", "--")
+			continue
+		}
+		fmt.Printf("  %10s", fmt.Sprintf("%02d:00 %.1fx", peakHour, float64(peak)/float64(overall)))
+	}
+	fmt.Println()
+}
+
+func writeHourlyCSV(path string, agg *HourlyAggregate) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	defer w.Flush()
+
+	if err := w.Write([]string{"hour", "resolver", "runs", "count", "successes", "min_ms", "median_ms", "p95_ms", "max_ms"}); err != nil {
+		return err
+	}
+	for h := 0; h < 24; h++ {
+		if agg.Runs[h] == 0 {
+			continue
+		}
+		for _, name := range agg.Names {
+			s := agg.Stats(name, h)
+			row := []string{
+				fmt.Sprintf("%02d", h),
+				exportAnonymizer.Text(name),
+				fmt.Sprintf("%d", agg.Runs[h]),
+				fmt.Sprintf("%d", s.Count),
+				fmt.Sprintf("%d", s.Successes),
+				fmt.Sprintf("%.3f", float64(s.Min.Microseconds())/1000.0),
+				fmt.Sprintf("%.3f", float64(s.Median.Microseconds())/1000.0),
+				fmt.Sprintf("%.3f", float64(s.P95.Microseconds())/1000.0),
+				fmt.Sprintf("%.3f", float64(s.Max.Microseconds())/1000.0),
+			}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	return writeCSVVersion(w)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// ScoreProfile weights the metrics combined into a composite score. Only
+// relative weights matter. A negative weight on a feature prefers resolvers
+// without it, e.g. "filtering": -1 favors unfiltered resolvers.
+type ScoreProfile struct {
+	Median    float64 `json:"median"`
+	P95       float64 `json:"p95"`
+	P99       float64 `json:"p99"`
+	Success   float64 `json:"success"`
+	DNSSEC    float64 `json:"dnssec"`
+	Filtering float64 `json:"filtering"`
+}
+
+// NeedsFeatures reports whether scoring needs the feature probe.
+func (p ScoreProfile) NeedsFeatures() bool {
+	return p.DNSSEC != 0 || p.Filtering != 0
+}
+
+// ResolverScore is the composite score of one resolver, from 0 to 100.
+type ResolverScore struct {
+	Name       string
+	Score      float64
+	Features   bench.Features
+	FeatureErr error
+}
+
+// probeFeatures runs the feature probe against every resolver.
+func probeFeatures(ctx context.Context, resolvers []bench.Resolver, timeout time.Duration) (map[string]bench.Features, map[string]error) {
+	feats := make(map[string]bench.Features)
+	errs := make(map[string]error)
+	for _, r := range resolvers {
+		tr, err := transport.New(r.Addr)
+		if err == nil {
+			feats[r.Name], err = bench.ProbeFeatureNames(ctx, tr, featureNames, timeout)
+		}
+		if err != nil {
+			errs[r.Name] = err
+		}
+	}
+	return feats, errs
+}
+
+// scoreResults combines the weighted metrics of each resolver. Latencies
+// score relative to the fastest resolver (fastest = 1), success as a
+// fraction, features as 1 or 0. A resolver without successful queries
+// scores 0 on every latency metric, and one whose feature probe failed
+// scores 0 on the features.
+func scoreResults(rows []bench.Result, p ScoreProfile, feats map[string]bench.Features, featErrs map[string]error) []ResolverScore {
+	best := func(get func(bench.Stats) time.Duration) time.Duration {
+		b := time.Duration(math.MaxInt64)
+		for _, r := range rows {
+			if r.Stats.Successes > 0 {
+				b = min(b, get(r.Stats))
+			}
+		}
+		return b
+	}
+	latency := []struct {
+		w    float64
+		get  func(bench.Stats) time.Duration
+		best time.Duration
+	}{
+		{p.Median, func(s bench.Stats) time.Duration { return s.Median }, 0},
+		{p.P95, func(s bench.Stats) time.Duration { return s.P95 }, 0},
+		{p.P99, func(s bench.Stats) time.Duration { return s.P99 }, 0},
+	}
+	for i := range latency {
+		latency[i].best = best(latency[i].get)
+	}
+	total := math.Abs(p.Median) + math.Abs(p.P95) + math.Abs(p.P99) + math.Abs(p.Success) + math.Abs(p.DNSSEC) + math.Abs(p.Filtering)
+
+	out := make([]ResolverScore, 0, len(rows))
+	for _, r := range rows {
+		rs := ResolverScore{Name: r.Name, Features: feats[r.Name], FeatureErr: featErrs[r.Name]}
+		var sum float64
+		for _, l := range latency {
+			if v := l.get(r.Stats); r.Stats.Successes > 0 && v > 0 {
+				sum += math.Abs(l.w) * float64(l.best) / float64(v)
+			}
+		}
+		sum += math.Abs(p.Success) * successPct(r.Stats) / 100
+		if rs.FeatureErr == nil {
+			sum += featureScore(p.DNSSEC, rs.Features.DNSSEC)
+			sum += featureScore(p.Filtering, rs.Features.Filtering)
+		}
+		if total > 0 {
+			rs.Score = 100 * sum / total
+		}
+		out = append(out, rs)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
+
+func featureScore(w float64, has bool) float64 {
+	if has == (w > 0) {
+		return math.Abs(w)
+	}
+	return 0
+}
+
+func printScores(scores []ResolverScore, p ScoreProfile) {
+	fmt.Printf("\nComposite score (median %g, p95 %g, p99 %g, success %g, dnssec %g, filtering %g)\n",
+		p.Median, p.P95, p.P99, p.Success, p.DNSSEC, p.Filtering)
+	fmt.Printf("%-12s  %6s  %6s  %9s\n", "Resolver", "Score", "DNSSEC", "Filtering")
+	fmt.Println(strings.Repeat("-", 40))
+	for _, s := range scores {
+		dnssec, filtering := "--", "--"
+		if p.NeedsFeatures() && s.FeatureErr == nil {
+			dnssec, filtering = ternary(s.Features.DNSSEC, "yes", "no"), ternary(s.Features.Filtering, "yes", "no")
+		}
+		fmt.Printf("%-12s  %6.1f  %6s  %9s\n", s.Name, s.Score, dnssec, filtering)
+		if s.FeatureErr != nil {
+			fmt.Printf("  ! feature probe: %v\n", s.FeatureErr)
+		}
+	}
+}
+
+// writeScores writes "score<TAB>name" lines, best first, for scripts that
+// pick a resolver automatically.
+func writeScores(path string, scores []ResolverScore) error {
+	var b strings.Builder
+	for _, s := range scores {
+		fmt.Fprintf(&b, "%.1f\t%s\n", s.Score, exportAnonymizer.Text(s.Name))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// searchConfig returns the search list and ndots option for -search: the
+// settings of the resolv.conf file conf if given, else the comma-separated
+// list with the default ndots of 1.
+func searchConfig(list, conf string) ([]string, int, error) {
+	if conf == "" {
+		return splitList(list), 1, nil
+	}
+	b, err := os.ReadFile(conf)
+	if err != nil {
+		return nil, 0, err
+	}
+	search, ndots := parseResolvSearch(string(b))
+	if len(search) == 0 {
+		return nil, 0, fmt.Errorf("no search domains in %s", conf)
+	}
+	return search, ndots, nil
+}
+
+// printSearch reports the cost of the search list: the queries each lookup
+// sent, which is the amplification factor of the configuration over
+// querying the fully qualified name, and how much longer the lookups took
+// than a single query does.
+func printSearch(rows []bench.Result, r *bench.Runner) {
+	fmt.Printf("\nSearch list amplification (search %s, ndots:%d)\n", strings.Join(r.Search, " "), r.Ndots)
+	fmt.Printf("%-12s  %7s  %7s  %10s  %10s  %9s\n", "Resolver", "Lookups", "Queries", "Per lookup", "Lookup med", "Query med")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, row := range rows {
+		var lookups, perQuery []float64
+		queries := 0
+		for _, s := range row.Samples {
+			queries += s.Queries
+			if s.Err == nil && s.Queries > 0 {
+				lookups = append(lookups, ms(s.Duration))
+				perQuery = append(perQuery, ms(s.Duration/time.Duration(s.Queries)))
+			}
+		}
+		amp := "--"
+		if len(row.Samples) > 0 {
+			amp = fmt.Sprintf("%.2fx", float64(queries)/float64(len(row.Samples)))
+		}
+		fmt.Printf("%-12s  %7d  %7d  %10s  %10s  %9s\n", row.Name, len(row.Samples), queries, amp, pctl(lookups, 50), pctl(perQuery, 50))
+	}
+	fmt.Println()
+	if len(r.Domains) == 0 && !r.Cold {
+		fmt.Printf("Names tried for %s: %s\n", r.Domain, strings.Join(bench.SearchNames(r.Domain, r.Search, r.Ndots), ", "))
+	}
+	fmt.Printf("Per lookup is the amplification factor over querying the fully qualified name.\n"+
+		"Query med is the lookup time per query sent. Names with %d or more dots, or ending\n"+
+		"in a dot, are tried as is first.\n", r.Ndots)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// Output formats of -select-format.
+const (
+	selectIPs        = "ips"
+	selectResolvConf = "resolv.conf"
+	selectDnsmasq    = "dnsmasq"
+	selectUnbound    = "unbound"
+	selectCoreDNS    = "coredns"
+)
+
+// selectFormats are the output formats of -select and export-config.
+var selectFormats = []string{selectIPs, selectResolvConf, selectDnsmasq, selectUnbound, selectCoreDNS}
+
+// resolvConfMax is the number of name servers the C library reads from
+// resolv.conf; it ignores further lines.
+const resolvConfMax = 3
+
+// selectResolvers returns the names and servers of the best n resolvers in
+// the order of rankResults, of those reachable as plain DNS that format can
+// forward to: on port 53, or on any port for dnsmasq, Unbound and CoreDNS. A
+// server is an IP, followed by its port in the syntax of format if not 53.
+func selectResolvers(ranked []string, resolvers []bench.Resolver, n int, format string) (names, servers []string) {
+	addrs := make(map[string]string, len(resolvers))
+	for _, r := range resolvers {
+		addrs[r.Name] = r.Addr
+	}
+	for _, name := range ranked {
+		if len(servers) == n {
+			break
+		}
+		ip, port, ok := plainServer(addrs[name])
+		switch {
+		case !ok:
+			continue
+		case port == "53":
+		case format == selectDnsmasq:
+			ip += "#" + port
+		case format == selectUnbound:
+			ip += "@" + port
+		case format == selectCoreDNS:
+			ip = net.JoinHostPort(ip, port)
+		default:
+			continue
+		}
+		if slices.Contains(servers, ip) {
+			continue // another name for a server already selected
+		}
+		names = append(names, name)
+		servers = append(servers, ip)
+	}
+	return names, servers
+}
+
+// writeSelection writes the selected servers, best first, in format: one IP
+// per line, or the configuration that makes the C library, dnsmasq, Unbound
+// or CoreDNS forward to them.
+func writeSelection(w io.Writer, format string, names, servers []string) error {
+	var b strings.Builder
+	switch format {
+	case selectIPs:
+		for _, s := range servers {
+			fmt.Fprintln(&b, s)
+		}
+	case selectResolvConf:
+		if len(servers) > resolvConfMax {
+			slog.Warn("the C library reads only the first name servers of resolv.conf", "max", resolvConfMax, "selected", len(servers))
+		}
+		fmt.Fprintf(&b, "# Selected by %s: %s\n", bench.Tool, strings.Join(names, ", "))
+		for _, s := range servers {
+			fmt.Fprintf(&b, "nameserver %s\n", s)
+		}
+	case selectDnsmasq:
+		// strict-order keeps the ranking: the next server is only asked
+		// when the one before does not answer.
+		fmt.Fprintf(&b, "# Selected by %s: %s\nno-resolv\nstrict-order\n", bench.Tool, strings.Join(names, ", "))
+		for _, s := range servers {
+			fmt.Fprintf(&b, "server=%s\n", s)
+		}
+	case selectUnbound:
+		fmt.Fprintf(&b, "# Selected by %s: %s\nforward-zone:\n    name: \".\"\n", bench.Tool, strings.Join(names, ", "))
+		for _, s := range servers {
+			fmt.Fprintf(&b, "    forward-addr: %s\n", s)
+		}
+	case selectCoreDNS:
+		// The sequential policy keeps the ranking, as strict-order does.
+		fmt.Fprintf(&b, "# Selected by %s: %s\n. {\n    forward . %s {\n        policy sequential\n    }\n}\n",
+			bench.Tool, strings.Join(names, ", "), strings.Join(servers, " "))
+	default:
+		return fmt.Errorf("unknown format %q (want %s)", format, strings.Join(selectFormats, ", "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
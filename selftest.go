@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/authserver"
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// selfTestSlack is how much later than the server's delay or the query
+// timeout a sample of the self-test may end: loopback and the scheduler
+// add a fraction of a millisecond, a loaded machine a few.
+const selfTestSlack = 10 * time.Millisecond
+
+// selfTest runs the checks of the selftest subcommand against an
+// authserver.Server and counts the queries it receives by name.
+type selfTest struct {
+	srv     *authserver.Server
+	count   int
+	delay   time.Duration
+	timeout time.Duration
+
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+// selfCheck is one check: run returns what it found, or why it failed.
+type selfCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// runSelfTest implements the selftest subcommand.
+func runSelfTest(args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	zone := fs.String("zone", "dnsbench.test", "Zone the built-in server is authoritative for")
+	listen := fs.String("listen", "", "Only serve the zone on this address, e.g. 127.0.0.1:5300, until interrupted, as a target for other runs")
+	count := fs.Int("count", 20, "Number of queries of each benchmark check")
+	delay := fs.Duration("delay", 20*time.Millisecond, "How long the server delays the answers for slow.ZONE")
+	timeout := fs.Duration("timeout", 500*time.Millisecond, "Timeout per query; the answers for drop.ZONE never come")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench selftest [flags]\n\n"+
+			"Starts a built-in authoritative DNS server for a zone of known records on\n"+
+			"loopback and checks the transports, the message parsers, the timeouts and the\n"+
+			"benchmark pipeline against it: answers over UDP and TCP, NXDOMAIN and NODATA,\n"+
+			"truncation and the TCP fallback, SERVFAIL, queries that time out, query and\n"+
+			"cache-busting counts, and latency against a known delay. Exits with status 1\n"+
+			"if any check fails.\n"+
+			"With -listen, serves the zone instead: wild.ZONE and below it A 192.0.2.1 and\n"+
+			"AAAA 2001:db8::1, ttl.ZONE the same with a TTL of 20s, large.ZONE a 3000-byte\n"+
+			"TXT record, slow.ZONE answers after -delay, drop.ZONE none, servfail.ZONE\n"+
+			"SERVFAIL, and other names NXDOMAIN. The zone is not signed.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 || *count < 1 || *delay < 0 || *timeout <= 0 {
+		fs.Usage()
+		return 2
+	}
+
+	st := &selfTest{count: *count, delay: *delay, timeout: *timeout, seen: make(map[string]int)}
+	st.srv = &authserver.Server{Zone: *zone, SlowDelay: *delay, OnQuery: st.saw}
+	addr := *listen
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	if err := st.srv.Start(addr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer st.srv.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *listen != "" {
+		fmt.Printf("Serving %s on %s over UDP and TCP until interrupted, e.g. for\n", st.srv.Zone, st.srv.Addr())
+		fmt.Printf("  dnsbench -resolvers Local=%s -test-zone %s\n", st.srv.Addr(), st.srv.Zone)
+		<-ctx.Done()
+		return 0
+	}
+
+	fmt.Printf("DNS Self-Test\n")
+	fmt.Printf("Server: %s over UDP and TCP | Zone: %s | Queries: %d per benchmark | Delay: %v | Timeout: %v\n",
+		st.srv.Addr(), st.srv.Zone, *count, *delay, *timeout)
+	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("%-14s  %-6s  %s\n", "Check", "Result", "Detail")
+	fmt.Println(strings.Repeat("-", 80))
+	checks := st.checks()
+	failed := 0
+	for _, c := range checks {
+		detail, err := c.run(ctx)
+		if ctx.Err() != nil {
+			return 1
+		}
+		result := "PASS"
+		if err != nil {
+			result, detail = "FAIL", err.Error()
+			failed++
+		}
+		fmt.Printf("%-14s  %-6s  %s\n", c.name, result, detail)
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed.\n", failed, len(checks))
+		return 1
+	}
+	fmt.Printf("\nAll %d checks passed.\n", len(checks))
+	return 0
+}
+
+// saw counts a query the server received.
+func (st *selfTest) saw(_ string, q dnsmsg.Question) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.seen[strings.ToLower(strings.TrimSuffix(q.Name, "."))]++
+}
+
+// queries returns how many queries the server received for name, and for
+// how many different names below it.
+func (st *selfTest) queries(name string) (n, below int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for qname, c := range st.seen {
+		switch {
+		case qname == name:
+			n += c
+		case strings.HasSuffix(qname, "."+name):
+			below++
+		}
+	}
+	return n, below
+}
+
+// name returns label below the zone, after a random label for a name no
+// check has asked for before.
+func (st *selfTest) name(label string) string {
+	return bench.RandomLabel() + "." + label + "." + st.srv.Zone
+}
+
+func (st *selfTest) checks() []selfCheck {
+	udp, tcp := st.srv.Addr(), "tcp://"+st.srv.Addr()
+	return []selfCheck{
+		{"UDP answer", func(ctx context.Context) (string, error) {
+			return st.checkAnswer(ctx, udp, dnsmsg.TypeA, authserver.Addr4.String())
+		}},
+		{"TCP answer", func(ctx context.Context) (string, error) {
+			return st.checkAnswer(ctx, tcp, dnsmsg.TypeAAAA, authserver.Addr6.String())
+		}},
+		{"NXDOMAIN", func(ctx context.Context) (string, error) {
+			return st.checkNegative(ctx, bench.RandomLabel()+"."+st.srv.Zone, dnsmsg.TypeA, dnsmsg.RCodeNameError)
+		}},
+		{"NODATA", func(ctx context.Context) (string, error) {
+			return st.checkNegative(ctx, st.name(authserver.LabelWild), dnsmsg.TypeMX, dnsmsg.RCodeSuccess)
+		}},
+		{"Truncation", st.checkTruncation},
+		{"TCP fallback", st.checkFallback},
+		{"SERVFAIL", st.checkServFail},
+		{"Timeout", st.checkTimeout},
+		{"Pipeline UDP", func(ctx context.Context) (string, error) { return st.checkPipeline(ctx, udp, false) }},
+		{"Pipeline TCP", func(ctx context.Context) (string, error) { return st.checkPipeline(ctx, tcp, false) }},
+		{"Cold names", func(ctx context.Context) (string, error) { return st.checkPipeline(ctx, udp, true) }},
+		{"Latency", st.checkLatency},
+	}
+}
+
+// exchange sends one query for name through tr and times it.
+func (st *selfTest) exchange(ctx context.Context, tr transport.Transport, name string, qtype dnsmsg.Type) (*dnsmsg.Message, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, st.timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+	return resp, time.Since(start), err
+}
+
+// checkAnswer looks up an address below wild over addr and compares it and
+// its TTL with the zone's.
+func (st *selfTest) checkAnswer(ctx context.Context, addr string, qtype dnsmsg.Type, want string) (string, error) {
+	tr, err := transport.New(addr)
+	if err != nil {
+		return "", err
+	}
+	if c, ok := tr.(interface{ CloseIdleConnections() }); ok {
+		defer c.CloseIdleConnections()
+	}
+	name := st.name(authserver.LabelWild)
+	resp, d, err := st.exchange(ctx, tr, name, qtype)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case resp.RCode != dnsmsg.RCodeSuccess:
+		return "", fmt.Errorf("rcode %s, want NOERROR", resp.RCode)
+	case !resp.Authoritative:
+		return "", errors.New("answer not authoritative")
+	case len(resp.Answers) != 1 || resp.Answers[0].Type != qtype:
+		return "", fmt.Errorf("%d answer records, want one %s", len(resp.Answers), qtype)
+	}
+	rr := resp.Answers[0]
+	ip, err := rr.IP()
+	if err != nil {
+		return "", err
+	}
+	if ip.String() != want || rr.TTL != authserver.TTL {
+		return "", fmt.Errorf("%s TTL %d, want %s TTL %d", ip, rr.TTL, want, authserver.TTL)
+	}
+	return fmt.Sprintf("%s %s, TTL %d, in %s", qtype, ip, rr.TTL, durFmt(d)), nil
+}
+
+// checkNegative expects rcode and no answer records for name, with the
+// zone's SOA telling how long to cache that.
+func (st *selfTest) checkNegative(ctx context.Context, name string, qtype dnsmsg.Type, rcode dnsmsg.RCode) (string, error) {
+	tr, err := transport.New(st.srv.Addr())
+	if err != nil {
+		return "", err
+	}
+	resp, _, err := st.exchange(ctx, tr, name, qtype)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case resp.RCode != rcode:
+		return "", fmt.Errorf("rcode %s, want %s", resp.RCode, rcode)
+	case len(resp.Answers) > 0:
+		return "", fmt.Errorf("%d answer records, want none", len(resp.Answers))
+	case len(resp.Authorities) != 1 || resp.Authorities[0].Type != dnsmsg.TypeSOA:
+		return "", errors.New("no SOA record in the authority section")
+	}
+	soa, err := resp.Authorities[0].SOA()
+	if err != nil {
+		return "", err
+	}
+	if soa.Minimum != authserver.NegativeTTL {
+		return "", fmt.Errorf("SOA minimum %d, want %d", soa.Minimum, authserver.NegativeTTL)
+	}
+	return fmt.Sprintf("%s for %s, SOA minimum %d", resp.RCode, qtype, soa.Minimum), nil
+}
+
+// checkTruncation expects the large TXT record over UDP without EDNS(0) to
+// come back truncated.
+func (st *selfTest) checkTruncation(ctx context.Context) (string, error) {
+	tr := &transport.UDP{Addr: st.srv.Addr(), NoTCPFallback: true}
+	resp, _, err := st.exchange(ctx, tr, authserver.LabelLarge+"."+st.srv.Zone, dnsmsg.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+	if !resp.Truncated || len(resp.Answers) > 0 {
+		return "", fmt.Errorf("TC %v with %d answer records, want TC and none", resp.Truncated, len(resp.Answers))
+	}
+	return "TC set on the 512-byte UDP answer", nil
+}
+
+// checkFallback expects the UDP transport to fetch the large TXT record
+// over TCP after the truncated answer, and all of it to decode.
+func (st *selfTest) checkFallback(ctx context.Context) (string, error) {
+	tr, err := transport.New(st.srv.Addr())
+	if err != nil {
+		return "", err
+	}
+	name := authserver.LabelLarge + "." + st.srv.Zone
+	resp, d, err := st.exchange(ctx, tr, name, dnsmsg.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+	if resp.Truncated || len(resp.Answers) != 1 {
+		return "", fmt.Errorf("TC %v with %d answer records, want the full answer", resp.Truncated, len(resp.Answers))
+	}
+	txt, err := resp.Answers[0].TXT()
+	if err != nil {
+		return "", err
+	}
+	if n := len(strings.Join(txt, "")); n != authserver.LargeSize {
+		return "", fmt.Errorf("%d bytes of TXT, want %d", n, authserver.LargeSize)
+	}
+	return fmt.Sprintf("%d bytes of TXT in %d strings over TCP, in %s", authserver.LargeSize, len(txt), durFmt(d)), nil
+}
+
+// checkServFail expects the lookup of a name below servfail to fail with
+// the SERVFAIL response code, an answer rather than a lost query.
+func (st *selfTest) checkServFail(ctx context.Context) (string, error) {
+	tr, err := transport.New(st.srv.Addr())
+	if err != nil {
+		return "", err
+	}
+	qctx, cancel := context.WithTimeout(ctx, st.timeout)
+	defer cancel()
+	_, err = bench.LookupIP(qctx, tr, st.name(authserver.LabelServFail), dnsmsg.TypeA)
+	rc := bench.RCodeError(0)
+	if !errors.As(err, &rc) || dnsmsg.RCode(rc) != dnsmsg.RCodeServerFailure {
+		return "", fmt.Errorf("error %v, want rcode SERVFAIL", err)
+	}
+	return "lookup fails with " + err.Error(), nil
+}
+
+// checkTimeout benchmarks a name below drop, which the server never
+// answers, and expects every sample to time out after the timeout.
+func (st *selfTest) checkTimeout(ctx context.Context) (string, error) {
+	const n = 3
+	runner := &bench.Runner{
+		Resolvers: []bench.Resolver{{Name: "selftest", Addr: st.srv.Addr()}},
+		Domain:    st.name(authserver.LabelDrop),
+		Count:     n,
+		Timeout:   st.timeout,
+	}
+	results, err := runner.Run(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	samples := results[0].Samples
+	if len(samples) != n {
+		return "", fmt.Errorf("%d samples, want %d", len(samples), n)
+	}
+	lo, hi := samples[0].Duration, samples[0].Duration
+	for _, s := range samples {
+		var ne net.Error
+		if !errors.As(s.Err, &ne) || !ne.Timeout() {
+			return "", fmt.Errorf("error %v, want a timeout", s.Err)
+		}
+		if s.Duration < st.timeout || s.Duration > st.timeout+selfTestSlack {
+			return "", fmt.Errorf("timed out after %s, want %v", durFmt(s.Duration), st.timeout)
+		}
+		lo, hi = min(lo, s.Duration), max(hi, s.Duration)
+	}
+	return fmt.Sprintf("%d queries timed out after %s to %s", n, durFmt(lo), durFmt(hi)), nil
+}
+
+// checkPipeline benchmarks a name below wild over addr and expects every
+// query to reach the server once and be answered. With cold, it expects a
+// different name for every query, as cache busting makes them.
+func (st *selfTest) checkPipeline(ctx context.Context, addr string, cold bool) (string, error) {
+	domain := st.name(authserver.LabelWild)
+	runner := &bench.Runner{
+		Resolvers: []bench.Resolver{{Name: "selftest", Addr: addr}},
+		Domain:    domain,
+		Count:     st.count,
+		Timeout:   st.timeout,
+		Cold:      cold,
+	}
+	results, err := runner.Run(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	stats := results[0].Stats
+	if stats.Count != st.count || stats.Successes != st.count {
+		if errs := uniqueErrors(stats.Errors); len(errs) > 0 {
+			return "", fmt.Errorf("%d of %d answered: %s", stats.Successes, st.count, errs[0])
+		}
+		return "", fmt.Errorf("%d of %d answered", stats.Successes, stats.Count)
+	}
+	seen, below := st.queries(domain)
+	if cold {
+		if seen != 0 || below != st.count {
+			return "", fmt.Errorf("%d different names queried, want %d", below, st.count)
+		}
+		return fmt.Sprintf("%d/%d answered, for %d different names", stats.Successes, st.count, below), nil
+	}
+	if seen != st.count {
+		return "", fmt.Errorf("server got %d queries, want %d", seen, st.count)
+	}
+	if stats.Responses != st.count || stats.MinSize != stats.MaxSize {
+		return "", fmt.Errorf("%d responses of %d to %d bytes, want %d of one size", stats.Responses, stats.MinSize, stats.MaxSize, st.count)
+	}
+	return fmt.Sprintf("%d/%d answered, %d bytes each, median %s", stats.Successes, st.count, stats.MinSize, durFmt(stats.Median)), nil
+}
+
+// checkLatency benchmarks a name below slow, whose answers the server
+// delays, and expects the measured median to match the delay.
+func (st *selfTest) checkLatency(ctx context.Context) (string, error) {
+	runner := &bench.Runner{
+		Resolvers: []bench.Resolver{{Name: "selftest", Addr: st.srv.Addr()}},
+		Domain:    st.name(authserver.LabelSlow),
+		Count:     st.count,
+		Timeout:   st.timeout + st.delay,
+	}
+	results, err := runner.Run(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	stats := results[0].Stats
+	if stats.Successes != st.count {
+		return "", fmt.Errorf("%d of %d answered", stats.Successes, st.count)
+	}
+	if stats.Min < st.delay || stats.Median > st.delay+selfTestSlack {
+		return "", fmt.Errorf("min %s, median %s for a delay of %v", durFmt(stats.Min), durFmt(stats.Median), st.delay)
+	}
+	return fmt.Sprintf("median %s, min %s for a delay of %v", durFmt(stats.Median), durFmt(stats.Min), st.delay), nil
+}
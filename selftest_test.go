@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/authserver"
+)
+
+// TestSelfTest runs the checks of the selftest subcommand as an end-to-end
+// test: an authserver.Server on loopback, and the transports and
+// bench.Runner against it.
+func TestSelfTest(t *testing.T) {
+	st := &selfTest{count: 20, delay: 20 * time.Millisecond, timeout: 500 * time.Millisecond, seen: make(map[string]int)}
+	st.srv = &authserver.Server{Zone: "dnsbench.test", SlowDelay: st.delay, OnQuery: st.saw}
+	if err := st.srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer st.srv.Close()
+	for _, c := range st.checks() {
+		t.Run(c.name, func(t *testing.T) {
+			detail, err := c.run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Log(detail)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// apiMetrics are the per-run values the API serves for each resolver.
+var apiMetrics = map[string]func(bench.Stats) float64{
+	"min":         func(s bench.Stats) float64 { return ms(s.Min) },
+	"avg":         func(s bench.Stats) float64 { return ms(s.Avg) },
+	"median":      func(s bench.Stats) float64 { return ms(s.Median) },
+	"p95":         func(s bench.Stats) float64 { return ms(s.P95) },
+	"max":         func(s bench.Stats) float64 { return ms(s.Max) },
+	"success_pct": successPct,
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000.0 }
+
+// apiServer serves saved runs over HTTP. Runs are re-read on every request
+// so that files added by cron jobs show up without a restart.
+type apiServer struct {
+	paths []string
+}
+
+// runServeAPI implements the serve-api subcommand.
+func runServeAPI(args []string) int {
+	fs := flag.NewFlagSet("serve-api", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8053", "Address to listen on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench serve-api [-listen addr] FILE|DIR...\n\n"+
+			"Serves runs saved with -save as a JSON API and a Grafana JSON datasource.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	s := &apiServer{paths: fs.Args()}
+	fmt.Printf("Serving %s on http://%s\n", strings.Join(s.paths, ", "), *listen)
+	if err := http.ListenAndServe(*listen, s.handler()); err != nil {
+		slog.Error("API server failed", "err", err)
+		return 1
+	}
+	return 0
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/runs", s.handleRuns)
+	mux.HandleFunc("GET /api/metrics", s.handleMetrics)
+
+	// Grafana JSON datasource endpoints.
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "OK") })
+	mux.HandleFunc("POST /search", s.handleSearch)
+	mux.HandleFunc("POST /metrics", s.handleSearch)
+	mux.HandleFunc("POST /query", s.handleQuery)
+	return mux
+}
+
+// records loads the saved runs that started within [from, to]; a zero
+// bound is open.
+func (s *apiServer) records(from, to time.Time) ([]bench.RunRecord, error) {
+	recs, err := loadRecords(s.paths)
+	if err != nil {
+		return nil, err
+	}
+	out := recs[:0]
+	for _, rec := range recs {
+		if (!from.IsZero() && rec.Started.Before(from)) || (!to.IsZero() && rec.Started.After(to)) {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// timeRange parses the optional RFC 3339 from and to query parameters.
+func timeRange(r *http.Request) (from, to time.Time, err error) {
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := r.URL.Query().Get(p.name); v != "" {
+			if *p.dst, err = time.Parse(time.RFC3339, v); err != nil {
+				return from, to, fmt.Errorf("bad %s: %w", p.name, err)
+			}
+		}
+	}
+	return from, to, nil
+}
+
+type apiRun struct {
+	Schema    int       `json:"schema_version"`
+	Tool      string    `json:"tool,omitempty"`
+	Started   time.Time `json:"started"`
+	Host      string    `json:"host,omitempty"`
+	Domain    string    `json:"domain"`
+	Network   string    `json:"network"`
+	Cold      bool      `json:"cold,omitempty"`
+	Resolvers []string  `json:"resolvers"`
+}
+
+// handleRuns lists saved runs: GET /api/runs[?from=&to=].
+func (s *apiServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	from, to, err := timeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recs, err := s.records(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	runs := make([]apiRun, 0, len(recs))
+	for _, rec := range recs {
+		run := apiRun{Schema: rec.Version, Tool: rec.Tool, Started: rec.Started, Host: rec.Host, Domain: rec.Domain, Network: rec.Network, Cold: rec.Cold}
+		for _, rr := range rec.Resolvers {
+			run.Resolvers = append(run.Resolvers, rr.Name)
+		}
+		runs = append(runs, run)
+	}
+	writeJSON(w, runs)
+}
+
+type apiPoint struct {
+	Time  time.Time `json:"time"`
+	Host  string    `json:"host,omitempty"`
+	Value float64   `json:"value"`
+}
+
+// handleMetrics returns one value per run for a resolver:
+// GET /api/metrics?resolver=NAME&metric=median[&from=&to=].
+func (s *apiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	from, to, err := timeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resolver := r.URL.Query().Get("resolver")
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "median"
+	}
+	if _, ok := apiMetrics[metric]; !ok {
+		http.Error(w, "unknown metric "+metric, http.StatusBadRequest)
+		return
+	}
+	recs, err := s.records(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	points := []apiPoint{}
+	for _, rec := range recs {
+		if v, ok := recordMetric(rec, resolver, metric); ok {
+			points = append(points, apiPoint{Time: rec.Started, Host: rec.Host, Value: v})
+		}
+	}
+	writeJSON(w, points)
+}
+
+// recordMetric returns metric for the named resolver in rec. Latency
+// metrics are absent for runs in which every query failed.
+func recordMetric(rec bench.RunRecord, resolver, metric string) (float64, bool) {
+	for _, res := range rec.Results() {
+		if res.Name == resolver {
+			if res.Stats.Successes == 0 && metric != "success_pct" {
+				return 0, false
+			}
+			return apiMetrics[metric](res.Stats), true
+		}
+	}
+	return 0, false
+}
+
+// handleSearch lists the available Grafana targets, "Resolver:metric".
+func (s *apiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	recs, err := s.records(time.Time{}, time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	seen := make(map[string]bool)
+	targets := []string{}
+	for _, rec := range recs {
+		for _, rr := range rec.Resolvers {
+			if seen[rr.Name] {
+				continue
+			}
+			seen[rr.Name] = true
+			for m := range apiMetrics {
+				targets = append(targets, rr.Name+":"+m)
+			}
+		}
+	}
+	sort.Strings(targets)
+	writeJSON(w, targets)
+}
+
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"` // [value, unix ms]
+}
+
+// handleQuery answers a Grafana time-series query for "Resolver:metric"
+// targets over the dashboard's time range.
+func (s *apiServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var q grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recs, err := s.records(q.Range.From, q.Range.To)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	series := []grafanaSeries{}
+	for _, t := range q.Targets {
+		resolver, metric := splitTarget(t.Target)
+		ser := grafanaSeries{Target: t.Target, Datapoints: [][2]float64{}}
+		for _, rec := range recs {
+			if v, ok := recordMetric(rec, resolver, metric); ok {
+				ser.Datapoints = append(ser.Datapoints, [2]float64{v, float64(rec.Started.UnixMilli())})
+			}
+		}
+		series = append(series, ser)
+	}
+	writeJSON(w, series)
+}
+
+// splitTarget splits a Grafana target into a resolver name and a metric at
+// the last colon, since names may hold colons too, as Name/Addr does for
+// an IPv6 address of a group. A target without a known metric after its last colon
+// is a resolver name alone, for its median.
+func splitTarget(target string) (resolver, metric string) {
+	if i := strings.LastIndexByte(target, ':'); i >= 0 {
+		if _, ok := apiMetrics[target[i+1:]]; ok {
+			return target[:i], target[i+1:]
+		}
+	}
+	return target, "median"
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// smallResponseRatio flags a resolver whose average response is below this
+// fraction of the median across resolvers: blocked names are usually
+// answered with NXDOMAIN or a single sinkhole address instead of the full
+// record set.
+const smallResponseRatio = 0.6
+
+// printSizes reports response sizes per resolver and flags resolvers whose
+// answers are unusually small or carry EDNS(0) padding.
+func printSizes(rows []bench.Result) {
+	var avgs []float64
+	for _, r := range rows {
+		if r.Stats.Responses > 0 {
+			avgs = append(avgs, r.Stats.AvgSize)
+		}
+	}
+	if len(avgs) == 0 {
+		return
+	}
+	sort.Float64s(avgs)
+	typical := bench.Percentile(avgs, 50)
+
+	fmt.Printf("\nResponse size (bytes)\n")
+	fmt.Printf("%-12s  %6s  %6s  %6s  %s\n", "Resolver", "Min", "Avg", "Max", "Note")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range rows {
+		s := r.Stats
+		if s.Responses == 0 {
+			fmt.Printf("%-12s  %6s  %6s  %6s\n", r.Name, "--", "--", "--")
+			continue
+		}
+		var notes []string
+		if len(avgs) > 1 && s.AvgSize < smallResponseRatio*typical {
+			notes = append(notes, fmt.Sprintf("small: %.0f%% of typical, filtered?", 100*s.AvgSize/typical))
+		}
+		if s.Padded > 0 {
+			notes = append(notes, fmt.Sprintf("padded (%d of %d)", s.Padded, s.Responses))
+		}
+		line := fmt.Sprintf("%-12s  %6d  %6.0f  %6d  %s", r.Name, s.MinSize, s.AvgSize, s.MaxSize, strings.Join(notes, "; "))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
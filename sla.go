@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// SLAAggregate follows the availability of each resolver over the runs of
+// continuous mode (-watch, -schedule) or of saved runs.
+type SLAAggregate struct {
+	Names []string // resolver order of the first run
+	Runs  map[string][]slaRun
+}
+
+// slaRun is the state of a resolver in one run: up if any query was
+// answered.
+type slaRun struct {
+	At time.Time
+	Up bool
+}
+
+func newSLAAggregate() *SLAAggregate {
+	return &SLAAggregate{Runs: make(map[string][]slaRun)}
+}
+
+// Add records one run that started at the given time.
+func (a *SLAAggregate) Add(at time.Time, rows []bench.Result) {
+	for _, r := range rows {
+		if _, ok := a.Runs[r.Name]; !ok {
+			a.Names = append(a.Names, r.Name)
+		}
+		a.Runs[r.Name] = append(a.Runs[r.Name], slaRun{At: at, Up: r.Stats.Successes > 0})
+	}
+}
+
+// SLA is the availability of a resolver over the monitoring window.
+type SLA struct {
+	Name      string
+	Minutes   int           // minutes covered by runs
+	UpMinutes int           // ... in which every run got an answer
+	Outages   int           // stretches of consecutive down minutes
+	Longest   time.Duration // longest outage
+	MTBF      time.Duration // up time per outage; zero without outages
+}
+
+// Availability is the percentage of successful minutes.
+func (s SLA) Availability() float64 {
+	if s.Minutes == 0 {
+		return 0
+	}
+	return 100.0 * float64(s.UpMinutes) / float64(s.Minutes)
+}
+
+// SLAs returns the availability of every resolver.
+func (a *SLAAggregate) SLAs() []SLA {
+	out := make([]SLA, 0, len(a.Names))
+	for _, name := range a.Names {
+		s := slaOf(a.Runs[name])
+		s.Name = name
+		out = append(out, s)
+	}
+	return out
+}
+
+// slaOf computes the availability of one resolver by the minute. The state
+// of a run holds until the next run, so with -watch 5m each run stands for
+// five minutes, but for no more than twice the usual interval between runs,
+// so that a gap such as between two monitoring sessions is not counted as
+// monitored. The last run stands for one usual interval. A minute is down
+// if any run in it failed.
+func slaOf(runs []slaRun) SLA {
+	runs = slices.Clone(runs)
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].At.Before(runs[j].At) })
+	var gaps []time.Duration
+	for i := 1; i < len(runs); i++ {
+		gaps = append(gaps, runs[i].At.Sub(runs[i-1].At))
+	}
+	interval := time.Minute
+	if len(gaps) > 0 {
+		slices.Sort(gaps)
+		interval = max(gaps[len(gaps)/2], time.Minute)
+	}
+
+	down := make(map[time.Time]bool) // minute -> down
+	for i, r := range runs {
+		end := r.At.Add(interval)
+		if i+1 < len(runs) {
+			end = r.At.Add(min(runs[i+1].At.Sub(r.At), 2*interval))
+		}
+		for m := r.At.Truncate(time.Minute); ; m = m.Add(time.Minute) {
+			down[m] = down[m] || !r.Up
+			if !m.Add(time.Minute).Before(end) {
+				break
+			}
+		}
+	}
+	minutes := make([]time.Time, 0, len(down))
+	for m := range down {
+		minutes = append(minutes, m)
+	}
+	slices.SortFunc(minutes, func(a, b time.Time) int { return a.Compare(b) })
+
+	var s SLA
+	outage := 0
+	for i, m := range minutes {
+		s.Minutes++
+		if i > 0 && !m.Equal(minutes[i-1].Add(time.Minute)) {
+			outage = 0 // an unmonitored gap ends an outage
+		}
+		if !down[m] {
+			s.UpMinutes++
+			outage = 0
+			continue
+		}
+		if outage == 0 {
+			s.Outages++
+		}
+		outage++
+		s.Longest = max(s.Longest, time.Duration(outage)*time.Minute)
+	}
+	if s.Outages > 0 {
+		s.MTBF = time.Duration(s.UpMinutes/s.Outages) * time.Minute
+	}
+	return s
+}
+
+// printSLA prints the availability of each resolver over the window from
+// the first to the last run.
+func printSLA(slas []SLA, from, to time.Time) {
+	fmt.Printf("\nAvailability SLA, %s to %s\n", from.Local().Format("2006-01-02 15:04"), to.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("%-12s  %8s  %8s  %7s  %9s  %9s\n", "Resolver", "Minutes", "Avail%", "Outages", "Longest", "MTBF")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, s := range slas {
+		longest, mtbf := "--", "--"
+		if s.Outages > 0 {
+			longest, mtbf = minutesFmt(s.Longest), minutesFmt(s.MTBF)
+		}
+		fmt.Printf("%-12s  %8d  %7.2f%%  %7d  %9s  %9s\n", s.Name, s.Minutes, s.Availability(), s.Outages, longest, mtbf)
+	}
+}
+
+// minutesFmt formats a whole number of minutes as days, hours and minutes,
+// e.g. 1d2h5m.
+func minutesFmt(d time.Duration) string {
+	m := int(d / time.Minute)
+	var b strings.Builder
+	if m >= 24*60 {
+		fmt.Fprintf(&b, "%dd", m/(24*60))
+		m %= 24 * 60
+	}
+	if m >= 60 {
+		fmt.Fprintf(&b, "%dh", m/60)
+		m %= 60
+	}
+	if m > 0 || b.Len() == 0 {
+		fmt.Fprintf(&b, "%dm", m)
+	}
+	return b.String()
+}
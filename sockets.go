@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// UDP socket modes of -udp-sockets.
+const (
+	socketsFresh   = "fresh"
+	socketsReuse   = "reuse"
+	socketsCompare = "compare"
+)
+
+// runSocketModes runs the benchmark with a fresh UDP socket per query and
+// then with reused sockets, prints the results of each and then both side
+// by side. Binding a new ephemeral port for every query costs little on
+// most systems but dominates the latency on some, which the difference
+// shows. Each run is saved on its own.
+func runSocketModes(ctx context.Context, runner *bench.Runner, saveDir string) {
+	results := make([][]bench.Result, 2)
+	for i, reuse := range []bool{false, true} {
+		r := *runner
+		r.ReuseSockets = reuse
+		fmt.Printf("\n%s\n", ternary(reuse, "Reused sockets", "Fresh sockets"))
+		started := time.Now()
+		rows, err := runHooks.Run(ctx, &r, nil)
+		if err != nil {
+			slog.Warn("run interrupted, showing partial results", "reuse_sockets", reuse, "err", err)
+		}
+		results[i] = rows
+		printTable(rows)
+		if saveDir != "" && err == nil {
+			path, err := saveRun(saveDir, &r, started, rows)
+			if err != nil {
+				slog.Error("saving run failed", "dir", saveDir, "err", err)
+			} else {
+				fmt.Printf("Run saved to: %s\n", path)
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	printComparison("UDP sockets", socketsFresh, socketsReuse, results)
+	fmt.Println("Only plain DNS over UDP is affected; other transports serve as a control.")
+}
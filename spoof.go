@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// spoofExamples is how many suspect messages per resolver printSuspects
+// shows in full.
+const spoofExamples = 3
+
+// suspectLog collects the suspect messages of -spoof-check by resolver.
+type suspectLog struct {
+	mu       sync.Mutex
+	reasons  map[string]map[string]int // resolver -> reason -> count
+	examples map[string][]transport.Suspect
+}
+
+func newSuspectLog() *suspectLog {
+	l := &suspectLog{reasons: make(map[string]map[string]int), examples: make(map[string][]transport.Suspect)}
+	transport.AddSuspectHandler(l.add)
+	return l
+}
+
+func (l *suspectLog) add(ctx context.Context, s transport.Suspect) {
+	name := s.Server
+	if qi, ok := bench.QueryInfoFrom(ctx); ok {
+		name = qi.Resolver.Name
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reasons[name] == nil {
+		l.reasons[name] = make(map[string]int)
+	}
+	l.reasons[name][s.Reason]++
+	if len(l.examples[name]) < spoofExamples {
+		l.examples[name] = append(l.examples[name], s)
+	}
+}
+
+// print reports the suspect messages of each resolver, or that there were
+// none.
+func (l *suspectLog) print(rows []bench.Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Printf("\nSuspicious responses (UDP)\n")
+	if n := transport.SpoofCheckSkipped(); n > 0 {
+		fmt.Printf("%d answers were not checked for a conflicting second answer: %d sockets were listening already.\n", n, transport.SpoofCheckMaxLingering)
+	}
+	if len(l.reasons) == 0 {
+		fmt.Printf("None: every response came from the server and matched its query.\n")
+		return
+	}
+	fmt.Printf("%-12s  %6s  %s\n", "Resolver", "Count", "Reasons")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, name := range suspectNames(rows, l.reasons) {
+		total := 0
+		var reasons []string
+		for reason, n := range l.reasons[name] {
+			total += n
+			reasons = append(reasons, fmt.Sprintf("%s x%d", reason, n))
+		}
+		sort.Strings(reasons)
+		fmt.Printf("%-12s  %6d  %s\n", name, total, strings.Join(reasons, ", "))
+		for _, s := range l.examples[name] {
+			fmt.Printf("  ! %s from %s%s\n", s.Reason, s.From, ternary(s.Detail != "", ": "+s.Detail, ""))
+		}
+	}
+	fmt.Printf("\nA conflicting second answer means two different answers arrived for one query,\n" +
+		"the usual sign of on-path injection; either may be the forged one.\n")
+}
+
+// suspectNames returns the resolvers with suspect messages in table order,
+// followed by server addresses outside any benchmark query.
+func suspectNames(rows []bench.Result, reasons map[string]map[string]int) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range rows {
+		if reasons[r.Name] != nil {
+			names = append(names, r.Name)
+			seen[r.Name] = true
+		}
+	}
+	var rest []string
+	for name := range reasons {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
@@ -0,0 +1,283 @@
+// Package stamp decodes DNS stamps (sdns://...), the compact resolver
+// descriptions published by public encrypted-resolver lists. See
+// https://dnscrypt.info/stamps-specifications.
+package stamp
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Protocol identifies the resolver protocol a stamp describes.
+type Protocol uint8
+
+const (
+	ProtoPlain         Protocol = 0x00
+	ProtoDNSCrypt      Protocol = 0x01
+	ProtoDoH           Protocol = 0x02
+	ProtoDoT           Protocol = 0x03
+	ProtoDoQ           Protocol = 0x04
+	ProtoODoHTarget    Protocol = 0x05
+	ProtoDNSCryptRelay Protocol = 0x81
+	ProtoODoHRelay     Protocol = 0x85
+)
+
+var protoNames = map[Protocol]string{
+	ProtoPlain:         "Plain",
+	ProtoDNSCrypt:      "DNSCrypt",
+	ProtoDoH:           "DoH",
+	ProtoDoT:           "DoT",
+	ProtoDoQ:           "DoQ",
+	ProtoODoHTarget:    "ODoH",
+	ProtoDNSCryptRelay: "DNSCrypt relay",
+	ProtoODoHRelay:     "ODoH relay",
+}
+
+func (p Protocol) String() string {
+	if s, ok := protoNames[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("Protocol(%#02x)", uint8(p))
+}
+
+// Scheme returns the transport scheme that handles the protocol, or "" for
+// none.
+func (p Protocol) Scheme() string {
+	switch p {
+	case ProtoPlain:
+		return "udp"
+	case ProtoDNSCrypt:
+		return "dnscrypt"
+	case ProtoDoH:
+		return "https"
+	case ProtoDoT:
+		return "tls"
+	case ProtoDoQ:
+		return "quic"
+	case ProtoODoHTarget:
+		return "odoh"
+	}
+	return ""
+}
+
+// Props are the informal properties a resolver operator declares.
+type Props uint64
+
+const (
+	PropDNSSEC   Props = 1 << 0 // resolver validates DNSSEC
+	PropNoLog    Props = 1 << 1 // resolver does not keep logs
+	PropNoFilter Props = 1 << 2 // resolver does not intentionally block domains
+)
+
+func (p Props) String() string {
+	var out []string
+	if p&PropDNSSEC != 0 {
+		out = append(out, "dnssec")
+	}
+	if p&PropNoLog != 0 {
+		out = append(out, "nolog")
+	}
+	if p&PropNoFilter != 0 {
+		out = append(out, "nofilter")
+	}
+	if len(out) == 0 {
+		return "-"
+	}
+	return strings.Join(out, ",")
+}
+
+// Stamp is a decoded DNS stamp. Fields not used by Proto are empty.
+type Stamp struct {
+	Proto        Protocol
+	Props        Props
+	Addr         string   // IP[:port]; the port defaults per protocol
+	ServerPK     []byte   // DNSCrypt provider public key (Ed25519)
+	ProviderName string   // DNSCrypt provider name, e.g. 2.dnscrypt-cert.example.com
+	Hashes       [][]byte // SHA-256 of the TBS certificate of an accepted chain member
+	Hostname     string   // TLS server name / HTTP host, with optional port
+	Path         string   // DoH / ODoH path
+	Bootstrap    []string // IPs to resolve Hostname with
+}
+
+// Name returns a human-readable name for the server: the provider name for
+// DNSCrypt, the host name for TLS-based protocols, else the address.
+func (s Stamp) Name() string {
+	switch {
+	case s.ProviderName != "":
+		return strings.TrimPrefix(strings.TrimSuffix(s.ProviderName, "."), "2.dnscrypt-cert.")
+	case s.Hostname != "":
+		return s.Hostname
+	}
+	return s.Addr
+}
+
+// String summarizes the stamp, e.g. "DoH dns.google/dns-query addr=8.8.8.8:443 props=dnssec".
+func (s Stamp) String() string {
+	var b strings.Builder
+	b.WriteString(s.Proto.String())
+	b.WriteString(" ")
+	b.WriteString(s.Name())
+	b.WriteString(s.Path)
+	if s.Addr != "" && s.Addr != s.Name() {
+		fmt.Fprintf(&b, " addr=%s", s.Addr)
+	}
+	if len(s.ServerPK) > 0 {
+		fmt.Fprintf(&b, " pk=%s", hex.EncodeToString(s.ServerPK[:4]))
+	}
+	if len(s.Hashes) > 0 {
+		fmt.Fprintf(&b, " pins=%d", len(s.Hashes))
+	}
+	if s.Proto != ProtoDNSCryptRelay {
+		fmt.Fprintf(&b, " props=%s", s.Props)
+	}
+	return b.String()
+}
+
+var errTruncated = errors.New("stamp: truncated")
+
+// Parse decodes an sdns:// stamp. Parameters appended after "?" (such as
+// relay=...) are not part of the stamp and are ignored here.
+func Parse(s string) (Stamp, error) {
+	var st Stamp
+	s, _, _ = strings.Cut(s, "?")
+	rest, ok := strings.CutPrefix(s, "sdns://")
+	if !ok {
+		return st, errors.New("stamp: missing sdns:// prefix")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(rest)
+	if err != nil {
+		return st, fmt.Errorf("stamp: %w", err)
+	}
+	if len(b) < 1 {
+		return st, errTruncated
+	}
+	st.Proto = Protocol(b[0])
+	r := reader{b: b[1:]}
+	switch st.Proto {
+	case ProtoPlain:
+		st.Props = r.props()
+		st.Addr = withDefaultPort(r.lp(), "53")
+	case ProtoDNSCrypt:
+		st.Props = r.props()
+		st.Addr = r.lp()
+		st.ServerPK = []byte(r.lp())
+		st.ProviderName = r.lp()
+		if r.err == nil && len(st.ServerPK) != 32 {
+			r.err = errors.New("stamp: DNSCrypt public key must be 32 bytes")
+		}
+		st.Addr = withDefaultPort(st.Addr, "443")
+	case ProtoDoH, ProtoODoHRelay:
+		st.Props = r.props()
+		st.Addr = withDefaultPort(r.lp(), "443")
+		st.Hashes = r.vlp()
+		st.Hostname = r.lp()
+		st.Path = r.lp()
+		st.Bootstrap = r.optionalVLPStrings()
+	case ProtoDoT, ProtoDoQ:
+		st.Props = r.props()
+		st.Addr = withDefaultPort(r.lp(), "853")
+		st.Hashes = r.vlp()
+		st.Hostname = r.lp()
+		st.Bootstrap = r.optionalVLPStrings()
+	case ProtoODoHTarget:
+		st.Props = r.props()
+		st.Hostname = r.lp()
+		st.Path = r.lp()
+	case ProtoDNSCryptRelay:
+		st.Addr = withDefaultPort(r.lp(), "443")
+	default:
+		return st, fmt.Errorf("stamp: unsupported protocol %s", st.Proto)
+	}
+	if r.err != nil {
+		return st, r.err
+	}
+	return st, nil
+}
+
+// withDefaultPort appends port to addr if it has none.
+func withDefaultPort(addr, port string) string {
+	if addr == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
+
+// reader consumes stamp fields, remembering the first error.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) props() Props {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) < 8 {
+		r.err = errTruncated
+		return 0
+	}
+	p := Props(binary.LittleEndian.Uint64(r.b))
+	r.b = r.b[8:]
+	return p
+}
+
+// lp reads a length-prefixed string.
+func (r *reader) lp() string {
+	if r.err != nil {
+		return ""
+	}
+	if len(r.b) < 1 || len(r.b) < 1+int(r.b[0]) {
+		r.err = errTruncated
+		return ""
+	}
+	n := int(r.b[0])
+	s := string(r.b[1 : 1+n])
+	r.b = r.b[1+n:]
+	return s
+}
+
+// vlp reads a variable-length set: each element's length byte has the high
+// bit set when more elements follow. Empty elements are dropped.
+func (r *reader) vlp() [][]byte {
+	var out [][]byte
+	for r.err == nil {
+		if len(r.b) < 1 {
+			r.err = errTruncated
+			return nil
+		}
+		more := r.b[0]&0x80 != 0
+		n := int(r.b[0] &^ 0x80)
+		if len(r.b) < 1+n {
+			r.err = errTruncated
+			return nil
+		}
+		if n > 0 {
+			out = append(out, r.b[1:1+n])
+		}
+		r.b = r.b[1+n:]
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// optionalVLPStrings reads a trailing variable-length set if present.
+func (r *reader) optionalVLPStrings() []string {
+	if r.err != nil || len(r.b) == 0 {
+		return nil
+	}
+	var out []string
+	for _, v := range r.vlp() {
+		out = append(out, string(v))
+	}
+	return out
+}
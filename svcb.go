@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// defaultHTTPSDomain publishes HTTPS records with alpn, address hints and
+// ech, and is used for -qtype HTTPS when -domain is not given.
+const defaultHTTPSDomain = "cloudflare.com"
+
+// SVCBResult is the SVCB or HTTPS answer one resolver gave for the domain.
+type SVCBResult struct {
+	Name    string
+	Records []dnsmsg.SVCB
+	Err     error
+}
+
+// probeSVCB asks each resolver once for the SVCB or HTTPS records of
+// domain, decoding the answers for the report.
+func probeSVCB(resolvers []bench.Resolver, domain string, qtype dnsmsg.Type, timeout time.Duration) []SVCBResult {
+	results := make([]SVCBResult, 0, len(resolvers))
+	for _, r := range resolvers {
+		res := SVCBResult{Name: r.Name}
+		tr, err := transport.New(r.Addr)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			var rrs []dnsmsg.Resource
+			rrs, err = bench.LookupRecords(ctx, tr, domain, qtype)
+			cancel()
+			for _, rr := range rrs {
+				s, _ := rr.SVCB() // validated by LookupRecords
+				res.Records = append(res.Records, s)
+			}
+		}
+		res.Err = err
+		results = append(results, res)
+	}
+	return results
+}
+
+func printSVCB(results []SVCBResult, domain string, qtype dnsmsg.Type) {
+	fmt.Printf("\n%s records for %s\n", qtype, domain)
+	fmt.Printf("%-12s  %-7s  %-10s  %-18s  %-18s  %s\n", "Resolver", "Answer", "ALPN", "IPv4 hint", "IPv6 hint", "ECH")
+	fmt.Println(strings.Repeat("-", 80))
+	correct := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("%-12s  FAILED\n  ! %v\n", r.Name, r.Err)
+			continue
+		}
+		correct++
+		for i, s := range r.Records {
+			name, answer := r.Name, "ok"
+			if i > 0 {
+				name, answer = "", ""
+			}
+			if s.Priority == 0 {
+				fmt.Printf("%-12s  %-7s  alias to %s\n", name, answer, s.Target)
+				continue
+			}
+			fmt.Printf("%-12s  %-7s  %-10s  %-18s  %-18s  %s\n", name, answer,
+				orDash(strings.Join(s.ALPN(), ",")), orDash(joinIPs(s.IPv4Hint())), orDash(joinIPs(s.IPv6Hint())),
+				ternary(s.ECH() != nil, fmt.Sprintf("%d bytes", len(s.ECH())), "-"))
+		}
+	}
+	fmt.Printf("\n%d of %d resolvers returned valid %s records.\n", correct, len(results), qtype)
+}
+
+func joinIPs(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func orDash(s string) string {
+	return ternary(s == "", "-", s)
+}
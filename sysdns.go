@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// systemResolvers returns the resolvers the operating system is configured
+// with: per adapter on Windows (from netsh), else the nameserver lines of
+// /etc/resolv.conf. On Linux the per-link servers of systemd-resolved or
+// NetworkManager follow, which a local stub in resolv.conf forwards to,
+// with a description of each link.
+func systemResolvers() ([]bench.Resolver, []string, error) {
+	if runtime.GOOS == "windows" {
+		var out []bench.Resolver
+		for _, family := range []string{"ipv4", "ipv6"} {
+			b, err := exec.Command("netsh", "interface", family, "show", "dnsservers").Output()
+			if err != nil {
+				return nil, nil, fmt.Errorf("netsh: %w", err)
+			}
+			out = append(out, parseNetshDNSServers(string(b))...)
+		}
+		return out, nil, nil
+	}
+	b, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, nil, err
+	}
+	out := parseResolvConf(string(b))
+	if runtime.GOOS != "linux" {
+		return out, nil, nil
+	}
+	links, notes, err := linkResolvers()
+	if err != nil {
+		slog.Debug("no per-link DNS servers", "err", err)
+	}
+	// resolv.conf has no ports, while link servers may have one.
+	key := func(addr string) string {
+		return transport.Scheme(addr) + " " + transport.HostPort(addr, "53")
+	}
+	seen := make(map[string]bool)
+	for _, r := range out {
+		seen[key(r.Addr)] = true
+	}
+	for _, r := range links {
+		if !seen[key(r.Addr)] {
+			out = append(out, r)
+		}
+	}
+	return out, notes, nil
+}
+
+// parseNetshDNSServers extracts the DNS servers per adapter from the output
+// of "netsh interface ipv4|ipv6 show dnsservers". Servers are named
+// Adapter#N. Only the quoted interface name and the addresses are used, so
+// the parse does not depend on the display language.
+func parseNetshDNSServers(out string) []bench.Resolver {
+	var res []bench.Resolver
+	adapter, n := "", 0
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '"'); i >= 0 && !strings.HasPrefix(line, " ") {
+			if j := strings.LastIndexByte(line, '"'); j > i {
+				adapter, n = line[i+1:j], 0
+				continue
+			}
+		}
+		f := strings.Fields(line)
+		if adapter == "" || len(f) == 0 {
+			continue
+		}
+		if ip := net.ParseIP(f[len(f)-1]); ip != nil {
+			n++
+			res = append(res, bench.Resolver{Name: fmt.Sprintf("%s#%d", adapter, n), Addr: ip.String()})
+		}
+	}
+	return res
+}
+
+// parseResolvConf returns the nameservers of a resolv.conf file, named
+// System#N.
+func parseResolvConf(conf string) []bench.Resolver {
+	var res []bench.Resolver
+	sc := bufio.NewScanner(strings.NewReader(conf))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 || f[0] != "nameserver" {
+			continue
+		}
+		host, _, _ := strings.Cut(f[1], "%") // IPv6 zone, kept in Addr
+		if net.ParseIP(host) != nil {
+			res = append(res, bench.Resolver{Name: fmt.Sprintf("System#%d", len(res)+1), Addr: f[1]})
+		}
+	}
+	return res
+}
+
+// parseResolvSearch returns the search domains and ndots option of a
+// resolv.conf file. The last search or domain line wins, as in the C
+// library; ndots defaults to 1.
+func parseResolvSearch(conf string) (search []string, ndots int) {
+	ndots = 1
+	sc := bufio.NewScanner(strings.NewReader(conf))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case "search":
+			search = f[1:]
+		case "domain":
+			search = f[1:2]
+		case "options":
+			for _, opt := range f[1:] {
+				if v, ok := strings.CutPrefix(opt, "ndots:"); ok {
+					if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+						ndots = min(n, 15)
+					}
+				}
+			}
+		}
+	}
+	return search, ndots
+}
+
+// netshTarget configures the DNS servers of a Windows network adapter.
+type netshTarget struct{ adapter string }
+
+func (t netshTarget) Plan(servers []string) string {
+	return fmt.Sprintf("set the DNS servers of adapter %q to %s with netsh", t.adapter, strings.Join(servers, ", "))
+}
+
+func (t netshTarget) Apply(servers []string) error {
+	for _, family := range []string{"ipv4", "ipv6"} {
+		index := 0
+		for _, s := range servers {
+			if (net.ParseIP(s).To4() != nil) != (family == "ipv4") {
+				continue
+			}
+			index++
+			name := "name=" + t.adapter
+			var err error
+			if index == 1 {
+				err = run("netsh", "interface", family, "set", "dnsservers", name, "source=static", "address="+s, "validate=no")
+			} else {
+				err = run("netsh", "interface", family, "add", "dnsservers", name, "address="+s, fmt.Sprintf("index=%d", index), "validate=no")
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// osResolvers are the lookups through this machine's resolver libraries
+// added by -os-resolver (see transport.OS).
+var osResolvers = []bench.Resolver{
+	{Name: "OS-libc", Addr: "os://libc"},
+	{Name: "OS-Go", Addr: "os://go"},
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// printTail prints each resolver's high percentiles. A percentile is shown
+// only with enough answers to have a sample above it: 100 for p99, 1000
+// for p99.9 and 10000 for p99.99.
+func printTail(rows []bench.Result) {
+	fmt.Printf("\nTail latency\n")
+	fmt.Printf("%-12s  %8s  %9s  %9s  %9s  %9s\n", "Resolver", "Answers", "p99", "p99.9", "p99.99", "Max")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, r := range rows {
+		s := r.Stats
+		at := func(d time.Duration, need int) string {
+			if s.Successes < need {
+				return "--"
+			}
+			return durFmt(d)
+		}
+		fmt.Printf("%-12s  %8d  %9s  %9s  %9s  %9s\n", r.Name, s.Successes,
+			at(s.P99, 100), at(s.P999, 1000), at(s.P9999, 10000), durFmt(s.Max))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// templateData is what a -template is executed with.
+type templateData struct {
+	Domain   string
+	Network  string
+	QType    string        // empty for A/AAAA
+	Mode     string        // e.g. "WARM" or "COLD+DNS64"
+	Count    int           // queries per resolver, unless Duration is set
+	Duration time.Duration // how long each resolver was queried, with -duration
+	Started  time.Time
+	Elapsed  time.Duration
+	Complete bool           // false if the run was interrupted
+	Results  []bench.Result // one per resolver address, in -resolvers order
+	Groups   []bench.Result // combined results of Name=Addr|Addr entries
+	Tags     []bench.Result // combined results per tag of Name=Addr#tags=... entries
+	Tool     string         // program and version, e.g. "dnsbench v1.4.0"
+	Schema   int            // results schema version of saved runs
+}
+
+var templateFuncs = template.FuncMap{
+	"ms":         ms,
+	"dur":        durFmt,
+	"successPct": successPct,
+	"errors":     uniqueErrors,
+	"join":       strings.Join,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    strings.ReplaceAll,
+}
+
+// parseTemplate parses the -template value, which is either the template
+// text or @path of a file holding it.
+func parseTemplate(s string) (*template.Template, error) {
+	name, text := "-template", s
+	if path, ok := strings.CutPrefix(s, "@"); ok {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name, text = path, string(b)
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// writeTemplate executes t and writes its output to stdout, ending it with
+// a newline if it has none, as one-line templates from the command line
+// usually do not.
+func writeTemplate(t *template.Template, data templateData) error {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return err
+	}
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// Labels of the records a -test-zone must have, below its apex. The apex
+// itself is signed with DNSSEC, has an A record, and an SOA whose MINIMUM
+// sets the TTL of NXDOMAIN answers for the other names below it.
+const (
+	zoneWild  = "wild"  // wild and *.wild: A records; every cold name exists
+	zoneTTL   = "ttl"   // *.ttl: A records with a TTL of 20s, for -stale-zone
+	zoneLarge = "large" // TXT records of about 3000 bytes, for -mtu-probe
+	zoneBogus = "bogus" // an A record whose signature does not validate
+)
+
+// featureNames are the names -features and scoring profiles probe, those
+// of the test zone with -test-zone.
+var featureNames = bench.DefaultFeatureNames
+
+// testZone is a zone its user operates with the records of the labels
+// above, for probes that public names cannot make exact: cold queries for
+// names that exist, records of a known TTL no one else caches, a bogus
+// signature and a large answer.
+type testZone string
+
+func parseTestZone(s string) testZone {
+	return testZone(strings.ToLower(strings.TrimSuffix(s, ".")))
+}
+
+// name returns label below the zone, or the apex for "".
+func (z testZone) name(label string) string {
+	if label == "" {
+		return string(z)
+	}
+	return label + "." + string(z)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+// FastOpenResult is the outcome of the TCP Fast Open probe for one
+// resolver: queries over new connections without and with fast open, and
+// how many of the latter had the data in their SYN acknowledged.
+type FastOpenResult struct {
+	Name      string
+	Transport string // "" for transports without TCP connections
+	Plain     []bench.Sample
+	FastOpen  []bench.Sample
+	Accepted  int
+	Known     int   // fast open queries whose connection told if it was accepted
+	Err       error // the cookie request failed
+}
+
+// probeFastOpen sends count queries over new TCP or DoT connections with
+// TCP Fast Open and count without, alternating so that both see the same
+// network. A first fast open connection, not counted, fetches the server's
+// cookie: only later ones can carry the query (or the TLS ClientHello) in
+// the SYN and save the round trip of the handshake.
+func probeFastOpen(r bench.Resolver, name string, qtype dnsmsg.Type, count int, interval, timeout time.Duration) FastOpenResult {
+	res := FastOpenResult{Name: r.Name}
+	tr, err := transport.New(r.Addr)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	switch tr.(type) {
+	case *transport.TCP:
+		res.Transport = "TCP"
+	case *transport.TLS:
+		res.Transport = "DoT"
+	default:
+		return res
+	}
+
+	query := func(fastOpen bool) (s bench.Sample, accepted, known bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if fastOpen {
+			ctx = transport.WithFastOpen(ctx)
+			ctx = transport.WithTrace(ctx, &transport.Trace{GotFastOpen: func(a bool) { accepted, known = a, true }})
+		}
+		start := time.Now()
+		resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+		d := time.Since(start)
+		if err == nil {
+			err = rcodeError(resp)
+		}
+		return bench.Sample{Duration: d, Err: err}, accepted, known
+	}
+
+	if s, _, _ := query(true); s.Err != nil {
+		res.Err = s.Err
+		return res
+	}
+	for i := 0; i < count; i++ {
+		time.Sleep(interval)
+		s, _, _ := query(false)
+		res.Plain = append(res.Plain, s)
+		time.Sleep(interval)
+		s, accepted, known := query(true)
+		res.FastOpen = append(res.FastOpen, s)
+		if accepted {
+			res.Accepted++
+		}
+		if known {
+			res.Known++
+		}
+	}
+	return res
+}
+
+// verdict sums up whether the server takes data in the SYN.
+func (r FastOpenResult) verdict() string {
+	switch {
+	case r.Transport == "":
+		return "no TCP connections"
+	case r.Err != nil, len(r.FastOpen) == 0:
+		return "--"
+	case r.Known == 0:
+		return "unknown"
+	case r.Accepted == 0:
+		return "not accepted"
+	case r.Accepted < len(r.FastOpen):
+		return "sometimes accepted"
+	}
+	return "accepted"
+}
+
+func printFastOpen(results []FastOpenResult) {
+	fmt.Printf("%-12s  %-9s  %8s  %8s  %8s  %8s  %s\n", "Resolver", "Transport", "Plain", "TFO", "Saving", "SYN data", "Verdict")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, r := range results {
+		plain, tfo := bench.Summarize(r.Plain), bench.Summarize(r.FastOpen)
+		saving, synData := "--", "--"
+		if r.Known > 0 {
+			synData = fmt.Sprintf("%d/%d", r.Accepted, len(r.FastOpen))
+		}
+		if plain.Median > 0 && tfo.Median > 0 {
+			saving = deltaFmt(plain.Median - tfo.Median)
+		}
+		fmt.Printf("%-12s  %-9s  %8s  %8s  %8s  %8s  %s\n",
+			r.Name, orDash(r.Transport), durFmt(plain.Median), durFmt(tfo.Median), saving, synData, r.verdict())
+		if r.Err != nil {
+			fmt.Printf("  ! %s\n", r.Err)
+		}
+		for _, e := range uniqueErrors(append(plain.Errors, tfo.Errors...)) {
+			fmt.Printf("  ! %s\n", e)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// Limits of the built-in trace of -trace-on-slow, which works like mtr's
+// report mode with few cycles.
+const (
+	traceMaxHops    = 30
+	traceProbes     = 3 // echo requests per hop
+	traceWait       = time.Second
+	traceSilentHops = 5 // consecutive silent hops after which the trace gives up
+)
+
+// A traceHop is what came back for the probes with one hop limit.
+type traceHop struct {
+	addrs []string // routers that answered, more than one with load balancing
+	sent  int
+	rtts  []time.Duration
+	// unreachable is set if a router reported the destination unreachable.
+	unreachable bool
+}
+
+// tracePath sends ICMP echo requests to ip with increasing hop limits and
+// collects the routers that report them expired, until ip answers. It needs
+// raw socket privileges (root or CAP_NET_RAW).
+func tracePath(ctx context.Context, ip netip.Addr) ([]traceHop, error) {
+	conn, err := net.ListenPacket(icmpNetwork(ip), "")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var hops []traceHop
+	silent := 0
+	for ttl := 1; ttl <= traceMaxHops && silent < traceSilentHops; ttl++ {
+		if err := setHopLimit(conn, ip.Is6(), ttl); err != nil {
+			return nil, err
+		}
+		var h traceHop
+		done := false
+		for range traceProbes {
+			if err := ctx.Err(); err != nil {
+				return hops, err
+			}
+			from, kind, rtt, err := traceProbe(conn, ip)
+			h.sent++
+			if err != nil {
+				return hops, err
+			}
+			if from == "" {
+				continue
+			}
+			if !slices.Contains(h.addrs, from) {
+				h.addrs = append(h.addrs, from)
+			}
+			h.rtts = append(h.rtts, rtt)
+			h.unreachable = h.unreachable || kind == icmpUnreachable
+			done = done || kind != icmpTimeExceeded
+		}
+		hops = append(hops, h)
+		if len(h.rtts) == 0 {
+			silent++
+		} else {
+			silent = 0
+		}
+		if done {
+			break
+		}
+	}
+	return hops, nil
+}
+
+// traceProbe sends one echo request on conn and waits traceWait for the
+// reply or the error it causes. from is empty if nothing came back.
+func traceProbe(conn net.PacketConn, ip netip.Addr) (from string, kind icmpKind, rtt time.Duration, err error) {
+	msg, seq := echoRequest(ip)
+	start := time.Now()
+	_ = conn.SetDeadline(start.Add(traceWait))
+	if _, err := conn.WriteTo(msg, &net.IPAddr{IP: ip.AsSlice()}); err != nil {
+		return "", 0, 0, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, src, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return "", 0, 0, nil
+		}
+		if err != nil {
+			return "", 0, 0, err
+		}
+		r, ok := parseICMP(buf[:n], ip.Is6())
+		if !ok || r.seq != seq || (r.kind == icmpEchoReply && !sameIP(src, ip)) {
+			continue
+		}
+		addr, _ := netip.ParseAddr(src.String())
+		return addr.Unmap().String(), r.kind, time.Since(start), nil
+	}
+}
+
+// systemTraceroute runs the traceroute of the operating system, for when
+// the built-in trace cannot open a raw socket.
+func systemTraceroute(ctx context.Context, ip netip.Addr) (string, error) {
+	name, args := "traceroute", []string{"-n", "-q", "1", "-w", "1", "-m", fmt.Sprint(traceMaxHops)}
+	switch {
+	case runtime.GOOS == "windows":
+		name, args = "tracert", []string{"-d", "-w", "1000", "-h", fmt.Sprint(traceMaxHops)}
+	case ip.Is6() && runtime.GOOS == "linux":
+		args = append(args, "-6")
+	case ip.Is6():
+		name = "traceroute6"
+	}
+	out, err := exec.CommandContext(ctx, name, append(args, ip.String())...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return string(out), nil
+}
+
+// printTraces traces the network path to every resolver whose median is
+// above threshold or that did not answer at all, so that the report shows
+// where on the way the time goes.
+func printTraces(ctx context.Context, rows []bench.Result, resolvers []bench.Resolver, threshold time.Duration) {
+	fmt.Printf("\nNetwork paths to resolvers with a median over %v\n", threshold)
+	traced := 0
+	for _, r := range rows {
+		reason := fmt.Sprintf("median %s", durFmt(r.Stats.Median))
+		switch {
+		case r.Stats.Successes == 0:
+			reason = "no answers"
+		case r.Stats.Median <= threshold:
+			continue
+		}
+		i := slices.IndexFunc(resolvers, func(res bench.Resolver) bool { return res.Name == r.Name })
+		if i < 0 {
+			continue
+		}
+		traced++
+		target, err := rttTarget(ctx, resolvers[i])
+		if err != nil {
+			fmt.Printf("\n%s (%s): %v\n", r.Name, reason, err)
+			continue
+		}
+		fmt.Printf("\n%s, %s (%s)\n", r.Name, target.Addr(), reason)
+		hops, err := tracePath(ctx, target.Addr())
+		if err != nil && len(hops) == 0 && ctx.Err() == nil {
+			out, serr := systemTraceroute(ctx, target.Addr())
+			if serr != nil {
+				fmt.Printf("Trace failed: %v; %v\n", err, serr)
+				continue
+			}
+			fmt.Print(out)
+			continue
+		}
+		printHops(hops)
+	}
+	if traced == 0 {
+		fmt.Printf("None; no paths traced.\n")
+	}
+}
+
+func printHops(hops []traceHop) {
+	fmt.Printf("%3s  %-24s  %5s  %8s  %8s  %8s\n", "Hop", "Address", "Loss", "Best", "Avg", "Worst")
+	fmt.Println(strings.Repeat("-", 72))
+	for i, h := range hops {
+		loss := fmt.Sprintf("%.0f%%", 100*float64(h.sent-len(h.rtts))/float64(h.sent))
+		if len(h.rtts) == 0 {
+			fmt.Printf("%3d  %-24s  %5s\n", i+1, "*", loss)
+			continue
+		}
+		var sum time.Duration
+		for _, d := range h.rtts {
+			sum += d
+		}
+		fmt.Printf("%3d  %-24s  %5s  %8s  %8s  %8s\n", i+1, strings.Join(h.addrs, " "), loss,
+			durFmt(slices.Min(h.rtts)), durFmt(sum/time.Duration(len(h.rtts))), durFmt(slices.Max(h.rtts)))
+		if h.unreachable {
+			fmt.Printf("     Destination unreachable, reported by hop %d.\n", i+1)
+		}
+	}
+}
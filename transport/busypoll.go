@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+type busyPollKey struct{}
+
+// WithBusyPoll returns a context whose UDP and TCP queries wait for their
+// answers by reading the socket in a loop, rather than sleeping until the
+// OS reports it readable and the scheduler runs the goroutine again, so
+// that these wakeups are not in the timing. Each query in flight keeps a
+// CPU busy while it waits. DoT, DoH, sockets with an impairment and
+// systems other than Unix wait as usual.
+func WithBusyPoll(ctx context.Context) context.Context {
+	return context.WithValue(ctx, busyPollKey{}, true)
+}
+
+func busyPoll(ctx context.Context) bool {
+	on, _ := ctx.Value(busyPollKey{}).(bool)
+	return on
+}
+
+// busyPollReader returns a reader of conn that polls its socket until ctx
+// is done, or conn itself if it cannot be polled.
+func busyPollReader(ctx context.Context, conn net.Conn) io.Reader {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return conn
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil || !canSpin {
+		return conn
+	}
+	_, stream := conn.(*net.TCPConn)
+	dl, _ := ctx.Deadline()
+	return &spinReader{ctx: ctx, raw: raw, dl: dl, stream: stream}
+}
+
+// spinReader reads a socket by polling it.
+type spinReader struct {
+	ctx    context.Context
+	raw    syscall.RawConn
+	dl     time.Time
+	stream bool // a read of zero bytes is the end of the stream
+}
+
+func (r *spinReader) Read(p []byte) (int, error) {
+	var n int
+	var err error
+	if cerr := r.raw.Read(func(fd uintptr) bool {
+		n, err = spin(r.ctx, fd, p, r.dl)
+		return true
+	}); cerr != nil {
+		return 0, cerr
+	}
+	if err == nil && n == 0 && r.stream && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, err
+}
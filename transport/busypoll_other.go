@@ -0,0 +1,15 @@
+//go:build !unix
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const canSpin = false
+
+func spin(context.Context, uintptr, []byte, time.Time) (int, error) {
+	return 0, errors.ErrUnsupported
+}
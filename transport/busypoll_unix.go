@@ -0,0 +1,29 @@
+//go:build unix
+
+package transport
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+const canSpin = true
+
+// spin reads from the non-blocking socket fd until data arrives, the
+// deadline dl passes or ctx is done.
+func spin(ctx context.Context, fd uintptr, p []byte, dl time.Time) (int, error) {
+	for i := 0; ; i++ {
+		n, err := syscall.Read(int(fd), p)
+		if err != syscall.EAGAIN && err != syscall.EINTR {
+			return max(n, 0), err
+		}
+		if !dl.IsZero() && time.Now().After(dl) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		if i%1024 == 0 && ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	dialMu    sync.RWMutex
+	bootstrap = net.DefaultResolver
+	pins      = make(map[string]string) // lower-cased host name -> IP
+)
+
+// SetBootstrap makes transports resolve server host names through the plain
+// DNS server at addr (host[:port]) instead of the system resolver.
+func SetBootstrap(addr string) {
+	r := plainResolver([]string{addr})
+	dialMu.Lock()
+	defer dialMu.Unlock()
+	bootstrap = r
+}
+
+// Bootstrap returns the resolver used for server host names.
+func Bootstrap() *net.Resolver {
+	dialMu.RLock()
+	defer dialMu.RUnlock()
+	return bootstrap
+}
+
+// plainResolver returns a resolver that queries the plain DNS servers at
+// addrs (host[:port]), moving on to the next one on each retry.
+func plainResolver(addrs []string) *net.Resolver {
+	servers := make([]string, len(addrs))
+	for i, a := range addrs {
+		servers[i] = HostPort(a, "53")
+	}
+	var next atomic.Uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := servers[int(next.Add(1)-1)%len(servers)]
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+type resolverKey struct{}
+
+// withResolver returns a context whose connections resolve server host
+// names through r instead of the bootstrap resolver.
+func withResolver(ctx context.Context, r *net.Resolver) context.Context {
+	return context.WithValue(ctx, resolverKey{}, r)
+}
+
+// contextResolver returns the resolver for the server host names of ctx.
+func contextResolver(ctx context.Context) *net.Resolver {
+	if r, ok := ctx.Value(resolverKey{}).(*net.Resolver); ok {
+		return r
+	}
+	return Bootstrap()
+}
+
+// Pin makes transports connect to ip whenever they dial host, so that a
+// run keeps using the same server regardless of DNS changes. TLS and HTTPS
+// still verify the certificate against host.
+func Pin(host, ip string) {
+	dialMu.Lock()
+	defer dialMu.Unlock()
+	pins[strings.ToLower(host)] = ip
+}
+
+// DialContext connects to addr like net.Dialer, resolving a host name with
+// the bootstrap resolver (or that of a stamp) unless it is pinned, racing TCP connections to its
+// IPv6 and IPv4 addresses with Happy Eyeballs (see dialRace), over the Path
+// of ctx, if any, with TCP Fast Open if ctx asks for it (WithFastOpen),
+// which leaves out the race, and applies SetImpairment.
+// Transports registered by other packages should dial through it so that
+// -bootstrap, -pin and -impair apply to them.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	target := addr
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		dialMu.RLock()
+		ip, ok := pins[strings.ToLower(host)]
+		dialMu.RUnlock()
+		if ok {
+			target = net.JoinHostPort(ip, port)
+		}
+	}
+	d := &net.Dialer{Resolver: contextResolver(ctx), Control: contextControl(ctx)}
+	start := time.Now()
+	var conn net.Conn
+	var err error
+	// With fast open, connect returns before the handshake, the SYN
+	// waiting for the first write: the first attempt would always win the
+	// race, reachable or not. Such dials take the addresses in turn.
+	if host, port, ok := raceable(network, target); ok && !fastOpen(ctx) {
+		var race Race
+		if conn, race, err = dialRace(ctx, d, host, port, familyRace(ctx)); err == nil {
+			slog.DebugContext(ctx, "happy eyeballs", "addr", addr, "won", race.Addr,
+				"ipv6", race.IPv6, "ipv4", race.IPv4, "attempts", race.Attempts)
+			ContextTrace(ctx).gotRace(race)
+		}
+	} else {
+		conn, err = d.DialContext(ctx, network, target)
+	}
+	if err != nil {
+		slog.DebugContext(ctx, "dial failed", "network", network, "addr", addr, "err", err)
+		return nil, err
+	}
+	slog.DebugContext(ctx, "connected", "network", network, "addr", addr,
+		"local", conn.LocalAddr(), "remote", conn.RemoteAddr(), "took", time.Since(start))
+	if imp := impairment.Load(); imp != nil {
+		return impairConn(ctx, conn, network, imp)
+	}
+	return conn, nil
+}
+
+// ServerHost returns the host (name or IP) of the server that a plain,
+// tcp://, tls://, quic:// or https:// resolver address connects to, or ""
+// for other schemes.
+func ServerHost(addr string) string {
+	switch Scheme(addr) {
+	case "udp", "tcp", "tls", "quic", "https":
+	default:
+		return ""
+	}
+	host, _, err := net.SplitHostPort(HostPort(addr, "53"))
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// NewHTTPClient returns a client for DoH and similar transports that dials
+// through DialContext.
+func NewHTTPClient() *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = DialContext
+	return &http.Client{Transport: tr}
+}
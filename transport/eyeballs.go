@@ -0,0 +1,273 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// Delays of Happy Eyeballs, the values RFC 8305 recommends.
+const (
+	// resolutionDelay is how long the A answer waits for the AAAA answer
+	// before the first connection attempt (section 3).
+	resolutionDelay = 50 * time.Millisecond
+	// attemptDelay is how long a connection attempt has before the next
+	// address is tried alongside it (section 5).
+	attemptDelay = 250 * time.Millisecond
+)
+
+// Race is how DialContext connected to a server host name, passed to
+// Trace.GotRace.
+type Race struct {
+	Addr     netip.AddrPort // the address that won
+	IPv6     int            // addresses found of each family, in the running
+	IPv4     int
+	Attempts int           // connection attempts started up to the winner
+	Took     time.Duration // from the lookups to the winning connection
+	Connect  time.Duration // the winning attempt alone
+	// Other is how long connecting to an address of the other family
+	// took, with WithFamilyRace only; zero if not measured or failed.
+	Other time.Duration
+}
+
+// Family returns "IPv6" or "IPv4", the family that won.
+func (r Race) Family() string {
+	if r.Addr.Addr().Is6() {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+type familyRaceKey struct{}
+
+// WithFamilyRace returns a context whose connections to server host names
+// also connect to the other address family once Happy Eyeballs picked a
+// winner, to measure by how much it won (Race.Other). The query waits for
+// that connection, which is closed at once.
+func WithFamilyRace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, familyRaceKey{}, true)
+}
+
+func familyRace(ctx context.Context) bool {
+	on, _ := ctx.Value(familyRaceKey{}).(bool)
+	return on
+}
+
+type lookupResult struct {
+	ip6   bool
+	addrs []netip.Addr
+	err   error
+}
+
+type attemptResult struct {
+	conn net.Conn
+	addr netip.AddrPort
+	took time.Duration
+	err  error
+}
+
+// interleave orders addresses for connection attempts, alternating between
+// the families and starting with IPv6 (RFC 8305, section 4).
+func interleave(addrs []netip.Addr) []netip.Addr {
+	var v6, v4 []netip.Addr
+	for _, a := range addrs {
+		if a.Is6() {
+			v6 = append(v6, a)
+		} else {
+			v4 = append(v4, a)
+		}
+	}
+	out := make([]netip.Addr, 0, len(addrs))
+	for len(v6) > 0 || len(v4) > 0 {
+		if len(v6) > 0 {
+			out, v6 = append(out, v6[0]), v6[1:]
+		}
+		if len(v4) > 0 {
+			out, v4 = append(out, v4[0]), v4[1:]
+		}
+	}
+	return out
+}
+
+// raceable returns the host name and port of addr if a dial over network
+// goes through dialRace: a TCP connection to a host name rather than an
+// address.
+func raceable(network, addr string) (string, uint16, bool) {
+	if network != "tcp" {
+		return "", 0, false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, false
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return "", 0, false
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, uint16(p), true
+}
+
+// dialRace connects to host with Happy Eyeballs (RFC 8305): it looks up
+// the AAAA and A records with d.Resolver at the same time, starts connecting once the
+// AAAA answer is in or the A answer has waited resolutionDelay for it, and
+// tries the addresses of both families in turn, starting another attempt
+// whenever one fails or has run attemptDelay. The first connection wins
+// and the others are abandoned, unless measure asks to connect to the
+// other family as well.
+func dialRace(ctx context.Context, d *net.Dialer, host string, port uint16, measure bool) (net.Conn, Race, error) {
+	var race Race
+	start := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan attemptResult)
+	flying := make(map[bool]int) // attempts in flight by family, IPv6 true
+	defer func() {
+		cancel()
+		if n := flying[true] + flying[false]; n > 0 {
+			go func() {
+				for range n {
+					if r := <-results; r.conn != nil {
+						r.conn.Close()
+					}
+				}
+			}()
+		}
+	}()
+
+	lookups := make(chan lookupResult, 2)
+	for _, ip6 := range []bool{true, false} {
+		network := "ip4"
+		if ip6 {
+			network = "ip6"
+		}
+		go func() {
+			addrs, err := d.Resolver.LookupNetIP(ctx, network, host)
+			lookups <- lookupResult{ip6, addrs, err}
+		}()
+	}
+	pending := 2
+	var queue []netip.Addr
+	var lastErr error
+	add := func(l lookupResult) {
+		pending--
+		if l.err != nil {
+			lastErr = l.err
+			return
+		}
+		if l.ip6 {
+			race.IPv6 = len(l.addrs)
+		} else {
+			race.IPv4 = len(l.addrs)
+		}
+		for _, a := range l.addrs {
+			queue = append(queue, a.Unmap())
+		}
+		queue = interleave(queue)
+	}
+	for len(queue) == 0 && pending > 0 {
+		select {
+		case l := <-lookups:
+			add(l)
+		case <-ctx.Done():
+			return nil, race, ctx.Err()
+		}
+	}
+	if pending > 0 && race.IPv6 == 0 {
+		select {
+		case l := <-lookups:
+			add(l)
+		case <-time.After(resolutionDelay):
+		case <-ctx.Done():
+			return nil, race, ctx.Err()
+		}
+	}
+	if len(queue) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("transport: no addresses for %s", host)
+		}
+		return nil, race, lastErr
+	}
+
+	var won attemptResult
+	attempt := func() {
+		addr := netip.AddrPortFrom(queue[0], port)
+		queue = queue[1:]
+		flying[addr.Addr().Is6()]++
+		if won.conn == nil {
+			race.Attempts++
+		}
+		go func() {
+			began := time.Now()
+			conn, err := d.DialContext(ctx, "tcp", addr.String())
+			results <- attemptResult{conn, addr, time.Since(began), err}
+		}()
+	}
+	attempt()
+	next := time.NewTimer(attemptDelay)
+	defer next.Stop()
+	for won.conn == nil {
+		select {
+		case r := <-results:
+			flying[r.addr.Addr().Is6()]--
+			if r.err == nil {
+				won = r
+				continue
+			}
+			lastErr = r.err
+			if len(queue) > 0 {
+				attempt()
+				next.Reset(attemptDelay)
+			}
+		case <-next.C:
+			if len(queue) > 0 {
+				attempt()
+				next.Reset(attemptDelay)
+			}
+		case l := <-lookups:
+			add(l)
+			if flying[true]+flying[false] == 0 && len(queue) > 0 {
+				attempt()
+				next.Reset(attemptDelay)
+			}
+		case <-ctx.Done():
+			return nil, race, ctx.Err()
+		}
+		if won.conn == nil && flying[true]+flying[false] == 0 && len(queue) == 0 && pending == 0 {
+			return nil, race, lastErr
+		}
+	}
+	race.Addr, race.Connect, race.Took = won.addr, won.took, time.Since(start)
+	if measure {
+		other := !won.addr.Addr().Is6()
+		var rest []netip.Addr
+		for _, a := range queue {
+			if a.Is6() == other {
+				rest = append(rest, a)
+			}
+		}
+		queue = rest
+		for race.Other == 0 && (flying[other] > 0 || len(queue) > 0) {
+			if flying[other] == 0 {
+				attempt()
+			}
+			select {
+			case r := <-results:
+				flying[r.addr.Addr().Is6()]--
+				if r.conn != nil {
+					r.conn.Close()
+					if r.addr.Addr().Is6() == other {
+						race.Other = r.took
+					}
+				}
+			case <-ctx.Done():
+				return won.conn, race, nil
+			}
+		}
+	}
+	return won.conn, race, nil
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+type fastOpenKey struct{}
+
+// WithFastOpen returns a context whose queries open TCP connections with
+// TCP Fast Open (RFC 7413), on Linux only: the query goes out in the SYN
+// once the kernel holds a cookie from the server, saving a round trip.
+// The first connection to a server only asks for the cookie.
+func WithFastOpen(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fastOpenKey{}, true)
+}
+
+func fastOpen(ctx context.Context) bool {
+	on, _ := ctx.Value(fastOpenKey{}).(bool)
+	return on
+}
+
+// contextControl returns the socket control function for the Path and
+// fast open setting of ctx, or nil without either.
+func contextControl(ctx context.Context) func(network, address string, c syscall.RawConn) error {
+	path := contextPath(ctx)
+	if !fastOpen(ctx) {
+		return path
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if path != nil {
+			if err := path(network, address, c); err != nil {
+				return err
+			}
+		}
+		if network != "tcp" && network != "tcp4" && network != "tcp6" {
+			return nil
+		}
+		var serr error
+		if err := c.Control(func(fd uintptr) { serr = setFastOpen(fd) }); err != nil {
+			return err
+		}
+		if serr != nil {
+			return fmt.Errorf("transport: TCP Fast Open: %w", serr)
+		}
+		return nil
+	}
+}
+
+// FastOpenAccepted reports whether the server acknowledged the data sent
+// in the SYN of conn, a TCP or TLS connection opened with WithFastOpen,
+// impaired or not.
+func FastOpenAccepted(conn net.Conn) (bool, error) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if ic, ok := conn.(*impairedConn); ok {
+		conn = ic.Conn
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false, syscall.EINVAL
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+	var acked bool
+	var serr error
+	if err := raw.Control(func(fd uintptr) { acked, serr = synDataAcked(fd) }); err != nil {
+		return false, err
+	}
+	return acked, serr
+}
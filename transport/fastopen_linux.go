@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	tcpFastOpenConnect = 30   // TCP_FASTOPEN_CONNECT, since Linux 4.11
+	tcpiOptSynData     = 0x20 // TCPI_OPT_SYN_DATA: the SYN's data was acknowledged
+)
+
+func setFastOpen(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+}
+
+func synDataAcked(fd uintptr) (bool, error) {
+	var info syscall.TCPInfo
+	size := uint32(syscall.SizeofTCPInfo)
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, syscall.TCP_INFO,
+		uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return false, errno
+	}
+	return info.Options&tcpiOptSynData != 0, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package transport
+
+import "errors"
+
+func setFastOpen(uintptr) error {
+	return errors.ErrUnsupported
+}
+
+func synDataAcked(uintptr) (bool, error) {
+	return false, errors.ErrUnsupported
+}
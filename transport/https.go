@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("https", func(addr string) (Transport, error) {
+		return &HTTPS{URL: addr, Client: NewHTTPClient()}, nil
+	})
+}
+
+const dnsMessageType = "application/dns-message"
+
+// HTTPS sends queries as DNS-over-HTTPS requests (RFC 8484). The client's
+// connection pool is reused across queries.
+type HTTPS struct {
+	URL    string
+	Client *http.Client
+	// Method is http.MethodPost (the default when empty) or http.MethodGet,
+	// which carries the query in the dns URL parameter, base64url-encoded,
+	// so that HTTP caches and CDNs in front of the server can answer it.
+	Method string
+}
+
+// LimitConns makes the client open at most n connections to the server
+// and keep as many idle. Over HTTP/2, one connection carries many queries
+// at a time, so n matters little until the server limits its streams.
+func (t *HTTPS) LimitConns(n int) {
+	if tr, ok := t.Client.Transport.(*http.Transport); ok {
+		tr.MaxConnsPerHost, tr.MaxIdleConnsPerHost = n, n
+	}
+}
+
+// SendQuery implements Transport.
+func (t *HTTPS) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	// RFC 8484 recommends ID 0 so that responses are cache friendly.
+	q := *msg
+	q.ID = 0
+	wire, err := pack(ctx, &q)
+	if err != nil {
+		return nil, err
+	}
+	var local, remote net.Addr
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			local, remote = info.Conn.LocalAddr(), info.Conn.RemoteAddr()
+			slog.DebugContext(ctx, "got connection", "url", t.URL, "local", local, "remote", remote,
+				"reused", info.Reused, "idle", info.IdleTime)
+			ContextTrace(ctx).gotConn(info.Reused)
+			ContextTrace(ctx).writeStart()
+		},
+		GotFirstResponseByte: ContextTrace(ctx).gotFirstResponseByte,
+	})
+	req, err := t.newRequest(ctx, wire)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := t.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	sentQuery(ctx, local, remote, wire)
+	defer httpResp.Body.Close()
+	ContextTrace(ctx).gotHTTPResponse(httpResp)
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transport: DoH status %s", httpResp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+	ContextTrace(ctx).readDone()
+	Observe(ctx, remote, local, body)
+	resp, err := unpack(ctx, body)
+	if err != nil {
+		slog.DebugContext(ctx, "malformed response", "url", t.URL, "bytes", len(body), "err", err)
+		return nil, err
+	}
+	ContextTrace(ctx).gotResponse(body)
+	resp.ID = msg.ID
+	return resp, nil
+}
+
+// newRequest returns the HTTP request carrying the query wire in t.Method.
+func (t *HTTPS) newRequest(ctx context.Context, wire []byte) (*http.Request, error) {
+	if t.Method == http.MethodGet {
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return nil, err
+		}
+		v := u.Query()
+		v.Set("dns", base64.RawURLEncoding.EncodeToString(wire))
+		u.RawQuery = v.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", dnsMessageType)
+		return req, nil
+	}
+	if t.Method != "" && t.Method != http.MethodPost {
+		return nil, fmt.Errorf("transport: unsupported DoH method %q (want GET or POST)", t.Method)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(wire))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+	return req, nil
+}
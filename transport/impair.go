@@ -0,0 +1,182 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Impairment degrades the network as the transports see it, in the manner
+// of tc netem but in userspace and on the program's own sockets only, so
+// it needs no privileges and does not affect other traffic.
+type Impairment struct {
+	Loss   float64       // chance of losing each packet, in each direction
+	Delay  time.Duration // added to every packet sent
+	Jitter time.Duration // Delay varies by up to this much either way
+}
+
+// impairRTO stands in for the retransmission timeout after a lost segment
+// of a stream: the minimum RTO on Linux. A lost SYN waits the initial RTO
+// of one second instead.
+const impairRTO = 200 * time.Millisecond
+
+var impairment atomic.Pointer[Impairment]
+
+// SetImpairment applies imp to the connections DialContext opens from now
+// on. The zero Impairment turns it off.
+func SetImpairment(imp Impairment) error {
+	if imp.Loss < 0 || imp.Loss > 1 || imp.Delay < 0 || imp.Jitter < 0 {
+		return fmt.Errorf("transport: invalid impairment: loss %v, delay %v, jitter %v", imp.Loss, imp.Delay, imp.Jitter)
+	}
+	if imp == (Impairment{}) {
+		impairment.Store(nil)
+		return nil
+	}
+	impairment.Store(&imp)
+	return nil
+}
+
+// CurrentImpairment returns the impairment set with SetImpairment, or the
+// zero Impairment.
+func CurrentImpairment() Impairment {
+	if imp := impairment.Load(); imp != nil {
+		return *imp
+	}
+	return Impairment{}
+}
+
+// String describes imp, e.g. "5% loss, 50ms ±10ms delay".
+func (imp Impairment) String() string {
+	var parts []string
+	if imp.Loss > 0 {
+		parts = append(parts, fmt.Sprintf("%g%% loss", imp.Loss*100))
+	}
+	if imp.Delay > 0 || imp.Jitter > 0 {
+		d := imp.Delay.String()
+		if imp.Jitter > 0 {
+			d += " ±" + imp.Jitter.String()
+		}
+		parts = append(parts, d+" delay")
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (imp *Impairment) lose() bool {
+	return imp.Loss > 0 && rand.Float64() < imp.Loss
+}
+
+// delay returns Delay with jitter applied.
+func (imp *Impairment) delay() time.Duration {
+	d := imp.Delay
+	if imp.Jitter > 0 {
+		d += time.Duration(rand.Int64N(int64(2*imp.Jitter)+1)) - imp.Jitter
+	}
+	return max(d, 0)
+}
+
+// impairConn wraps a connection from DialContext. Datagrams are dropped
+// outright; on a stream a loss costs a retransmission timeout instead.
+func impairConn(ctx context.Context, conn net.Conn, network string, imp *Impairment) (net.Conn, error) {
+	ic := &impairedConn{Conn: conn, imp: imp, packets: network == "udp" || network == "udp4" || network == "udp6"}
+	if !ic.packets {
+		// The handshake is one more round trip to delay, and its SYN can be lost.
+		wait := imp.delay()
+		if imp.lose() {
+			wait += time.Second
+		}
+		if err := impairSleep(ctx, wait); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return ic, nil
+}
+
+// impairSleep waits for d or until ctx is done.
+func impairSleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type impairedConn struct {
+	net.Conn
+	imp     *Impairment
+	packets bool
+
+	mu       sync.Mutex
+	deadline time.Time // of writes
+}
+
+func (c *impairedConn) Write(b []byte) (int, error) {
+	wait := c.imp.delay()
+	if c.imp.lose() {
+		if c.packets {
+			return len(b), c.sleep(wait) // sent, but never arrives
+		}
+		wait += impairRTO
+	}
+	if err := c.sleep(wait); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *impairedConn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(b)
+		if err != nil || !c.imp.lose() {
+			return n, err
+		}
+		if !c.packets {
+			// The data arrives after a retransmission.
+			if err := c.sleep(impairRTO); err != nil {
+				return 0, err
+			}
+			return n, nil
+		}
+	}
+}
+
+func (c *impairedConn) SetDeadline(t time.Time) error {
+	c.setWriteDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *impairedConn) SetWriteDeadline(t time.Time) error {
+	c.setWriteDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *impairedConn) setWriteDeadline(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+}
+
+// sleep waits for d, but not past the write deadline.
+func (c *impairedConn) sleep(d time.Duration) error {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	if !deadline.IsZero() && time.Now().Add(d).After(deadline) {
+		time.Sleep(time.Until(deadline))
+		return os.ErrDeadlineExceeded
+	}
+	time.Sleep(d)
+	return nil
+}
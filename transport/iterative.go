@@ -0,0 +1,256 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("iterative", func(addr string) (Transport, error) {
+		t := &Iterative{Roots: RootServers[:]}
+		if _, host, _ := strings.Cut(addr, "://"); host != "" {
+			t.Roots = []string{host}
+		}
+		return t, nil
+	})
+}
+
+// RootServers are the IPv4 addresses of the root servers A to M.
+var RootServers = [13]string{
+	"198.41.0.4", "170.247.170.2", "192.33.4.12", "199.7.91.13", "192.203.230.10", "192.5.5.241", "192.112.36.4",
+	"198.97.190.53", "192.36.148.17", "192.58.128.30", "193.0.14.129", "199.7.83.42", "202.12.27.33",
+}
+
+// Iterative resolves queries itself, as a recursive resolver does: it asks
+// a root server, follows the referrals to the name servers of the TLD and
+// of the zone, and follows CNAMEs. Delegations are cached for their TTL,
+// like a resolver's infrastructure cache, but answers are not, so every
+// query is resolved by the authoritative servers. Queries to the servers
+// are sent over UDP, with TCP for truncated answers.
+type Iterative struct {
+	Roots []string // IP[:port] of the servers to start at
+
+	mu    sync.Mutex
+	zones map[string]delegation // by lower-cased zone name with trailing dot
+}
+
+type delegation struct {
+	servers []string // host:port
+	expires time.Time
+}
+
+const (
+	// iterativeSteps bounds the referrals and CNAMEs followed per query.
+	iterativeSteps = 24
+	// iterativeServerTimeout is how long one server gets before the next
+	// server of the zone is tried.
+	iterativeServerTimeout = 800 * time.Millisecond
+)
+
+var errNoServers = errors.New("transport: no reachable name server")
+
+// SendQuery implements Transport.
+func (t *Iterative) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	if len(msg.Questions) != 1 {
+		return nil, errors.New("transport: iterative resolution needs exactly one question")
+	}
+	q := msg.Questions[0]
+	// Only the final answer counts as the response for the caller's trace.
+	inner := WithTrace(ctx, nil)
+	resp, err := t.resolve(inner, q.Name, q.Type, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.ID = msg.ID
+	resp.Questions = msg.Questions
+	resp.RecursionDesired = msg.RecursionDesired
+	resp.RecursionAvailable = true
+	resp.Authoritative = false
+	if wire, err := resp.Pack(); err == nil {
+		trace := ContextTrace(ctx)
+		trace.gotFirstResponseByte()
+		trace.gotResponse(wire)
+	}
+	return resp, nil
+}
+
+// resolve finds the answer to name/qtype, starting at the closest cached
+// delegation. depth counts nested resolutions of name server addresses.
+func (t *Iterative) resolve(ctx context.Context, name string, qtype dnsmsg.Type, depth int) (*dnsmsg.Message, error) {
+	if depth > 4 {
+		return nil, fmt.Errorf("transport: name server lookups nested too deep resolving %s", name)
+	}
+	name = dnsmsg.Fqdn(name)
+	var chain []dnsmsg.Resource // CNAMEs followed so far
+	servers, cut := t.closest(name)
+	for step := 0; step < iterativeSteps; step++ {
+		resp, err := t.ask(ctx, servers, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		if cname, ok := cnameOf(resp, name, qtype); ok {
+			slog.DebugContext(ctx, "following CNAME", "name", name, "target", cname)
+			chain = append(chain, resp.Answers...)
+			name = cname
+			servers, cut = t.closest(name)
+			continue
+		}
+		// A referral must lead below the zone asked, or it goes in circles.
+		zone, nss := referral(resp, name)
+		if resp.RCode != dnsmsg.RCodeSuccess || resp.Authoritative || len(resp.Answers) > 0 ||
+			zone == "" || !inZone(zone, cut) || dnsmsg.EqualNames(zone, cut) {
+			resp.Answers = append(chain, resp.Answers...)
+			return resp, nil
+		}
+		next := t.glue(ctx, resp, nss, depth)
+		if len(next) == 0 {
+			return nil, fmt.Errorf("transport: no address for the name servers of %s", zone)
+		}
+		slog.DebugContext(ctx, "referral", "zone", zone, "servers", len(next))
+		t.store(zone, next, resp)
+		servers, cut = next, zone
+	}
+	return nil, fmt.Errorf("transport: more than %d referrals and CNAMEs resolving %s", iterativeSteps, name)
+}
+
+// ask sends a non-recursive query to the servers in turn until one answers.
+func (t *Iterative) ask(ctx context.Context, servers []string, name string, qtype dnsmsg.Type) (*dnsmsg.Message, error) {
+	err := errNoServers
+	for _, server := range servers {
+		qctx, cancel := context.WithTimeout(ctx, iterativeServerTimeout)
+		q := dnsmsg.NewQuery(name, qtype)
+		q.RecursionDesired = false
+		var resp *dnsmsg.Message
+		resp, err = (&UDP{Addr: server}).SendQuery(qctx, q)
+		cancel()
+		if err == nil && resp.RCode != dnsmsg.RCodeServerFailure && resp.RCode != dnsmsg.RCodeRefused {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			err = fmt.Errorf("transport: %s answered %s", server, resp.RCode)
+		}
+		slog.DebugContext(ctx, "name server failed, trying the next", "server", server, "err", err)
+	}
+	return nil, err
+}
+
+// cnameOf returns the CNAME target of name in an answer without records of
+// the queried type.
+func cnameOf(resp *dnsmsg.Message, name string, qtype dnsmsg.Type) (string, bool) {
+	if qtype == dnsmsg.TypeCNAME {
+		return "", false
+	}
+	var target string
+	for _, rr := range resp.Answers {
+		if rr.Type == qtype {
+			return "", false
+		}
+		if rr.Type == dnsmsg.TypeCNAME && dnsmsg.EqualNames(rr.Name, name) {
+			target, _ = rr.Target()
+		}
+	}
+	return target, target != ""
+}
+
+// referral returns the zone and name servers a response delegates name to,
+// or "" if it is not a referral.
+func referral(resp *dnsmsg.Message, name string) (zone string, nss []string) {
+	for _, rr := range resp.Authorities {
+		if rr.Type != dnsmsg.TypeNS || !inZone(name, rr.Name) {
+			continue
+		}
+		if ns, err := rr.Target(); err == nil {
+			zone = rr.Name
+			nss = append(nss, ns)
+		}
+	}
+	return zone, nss
+}
+
+// glue returns the addresses of the name servers, taken from the
+// additional section or else resolved, for the first servers only.
+func (t *Iterative) glue(ctx context.Context, resp *dnsmsg.Message, nss []string, depth int) []string {
+	var out []string
+	for _, ns := range nss {
+		for _, rr := range resp.Additionals {
+			if rr.Type == dnsmsg.TypeA && dnsmsg.EqualNames(rr.Name, ns) {
+				if ip, err := rr.IP(); err == nil {
+					out = append(out, HostPort(ip.String(), "53"))
+				}
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, ns := range nss[:min(len(nss), 2)] {
+		r, err := t.resolve(ctx, ns, dnsmsg.TypeA, depth+1)
+		if err != nil {
+			continue
+		}
+		for _, rr := range r.Answers {
+			if ip, err := rr.IP(); err == nil && rr.Type == dnsmsg.TypeA {
+				out = append(out, HostPort(ip.String(), "53"))
+			}
+		}
+		if len(out) > 0 {
+			break
+		}
+	}
+	return out
+}
+
+// closest returns the closest cached zone enclosing name and its servers,
+// or the root zone and servers.
+func (t *Iterative) closest(name string) ([]string, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	name = strings.ToLower(name)
+	for {
+		if d, ok := t.zones[name]; ok && time.Now().Before(d.expires) {
+			return d.servers, name
+		}
+		_, rest, ok := strings.Cut(name, ".")
+		if !ok || rest == "" {
+			break
+		}
+		name = rest
+	}
+	roots := make([]string, len(t.Roots))
+	for i, r := range t.Roots {
+		roots[i] = HostPort(r, "53")
+	}
+	return roots, "."
+}
+
+// store caches a delegation for the lowest TTL of its NS records.
+func (t *Iterative) store(zone string, servers []string, resp *dnsmsg.Message) {
+	ttl := uint32(0)
+	for _, rr := range resp.Authorities {
+		if rr.Type == dnsmsg.TypeNS && (ttl == 0 || rr.TTL < ttl) {
+			ttl = rr.TTL
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.zones == nil {
+		t.zones = make(map[string]delegation)
+	}
+	t.zones[strings.ToLower(dnsmsg.Fqdn(zone))] = delegation{servers: servers, expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+}
+
+// inZone reports whether name is zone or below it.
+func inZone(name, zone string) bool {
+	name, zone = strings.ToLower(dnsmsg.Fqdn(name)), strings.ToLower(dnsmsg.Fqdn(zone))
+	return zone == "." || name == zone || strings.HasSuffix(name, "."+zone)
+}
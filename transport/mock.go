@@ -0,0 +1,412 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("mock", func(addr string) (Transport, error) {
+		sc := scenario.Load()
+		if sc == nil {
+			return nil, errors.New("transport: no mock scenario loaded")
+		}
+		_, name, _ := strings.Cut(addr, "://")
+		for i := range sc.Resolvers {
+			if r := &sc.Resolvers[i]; strings.EqualFold(r.Name, name) {
+				return newMock(sc, r), nil
+			}
+		}
+		return nil, fmt.Errorf("transport: mock resolver %q is not in the scenario", name)
+	})
+}
+
+// Scenario scripts the answers of mock resolvers, for runs without network
+// access: demos, tests of programs that embed the benchmark, and work on
+// output formats. Each resolver replays its Script, or draws every answer
+// from its latency and shares of timeouts and response codes.
+type Scenario struct {
+	// Seed makes the draws; every run of a scenario with the same seed
+	// gets the same answers. Zero picks a random seed.
+	Seed      uint64
+	TTL       uint32 // of the records answered
+	Resolvers []MockResolver
+}
+
+// MockResolver is one resolver of a Scenario.
+type MockResolver struct {
+	Name     string
+	Latency  time.Duration
+	Jitter   time.Duration // Latency varies by up to this much either way
+	Timeouts float64       // share of queries never answered, from 0 to 1
+	// RCodes holds the shares of answers with these response codes
+	// instead of NOERROR.
+	RCodes map[dnsmsg.RCode]float64
+	// Script, if set, is replayed in order and then over again instead of
+	// drawing the answers.
+	Script []MockStep
+}
+
+// MockStep is one scripted answer: its latency and response code, or a
+// query that times out.
+type MockStep struct {
+	Latency time.Duration
+	RCode   dnsmsg.RCode
+	Timeout bool
+}
+
+// The records of NOERROR answers.
+var (
+	mockAddr4 = netip.MustParseAddr("192.0.2.1")
+	mockAddr6 = netip.MustParseAddr("2001:db8::1")
+)
+
+var scenario atomic.Pointer[Scenario]
+
+// UseScenario makes mock://NAME addresses answer as the resolver named NAME
+// of sc.
+func UseScenario(sc *Scenario) {
+	scenario.Store(sc)
+}
+
+// LoadScenario reads a scenario file; see ParseScenario.
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc, err := ParseScenario(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// ParseScenario reads a scenario in the subset of YAML below. Durations
+// are Go durations, shares are percentages or fractions, and a script step
+// is a latency with an optional response code, or "timeout". Only script
+// takes a flow list; flow maps such as rcodes: {SERVFAIL: 2%} are not
+// supported.
+//
+//	seed: 42
+//	ttl: 300
+//	resolvers:
+//	  - name: Fast
+//	    latency: 12ms
+//	    jitter: 3ms
+//	  - name: Flaky
+//	    latency: 45ms
+//	    jitter: 25ms
+//	    timeouts: 5%
+//	    rcodes:
+//	      SERVFAIL: 2%
+//	  - name: Scripted
+//	    script: [8ms, 9ms, 30ms SERVFAIL, timeout]
+func ParseScenario(r io.Reader) (*Scenario, error) {
+	sc := &Scenario{TTL: 300}
+	var res *MockResolver
+	inResolvers := false
+	block, blockIndent := "", 0 // the nested rcodes or script list being read
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		raw, _, _ := strings.Cut(s.Text(), "#")
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		fail := func(err error) (*Scenario, error) { return nil, fmt.Errorf("line %d: %w", n, err) }
+
+		if block != "" && indent > blockIndent {
+			if block == "script" {
+				step, ok := strings.CutPrefix(line, "- ")
+				if !ok {
+					return fail(errors.New("want a script step, - LATENCY [RCODE] or - timeout"))
+				}
+				st, err := parseMockStep(step)
+				if err != nil {
+					return fail(err)
+				}
+				res.Script = append(res.Script, st)
+				continue
+			}
+			key, value, _ := strings.Cut(line, ":")
+			rc, err := dnsmsg.ParseRCode(strings.TrimSpace(key))
+			if err != nil {
+				return fail(err)
+			}
+			share, err := parseShare(value)
+			if err != nil {
+				return fail(err)
+			}
+			res.RCodes[rc] = share
+			continue
+		}
+		block = ""
+
+		item := false
+		if rest, ok := strings.CutPrefix(line, "- "); ok {
+			item, line = true, strings.TrimSpace(rest)
+			indent = len(raw) - len(strings.TrimLeft(raw[indent+1:], " "))
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fail(fmt.Errorf("want key: value, got %q", line))
+		}
+		key, value = strings.TrimSpace(key), strings.Trim(strings.TrimSpace(value), `"'`)
+		if item {
+			if !inResolvers {
+				return fail(errors.New("list item outside resolvers"))
+			}
+			sc.Resolvers = append(sc.Resolvers, MockResolver{})
+			res = &sc.Resolvers[len(sc.Resolvers)-1]
+		} else if indent == 0 {
+			res, inResolvers = nil, false
+		}
+
+		var err error
+		if res == nil {
+			switch key {
+			case "seed":
+				sc.Seed, err = strconv.ParseUint(value, 10, 64)
+			case "ttl":
+				var ttl uint64
+				ttl, err = strconv.ParseUint(value, 10, 32)
+				sc.TTL = uint32(ttl)
+			case "resolvers":
+				if value != "" {
+					err = errors.New("resolvers: want a list on the lines below")
+				}
+				inResolvers = true
+			default:
+				err = fmt.Errorf("unknown key %q (want seed, ttl or resolvers)", key)
+			}
+			if err != nil {
+				return fail(err)
+			}
+			continue
+		}
+		switch key {
+		case "name":
+			res.Name = value
+		case "latency":
+			res.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			res.Jitter, err = time.ParseDuration(value)
+		case "timeouts":
+			res.Timeouts, err = parseShare(value)
+		case "rcodes":
+			if value != "" {
+				err = errors.New("rcodes: want RCODE: share on the lines below")
+			}
+			res.RCodes = make(map[dnsmsg.RCode]float64)
+			block, blockIndent = key, indent
+		case "script":
+			if value == "" {
+				block, blockIndent = key, indent
+				break
+			}
+			list, ok := strings.CutPrefix(value, "[")
+			if list, ok2 := strings.CutSuffix(list, "]"); ok && ok2 {
+				for _, step := range strings.Split(list, ",") {
+					st, err := parseMockStep(step)
+					if err != nil {
+						return fail(err)
+					}
+					res.Script = append(res.Script, st)
+				}
+				break
+			}
+			err = errors.New("script: want [STEP, ...] or a list on the lines below")
+		default:
+			err = fmt.Errorf("unknown key %q (want name, latency, jitter, timeouts, rcodes or script)", key)
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(sc.Resolvers) == 0 {
+		return nil, errors.New("no resolvers")
+	}
+	for _, r := range sc.Resolvers {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// validate checks the values ParseScenario cannot check line by line.
+func (r MockResolver) validate() error {
+	if r.Name == "" {
+		return errors.New("resolver without a name")
+	}
+	total := r.Timeouts
+	for rc, share := range r.RCodes {
+		if rc > 15 {
+			return fmt.Errorf("resolver %s: %s does not fit the message header", r.Name, rc)
+		}
+		total += share
+	}
+	if r.Latency < 0 || r.Jitter < 0 || total > 1 {
+		return fmt.Errorf("resolver %s: latency %v, jitter %v, timeouts and rcodes %.4g%%: want no negative durations and shares up to 100%%",
+			r.Name, r.Latency, r.Jitter, total*100)
+	}
+	return nil
+}
+
+// parseMockStep parses a script step such as "12ms", "30ms SERVFAIL" or
+// "timeout".
+func parseMockStep(s string) (MockStep, error) {
+	fields := strings.Fields(strings.Trim(strings.TrimSpace(s), `"'`))
+	if len(fields) == 1 && strings.EqualFold(fields[0], "timeout") {
+		return MockStep{Timeout: true}, nil
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return MockStep{}, fmt.Errorf("script step %q: want LATENCY [RCODE] or timeout", s)
+	}
+	d, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return MockStep{}, fmt.Errorf("script step %q: %w", s, err)
+	}
+	st := MockStep{Latency: d}
+	if len(fields) == 2 {
+		if st.RCode, err = dnsmsg.ParseRCode(fields[1]); err != nil {
+			return MockStep{}, fmt.Errorf("script step %q: %w", s, err)
+		}
+	}
+	return st, nil
+}
+
+// parseShare parses a percentage ("5%") or a fraction ("0.05").
+func parseShare(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(pct, 64)
+		return v / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Mock answers as one resolver of a Scenario, after sleeping for the
+// scripted or drawn latency. NOERROR answers hold A 192.0.2.1, AAAA
+// 2001:db8::1, a TXT or an SVCB/HTTPS record of the name asked for, and no
+// records for other types. A query that times out waits for its context.
+type Mock struct {
+	r   *MockResolver
+	ttl uint32
+
+	mu   sync.Mutex
+	rng  *rand.Rand
+	next int // the script step of the next query
+}
+
+// newMock returns a Mock for r that starts at the first step of its script
+// and the first draw of its seed, so that every run replays the same
+// answers.
+func newMock(sc *Scenario, r *MockResolver) *Mock {
+	seed := sc.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	h := fnv.New64a()
+	h.Write([]byte(r.Name))
+	return &Mock{r: r, ttl: sc.TTL, rng: rand.New(rand.NewPCG(seed, h.Sum64()))}
+}
+
+// step returns the answer to the next query.
+func (t *Mock) step() MockStep {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.r.Script) > 0 {
+		st := t.r.Script[t.next%len(t.r.Script)]
+		t.next++
+		return st
+	}
+	st := MockStep{Latency: t.r.Latency}
+	if t.r.Jitter > 0 {
+		st.Latency += time.Duration(t.rng.Int64N(int64(2*t.r.Jitter)+1)) - t.r.Jitter
+		st.Latency = max(st.Latency, 0)
+	}
+	p := t.rng.Float64()
+	if p -= t.r.Timeouts; p < 0 {
+		st.Timeout = true
+		return st
+	}
+	// In the order of the codes, so that the same draw picks the same one.
+	for rc := dnsmsg.RCode(0); rc < 16; rc++ {
+		if share, ok := t.r.RCodes[rc]; ok {
+			if p -= share; p < 0 {
+				st.RCode = rc
+				break
+			}
+		}
+	}
+	return st
+}
+
+// SendQuery implements Transport.
+func (t *Mock) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	if len(msg.Questions) != 1 {
+		return nil, errors.New("mock: want one question")
+	}
+	wire, err := pack(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	ContextTrace(ctx).wroteQuery(nil, nil, wire)
+	st := t.step()
+	ContextTrace(ctx).writeStart()
+	if st.Timeout {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if err := impairSleep(ctx, st.Latency); err != nil {
+		return nil, err
+	}
+	ContextTrace(ctx).readDone()
+
+	q := msg.Questions[0]
+	resp := *msg
+	resp.Response, resp.RecursionAvailable = true, true
+	resp.RCode = st.RCode
+	resp.Answers, resp.Authorities, resp.Additionals = nil, nil, nil
+	if st.RCode == dnsmsg.RCodeSuccess {
+		rr := dnsmsg.Resource{Name: q.Name, Type: q.Type, Class: dnsmsg.ClassINET, TTL: t.ttl}
+		switch q.Type {
+		case dnsmsg.TypeA:
+			rr.Data = mockAddr4.AsSlice()
+		case dnsmsg.TypeAAAA:
+			rr.Data = mockAddr6.AsSlice()
+		case dnsmsg.TypeTXT:
+			rr.Data = append([]byte{4}, "mock"...)
+		case dnsmsg.TypeSVCB, dnsmsg.TypeHTTPS:
+			rr.Data = []byte{0, 1, 0} // priority 1, target "."
+		}
+		if rr.Data != nil {
+			resp.Answers = []dnsmsg.Resource{rr}
+		}
+	}
+	if out, err := resp.Pack(); err == nil {
+		ContextTrace(ctx).gotResponse(out)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func TestParseScenario(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want *Scenario
+		err  string // a substring of the error, if the scenario is invalid
+	}{
+		{
+			name: "defaults",
+			in:   "resolvers:\n  - name: Fast\n    latency: 12ms\n",
+			want: &Scenario{TTL: 300, Resolvers: []MockResolver{{Name: "Fast", Latency: 12 * time.Millisecond}}},
+		},
+		{
+			name: "draws",
+			in: `seed: 42   # comment
+ttl: 60
+resolvers:
+  - name: "Flaky"
+    latency: 45ms
+    jitter: 25ms
+    timeouts: 5%
+    rcodes:
+      SERVFAIL: 2%
+      NXDOMAIN: 0.01
+  - name: Fast
+    latency: 1ms
+`,
+			want: &Scenario{Seed: 42, TTL: 60, Resolvers: []MockResolver{
+				{
+					Name: "Flaky", Latency: 45 * time.Millisecond, Jitter: 25 * time.Millisecond, Timeouts: 0.05,
+					RCodes: map[dnsmsg.RCode]float64{dnsmsg.RCodeServerFailure: 0.02, dnsmsg.RCodeNameError: 0.01},
+				},
+				{Name: "Fast", Latency: time.Millisecond},
+			}},
+		},
+		{
+			name: "flow list",
+			in:   "resolvers:\n  - name: S\n    script: [8ms, 30ms SERVFAIL, timeout]\n",
+			want: &Scenario{TTL: 300, Resolvers: []MockResolver{{Name: "S", Script: []MockStep{
+				{Latency: 8 * time.Millisecond},
+				{Latency: 30 * time.Millisecond, RCode: dnsmsg.RCodeServerFailure},
+				{Timeout: true},
+			}}}},
+		},
+		{
+			name: "block list",
+			in:   "resolvers:\n  - name: S\n    script:\n      - 8ms\n      - timeout\n  - name: T\n",
+			want: &Scenario{TTL: 300, Resolvers: []MockResolver{
+				{Name: "S", Script: []MockStep{{Latency: 8 * time.Millisecond}, {Timeout: true}}},
+				{Name: "T"},
+			}},
+		},
+		{name: "no resolvers", in: "seed: 1\n", err: "no resolvers"},
+		{name: "unknown top-level key", in: "speed: 1\n", err: `line 1: unknown key "speed"`},
+		{name: "unknown resolver key", in: "resolvers:\n  - name: A\n    delay: 1ms\n", err: `line 3: unknown key "delay"`},
+		{name: "not key value", in: "resolvers:\n  - name: A\n    latency\n", err: "line 3: want key: value"},
+		{name: "item outside resolvers", in: "- name: A\n", err: "line 1: list item outside resolvers"},
+		{name: "inline resolvers", in: "resolvers: [A]\n", err: "line 1: resolvers: want a list"},
+		{name: "bad seed", in: "seed: -1\n", err: "line 1:"},
+		{name: "bad latency", in: "resolvers:\n  - name: A\n    latency: fast\n", err: "line 3:"},
+		{name: "bad share", in: "resolvers:\n  - name: A\n    timeouts: some\n", err: "line 3:"},
+		{name: "flow map", in: "resolvers:\n  - name: A\n    rcodes: {SERVFAIL: 2%}\n", err: "line 3: rcodes: want RCODE: share on the lines below"},
+		{name: "unknown rcode", in: "resolvers:\n  - name: A\n    rcodes:\n      BROKEN: 2%\n", err: "line 4:"},
+		{name: "bad rcode share", in: "resolvers:\n  - name: A\n    rcodes:\n      SERVFAIL: x\n", err: "line 4:"},
+		{name: "bad flow step", in: "resolvers:\n  - name: A\n    script: [8ms, soon]\n", err: `line 3: script step " soon"`},
+		{name: "unclosed flow list", in: "resolvers:\n  - name: A\n    script: [8ms\n", err: "line 3: script: want [STEP, ...]"},
+		{name: "block step without dash", in: "resolvers:\n  - name: A\n    script:\n      8ms\n", err: "line 4: want a script step"},
+		{name: "step with two codes", in: "resolvers:\n  - name: A\n    script: [8ms SERVFAIL REFUSED]\n", err: "want LATENCY [RCODE] or timeout"},
+		{name: "no name", in: "resolvers:\n  - latency: 1ms\n", err: "resolver without a name"},
+		{name: "shares over 100%", in: "resolvers:\n  - name: A\n    timeouts: 60%\n    rcodes:\n      SERVFAIL: 50%\n", err: "resolver A: latency"},
+		{name: "negative jitter", in: "resolvers:\n  - name: A\n    jitter: -1ms\n", err: "want no negative durations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScenario(strings.NewReader(tt.in))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMockSeed checks that a scenario with the same seed draws the same
+// answers in every run, and another seed other ones.
+func TestMockSeed(t *testing.T) {
+	r := MockResolver{
+		Name: "Flaky", Latency: 45 * time.Millisecond, Jitter: 25 * time.Millisecond, Timeouts: 0.1,
+		RCodes: map[dnsmsg.RCode]float64{dnsmsg.RCodeServerFailure: 0.1, dnsmsg.RCodeNameError: 0.05},
+	}
+	draw := func(seed uint64) []MockStep {
+		m := newMock(&Scenario{Seed: seed, Resolvers: []MockResolver{r}}, &r)
+		steps := make([]MockStep, 200)
+		for i := range steps {
+			steps[i] = m.step()
+		}
+		return steps
+	}
+	a, b := draw(42), draw(42)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("two runs with seed 42 drew different answers")
+	}
+	if reflect.DeepEqual(a, draw(43)) {
+		t.Error("seeds 42 and 43 drew the same answers")
+	}
+	var timeouts, failures int
+	for _, st := range a {
+		switch {
+		case st.Timeout:
+			timeouts++
+		case st.RCode != dnsmsg.RCodeSuccess:
+			failures++
+		}
+	}
+	if timeouts == 0 || failures == 0 {
+		t.Errorf("%d timeouts and %d error codes in %d draws, want some of each", timeouts, failures, len(a))
+	}
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("os", func(addr string) (Transport, error) {
+		switch _, lib, _ := strings.Cut(addr, "://"); strings.ToLower(lib) {
+		case "", "libc":
+			return &OS{}, nil
+		case "go":
+			return &OS{Go: true}, nil
+		}
+		return nil, fmt.Errorf("transport: unknown OS resolver %q (want os://libc or os://go)", addr)
+	})
+}
+
+// OS looks names up through a resolver library of this machine instead of
+// sending queries itself, to measure what applications experience: the
+// hosts file, the nsswitch.conf chain, caching daemons such as nscd or
+// systemd-resolved, and the library's own retries all count. It answers A
+// and AAAA questions only, with the addresses found and a TTL of zero,
+// and NXDOMAIN for names that do not exist.
+type OS struct {
+	// Go uses Go's built-in resolver, which reads /etc/hosts and
+	// /etc/resolv.conf itself, instead of getaddrinfo. Builds without cgo
+	// on Linux have no getaddrinfo and use Go's resolver either way; on
+	// Windows and macOS the system's resolver is used without cgo too.
+	Go bool
+}
+
+// OSLibrary names the resolver library of OS without Go in this build.
+func OSLibrary() string {
+	return osLibrary()
+}
+
+// SendQuery implements Transport.
+func (t *OS) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	if len(msg.Questions) != 1 {
+		return nil, errors.New("os resolver: want one question")
+	}
+	q := msg.Questions[0]
+	network := "ip4"
+	switch q.Type {
+	case dnsmsg.TypeA:
+	case dnsmsg.TypeAAAA:
+		network = "ip6"
+	default:
+		return nil, fmt.Errorf("os resolver: cannot look up %s records, only A and AAAA", q.Type)
+	}
+	host := strings.TrimSuffix(q.Name, ".")
+	var addrs []netip.Addr
+	var err error
+	if t.Go {
+		addrs, err = (&net.Resolver{PreferGo: true}).LookupNetIP(ctx, network, host)
+	} else {
+		addrs, err = lookupLibc(ctx, network, host)
+	}
+	resp := *msg
+	resp.Response, resp.RecursionAvailable = true, true
+	resp.Answers = nil
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		resp.RCode = dnsmsg.RCodeNameError
+		return &resp, nil
+	case err != nil:
+		return nil, err
+	}
+	for _, a := range addrs {
+		a = a.Unmap()
+		if a.Is4() != (q.Type == dnsmsg.TypeA) {
+			continue
+		}
+		resp.Answers = append(resp.Answers, dnsmsg.Resource{Name: q.Name, Type: q.Type, Class: dnsmsg.ClassINET, Data: a.AsSlice()})
+	}
+	return &resp, nil
+}
@@ -0,0 +1,77 @@
+//go:build cgo && unix
+
+package transport
+
+/*
+#include <stdlib.h>
+#include <sys/types.h>
+#include <sys/socket.h>
+#include <netdb.h>
+#include <netinet/in.h>
+*/
+import "C"
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"unsafe"
+)
+
+func osLibrary() string { return "getaddrinfo" }
+
+// lookupLibc returns the addresses getaddrinfo finds for host. The call
+// cannot be interrupted, so when ctx is done first it is left to finish in
+// the background, as the net package does.
+func lookupLibc(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	type result struct {
+		addrs []netip.Addr
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		addrs, err := getaddrinfo(network, host)
+		done <- result{addrs, err}
+	}()
+	select {
+	case r := <-done:
+		return r.addrs, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func getaddrinfo(network, host string) ([]netip.Addr, error) {
+	var hints C.struct_addrinfo
+	hints.ai_family = C.AF_INET
+	if network == "ip6" {
+		hints.ai_family = C.AF_INET6
+	}
+	hints.ai_socktype = C.SOCK_STREAM
+	name := C.CString(host)
+	defer C.free(unsafe.Pointer(name))
+	var res *C.struct_addrinfo
+	if rc := C.getaddrinfo(name, nil, &hints, &res); rc != 0 {
+		err := &net.DNSError{Err: C.GoString(C.gai_strerror(rc)), Name: host}
+		switch rc {
+		case C.EAI_NONAME:
+			err.IsNotFound = true
+		case C.EAI_AGAIN:
+			err.IsTemporary = true
+		}
+		return nil, err
+	}
+	defer C.freeaddrinfo(res)
+	var out []netip.Addr
+	for ai := res; ai != nil; ai = ai.ai_next {
+		switch ai.ai_family {
+		case C.AF_INET:
+			sa := (*C.struct_sockaddr_in)(unsafe.Pointer(ai.ai_addr))
+			out = append(out, netip.AddrFrom4(*(*[4]byte)(unsafe.Pointer(&sa.sin_addr))))
+		case C.AF_INET6:
+			sa := (*C.struct_sockaddr_in6)(unsafe.Pointer(ai.ai_addr))
+			out = append(out, netip.AddrFrom16(*(*[16]byte)(unsafe.Pointer(&sa.sin6_addr))))
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,26 @@
+//go:build !(cgo && unix)
+
+package transport
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"runtime"
+)
+
+func osLibrary() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "GetAddrInfoW"
+	case "darwin":
+		return "getaddrinfo"
+	}
+	return "Go's resolver (built without cgo)"
+}
+
+// lookupLibc looks host up through the net package's default resolver,
+// which is the system's on Windows and macOS and Go's own elsewhere.
+func lookupLibc(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, network, host)
+}
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+)
+
+// Path selects the network path of queries, for comparing routes such as
+// inside and outside a VPN tunnel in one run. It applies to the sockets
+// transports open through DialContext, on Linux only.
+type Path struct {
+	Device string // interface to bind sockets to (SO_BINDTODEVICE), e.g. wg0
+	Mark   uint32 // routing mark (SO_MARK) for policy routing rules; zero for none
+}
+
+func (p Path) String() string {
+	switch {
+	case p.Device != "" && p.Mark != 0:
+		return fmt.Sprintf("%s mark:%#x", p.Device, p.Mark)
+	case p.Mark != 0:
+		return fmt.Sprintf("mark:%#x", p.Mark)
+	}
+	return p.Device
+}
+
+type pathKey struct{}
+
+// WithPath returns a context whose queries take path p.
+func WithPath(ctx context.Context, p Path) context.Context {
+	return context.WithValue(ctx, pathKey{}, p)
+}
+
+// contextPath returns the socket control function for the Path of ctx, or
+// nil without one.
+func contextPath(ctx context.Context) func(network, address string, c syscall.RawConn) error {
+	p, ok := ctx.Value(pathKey{}).(Path)
+	if !ok || p == (Path{}) {
+		return nil
+	}
+	return func(_, _ string, c syscall.RawConn) error {
+		var serr error
+		if err := c.Control(func(fd uintptr) { serr = setPath(fd, p) }); err != nil {
+			return err
+		}
+		if serr != nil {
+			return fmt.Errorf("transport: path %s: %w", p, serr)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,15 @@
+package transport
+
+import "syscall"
+
+func setPath(fd uintptr, p Path) error {
+	if p.Device != "" {
+		if err := syscall.BindToDevice(int(fd), p.Device); err != nil {
+			return err
+		}
+	}
+	if p.Mark != 0 {
+		return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, int(p.Mark))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package transport
+
+import "errors"
+
+func setPath(uintptr, Path) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// connPool keeps up to size stream connections to one server open for
+// reuse, as forwarders that hold persistent TCP or TLS connections do
+// (RFC 7766, section 6.2.1). Each connection carries one query at a time;
+// queries beyond size wait for one to become free.
+type connPool struct {
+	dial  func(ctx context.Context) (net.Conn, error)
+	open  chan struct{} // a token per open connection
+	idle  chan net.Conn
+	close sync.Mutex // serializes CloseIdleConnections
+}
+
+func newConnPool(size int, dial func(ctx context.Context) (net.Conn, error)) *connPool {
+	return &connPool{dial: dial, open: make(chan struct{}, size), idle: make(chan net.Conn, size)}
+}
+
+// get returns an idle connection and true, or a new one and false if fewer
+// than size are open, or waits for one to become idle.
+func (p *connPool) get(ctx context.Context) (net.Conn, bool, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, true, nil
+	default:
+	}
+	select {
+	case conn := <-p.idle:
+		return conn, true, nil
+	case p.open <- struct{}{}:
+		conn, err := p.dial(ctx)
+		if err != nil {
+			<-p.open
+			return nil, false, err
+		}
+		return conn, false, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// put returns conn to the pool after an answered query, or closes it after
+// a failed one: a late answer would be read by the next query.
+func (p *connPool) put(conn net.Conn, answered bool) {
+	if answered {
+		p.idle <- conn
+		return
+	}
+	conn.Close()
+	<-p.open
+}
+
+// exchange sends msg over a pooled connection. A reused connection the
+// server has closed while idle fails at once; the query is then sent again
+// over a new one, as forwarders do.
+func (p *connPool) exchange(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	for {
+		conn, reused, err := p.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ContextTrace(ctx).gotConn(reused)
+		resp, err := streamExchange(ctx, conn, msg)
+		p.put(conn, err == nil)
+		if err == nil || !reused || ctx.Err() != nil {
+			return resp, err
+		}
+	}
+}
+
+// closeIdle closes the idle connections.
+func (p *connPool) closeIdle() {
+	p.close.Lock()
+	defer p.close.Unlock()
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Close()
+			<-p.open
+		default:
+			return
+		}
+	}
+}
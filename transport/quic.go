@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("quic", func(addr string) (Transport, error) {
+		hostport := HostPort(addr, "853")
+		host, _, _ := net.SplitHostPort(hostport)
+		return &QUIC{Addr: hostport, Config: &tls.Config{ServerName: host}}, nil
+	})
+}
+
+// QUIC sends each query over a new DNS-over-QUIC connection (RFC 9250),
+// so every sample includes the QUIC handshake, as TLS without Pool
+// includes the TCP and TLS ones. Servers must offer an AES-GCM cipher
+// suite; see newQUICKeys.
+type QUIC struct {
+	Addr   string // host:port
+	Config *tls.Config
+
+	resolver *net.Resolver // a stamp's bootstrap resolver, if any
+}
+
+// SendQuery implements Transport.
+func (t *QUIC) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	q := *msg
+	q.ID = 0 // RFC 9250 section 4.2.1
+	wire, err := pack(ctx, &q)
+	if err != nil {
+		return nil, err
+	}
+	if t.resolver != nil {
+		ctx = withResolver(ctx, t.resolver)
+	}
+	conn, err := DialContext(ctx, "udp", t.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	cfg := t.Config.Clone()
+	cfg.NextProtos = []string{"doq"}
+	c, err := newQUICConn(ctx, conn, cfg)
+	if err != nil {
+		return nil, err
+	}
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(wire)), uint16(len(wire)))
+	buf, err := c.exchange(append(framed, wire...))
+	if err != nil {
+		return nil, err
+	}
+	Observe(ctx, conn.RemoteAddr(), conn.LocalAddr(), buf)
+	resp, err := unpack(ctx, buf)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ID != 0 {
+		return nil, errIDMismatch
+	}
+	ContextTrace(ctx).gotResponse(buf)
+	resp.ID = msg.ID
+	return resp, nil
+}
@@ -0,0 +1,476 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestQUICInitialKeys checks the Initial packet protection against RFC
+// 9001 appendix A.
+func TestQUICInitialKeys(t *testing.T) {
+	client, server, err := quicInitialKeys(unhex(t, "8394c8f03e515708"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name         string
+		keys         *quicKeys
+		iv           string
+		sample, mask string
+	}{
+		{"client", client, "fa044b2f42a3fd3b46fb255c", "d1b1c98dd7689fb8ec11d242b123dc9b", "437b9aec36"},
+		{"server", server, "0ac1493ca1905853b0bba03e", "2cd0991cd25b0aac406a5816b6394100", "2ec0d8356a"},
+	} {
+		if iv := unhex(t, tt.iv); !bytes.Equal(tt.keys.iv, iv) {
+			t.Errorf("%s iv = %x, want %x", tt.name, tt.keys.iv, iv)
+		}
+		mask := make([]byte, 16)
+		tt.keys.hp.Encrypt(mask, unhex(t, tt.sample))
+		if want := unhex(t, tt.mask); !bytes.Equal(mask[:5], want) {
+			t.Errorf("%s header protection mask = %x, want %x", tt.name, mask[:5], want)
+		}
+	}
+
+	// The server's Initial packet of appendix A.3.
+	pkt := unhex(t, `
+		cf000000010008f067a5502a4262b5004075c0d95a482cd0991cd25b0aac406a
+		5816b6394100f37a1c69797554780bb38cc5a99f5ede4cf73c3ec2493a1839b3
+		dbcba3f6ea46c5b7684df3548e7ddeb9c3bf9c73cc3f3bded74b562bfb19fb84
+		022f8ef4cdd93795d77d06edbb7aaf2f58891850abbdca3d20398c276456cbc4
+		2158407dd074ee`)
+	h, pkt, rest, err := parseQUICLongHeader(pkt)
+	if err != nil || h.typ != quicInitial || len(rest) != 0 {
+		t.Fatalf("parseQUICLongHeader = %+v, %d bytes left, %v", h, len(rest), err)
+	}
+	pn, payload, err := server.open(pkt, h.pnOffset, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unhex(t, `
+		02000000000600405a020000560303eefce7f7b37ba1d1632e96677825ddf73988
+		cfc79825df566dc5430b9a045a1200130100002e00330024001d00209d3c940d
+		89690b84d08a60993c144eca684d1081287c834d5311bcf32bb9da1a002b0002
+		0304`)
+	if pn != 1 || !bytes.Equal(payload, want) {
+		t.Errorf("server Initial = packet %d %x, want packet 1 %x", pn, payload, want)
+	}
+}
+
+func TestQUICRetryTag(t *testing.T) {
+	// RFC 9001 appendix A.4.
+	retry := unhex(t, "ff000000010008f067a5502a4262b5746f6b656e04a265ba2eff4d829058fb3f0f2496ba")
+	tag := quicRetryTag(unhex(t, "8394c8f03e515708"), retry[:len(retry)-16])
+	if want := retry[len(retry)-16:]; !bytes.Equal(tag, want) {
+		t.Errorf("retry tag = %x, want %x", tag, want)
+	}
+}
+
+func TestQUICDecodePN(t *testing.T) {
+	// RFC 9000 appendix A.3.
+	if got := quicDecodePN(0xa82f30ea, 0x9b32, 16); got != 0xa82f9b32 {
+		t.Errorf("quicDecodePN = %#x, want 0xa82f9b32", got)
+	}
+}
+
+func TestQUICExchange(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		retry bool
+		drop  int // datagrams from the client to lose
+	}{
+		{name: "handshake"},
+		{name: "retry", retry: true},
+		{name: "lost ClientHello", drop: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newQUICTestServer(t, tt.retry, tt.drop)
+			q := &QUIC{Addr: srv.addr, Config: srv.clientConfig}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			for range 2 {
+				msg := dnsmsg.NewQuery("example.com", dnsmsg.TypeA)
+				resp, err := q.SendQuery(ctx, msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !resp.Response || resp.ID != msg.ID || len(resp.Questions) != 1 || resp.Questions[0] != msg.Questions[0] {
+					t.Errorf("response = %+v, want the answer to %+v", resp, msg)
+				}
+			}
+			if err := srv.wait(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// quicTestServer answers DNS over QUIC queries on loopback, one
+// connection at a time, echoing each query as its response.
+type quicTestServer struct {
+	t            *testing.T
+	pc           net.PacketConn
+	addr         string
+	clientConfig *tls.Config
+	serverConfig *tls.Config
+	retry        bool
+	drop         int
+
+	mu  sync.Mutex
+	err error // the first error
+}
+
+func newQUICTestServer(t *testing.T, retry bool, drop int) *quicTestServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"doq.dnsbench.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	s := &quicTestServer{
+		t:            t,
+		pc:           pc,
+		addr:         pc.LocalAddr().String(),
+		clientConfig: &tls.Config{ServerName: "doq.dnsbench.test", RootCAs: roots},
+		serverConfig: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+			NextProtos:   []string{"doq"},
+			MinVersion:   tls.VersionTLS13,
+		},
+		retry: retry,
+		drop:  drop,
+	}
+	go s.serve()
+	return s
+}
+
+func (s *quicTestServer) wait() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *quicTestServer) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// quicTestConn is the server side of one connection.
+type quicTestConn struct {
+	peer             net.Addr
+	dcid, scid       []byte
+	tls              *tls.QUICConn
+	spaces           [quicSpaces]quicSpace
+	cryptoSent       [quicSpaces]int
+	stream           quicReassembly
+	query            []byte
+	out              [quicSpaces][]byte // frames to send
+	handshakeDoneDue bool
+}
+
+func (s *quicTestServer) serve() {
+	var c *quicTestConn
+	var retryODCID, retrySCID []byte
+	buf := make([]byte, 65535)
+	for {
+		n, peer, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if s.drop > 0 {
+			s.drop--
+			continue
+		}
+		b := buf[:n]
+		if b[0]&0x80 != 0 {
+			h, _, _, err := parseQUICLongHeader(b)
+			if err != nil {
+				s.fail(err)
+				continue
+			}
+			if h.typ == quicInitial && (c == nil || !bytes.Equal(h.dcid, c.scid)) {
+				if c != nil && bytes.Equal(h.scid, c.dcid) {
+					goto packets // a retransmission of the connection's first flight
+				}
+				odcid := h.dcid
+				if s.retry && len(h.token) == 0 {
+					if bytes.Equal(h.dcid, retryODCID) {
+						continue // the rest of the first flight, already answered
+					}
+					retryODCID, retrySCID = bytes.Clone(h.dcid), make([]byte, quicCIDLen)
+					rand.Read(retrySCID)
+					pkt := binary.BigEndian.AppendUint32([]byte{0xf0}, quicVersion1)
+					pkt = append(append(pkt, byte(len(h.scid))), h.scid...)
+					pkt = append(append(pkt, byte(len(retrySCID))), retrySCID...)
+					pkt = append(pkt, "token"...)
+					s.pc.WriteTo(append(pkt, quicRetryTag(retryODCID, pkt)...), peer)
+					continue
+				}
+				if s.retry {
+					if string(h.token) != "token" || !bytes.Equal(h.dcid, retrySCID) {
+						s.fail(fmt.Errorf("Initial after Retry has token %q, DCID %x", h.token, h.dcid))
+						continue
+					}
+					odcid = retryODCID
+				}
+				if c, err = s.accept(peer, h, odcid, retrySCID); err != nil {
+					s.fail(err)
+					return
+				}
+			}
+		}
+	packets:
+		if c == nil {
+			continue
+		}
+		if err := c.handleDatagram(b); err != nil {
+			s.fail(err)
+			return
+		}
+		if err := c.flush(s.pc); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+func (s *quicTestServer) accept(peer net.Addr, h quicLongHeader, odcid, retrySCID []byte) (*quicTestConn, error) {
+	c := &quicTestConn{peer: peer, dcid: bytes.Clone(h.scid), scid: make([]byte, quicCIDLen)}
+	rand.Read(c.scid)
+	for i := range c.spaces {
+		c.spaces[i].largest = -1
+	}
+	var err error
+	if c.spaces[quicSpaceInitial].open, c.spaces[quicSpaceInitial].seal, err = quicInitialKeys(h.dcid); err != nil {
+		return nil, err
+	}
+	var params []byte
+	add := func(id uint64, v []byte) {
+		params = appendVarint(params, id)
+		params = appendVarint(params, uint64(len(v)))
+		params = append(params, v...)
+	}
+	add(0x00, odcid)
+	add(0x04, appendVarint(nil, 1<<20))
+	add(0x06, appendVarint(nil, 1<<16))
+	add(0x08, appendVarint(nil, 1))
+	add(0x0f, c.scid)
+	if retrySCID != nil {
+		add(0x10, retrySCID)
+	}
+	c.tls = tls.QUICServer(&tls.QUICConfig{TLSConfig: s.serverConfig})
+	c.tls.SetTransportParameters(params)
+	return c, c.tls.Start(context.Background())
+}
+
+func (c *quicTestConn) handleDatagram(b []byte) error {
+	for len(b) > 0 {
+		space, pnOffset, pkt := quicSpaceApp, 1+len(c.scid), b
+		b = nil
+		if pkt[0]&0x80 != 0 {
+			var h quicLongHeader
+			var err error
+			if h, pkt, b, err = parseQUICLongHeader(pkt); err != nil {
+				return err
+			}
+			space, pnOffset = quicSpaceInitial, h.pnOffset
+			if h.typ == quicHandshake {
+				space = quicSpaceHandshake
+			}
+		}
+		sp := &c.spaces[space]
+		if sp.open == nil {
+			continue
+		}
+		pn, payload, err := sp.open.open(pkt, pnOffset, sp.largest)
+		if err != nil {
+			return fmt.Errorf("space %d: %w", space, err)
+		}
+		if !sp.receive(pn) {
+			continue
+		}
+		sp.largest = max(sp.largest, int64(pn))
+		if err := c.handleFrames(space, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *quicTestConn) handleFrames(space int, payload []byte) error {
+	sp := &c.spaces[space]
+	r := quicReader{b: payload}
+	for len(r.b) > 0 && r.err == nil {
+		switch typ := r.varint(); {
+		case typ == 0x00:
+		case typ == 0x01:
+			sp.ackNeeded = true
+		case typ == 0x02:
+			r.varint()
+			r.varint()
+			for range 2*r.varint() + 1 {
+				r.varint()
+			}
+		case typ == 0x06:
+			sp.ackNeeded = true
+			off := r.varint()
+			if data := sp.cryptoIn.push(off, r.bytes(r.varint())); len(data) > 0 && r.err == nil {
+				if err := c.tls.HandleData(quicLevels[space], data); err != nil {
+					return err
+				}
+			}
+		case typ >= 0x08 && typ <= 0x0f:
+			sp.ackNeeded = true
+			if id := r.varint(); id != 0 {
+				return fmt.Errorf("query on stream %d", id)
+			}
+			var off uint64
+			if typ&0x04 != 0 {
+				off = r.varint()
+			}
+			if typ&0x02 == 0 {
+				return errors.New("STREAM frame without length")
+			}
+			c.query = append(c.query, c.stream.push(off, r.bytes(r.varint()))...)
+			if len(c.query) >= 2 && len(c.query) == 2+int(binary.BigEndian.Uint16(c.query)) {
+				if err := c.answer(); err != nil {
+					return err
+				}
+			}
+		case typ == 0x1c, typ == 0x1d:
+			if code := r.varint(); typ == 0x1c || code != 0 {
+				return fmt.Errorf("client closed the connection with error %#x", code)
+			}
+			r.bytes(r.varint())
+		default:
+			return fmt.Errorf("unexpected frame type %#x", typ)
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return c.handleTLSEvents()
+}
+
+func (c *quicTestConn) answer() error {
+	msg, err := dnsmsg.Unpack(c.query[2:])
+	if err != nil {
+		return err
+	}
+	if msg.ID != 0 {
+		return fmt.Errorf("query ID = %d, want 0", msg.ID)
+	}
+	msg.Response = true
+	wire, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	frame := appendVarint([]byte{0x08 | 0x02 | 0x01, 0x00}, uint64(2+len(wire)))
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(wire)))
+	c.out[quicSpaceApp] = append(c.out[quicSpaceApp], append(frame, wire...)...)
+	return nil
+}
+
+func (c *quicTestConn) handleTLSEvents() error {
+	for {
+		e := c.tls.NextEvent()
+		space := quicSpaceOf(e.Level)
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			keys, err := newQUICKeys(e.Suite, e.Data)
+			if err != nil {
+				return err
+			}
+			if e.Kind == tls.QUICSetReadSecret {
+				c.spaces[space].open = keys
+			} else {
+				c.spaces[space].seal = keys
+			}
+		case tls.QUICWriteData:
+			c.spaces[space].cryptoOut = append(c.spaces[space].cryptoOut, e.Data...)
+		case tls.QUICHandshakeDone:
+			c.out[quicSpaceApp] = append(c.out[quicSpaceApp], 0x1e)
+		}
+	}
+}
+
+// flush sends the packets due in one datagram; loopback carries it whole.
+func (c *quicTestConn) flush(pc net.PacketConn) error {
+	var b []byte
+	for i := range c.spaces {
+		sp := &c.spaces[i]
+		payload := c.out[i]
+		c.out[i] = nil
+		if sp.ackNeeded {
+			payload = sp.appendAck(payload)
+			sp.ackNeeded = false
+		}
+		if data := sp.cryptoOut[c.cryptoSent[i]:]; len(data) > 0 {
+			payload = append(payload, 0x06)
+			payload = appendVarint(payload, uint64(c.cryptoSent[i]))
+			payload = appendVarint(payload, uint64(len(data)))
+			payload = append(payload, data...)
+			c.cryptoSent[i] = len(sp.cryptoOut)
+		}
+		if len(payload) == 0 || sp.seal == nil {
+			continue
+		}
+		typ := []byte{quicInitial, quicHandshake, quicOneRTT}[i]
+		b = appendQUICPacket(b, typ, c.dcid, c.scid, nil, sp.nextPN, payload, sp.seal)
+		sp.nextPN++
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	_, err := pc.WriteTo(b, c.peer)
+	return err
+}
@@ -0,0 +1,1125 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"os"
+	"time"
+)
+
+// This file implements the part of QUIC version 1 (RFC 9000, RFC 9001)
+// that DNS over QUIC needs: a client connection that completes the
+// handshake through crypto/tls, sends one query on one bidirectional
+// stream and reads the answer. It retransmits on probe timeouts but has
+// no congestion control, 0-RTT, connection migration or key updates,
+// which a connection that lives for one exchange does without.
+
+const (
+	quicVersion1    = 0x00000001
+	quicMaxDatagram = 1200 // the minimum every path must carry (RFC 9000 section 14)
+	quicCIDLen      = 8
+	quicMaxIdle     = 30 * time.Second
+	quicInitialPTO  = time.Second
+	quicMaxBuffered = 16 // packets held until their keys are known
+)
+
+// Long header packet types, and quicOneRTT for short header packets.
+const (
+	quicInitial   = 0x0
+	quicZeroRTT   = 0x1
+	quicHandshake = 0x2
+	quicRetry     = 0x3
+	quicOneRTT    = 0xff
+)
+
+// Packet number spaces (RFC 9000 section 12.3).
+const (
+	quicSpaceInitial = iota
+	quicSpaceHandshake
+	quicSpaceApp
+	quicSpaces
+)
+
+var (
+	quicInitialSalt = []byte{
+		0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+	}
+	quicRetryKey   = []byte{0xbe, 0x0c, 0x69, 0x0b, 0x9f, 0x66, 0x57, 0x5a, 0x1d, 0x76, 0x6b, 0x54, 0xe3, 0x68, 0xc8, 0x4e}
+	quicRetryNonce = []byte{0x46, 0x15, 0x99, 0xd3, 0x5d, 0x63, 0x2b, 0xf2, 0x23, 0x98, 0x25, 0xbb}
+
+	errQUICMalformed = errors.New("transport: malformed QUIC packet")
+)
+
+// quicKeys protect the packets of one direction at one encryption level
+// (RFC 9001 section 5).
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// newQUICKeys derives the packet protection keys from a TLS traffic
+// secret. ChaCha20-Poly1305 is not supported: the standard library does
+// not export ChaCha20 for header protection.
+func newQUICKeys(suite uint16, secret []byte) (*quicKeys, error) {
+	var h func() hash.Hash
+	var keyLen int
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		h, keyLen = sha256.New, 16
+	case tls.TLS_AES_256_GCM_SHA384:
+		h, keyLen = sha512.New384, 32
+	default:
+		return nil, fmt.Errorf("transport: QUIC with cipher suite %s is not supported", tls.CipherSuiteName(suite))
+	}
+	key, err := hkdfExpandLabel(h, secret, "quic key", keyLen)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hkdfExpandLabel(h, secret, "quic iv", 12)
+	if err != nil {
+		return nil, err
+	}
+	hpKey, err := hkdfExpandLabel(h, secret, "quic hp", keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return nil, err
+	}
+	return &quicKeys{aead: aead, iv: iv, hp: hp}, nil
+}
+
+// quicInitialKeys derives the Initial keys of both directions from the
+// client's first destination connection ID (RFC 9001 section 5.2).
+func quicInitialKeys(dcid []byte) (client, server *quicKeys, err error) {
+	initial, err := hkdf.Extract(sha256.New, dcid, quicInitialSalt)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, k := range []struct {
+		label string
+		keys  **quicKeys
+	}{{"client in", &client}, {"server in", &server}} {
+		secret, err := hkdfExpandLabel(sha256.New, initial, k.label, sha256.Size)
+		if err != nil {
+			return nil, nil, err
+		}
+		if *k.keys, err = newQUICKeys(tls.TLS_AES_128_GCM_SHA256, secret); err != nil {
+			return nil, nil, err
+		}
+	}
+	return client, server, nil
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label of TLS 1.3 (RFC 8446 section 7.1)
+// with an empty context.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) ([]byte, error) {
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len("tls13 ")+len(label)))
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0)
+	return hkdf.Expand(h, secret, string(info), length)
+}
+
+func (k *quicKeys) nonce(pn uint64) []byte {
+	n := bytes.Clone(k.iv)
+	for i := 0; i < 8; i++ {
+		n[len(n)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return n
+}
+
+// mask returns the header protection mask for the packet whose packet
+// number starts at pnOffset.
+func (k *quicKeys) mask(pkt []byte, pnOffset int) ([]byte, error) {
+	if len(pkt) < pnOffset+4+aes.BlockSize {
+		return nil, errQUICMalformed
+	}
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, pkt[pnOffset+4:pnOffset+4+aes.BlockSize])
+	return mask, nil
+}
+
+// seal encrypts payload after header, which ends with the pnLen-byte
+// packet number pn, and applies header protection.
+func (k *quicKeys) seal(header []byte, pn uint64, pnLen int, payload []byte) []byte {
+	pkt := make([]byte, len(header), len(header)+len(payload)+k.aead.Overhead())
+	copy(pkt, header)
+	pkt = k.aead.Seal(pkt, k.nonce(pn), payload, header)
+	pnOffset := len(header) - pnLen
+	mask, _ := k.mask(pkt, pnOffset) // the tag alone covers the sample when pnLen is 4
+	if pkt[0]&0x80 != 0 {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+	}
+	return pkt
+}
+
+// open removes the protection of pkt, in place, decoding its packet number
+// against largest, the largest one received in its space so far.
+func (k *quicKeys) open(pkt []byte, pnOffset int, largest int64) (pn uint64, payload []byte, err error) {
+	mask, err := k.mask(pkt, pnOffset)
+	if err != nil {
+		return 0, nil, err
+	}
+	if pkt[0]&0x80 != 0 {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	pnLen := int(pkt[0]&0x03) + 1
+	var truncated uint64
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(pkt[pnOffset+i])
+	}
+	pn = quicDecodePN(largest, truncated, 8*pnLen)
+	body := pkt[pnOffset+pnLen:]
+	payload, err = k.aead.Open(body[:0], k.nonce(pn), body, pkt[:pnOffset+pnLen])
+	return pn, payload, err
+}
+
+// quicDecodePN recovers a full packet number (RFC 9000 appendix A.3).
+func quicDecodePN(largest int64, truncated uint64, bits int) uint64 {
+	expected := uint64(largest + 1)
+	win := uint64(1) << bits
+	hwin := win / 2
+	candidate := expected&^(win-1) | truncated
+	switch {
+	case candidate+hwin <= expected && candidate < 1<<62-win:
+		return candidate + win
+	case candidate > expected+hwin && candidate >= win:
+		return candidate - win
+	}
+	return candidate
+}
+
+// appendQUICPacket appends the packet of type typ (quicOneRTT for a short
+// header) carrying payload, with a 4-byte packet number, protected with k.
+func appendQUICPacket(b []byte, typ byte, dcid, scid, token []byte, pn uint64, payload []byte, k *quicKeys) []byte {
+	var hdr []byte
+	if typ == quicOneRTT {
+		hdr = append([]byte{0x40 | 0x03}, dcid...)
+	} else {
+		hdr = binary.BigEndian.AppendUint32([]byte{0xc0 | typ<<4 | 0x03}, quicVersion1)
+		hdr = append(hdr, byte(len(dcid)))
+		hdr = append(hdr, dcid...)
+		hdr = append(hdr, byte(len(scid)))
+		hdr = append(hdr, scid...)
+		if typ == quicInitial {
+			hdr = appendVarint(hdr, uint64(len(token)))
+			hdr = append(hdr, token...)
+		}
+		// Always two bytes, so that quicOverhead is exact.
+		hdr = binary.BigEndian.AppendUint16(hdr, 0x4000|uint16(4+len(payload)+k.aead.Overhead()))
+	}
+	hdr = binary.BigEndian.AppendUint32(hdr, uint32(pn))
+	return append(b, k.seal(hdr, pn, 4, payload)...)
+}
+
+// quicOverhead returns the bytes appendQUICPacket adds to a payload.
+func quicOverhead(typ byte, dcid, scid, token []byte) int {
+	n := 1 + len(dcid) + 4 + 16
+	if typ != quicOneRTT {
+		n += 4 + 1 + 1 + len(scid) + 2
+		if typ == quicInitial {
+			n += len(appendVarint(nil, uint64(len(token)))) + len(token)
+		}
+	}
+	return n
+}
+
+// quicLongHeader is the unprotected part of a long header packet.
+type quicLongHeader struct {
+	typ        byte
+	version    uint32
+	dcid, scid []byte
+	token      []byte // of Initial and Retry packets
+	pnOffset   int
+}
+
+// parseQUICLongHeader parses the long header packet at the start of b,
+// returning it and the packets coalesced after it. A Retry or Version
+// Negotiation packet takes up the whole datagram.
+func parseQUICLongHeader(b []byte) (h quicLongHeader, pkt, rest []byte, err error) {
+	r := quicReader{b: b[1:]}
+	h.typ = b[0] >> 4 & 0x03
+	h.version = binary.BigEndian.Uint32(r.bytes(4))
+	h.dcid = r.bytes(uint64(r.byte()))
+	h.scid = r.bytes(uint64(r.byte()))
+	if r.err != nil {
+		return h, nil, nil, r.err
+	}
+	if h.version == 0 {
+		return h, b, nil, nil
+	}
+	if h.typ == quicRetry {
+		if len(r.b) < 16 {
+			return h, nil, nil, errQUICMalformed
+		}
+		h.token = r.b[:len(r.b)-16]
+		return h, b, nil, nil
+	}
+	if h.typ == quicInitial {
+		h.token = r.bytes(r.varint())
+	}
+	length := r.varint()
+	if r.err != nil || length > uint64(len(r.b)) {
+		return h, nil, nil, errQUICMalformed
+	}
+	h.pnOffset = len(b) - len(r.b)
+	end := h.pnOffset + int(length)
+	return h, b[:end], b[end:], nil
+}
+
+// quicRetryTag computes the integrity tag of a Retry packet without its tag
+// (RFC 9001 section 5.8).
+func quicRetryTag(odcid, retry []byte) []byte {
+	block, _ := aes.NewCipher(quicRetryKey)
+	aead, _ := cipher.NewGCM(block)
+	pseudo := append([]byte{byte(len(odcid))}, odcid...)
+	pseudo = append(pseudo, retry...)
+	return aead.Seal(nil, quicRetryNonce, nil, pseudo)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return binary.BigEndian.AppendUint16(b, 0x4000|uint16(v))
+	case v < 1<<30:
+		return binary.BigEndian.AppendUint32(b, 0x80000000|uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(b, 0xc000000000000000|v)
+}
+
+// quicReader reads the fields of QUIC packets, frames and transport
+// parameters, keeping the first error.
+type quicReader struct {
+	b   []byte
+	err error
+}
+
+func (r *quicReader) bytes(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.b)) {
+		r.err = errQUICMalformed
+		return make([]byte, min(n, 8))
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *quicReader) byte() byte {
+	return r.bytes(1)[0]
+}
+
+func (r *quicReader) varint() uint64 {
+	if r.err != nil || len(r.b) == 0 {
+		r.err = errQUICMalformed
+		return 0
+	}
+	b := r.bytes(1 << (r.b[0] >> 6))
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// quicReassembly puts the data of a stream, or of the CRYPTO frames of an
+// encryption level, back in order.
+type quicReassembly struct {
+	offset  uint64            // of the first byte not yet delivered
+	pending map[uint64][]byte // received ahead of offset
+}
+
+// push adds data received at off and returns the bytes that now follow
+// the ones delivered before.
+func (a *quicReassembly) push(off uint64, data []byte) []byte {
+	if a.pending == nil {
+		a.pending = make(map[uint64][]byte)
+	}
+	if off > a.offset {
+		if len(data) > len(a.pending[off]) {
+			a.pending[off] = bytes.Clone(data)
+		}
+		return nil
+	}
+	var out []byte
+	if end := off + uint64(len(data)); end > a.offset {
+		out = append(out, data[a.offset-off:]...)
+		a.offset = end
+	}
+	for progress := true; progress; {
+		progress = false
+		for o, d := range a.pending {
+			if o > a.offset {
+				continue
+			}
+			delete(a.pending, o)
+			if end := o + uint64(len(d)); end > a.offset {
+				out = append(out, d[a.offset-o:]...)
+				a.offset = end
+			}
+			progress = true
+		}
+	}
+	return out
+}
+
+// quicRange is a range of packet numbers, both ends included.
+type quicRange struct{ lo, hi uint64 }
+
+// quicChunk is data to send in a CRYPTO or STREAM frame, and to send again
+// if the packet carrying it is lost.
+type quicChunk struct {
+	stream      bool
+	offset, len uint64
+}
+
+type quicSent struct {
+	at     time.Time
+	chunks []quicChunk
+}
+
+// quicSpace is the state of one packet number space.
+type quicSpace struct {
+	seal, open *quicKeys
+	discarded  bool
+
+	nextPN    uint64
+	largest   int64       // largest packet number received, -1 for none
+	received  []quicRange // descending, for ACK frames
+	ackNeeded bool
+	ping      bool
+
+	cryptoIn   quicReassembly
+	cryptoOut  []byte // all handshake data written at this level
+	cryptoSent uint64
+	inFlight   map[uint64]quicSent
+	lost       []quicChunk
+	buffered   []quicBuffered
+}
+
+type quicBuffered struct {
+	pkt      []byte
+	pnOffset int
+}
+
+// receive records packet number pn, reporting false for a duplicate.
+func (s *quicSpace) receive(pn uint64) bool {
+	for i, r := range s.received {
+		switch {
+		case pn >= r.lo && pn <= r.hi:
+			return false
+		case pn == r.hi+1:
+			s.received[i].hi = pn
+			if i > 0 && s.received[i-1].lo == pn+1 {
+				s.received[i-1].lo = r.lo
+				s.received = append(s.received[:i], s.received[i+1:]...)
+			}
+		case pn+1 == r.lo:
+			s.received[i].lo = pn
+		case pn < r.lo:
+			continue
+		default:
+			s.received = append(s.received[:i], append([]quicRange{{pn, pn}}, s.received[i:]...)...)
+		}
+		return true
+	}
+	s.received = append(s.received, quicRange{pn, pn})
+	return true
+}
+
+// appendAck appends an ACK frame for the packets received.
+func (s *quicSpace) appendAck(b []byte) []byte {
+	ranges := s.received[:min(len(s.received), 32)]
+	b = append(b, 0x02)
+	b = appendVarint(b, ranges[0].hi)
+	b = appendVarint(b, 0) // ACK Delay
+	b = appendVarint(b, uint64(len(ranges)-1))
+	b = appendVarint(b, ranges[0].hi-ranges[0].lo)
+	for i, r := range ranges[1:] {
+		b = appendVarint(b, ranges[i].lo-r.hi-2)
+		b = appendVarint(b, r.hi-r.lo)
+	}
+	return b
+}
+
+// quicConn is a client connection for one DNS over QUIC exchange.
+type quicConn struct {
+	ctx  context.Context
+	conn net.Conn
+	tls  *tls.QUICConn
+
+	origDCID, dcid, scid []byte
+	serverSCID           []byte // of the server's first Initial packet
+	retrySCID, token     []byte
+	spaces               [quicSpaces]quicSpace
+
+	pto time.Duration
+
+	query     []byte // the length-prefixed DNS query
+	querySent uint64
+	wrote     bool
+	answer    []byte // the length-prefixed response, as far as received
+	streamIn  quicReassembly
+	streamEnd uint64 // the final size of the response stream, once known
+	fin       bool
+	closeDue  bool
+}
+
+func newQUICConn(ctx context.Context, conn net.Conn, config *tls.Config) (*quicConn, error) {
+	c := &quicConn{ctx: ctx, conn: conn, pto: quicInitialPTO}
+	c.origDCID = make([]byte, quicCIDLen)
+	c.scid = make([]byte, quicCIDLen)
+	rand.Read(c.origDCID)
+	rand.Read(c.scid)
+	c.dcid = c.origDCID
+	for i := range c.spaces {
+		c.spaces[i].largest = -1
+		c.spaces[i].inFlight = make(map[uint64]quicSent)
+	}
+	var err error
+	if c.spaces[quicSpaceInitial].seal, c.spaces[quicSpaceInitial].open, err = quicInitialKeys(c.dcid); err != nil {
+		return nil, err
+	}
+	cfg := config.Clone()
+	cfg.MinVersion = tls.VersionTLS13
+	c.tls = tls.QUICClient(&tls.QUICConfig{TLSConfig: cfg})
+	c.tls.SetTransportParameters(c.transportParameters())
+	return c, nil
+}
+
+// transportParameters returns the client's transport parameters (RFC 9000
+// section 18.2): enough flow control credit for one response, and no
+// streams for the server to open.
+func (c *quicConn) transportParameters() []byte {
+	var b []byte
+	add := func(id uint64, v []byte) {
+		b = appendVarint(b, id)
+		b = appendVarint(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+	add(0x01, appendVarint(nil, uint64(quicMaxIdle.Milliseconds()))) // max_idle_timeout
+	add(0x04, appendVarint(nil, 1<<20))                              // initial_max_data
+	add(0x05, appendVarint(nil, 1<<18))                              // initial_max_stream_data_bidi_local
+	add(0x0f, c.scid)                                                // initial_source_connection_id
+	return b
+}
+
+// checkTransportParameters validates the connection IDs the server echoes
+// (RFC 9000 section 7.3) and that it lets the query be sent.
+func (c *quicConn) checkTransportParameters(b []byte) error {
+	r := quicReader{b: b}
+	var odcid, iscid, rscid []byte
+	var maxData, maxStreamData, maxStreams uint64
+	for len(r.b) > 0 && r.err == nil {
+		id := r.varint()
+		v := quicReader{b: r.bytes(r.varint())}
+		switch id {
+		case 0x00:
+			odcid = v.b
+		case 0x04:
+			maxData = v.varint()
+		case 0x06:
+			maxStreamData = v.varint() // initial_max_stream_data_bidi_remote
+		case 0x08:
+			maxStreams = v.varint() // initial_max_streams_bidi
+		case 0x0f:
+			iscid = v.b
+		case 0x10:
+			rscid = v.b
+		}
+		if v.err != nil {
+			r.err = v.err
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("transport: QUIC transport parameters: %w", r.err)
+	}
+	if !bytes.Equal(odcid, c.origDCID) || !bytes.Equal(iscid, c.serverSCID) || !bytes.Equal(rscid, c.retrySCID) {
+		return errors.New("transport: QUIC server's transport parameters do not match its connection IDs")
+	}
+	if need := uint64(len(c.query)); maxStreams == 0 || maxStreamData < need || maxData < need {
+		return fmt.Errorf("transport: QUIC server does not accept a %d-byte query stream", need)
+	}
+	return nil
+}
+
+// exchange sends query, a length-prefixed DNS message, on the first
+// bidirectional stream and returns the response without its prefix.
+func (c *quicConn) exchange(query []byte) ([]byte, error) {
+	defer c.tls.Close()
+	c.query = query
+	if err := c.tls.Start(c.ctx); err != nil {
+		return nil, err
+	}
+	if err := c.progress(); err != nil {
+		return nil, err
+	}
+	dl, _ := c.ctx.Deadline()
+	buf := make([]byte, 65535)
+	for {
+		wait := time.Now().Add(c.pto)
+		if !dl.IsZero() && dl.Before(wait) {
+			wait = dl
+		}
+		_ = c.conn.SetReadDeadline(wait)
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) && (dl.IsZero() || time.Now().Before(dl)) {
+				c.probeTimeout()
+				if err := c.flush(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+		if err := c.handleDatagram(buf[:n]); err != nil {
+			return nil, err
+		}
+		if err := c.progress(); err != nil {
+			return nil, err
+		}
+		if resp, ok := c.response(); ok {
+			ContextTrace(c.ctx).readDone()
+			c.closeDue = true
+			_ = c.flush()
+			return resp, nil
+		}
+	}
+}
+
+// response returns the response once it has been received in full.
+func (c *quicConn) response() ([]byte, bool) {
+	if len(c.answer) < 2 {
+		return nil, false
+	}
+	n := 2 + int(binary.BigEndian.Uint16(c.answer))
+	if len(c.answer) < n {
+		return nil, false
+	}
+	return c.answer[2:n], true
+}
+
+// progress handles the events of the TLS handshake, the packets held for
+// the keys it installs, and sends what there is to send.
+func (c *quicConn) progress() error {
+	for {
+		if err := c.handleTLSEvents(); err != nil {
+			return err
+		}
+		held := false
+		for i := range c.spaces {
+			s := &c.spaces[i]
+			if s.open == nil || len(s.buffered) == 0 {
+				continue
+			}
+			pkts := s.buffered
+			s.buffered = nil
+			for _, p := range pkts {
+				if err := c.handlePacket(i, p.pkt, p.pnOffset); err != nil {
+					return err
+				}
+			}
+			held = true
+		}
+		if !held {
+			return c.flush()
+		}
+	}
+}
+
+func (c *quicConn) handleTLSEvents() error {
+	for {
+		e := c.tls.NextEvent()
+		space := quicSpaceOf(e.Level)
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			if space < 0 {
+				continue // 0-RTT, which the client does not use
+			}
+			keys, err := newQUICKeys(e.Suite, e.Data)
+			if err != nil {
+				return err
+			}
+			if e.Kind == tls.QUICSetReadSecret {
+				c.spaces[space].open = keys
+			} else {
+				c.spaces[space].seal = keys
+			}
+		case tls.QUICWriteData:
+			c.spaces[space].cryptoOut = append(c.spaces[space].cryptoOut, e.Data...)
+		case tls.QUICTransportParameters:
+			if err := c.checkTransportParameters(e.Data); err != nil {
+				return err
+			}
+		case tls.QUICTransportParametersRequired:
+			c.tls.SetTransportParameters(c.transportParameters())
+		}
+	}
+}
+
+func quicSpaceOf(level tls.QUICEncryptionLevel) int {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return quicSpaceInitial
+	case tls.QUICEncryptionLevelHandshake:
+		return quicSpaceHandshake
+	case tls.QUICEncryptionLevelApplication:
+		return quicSpaceApp
+	}
+	return -1
+}
+
+var quicLevels = [quicSpaces]tls.QUICEncryptionLevel{
+	tls.QUICEncryptionLevelInitial, tls.QUICEncryptionLevelHandshake, tls.QUICEncryptionLevelApplication,
+}
+
+// handleDatagram processes the packets coalesced in a datagram. Packets
+// that cannot be authenticated or are not for this connection are
+// dropped, as RFC 9000 requires.
+func (c *quicConn) handleDatagram(b []byte) error {
+	for len(b) > 0 {
+		if b[0]&0x80 == 0 {
+			if len(b) < 1+len(c.scid) || !bytes.Equal(b[1:1+len(c.scid)], c.scid) {
+				return nil
+			}
+			return c.handlePacket(quicSpaceApp, b, 1+len(c.scid))
+		}
+		h, pkt, rest, err := parseQUICLongHeader(b)
+		if err != nil || !bytes.Equal(h.dcid, c.scid) {
+			return nil
+		}
+		b = rest
+		switch {
+		case h.version == 0:
+			if c.serverSCID == nil && c.retrySCID == nil {
+				return errors.New("transport: QUIC server does not support version 1")
+			}
+			return nil
+		case h.version != quicVersion1:
+			return nil
+		case h.typ == quicRetry:
+			c.handleRetry(h, pkt)
+			return nil
+		case h.typ == quicInitial || h.typ == quicHandshake:
+			space := quicSpaceInitial
+			if h.typ == quicHandshake {
+				space = quicSpaceHandshake
+			}
+			if c.serverSCID != nil && !bytes.Equal(h.scid, c.serverSCID) {
+				continue
+			}
+			if err := c.handlePacket(space, pkt, h.pnOffset); err != nil {
+				return err
+			}
+			if c.serverSCID == nil && c.spaces[space].largest >= 0 {
+				// Authenticated: use the server's connection ID from now on.
+				c.serverSCID = bytes.Clone(h.scid)
+				c.dcid = c.serverSCID
+			}
+		}
+	}
+	return nil
+}
+
+// handleRetry starts over with the token and connection ID of a valid
+// Retry packet (RFC 9000 section 17.2.5).
+func (c *quicConn) handleRetry(h quicLongHeader, pkt []byte) {
+	tag := quicRetryTag(c.origDCID, pkt[:len(pkt)-16])
+	if c.serverSCID != nil || c.retrySCID != nil || len(h.token) == 0 || !bytes.Equal(tag, pkt[len(pkt)-16:]) {
+		return
+	}
+	c.retrySCID = bytes.Clone(h.scid)
+	c.dcid = c.retrySCID
+	c.token = bytes.Clone(h.token)
+	s := &c.spaces[quicSpaceInitial]
+	s.seal, s.open, _ = quicInitialKeys(c.dcid)
+	clear(s.inFlight)
+	s.lost = nil
+	s.cryptoSent = 0
+}
+
+// handlePacket decrypts a packet of the given space and handles its frames.
+func (c *quicConn) handlePacket(space int, pkt []byte, pnOffset int) error {
+	s := &c.spaces[space]
+	if s.discarded {
+		return nil
+	}
+	if s.open == nil {
+		if len(s.buffered) < quicMaxBuffered {
+			s.buffered = append(s.buffered, quicBuffered{bytes.Clone(pkt), pnOffset})
+		}
+		return nil
+	}
+	pn, payload, err := s.open.open(pkt, pnOffset, s.largest)
+	if err != nil || !s.receive(pn) {
+		return nil
+	}
+	s.largest = max(s.largest, int64(pn))
+	return c.handleFrames(space, payload)
+}
+
+// handleFrames handles the frames of a packet (RFC 9000 section 19).
+func (c *quicConn) handleFrames(space int, payload []byte) error {
+	s := &c.spaces[space]
+	r := quicReader{b: payload}
+	for len(r.b) > 0 && r.err == nil {
+		typ := r.varint()
+		switch typ {
+		case 0x00, 0x02, 0x03, 0x1c, 0x1d:
+		default:
+			s.ackNeeded = true
+		}
+		switch {
+		case typ == 0x00, typ == 0x01: // PADDING, PING
+		case typ == 0x02, typ == 0x03: // ACK
+			largest, _, count := r.varint(), r.varint(), r.varint()
+			first := r.varint()
+			if first > largest {
+				return errQUICMalformed
+			}
+			hi, lo := largest, largest-first
+			c.acked(space, largest, lo, hi)
+			for range count {
+				gap, n := r.varint(), r.varint()
+				if gap+2+n > lo {
+					return errQUICMalformed
+				}
+				hi = lo - gap - 2
+				lo = hi - n
+				c.acked(space, largest, lo, hi)
+			}
+			if typ == 0x03 {
+				r.varint()
+				r.varint()
+				r.varint()
+			}
+		case typ == 0x04: // RESET_STREAM
+			id, code := r.varint(), r.varint()
+			r.varint()
+			if id == 0 && r.err == nil {
+				return fmt.Errorf("transport: DoQ server reset the query stream with error %#x", code)
+			}
+		case typ == 0x05: // STOP_SENDING
+			r.varint()
+			r.varint()
+		case typ == 0x06: // CRYPTO
+			off := r.varint()
+			data := r.bytes(r.varint())
+			if r.err != nil {
+				break
+			}
+			if data := s.cryptoIn.push(off, data); len(data) > 0 {
+				if err := c.tls.HandleData(quicLevels[space], data); err != nil {
+					return err
+				}
+			}
+		case typ == 0x07: // NEW_TOKEN
+			r.bytes(r.varint())
+		case typ >= 0x08 && typ <= 0x0f: // STREAM
+			id := r.varint()
+			var off uint64
+			if typ&0x04 != 0 {
+				off = r.varint()
+			}
+			var data []byte
+			if typ&0x02 != 0 {
+				data = r.bytes(r.varint())
+			} else {
+				data, r.b = r.b, nil
+			}
+			if id != 0 || r.err != nil {
+				break
+			}
+			if typ&0x01 != 0 {
+				c.streamEnd, c.fin = off+uint64(len(data)), true
+			}
+			if data := c.streamIn.push(off, data); len(data) > 0 {
+				if len(c.answer) == 0 {
+					ContextTrace(c.ctx).gotFirstResponseByte()
+				}
+				c.answer = append(c.answer, data...)
+			}
+			if _, ok := c.response(); !ok && c.fin && c.streamIn.offset >= c.streamEnd {
+				return errors.New("transport: DoQ server ended the stream before the whole response")
+			}
+		case typ == 0x10, typ == 0x12, typ == 0x13, typ == 0x14, typ == 0x16, typ == 0x17, typ == 0x19:
+			r.varint()
+		case typ == 0x11, typ == 0x15:
+			r.varint()
+			r.varint()
+		case typ == 0x18: // NEW_CONNECTION_ID
+			r.varint()
+			r.varint()
+			r.bytes(uint64(r.byte()))
+			r.bytes(16)
+		case typ == 0x1a, typ == 0x1b: // PATH_CHALLENGE, PATH_RESPONSE
+			r.bytes(8)
+		case typ == 0x1c, typ == 0x1d: // CONNECTION_CLOSE
+			code := r.varint()
+			if typ == 0x1c {
+				r.varint()
+			}
+			reason := r.bytes(r.varint())
+			if r.err != nil {
+				break
+			}
+			return fmt.Errorf("transport: QUIC server closed the connection with error %#x %q", code, reason)
+		case typ == 0x1e: // HANDSHAKE_DONE
+			c.discard(quicSpaceHandshake)
+		default:
+			return fmt.Errorf("transport: unexpected QUIC frame type %#x", typ)
+		}
+	}
+	return r.err
+}
+
+// acked handles a range of packet numbers acknowledged in space, largest
+// being the largest the ACK frame covers.
+func (c *quicConn) acked(space int, largest, lo, hi uint64) {
+	s := &c.spaces[space]
+	for pn, sent := range s.inFlight {
+		if pn < lo || pn > hi {
+			continue
+		}
+		if pn == largest {
+			// The RTT sample sets the probe timeout as RFC 9002 section
+			// 6.2.1 does for a first sample, with its default max_ack_delay.
+			c.pto = 3*time.Since(sent.at) + 25*time.Millisecond
+		}
+		delete(s.inFlight, pn)
+	}
+}
+
+// discard drops the keys and state of space (RFC 9001 section 4.9).
+func (c *quicConn) discard(space int) {
+	s := &c.spaces[space]
+	s.discarded = true
+	s.seal, s.open = nil, nil
+	clear(s.inFlight)
+	s.lost, s.buffered = nil, nil
+	s.ackNeeded, s.ping = false, false
+}
+
+// probeTimeout marks what is in flight as lost, so that flush sends it
+// again, or else asks for a PING, and backs off (RFC 9002 section 6.2).
+func (c *quicConn) probeTimeout() {
+	resend := false
+	for i := range c.spaces {
+		s := &c.spaces[i]
+		for pn, sent := range s.inFlight {
+			s.lost = append(s.lost, sent.chunks...)
+			delete(s.inFlight, pn)
+			resend = true
+		}
+	}
+	if !resend {
+		for i := quicSpaceApp; i >= 0; i-- {
+			if s := &c.spaces[i]; s.seal != nil && !s.discarded {
+				s.ping = true
+				break
+			}
+		}
+	}
+	c.pto *= 2
+}
+
+// quicPacket is a packet being assembled by flush.
+type quicPacket struct {
+	space     int
+	payload   []byte
+	chunks    []quicChunk
+	eliciting bool
+}
+
+// flush sends the acknowledgments, handshake data, query and close that
+// are due, coalescing packets into datagrams. Datagrams carrying an
+// Initial packet are padded to quicMaxDatagram (RFC 9000 section 14.1).
+func (c *quicConn) flush() error {
+	var dgram []quicPacket
+	size := 0
+	for space := range c.spaces {
+		for {
+			overhead := quicOverhead(c.packetType(space), c.dcid, c.scid, c.token)
+			if quicMaxDatagram-size-overhead < 64 {
+				if err := c.send(dgram); err != nil {
+					return err
+				}
+				dgram, size = nil, 0
+			}
+			p, ok := c.nextPacket(space, quicMaxDatagram-size-overhead)
+			if !ok {
+				break
+			}
+			dgram = append(dgram, p)
+			size += overhead + len(p.payload)
+		}
+	}
+	return c.send(dgram)
+}
+
+func (c *quicConn) packetType(space int) byte {
+	switch space {
+	case quicSpaceInitial:
+		return quicInitial
+	case quicSpaceHandshake:
+		return quicHandshake
+	}
+	return quicOneRTT
+}
+
+// nextPacket assembles the frames due in space, up to room bytes.
+func (c *quicConn) nextPacket(space, room int) (quicPacket, bool) {
+	s := &c.spaces[space]
+	p := quicPacket{space: space}
+	if s.seal == nil || s.discarded {
+		return p, false
+	}
+	if s.ackNeeded && len(s.received) > 0 {
+		p.payload = s.appendAck(p.payload)
+		s.ackNeeded = false
+	}
+	// Room for the largest CRYPTO or STREAM frame header.
+	const frameHeader = 1 + 1 + 8 + 2
+	add := func(ch quicChunk) quicChunk {
+		n := min(ch.len, uint64(max(room-len(p.payload)-frameHeader, 0)))
+		if n == 0 {
+			return ch
+		}
+		part := quicChunk{ch.stream, ch.offset, n}
+		if ch.stream {
+			typ := byte(0x08 | 0x02)
+			if part.offset > 0 {
+				typ |= 0x04
+			}
+			if part.offset+n == uint64(len(c.query)) {
+				typ |= 0x01 // FIN: one query per stream (RFC 9250 section 4.2)
+			}
+			p.payload = append(p.payload, typ, 0x00)
+			if part.offset > 0 {
+				p.payload = appendVarint(p.payload, part.offset)
+			}
+			p.payload = appendVarint(p.payload, n)
+			p.payload = append(p.payload, c.query[part.offset:part.offset+n]...)
+		} else {
+			p.payload = append(p.payload, 0x06)
+			p.payload = appendVarint(p.payload, part.offset)
+			p.payload = appendVarint(p.payload, n)
+			p.payload = append(p.payload, s.cryptoOut[part.offset:part.offset+n]...)
+		}
+		p.chunks = append(p.chunks, part)
+		p.eliciting = true
+		return quicChunk{ch.stream, ch.offset + n, ch.len - n}
+	}
+	for len(s.lost) > 0 {
+		if rest := add(s.lost[0]); rest.len > 0 {
+			s.lost[0] = rest
+			break
+		}
+		s.lost = s.lost[1:]
+	}
+	if n := uint64(len(s.cryptoOut)) - s.cryptoSent; n > 0 {
+		rest := add(quicChunk{offset: s.cryptoSent, len: n})
+		s.cryptoSent = rest.offset
+	}
+	if space == quicSpaceApp {
+		if n := uint64(len(c.query)) - c.querySent; n > 0 {
+			rest := add(quicChunk{stream: true, offset: c.querySent, len: n})
+			c.querySent = rest.offset
+		}
+		if c.closeDue {
+			p.payload = append(p.payload, 0x1d, 0x00, 0x00) // CONNECTION_CLOSE, DOQ_NO_ERROR, no reason
+			c.closeDue = false
+		}
+	}
+	if s.ping && !p.eliciting {
+		p.payload = append(p.payload, 0x01)
+		p.eliciting = true
+	}
+	s.ping = false
+	return p, len(p.payload) > 0
+}
+
+// send seals the packets of a datagram and writes it.
+func (c *quicConn) send(dgram []quicPacket) error {
+	if len(dgram) == 0 {
+		return nil
+	}
+	if dgram[0].space == quicSpaceInitial {
+		size := 0
+		for _, p := range dgram {
+			size += quicOverhead(c.packetType(p.space), c.dcid, c.scid, c.token) + len(p.payload)
+		}
+		last := &dgram[len(dgram)-1]
+		last.payload = append(last.payload, make([]byte, max(quicMaxDatagram-size, 0))...) // PADDING
+	}
+	var b []byte
+	query := false
+	now := time.Now()
+	for _, p := range dgram {
+		s := &c.spaces[p.space]
+		pn := s.nextPN
+		s.nextPN++
+		b = appendQUICPacket(b, c.packetType(p.space), c.dcid, c.scid, c.token, pn, p.payload, s.seal)
+		if p.eliciting {
+			s.inFlight[pn] = quicSent{at: now, chunks: p.chunks}
+		}
+		for _, ch := range p.chunks {
+			query = query || ch.stream && !c.wrote
+		}
+	}
+	if query {
+		ContextTrace(c.ctx).writeStart()
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		return err
+	}
+	if query {
+		c.wrote = true
+		sentQuery(c.ctx, c.conn.LocalAddr(), c.conn.RemoteAddr(), c.query[2:])
+	}
+	for _, p := range dgram {
+		if p.space == quicSpaceHandshake {
+			// A client stops using Initial packets once it sends a
+			// Handshake packet (RFC 9001 section 4.9.1).
+			c.discard(quicSpaceInitial)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/ohidurbappy/dns-bench/stamp"
+)
+
+// fromStamp builds the transport described by a decoded stamp. Plain, DoT,
+// DoQ and DoH stamps map onto the built-in transports, connecting to the
+// stamp's address when given, else resolving its host name through its
+// bootstrap resolvers (or the -bootstrap one), and enforcing its
+// certificate pins. Other protocols are handed to the
+// transport registered for them.
+func fromStamp(raw string, st stamp.Stamp) (Transport, error) {
+	switch st.Proto {
+	case stamp.ProtoPlain:
+		return &UDP{Addr: st.Addr}, nil
+	case stamp.ProtoDoT:
+		host, _, err := net.SplitHostPort(HostPort(st.Hostname, "853"))
+		if err != nil {
+			return nil, err
+		}
+		addr := HostPort(st.Hostname, "853")
+		if st.Addr != "" {
+			addr = st.Addr
+		}
+		return &TLS{Addr: addr, Config: pinnedTLSConfig(host, st.Hashes), resolver: stampResolver(st)}, nil
+	case stamp.ProtoDoH:
+		host, _, err := net.SplitHostPort(HostPort(st.Hostname, "443"))
+		if err != nil {
+			return nil, err
+		}
+		client := NewHTTPClient()
+		tr := client.Transport.(*http.Transport)
+		tr.TLSClientConfig = pinnedTLSConfig(host, st.Hashes)
+		if addr := st.Addr; addr != "" {
+			tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return DialContext(ctx, network, addr)
+			}
+		} else if r := stampResolver(st); r != nil {
+			tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return DialContext(withResolver(ctx, r), network, addr)
+			}
+		}
+		u := url.URL{Scheme: "https", Host: st.Hostname, Path: st.Path}
+		return &HTTPS{URL: u.String(), Client: client}, nil
+	case stamp.ProtoODoHTarget:
+		u := url.URL{Scheme: "odoh", Host: st.Hostname, Path: st.Path}
+		return newFromScheme("odoh", u.String())
+	case stamp.ProtoDoQ:
+		host, _, err := net.SplitHostPort(HostPort(st.Hostname, "853"))
+		if err != nil {
+			return nil, err
+		}
+		addr := HostPort(st.Hostname, "853")
+		if st.Addr != "" {
+			addr = st.Addr
+		}
+		return &QUIC{Addr: addr, Config: pinnedTLSConfig(host, st.Hashes), resolver: stampResolver(st)}, nil
+	case stamp.ProtoDNSCryptRelay, stamp.ProtoODoHRelay:
+		return nil, fmt.Errorf("transport: %s stamps describe a relay, not a resolver", st.Proto)
+	}
+	return newFromScheme(st.Proto.Scheme(), raw)
+}
+
+// stampResolver returns a resolver querying the stamp's bootstrap IPs for
+// its host name, or nil if it lists none, leaving it to Bootstrap.
+func stampResolver(st stamp.Stamp) *net.Resolver {
+	if len(st.Bootstrap) == 0 {
+		return nil
+	}
+	return plainResolver(st.Bootstrap)
+}
+
+// pinnedTLSConfig verifies the server as usual and, if hashes is non-empty,
+// additionally requires one certificate of the verified chain to match a
+// pin (SHA-256 of its TBS certificate, as defined for DNS stamps).
+func pinnedTLSConfig(serverName string, hashes [][]byte) *tls.Config {
+	cfg := &tls.Config{ServerName: serverName}
+	if len(hashes) == 0 {
+		return cfg
+	}
+	cfg.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+		for _, chain := range chains {
+			for _, cert := range chain {
+				sum := sha256.Sum256(cert.RawTBSCertificate)
+				for _, h := range hashes {
+					if bytes.Equal(sum[:], h) {
+						return nil
+					}
+				}
+			}
+		}
+		return errors.New("transport: no certificate matches the stamp's pinned hashes")
+	}
+	return cfg
+}
@@ -0,0 +1,262 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// A Suspect is a message that arrived for a query but is not its answer:
+// garbage, an answer to another query, one from another address, or a
+// second answer that contradicts the first. Off-path spoofing and on-path
+// injection both show up this way.
+type Suspect struct {
+	Server string // address the query was sent to
+	From   string // source address of the message
+	Reason string // e.g. "ID mismatch"
+	Detail string
+}
+
+var (
+	suspectMu       sync.RWMutex
+	suspectHandlers []func(context.Context, Suspect)
+	spoofCheck      atomic.Bool
+)
+
+// AddSuspectHandler registers h to be called for every suspect message.
+// ctx is the context of the query the message arrived for.
+func AddSuspectHandler(h func(ctx context.Context, s Suspect)) {
+	suspectMu.Lock()
+	defer suspectMu.Unlock()
+	suspectHandlers = append(suspectHandlers, h)
+}
+
+// ReportSuspect passes s to the registered handlers. Transports registered
+// by other packages call it for messages they discard.
+func ReportSuspect(ctx context.Context, s Suspect) {
+	slog.DebugContext(ctx, "ignoring response", "server", s.Server, "from", s.From, "reason", s.Reason, "detail", s.Detail)
+	suspectMu.RLock()
+	defer suspectMu.RUnlock()
+	for _, h := range suspectHandlers {
+		h(ctx, s)
+	}
+}
+
+// SetSpoofCheck makes the UDP transport receive on unconnected sockets, so
+// that responses from other addresses reach it instead of being dropped by
+// the kernel, and keep listening for SpoofCheckLinger after each answer to
+// catch a second, different answer to the same query.
+func SetSpoofCheck(on bool) { spoofCheck.Store(on) }
+
+// SpoofCheckLinger is how long the UDP transport keeps listening after an
+// answer with SetSpoofCheck. An injected answer usually wins the race and
+// the genuine one arrives within a round trip after it.
+const SpoofCheckLinger = 500 * time.Millisecond
+
+// SpoofCheckMaxLingering bounds the sockets that listen after their answer
+// at the same time. At higher query rates, later answers are not lingered
+// on and are counted in SpoofCheckSkipped instead of piling up goroutines.
+const SpoofCheckMaxLingering = 256
+
+var (
+	lingerSlots   = make(chan struct{}, SpoofCheckMaxLingering)
+	lingerSkipped atomic.Int64
+)
+
+// SpoofCheckSkipped returns how many answers were not listened after for
+// SpoofCheckLinger, because SpoofCheckMaxLingering sockets already were.
+func SpoofCheckSkipped() int64 { return lingerSkipped.Load() }
+
+// matchResponse decodes a message received for query q, reporting the
+// parse to the trace of ctx. It returns the reason for rejecting it, or ""
+// for the answer to q. Without strict, as on connected sockets without
+// SetSpoofCheck, only malformed messages and other IDs are rejected.
+func matchResponse(ctx context.Context, q *dnsmsg.Message, b []byte, strict bool) (*dnsmsg.Message, string, string) {
+	resp, err := unpack(ctx, b)
+	switch {
+	case err != nil:
+		return nil, "malformed", fmt.Sprintf("%d bytes: %v", len(b), err)
+	case resp.ID != q.ID:
+		return nil, "ID mismatch", fmt.Sprintf("ID %d, want %d", resp.ID, q.ID)
+	case !strict:
+	case !resp.Response:
+		return nil, "not a response", ""
+	case len(resp.Questions) == 0 && resp.RCode != dnsmsg.RCodeSuccess:
+		// Some servers drop the question from error responses.
+	case len(q.Questions) > 0 && (len(resp.Questions) != 1 || !sameQuestion(resp.Questions[0], q.Questions[0])):
+		return nil, "question mismatch", questionText(resp.Questions)
+	}
+	return resp, "", ""
+}
+
+func sameQuestion(a, b dnsmsg.Question) bool {
+	return a.Type == b.Type && a.Class == b.Class && dnsmsg.EqualNames(a.Name, b.Name)
+}
+
+func questionText(qs []dnsmsg.Question) string {
+	if len(qs) == 0 {
+		return "no question"
+	}
+	return fmt.Sprintf("%s %s", qs[0].Name, qs[0].Type)
+}
+
+// sendUnconnected is SendQuery with SetSpoofCheck.
+func (t *UDP) sendUnconnected(ctx context.Context, msg *dnsmsg.Message, wire []byte) (*dnsmsg.Message, error) {
+	server, err := resolveUDPAddr(ctx, t.Addr)
+	if err != nil {
+		return nil, err
+	}
+	lc := net.ListenConfig{Control: contextPath(ctx)}
+	pc, err := lc.ListenPacket(ctx, "udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.UDPConn)
+	lingering := false
+	defer func() {
+		if !lingering {
+			conn.Close()
+		}
+	}()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	imp := impairment.Load()
+	lost := false
+	if imp != nil {
+		if err := impairSleep(ctx, imp.delay()); err != nil {
+			return nil, err
+		}
+		lost = imp.lose()
+	}
+	if !lost {
+		if _, err := conn.WriteToUDPAddrPort(wire, server); err != nil {
+			return nil, err
+		}
+	}
+	sentQuery(ctx, conn.LocalAddr(), net.UDPAddrFromAddrPort(server), wire)
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return nil, err
+		}
+		if imp != nil && imp.lose() {
+			continue
+		}
+		from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+		Observe(ctx, net.UDPAddrFromAddrPort(from), conn.LocalAddr(), buf[:n])
+		if !sameAddrPort(from, server) {
+			ReportSuspect(ctx, Suspect{Server: t.Addr, From: from.String(), Reason: "unexpected source", Detail: fmt.Sprintf("%d bytes", n)})
+			continue
+		}
+		resp, reason, detail := matchResponse(ctx, msg, buf[:n], true)
+		if reason != "" {
+			ReportSuspect(ctx, Suspect{Server: t.Addr, From: from.String(), Reason: reason, Detail: detail})
+			continue
+		}
+		ContextTrace(ctx).gotResponse(buf[:n])
+		if resp.Truncated && !t.NoTCPFallback {
+			return (&TCP{Addr: t.Addr}).SendQuery(ctx, msg)
+		}
+		select {
+		case lingerSlots <- struct{}{}:
+			lingering = true
+			go t.linger(context.WithoutCancel(ctx), conn, msg, resp, server)
+		default:
+			lingerSkipped.Add(1)
+		}
+		return resp, nil
+	}
+}
+
+// linger reads conn for SpoofCheckLinger after the answer resp, reporting
+// anything but an identical copy of it, and then closes conn.
+func (t *UDP) linger(ctx context.Context, conn *net.UDPConn, msg, resp *dnsmsg.Message, server netip.AddrPort) {
+	defer func() { <-lingerSlots }()
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(SpoofCheckLinger))
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+		s := Suspect{Server: t.Addr, From: from.String()}
+		other, reason, detail := matchResponse(context.Background(), msg, buf[:n], true) // after the query
+		switch {
+		case !sameAddrPort(from, server):
+			s.Reason, s.Detail = "unexpected source", fmt.Sprintf("%d bytes", n)
+		case reason != "":
+			s.Reason, s.Detail = reason, detail
+		case other.RCode != resp.RCode || answerKey(other) != answerKey(resp):
+			s.Reason = "conflicting second answer"
+			s.Detail = fmt.Sprintf("first %s [%s], then %s [%s]", resp.RCode, answerKey(resp), other.RCode, answerKey(other))
+		default:
+			continue // a duplicate of the answer
+		}
+		ReportSuspect(ctx, s)
+	}
+}
+
+// answerKey summarizes the answer records in a comparable form.
+func answerKey(m *dnsmsg.Message) string {
+	var rrs []string
+	for _, rr := range m.Answers {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "%s %s ", strings.ToLower(rr.Name), rr.Type)
+		if ip, err := rr.IP(); err == nil {
+			b.WriteString(ip.String())
+		} else if target, err := rr.Target(); err == nil && (rr.Type == dnsmsg.TypeCNAME || rr.Type == dnsmsg.TypeNS) {
+			b.WriteString(strings.ToLower(target))
+		} else {
+			fmt.Fprintf(&b, "%x", rr.Data)
+		}
+		rrs = append(rrs, b.String())
+	}
+	sort.Strings(rrs)
+	return strings.Join(rrs, ", ")
+}
+
+func sameAddrPort(a, b netip.AddrPort) bool {
+	return a.Addr() == b.Addr() && a.Port() == b.Port()
+}
+
+// resolveUDPAddr returns the address of host:port, honoring Pin and the
+// bootstrap resolver like DialContext.
+func resolveUDPAddr(ctx context.Context, addr string) (netip.AddrPort, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("transport: invalid port in %s", addr)
+	}
+	dialMu.RLock()
+	if ip, ok := pins[strings.ToLower(host)]; ok {
+		host = ip
+	}
+	dialMu.RUnlock()
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		ips, err := Bootstrap().LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		ip = ips[0]
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(port)), nil
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// A Tap observes every DNS message the transports send or receive, for
+// packet captures and debugging dumps. Messages of encrypted transports are
+// passed in plaintext. src or dst is nil when the transport does not know
+// the socket address. ctx is the context of the query, through which callers
+// can identify it. DNSMessage is called within the timing of the query:
+// it should copy msg, which the transport reuses, and return at once,
+// leaving the writing to a goroutine of its own, as AsyncTap does.
+type Tap interface {
+	DNSMessage(ctx context.Context, t time.Time, src, dst net.Addr, msg []byte)
+}
+
+var (
+	tapMu sync.RWMutex
+	taps  []Tap
+)
+
+// AddTap registers t with all transports.
+func AddTap(t Tap) {
+	tapMu.Lock()
+	defer tapMu.Unlock()
+	taps = append(taps, t)
+}
+
+// Observe reports a message to the registered taps. Transports registered
+// by other packages call it for each query they send and response they
+// receive.
+func Observe(ctx context.Context, src, dst net.Addr, msg []byte) {
+	tapMu.RLock()
+	ts := taps
+	tapMu.RUnlock()
+	if len(ts) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, t := range ts {
+		t.DNSMessage(ctx, now, src, dst, msg)
+	}
+}
+
+// TapMessage is a message an AsyncTap hands on: the arguments of
+// DNSMessage, with a copy of msg.
+type TapMessage struct {
+	Ctx      context.Context
+	Time     time.Time
+	Src, Dst net.Addr
+	Msg      []byte
+}
+
+// tapQueue is the number of messages that wait for the goroutine of an
+// AsyncTap before the queries do.
+const tapQueue = 1024
+
+// AsyncTap is a Tap that hands each message to a function on a goroutine
+// of its own, one at a time and in order, so that DNSMessage returns at
+// once, within the timing of a query. It is safe for concurrent use.
+type AsyncTap struct {
+	handle func(TapMessage)
+	queue  chan TapMessage
+	done   chan struct{}
+
+	mu     sync.Mutex // held to send to queue
+	closed bool
+}
+
+// NewAsyncTap returns an AsyncTap that passes the messages to handle.
+func NewAsyncTap(handle func(TapMessage)) *AsyncTap {
+	a := &AsyncTap{handle: handle, queue: make(chan TapMessage, tapQueue), done: make(chan struct{})}
+	go a.run()
+	return a
+}
+
+// DNSMessage implements Tap. Messages that arrive after Close are
+// dropped.
+func (a *AsyncTap) DNSMessage(ctx context.Context, t time.Time, src, dst net.Addr, msg []byte) {
+	// The transport may reuse msg once this returns.
+	m := TapMessage{Ctx: ctx, Time: t, Src: src, Dst: dst, Msg: bytes.Clone(msg)}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.closed {
+		a.queue <- m
+	}
+}
+
+// run hands on the queued messages until Close.
+func (a *AsyncTap) run() {
+	defer close(a.done)
+	for m := range a.queue {
+		a.handle(m)
+	}
+}
+
+// Close returns once the messages still queued have been handled.
+func (a *AsyncTap) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("tcp", func(addr string) (Transport, error) {
+		return &TCP{Addr: HostPort(addr, "53")}, nil
+	})
+}
+
+var errIDMismatch = errors.New("transport: response ID mismatch")
+
+// TCP sends each query over a new TCP connection (RFC 7766 framing), or
+// with Pool over one of a pool of persistent connections.
+type TCP struct {
+	Addr string // host:port
+	// Pool, if positive, keeps up to this many connections open and sends
+	// one query at a time over each, reusing them as forwarders do; more
+	// queries in flight wait for a free connection. Set it before the
+	// first query.
+	Pool int
+
+	once sync.Once
+	pool *connPool
+}
+
+// SendQuery implements Transport.
+func (t *TCP) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	if t.Pool > 0 {
+		t.once.Do(func() {
+			t.pool = newConnPool(t.Pool, func(ctx context.Context) (net.Conn, error) {
+				return DialContext(ctx, "tcp", t.Addr)
+			})
+		})
+		return t.pool.exchange(ctx, msg)
+	}
+	conn, err := DialContext(ctx, "tcp", t.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return streamExchange(ctx, conn, msg)
+}
+
+// CloseIdleConnections closes the idle connections of Pool.
+func (t *TCP) CloseIdleConnections() {
+	if t.pool != nil {
+		t.pool.closeIdle()
+	}
+}
+
+// streamExchange writes a length-prefixed query to conn and reads the
+// length-prefixed response.
+func streamExchange(ctx context.Context, conn net.Conn, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	dl, _ := ctx.Deadline()
+	_ = conn.SetDeadline(dl) // clears the deadline of a pooled conn's last query
+	wire, err := pack(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(wire)), uint16(len(wire)))
+	framed = append(framed, wire...)
+	var r io.Reader = conn
+	if busyPoll(ctx) {
+		r = busyPollReader(ctx, conn)
+	}
+	ContextTrace(ctx).writeStart()
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+	sentQuery(ctx, conn.LocalAddr(), conn.RemoteAddr(), wire)
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	ContextTrace(ctx).gotFirstResponseByte()
+	buf := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	ContextTrace(ctx).readDone()
+	Observe(ctx, conn.RemoteAddr(), conn.LocalAddr(), buf)
+	resp, err := unpack(ctx, buf)
+	if err != nil {
+		slog.DebugContext(ctx, "malformed response", "server", conn.RemoteAddr(), "bytes", len(buf), "err", err)
+		return nil, err
+	}
+	if resp.ID != msg.ID {
+		slog.DebugContext(ctx, "response to another query", "server", conn.RemoteAddr(), "id", resp.ID, "want", msg.ID)
+		return nil, errIDMismatch
+	}
+	ContextTrace(ctx).gotResponse(buf)
+	if fastOpen(ctx) {
+		if accepted, err := FastOpenAccepted(conn); err == nil {
+			ContextTrace(ctx).gotFastOpen(accepted)
+		}
+	}
+	return resp, nil
+}
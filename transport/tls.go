@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("tls", func(addr string) (Transport, error) {
+		hostport := HostPort(addr, "853")
+		host, _, _ := net.SplitHostPort(hostport)
+		return &TLS{Addr: hostport, Config: &tls.Config{ServerName: host}}, nil
+	})
+}
+
+// TLS sends each query over a new DNS-over-TLS connection (RFC 7858), so
+// every sample includes the TCP and TLS handshakes, or with Pool over one
+// of a pool of persistent connections, so that only the queries that open
+// one do.
+type TLS struct {
+	Addr   string // host:port
+	Config *tls.Config
+	// Pool is the number of persistent connections, as for TCP.Pool.
+	Pool int
+
+	resolver *net.Resolver // a stamp's bootstrap resolver, if any
+	once     sync.Once
+	pool     *connPool
+}
+
+// SendQuery implements Transport.
+func (t *TLS) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	if t.Pool > 0 {
+		t.once.Do(func() { t.pool = newConnPool(t.Pool, t.dial) })
+		return t.pool.exchange(ctx, msg)
+	}
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return streamExchange(ctx, conn, msg)
+}
+
+// dial opens a connection and completes the TLS handshake.
+func (t *TLS) dial(ctx context.Context) (net.Conn, error) {
+	if t.resolver != nil {
+		ctx = withResolver(ctx, t.resolver)
+	}
+	raw, err := DialContext(ctx, "tcp", t.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, t.Config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// CloseIdleConnections closes the idle connections of Pool.
+func (t *TLS) CloseIdleConnections() {
+	if t.pool != nil {
+		t.pool.closeIdle()
+	}
+}
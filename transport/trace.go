@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+// Trace is a set of hooks run at stages of a query, in the manner of
+// net/http/httptrace. Any hook may be nil. Transports call the hooks they
+// can observe; a hook a transport does not support is never called.
+type Trace struct {
+	// GotFirstResponseByte is called when the first byte of the response
+	// arrives on a stream transport: the length prefix for TCP and TLS,
+	// the response headers for HTTPS.
+	GotFirstResponseByte func()
+	// GotResponse is called with the response message SendQuery is about
+	// to decode, in plaintext for encrypted transports. A query retried
+	// over TCP after truncation reports both responses.
+	GotResponse func(msg []byte)
+	// WroteQuery is called with the query message once it is sent, and
+	// the addresses of its socket when the transport knows them, so that
+	// the query can be found in firewall and server logs by source port
+	// and ID. A query retried over TCP after truncation reports both.
+	WroteQuery func(src, dst net.Addr, msg []byte)
+	// GotHTTPResponse is called with the status and headers of a DoH
+	// response, whatever its status, before its body is read.
+	GotHTTPResponse func(resp *http.Response)
+	// GotConn is called when a TCP or DoT query with a connection pool, or
+	// a DoH query, has its connection; reused reports whether the
+	// connection was kept open from an earlier query. A pooled query whose
+	// idle connection turned out closed reports again for the new one.
+	GotConn func(reused bool)
+	// GotFastOpen is called when a TCP or DoT query over a connection
+	// opened with WithFastOpen is answered; accepted reports whether the
+	// server acknowledged the data in the SYN, saving the round trip of
+	// the handshake.
+	GotFastOpen func(accepted bool)
+	// GotRace is called when a TCP, DoT or DoH connection to a server host
+	// name is made, with how the Happy Eyeballs race between its IPv6 and
+	// IPv4 addresses went.
+	GotRace func(race Race)
+	// WriteStart is called immediately before the query is written to its
+	// socket, once the message is packed and the connection is open (for
+	// DoH, when the request has its connection), and ReadDone immediately
+	// after the response is read, before it is parsed: the moments that
+	// bound the time on the wire. A query retried over TCP after
+	// truncation reports both writes and both reads.
+	WriteStart func()
+	ReadDone   func()
+	// Packed is called with how long packing the query took, and Parsed
+	// with how long parsing a response took: the CPU time of the query
+	// on this host, which is no part of the resolver's latency. A query
+	// retried over TCP after truncation reports both of each, and UDP
+	// reports a parse for every datagram read, stray ones included.
+	Packed func(took time.Duration)
+	Parsed func(took time.Duration)
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context carrying trace for the queries sent with it.
+func WithTrace(ctx context.Context, trace *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// ContextTrace returns the Trace attached to ctx, or an empty one.
+func ContextTrace(ctx context.Context) *Trace {
+	if t, ok := ctx.Value(traceKey{}).(*Trace); ok && t != nil {
+		return t
+	}
+	return &Trace{}
+}
+
+func (t *Trace) gotFirstResponseByte() {
+	if t.GotFirstResponseByte != nil {
+		t.GotFirstResponseByte()
+	}
+}
+
+func (t *Trace) gotResponse(msg []byte) {
+	if t.GotResponse != nil {
+		t.GotResponse(msg)
+	}
+}
+
+func (t *Trace) gotConn(reused bool) {
+	if t.GotConn != nil {
+		t.GotConn(reused)
+	}
+}
+
+func (t *Trace) gotRace(race Race) {
+	if t.GotRace != nil {
+		t.GotRace(race)
+	}
+}
+
+func (t *Trace) gotFastOpen(accepted bool) {
+	if t.GotFastOpen != nil {
+		t.GotFastOpen(accepted)
+	}
+}
+
+func (t *Trace) writeStart() {
+	if t.WriteStart != nil {
+		t.WriteStart()
+	}
+}
+
+func (t *Trace) readDone() {
+	if t.ReadDone != nil {
+		t.ReadDone()
+	}
+}
+
+func (t *Trace) packed(took time.Duration) {
+	if t.Packed != nil {
+		t.Packed(took)
+	}
+}
+
+func (t *Trace) parsed(took time.Duration) {
+	if t.Parsed != nil {
+		t.Parsed(took)
+	}
+}
+
+func (t *Trace) gotHTTPResponse(resp *http.Response) {
+	if t.GotHTTPResponse != nil {
+		t.GotHTTPResponse(resp)
+	}
+}
+
+func (t *Trace) wroteQuery(src, dst net.Addr, msg []byte) {
+	if t.WroteQuery != nil {
+		t.WroteQuery(src, dst, msg)
+	}
+}
+
+// sentQuery reports a query the transport has sent to the taps and the
+// trace of ctx.
+func sentQuery(ctx context.Context, src, dst net.Addr, msg []byte) {
+	Observe(ctx, src, dst, msg)
+	ContextTrace(ctx).wroteQuery(src, dst, msg)
+}
+
+// pack packs msg, reporting how long it took to the trace of ctx.
+func pack(ctx context.Context, msg *dnsmsg.Message) ([]byte, error) {
+	start := time.Now()
+	wire, err := msg.Pack()
+	ContextTrace(ctx).packed(time.Since(start))
+	return wire, err
+}
+
+// unpack parses the message in b, reporting how long it took to the trace
+// of ctx.
+func unpack(ctx context.Context, b []byte) (*dnsmsg.Message, error) {
+	start := time.Now()
+	msg, err := dnsmsg.Unpack(b)
+	ContextTrace(ctx).parsed(time.Since(start))
+	return msg, err
+}
@@ -0,0 +1,103 @@
+// Package transport sends DNS queries over the wire. Each protocol (plain
+// UDP and TCP, DNS-over-TLS, DNS-over-HTTPS, ...) is a Transport registered
+// under a URL scheme, so resolver addresses such as "tls://1.1.1.1" or
+// "https://dns.google/dns-query" select their protocol. Third parties add
+// protocols by calling Register from an init function.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/stamp"
+)
+
+// Transport sends a query to one resolver and returns its response.
+// Implementations must be safe for concurrent use.
+type Transport interface {
+	SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error)
+}
+
+// Factory creates a Transport for a resolver address. addr is the full
+// resolver specification, scheme included when one was given.
+type Factory func(addr string) (Transport, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a transport available under scheme. It panics if scheme is
+// already registered, like database/sql.Register.
+func Register(scheme string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	scheme = strings.ToLower(scheme)
+	if _, dup := factories[scheme]; dup {
+		panic("transport: Register called twice for scheme " + scheme)
+	}
+	factories[scheme] = f
+}
+
+// Schemes returns the registered schemes in sorted order.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]string, 0, len(factories))
+	for s := range factories {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// New returns a Transport for addr. Addresses without a scheme use UDP;
+// sdns:// stamps are dispatched on the protocol they describe.
+func New(addr string) (Transport, error) {
+	scheme := Scheme(addr)
+	if scheme == "sdns" {
+		st, err := stamp.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		return fromStamp(addr, st)
+	}
+	return newFromScheme(scheme, addr)
+}
+
+func newFromScheme(scheme, addr string) (Transport, error) {
+	mu.RLock()
+	f, ok := factories[scheme]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("transport: unsupported scheme %q (registered: %s)", scheme, strings.Join(Schemes(), ", "))
+	}
+	return f(addr)
+}
+
+// Scheme returns the lower-cased scheme of addr, or "udp" if it has none.
+func Scheme(addr string) string {
+	if scheme, _, ok := strings.Cut(addr, "://"); ok {
+		return strings.ToLower(scheme)
+	}
+	return "udp"
+}
+
+// HostPort strips any scheme from addr and returns host:port, using
+// defaultPort when addr has no port.
+func HostPort(addr, defaultPort string) string {
+	if _, rest, ok := strings.Cut(addr, "://"); ok {
+		addr = rest
+	}
+	addr, _, _ = strings.Cut(addr, "/")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), defaultPort)
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+)
+
+func init() {
+	Register("udp", func(addr string) (Transport, error) {
+		return &UDP{Addr: HostPort(addr, "53")}, nil
+	})
+}
+
+// UDP sends each query from a fresh UDP socket, or with Reuse from one it
+// has used before. Truncated answers are retried over TCP, as a stub
+// resolver would.
+type UDP struct {
+	Addr string // host:port
+	// NoTCPFallback returns truncated answers as they are, for probes of
+	// the UDP path itself.
+	NoTCPFallback bool
+	// Reuse keeps the socket of an answered query open for the next one,
+	// as stub resolvers that hold a socket per server do, instead of
+	// binding a new ephemeral port for every query. Queries in flight at
+	// the same time use a socket each. A socket whose query failed is
+	// closed, so that a late answer is not read by the next query. Reuse
+	// does not apply with SetSpoofCheck.
+	Reuse bool
+
+	mu   sync.Mutex
+	idle []net.Conn
+}
+
+// SendQuery implements Transport.
+func (t *UDP) SendQuery(ctx context.Context, msg *dnsmsg.Message) (*dnsmsg.Message, error) {
+	wire, err := pack(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if spoofCheck.Load() {
+		return t.sendUnconnected(ctx, msg, wire)
+	}
+	conn, err := t.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	answered := false
+	defer func() {
+		if answered && t.Reuse {
+			t.release(conn)
+		} else {
+			conn.Close()
+		}
+	}()
+	dl, _ := ctx.Deadline()
+	_ = conn.SetDeadline(dl)
+	var r io.Reader = conn
+	if busyPoll(ctx) {
+		r = busyPollReader(ctx, conn)
+	}
+	buf := make([]byte, 65535)
+	ContextTrace(ctx).writeStart()
+	if _, err := conn.Write(wire); err != nil {
+		return nil, err
+	}
+	sentQuery(ctx, conn.LocalAddr(), conn.RemoteAddr(), wire)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		ContextTrace(ctx).readDone()
+		Observe(ctx, conn.RemoteAddr(), conn.LocalAddr(), buf[:n])
+		// Ignore garbage and stray answers; keep waiting for ours.
+		resp, reason, detail := matchResponse(ctx, msg, buf[:n], false)
+		if reason != "" {
+			ReportSuspect(ctx, Suspect{Server: t.Addr, From: conn.RemoteAddr().String(), Reason: reason, Detail: detail})
+			continue
+		}
+		ContextTrace(ctx).gotResponse(buf[:n])
+		answered = true
+		if resp.Truncated && !t.NoTCPFallback {
+			slog.DebugContext(ctx, "truncated response, retrying over TCP", "server", t.Addr)
+			return (&TCP{Addr: t.Addr}).SendQuery(ctx, msg)
+		}
+		return resp, nil
+	}
+}
+
+// conn returns an idle socket with Reuse, or else a new one.
+func (t *UDP) conn(ctx context.Context) (net.Conn, error) {
+	if t.Reuse {
+		t.mu.Lock()
+		if n := len(t.idle); n > 0 {
+			conn := t.idle[n-1]
+			t.idle = t.idle[:n-1]
+			t.mu.Unlock()
+			return conn, nil
+		}
+		t.mu.Unlock()
+	}
+	return DialContext(ctx, "udp", t.Addr)
+}
+
+func (t *UDP) release(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idle = append(t.idle, conn)
+}
+
+// CloseIdleConnections closes the sockets kept open with Reuse.
+func (t *UDP) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, conn := range t.idle {
+		conn.Close()
+	}
+	t.idle = nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// sparkBars are the levels of a sparkline, lowest first.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkFailed marks a run without any answer in a sparkline.
+const sparkFailed = '·'
+
+// MedianTrend keeps the medians of each resolver's last runs in -watch
+// mode, to show latency trends in the results table.
+type MedianTrend struct {
+	N       int                        // runs to keep
+	Medians map[string][]time.Duration // oldest first; zero for a failed run
+}
+
+func newMedianTrend(n int) *MedianTrend {
+	return &MedianTrend{N: n, Medians: make(map[string][]time.Duration)}
+}
+
+// Add records the medians of one run.
+func (t *MedianTrend) Add(rows []bench.Result) {
+	for _, r := range rows {
+		var med time.Duration
+		if r.Stats.Successes > 0 {
+			med = max(r.Stats.Median, 1)
+		}
+		m := append(t.Medians[r.Name], med)
+		if len(m) > t.N {
+			m = m[len(m)-t.N:]
+		}
+		t.Medians[r.Name] = m
+	}
+}
+
+// Sparkline draws the kept medians of a resolver, scaled from the lowest to
+// the highest of them and right-aligned in N columns.
+func (t *MedianTrend) Sparkline(name string) string {
+	meds := t.Medians[name]
+	var lo, hi time.Duration
+	for _, m := range meds {
+		if m == 0 {
+			continue
+		}
+		if lo == 0 || m < lo {
+			lo = m
+		}
+		hi = max(hi, m)
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", t.N-len(meds)))
+	for _, m := range meds {
+		switch {
+		case m == 0:
+			b.WriteRune(sparkFailed)
+		case hi == lo:
+			b.WriteRune(sparkBars[len(sparkBars)/2-1])
+		default:
+			b.WriteRune(sparkBars[int(float64(m-lo)/float64(hi-lo)*float64(len(sparkBars)-1)+0.5)])
+		}
+	}
+	return b.String()
+}
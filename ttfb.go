@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// printFirstByte compares time to first byte with time to the complete
+// response for resolvers on stream transports. The two diverge for large
+// responses, and a wide gap hints at small server send buffers or Nagle
+// delays between the length prefix and the message. It prints nothing when
+// no sample reported a first byte time.
+func printFirstByte(rows []bench.Result) {
+	type line struct {
+		name             string
+		ttfb, full, gaps []float64
+	}
+	var lines []line
+	for _, r := range rows {
+		l := line{name: r.Name}
+		for _, s := range r.Samples {
+			if s.Err != nil || s.FirstByte <= 0 {
+				continue
+			}
+			l.ttfb = append(l.ttfb, ms(s.FirstByte))
+			l.full = append(l.full, ms(s.Duration))
+			l.gaps = append(l.gaps, ms(s.Duration-s.FirstByte))
+		}
+		if len(l.ttfb) > 0 {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	pct := func(v []float64, p float64) string {
+		sort.Float64s(v)
+		return durFmt(time.Duration(bench.Percentile(v, p) * float64(time.Millisecond)))
+	}
+	fmt.Printf("\nFirst byte vs. complete response (stream transports)\n")
+	fmt.Printf("%-12s  %8s  %8s  %8s  %8s  %8s\n", "Resolver", "TTFB med", "Full med", "Gap med", "Gap p95", "Gap max")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, l := range lines {
+		fmt.Printf("%-12s  %8s  %8s  %8s  %8s  %8s\n", l.name,
+			pct(l.ttfb, 50), pct(l.full, 50), pct(l.gaps, 50), pct(l.gaps, 95), pct(l.gaps, 100))
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+var errNoAnswer = errors.New("empty answer section")
+
+// TTLProbeResult summarizes how a resolver treated a record's TTL over the
+// probe window.
+type TTLProbeResult struct {
+	Name       string
+	OrigTTL    uint32 // largest TTL observed, taken as the authoritative TTL
+	Expiries   int    // queries issued after the cached copy should have expired
+	Refetched  int    // ... answered with a fresh, full TTL (TTL honored)
+	Stale      int    // ... answered with a short or zero TTL (serve-stale, RFC 8767)
+	Prefetched int    // TTL reset before the cached copy expired
+	Behavior   string
+	Samples    []bench.Sample
+}
+
+// ttlSlack absorbs rounding of TTLs to whole seconds and query latency.
+const ttlSlack = 1 * time.Second
+
+// probeTTL queries name repeatedly and follows the answer TTL. Each answer
+// predicts when the resolver's cached copy expires; the next answer shows
+// whether the resolver refreshed early (prefetch), kept serving the expired
+// record (serve-stale) or fetched it again once it expired.
+func probeTTL(r bench.Resolver, name string, qtype dnsmsg.Type, count int, interval, timeout time.Duration) TTLProbeResult {
+	res := TTLProbeResult{Name: r.Name, Behavior: "--"}
+	tr, err := transport.New(r.Addr)
+	if err != nil {
+		res.Samples = append(res.Samples, bench.Sample{Err: err})
+		return res
+	}
+	type obs struct {
+		at  time.Time
+		ttl uint32
+	}
+	var seen []obs
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		resp, err := tr.SendQuery(ctx, dnsmsg.NewQuery(name, qtype))
+		d := time.Since(start)
+		cancel()
+
+		if err == nil {
+			var ttl uint32
+			ttl, err = answerTTL(resp)
+			if err == nil {
+				seen = append(seen, obs{at: start, ttl: ttl})
+				res.OrigTTL = max(res.OrigTTL, ttl)
+			}
+		}
+		res.Samples = append(res.Samples, bench.Sample{Duration: d, Err: err})
+	}
+
+	for i := 1; i < len(seen); i++ {
+		prev, cur := seen[i-1], seen[i]
+		expires := prev.at.Add(time.Duration(prev.ttl) * time.Second)
+		remaining := time.Duration(prev.ttl)*time.Second - cur.at.Sub(prev.at)
+		got := time.Duration(cur.ttl) * time.Second
+		switch {
+		case cur.at.After(expires.Add(ttlSlack)):
+			res.Expiries++
+			if cur.ttl+1 >= res.OrigTTL {
+				res.Refetched++
+			} else {
+				res.Stale++
+			}
+		case got > remaining+ttlSlack && cur.ttl+1 >= res.OrigTTL:
+			res.Prefetched++
+		}
+	}
+
+	switch {
+	case len(seen) < 2:
+		res.Behavior = "--"
+	case res.Stale > 0:
+		res.Behavior = "serve-stale"
+	case res.Prefetched > 0:
+		res.Behavior = "prefetch"
+	case res.Refetched > 0:
+		res.Behavior = "honors TTL"
+	default:
+		res.Behavior = "inconclusive (window shorter than TTL)"
+	}
+	return res
+}
+
+// answerTTL returns the smallest TTL in the answer section.
+func answerTTL(resp *dnsmsg.Message) (uint32, error) {
+	if err := rcodeError(resp); err != nil {
+		return 0, err
+	}
+	if len(resp.Answers) == 0 {
+		return 0, errNoAnswer
+	}
+	ttl := resp.Answers[0].TTL
+	for _, rr := range resp.Answers[1:] {
+		ttl = min(ttl, rr.TTL)
+	}
+	return ttl, nil
+}
+
+func printTTLProbe(results []TTLProbeResult) {
+	fmt.Printf("%-12s  %6s  %8s  %9s  %5s  %8s  %s\n",
+		"Resolver", "TTL", "Expiries", "Refetched", "Stale", "Prefetch", "Behavior")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, r := range results {
+		fmt.Printf("%-12s  %5ds  %8d  %9d  %5d  %8d  %s\n",
+			r.Name, r.OrigTTL, r.Expiries, r.Refetched, r.Stale, r.Prefetched, r.Behavior)
+		for _, e := range uniqueErrors(bench.Summarize(r.Samples).Errors) {
+			fmt.Printf("  ! %s\n", e)
+		}
+	}
+}
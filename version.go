@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// Version and BuildTime are set by the Makefile through -ldflags -X.
+var (
+	Version   = ""
+	BuildTime = ""
+)
+
+// releasesURL is the GitHub API endpoint of the latest release.
+const releasesURL = "https://api.github.com/repos/ohidurbappy/dns-bench/releases/latest"
+
+// version returns Version, or for builds without it the module version or
+// VCS revision recorded by the Go toolchain.
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	rev, dirty := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if rev == "" {
+		return "dev"
+	}
+	if len(rev) > 7 {
+		rev = rev[:7]
+	}
+	return rev + ternary(dirty, "-dirty", "")
+}
+
+// runVersion implements the version subcommand.
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	check := fs.Bool("check", false, "Ask GitHub whether a newer release is available")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for -check")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dnsbench version [-check]\n\n"+
+			"Prints the version, build and results schema version.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	fmt.Printf("dnsbench %s\n", version())
+	if BuildTime != "" {
+		fmt.Printf("Built:          %s\n", BuildTime)
+	}
+	fmt.Printf("Go:             %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Results schema: %d (reads saved runs of version 1 to %d)\n", bench.RecordVersion, bench.RecordVersion)
+	if !*check {
+		return 0
+	}
+
+	tag, url, err := latestRelease(*timeout)
+	if err != nil {
+		slog.Error("release check failed", "err", err)
+		return 1
+	}
+	if strings.TrimPrefix(tag, "v") == strings.TrimPrefix(version(), "v") {
+		fmt.Printf("\nUp to date (latest release %s).\n", tag)
+		return 0
+	}
+	fmt.Printf("\nLatest release: %s\n%s\n", tag, url)
+	return 0
+}
+
+// latestRelease returns the tag and page of the latest GitHub release.
+func latestRelease(timeout time.Duration) (tag, url string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releasesURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("GET %s: %s", releasesURL, resp.Status)
+	}
+	var rel struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return "", "", err
+	}
+	return rel.TagName, rel.HTMLURL, nil
+}
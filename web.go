@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+	"github.com/ohidurbappy/dns-bench/stamp"
+	"github.com/ohidurbappy/dns-bench/transport"
+)
+
+//go:embed web/index.html
+var webIndex []byte
+
+// webServer serves the embedded results UI. History comes from saveDir
+// when set, else from the runs started through the UI in this process.
+type webServer struct {
+	runner  *bench.Runner
+	saveDir string
+
+	mu      sync.Mutex
+	running bool
+	lastErr string
+	runs    []bench.RunRecord
+}
+
+// serveWeb runs the web UI on addr until ctx is cancelled.
+func serveWeb(ctx context.Context, addr string, runner *bench.Runner, saveDir string) error {
+	s := &webServer{runner: runner, saveDir: saveDir}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webIndex)
+	})
+	mux.HandleFunc("GET /api/history", s.handleHistory)
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("POST /api/run", s.handleRun)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	fmt.Printf("Web UI on http://%s\n", addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+type webResolver struct {
+	Name      string    `json:"name"`
+	Protocol  string    `json:"protocol"`
+	Count     int       `json:"count"`
+	Successes int       `json:"successes"`
+	Min       float64   `json:"min"`
+	Median    float64   `json:"median"`
+	P95       float64   `json:"p95"`
+	Max       float64   `json:"max"`
+	Samples   []float64 `json:"samples"` // successful query durations, ms
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+type webRun struct {
+	Started   time.Time     `json:"started"`
+	Host      string        `json:"host,omitempty"`
+	Domain    string        `json:"domain"`
+	Network   string        `json:"network"`
+	Cold      bool          `json:"cold,omitempty"`
+	Resolvers []webResolver `json:"resolvers"`
+}
+
+// protocolOf names the transport an address uses, looking inside stamps.
+func protocolOf(addr string) string {
+	scheme := transport.Scheme(addr)
+	if scheme == "sdns" {
+		if st, err := stamp.Parse(addr); err == nil {
+			return st.Proto.String()
+		}
+	}
+	return scheme
+}
+
+func (s *webServer) history() ([]bench.RunRecord, error) {
+	if s.saveDir != "" {
+		if _, err := os.Stat(s.saveDir); os.IsNotExist(err) {
+			return nil, nil
+		}
+		return loadRecords([]string{s.saveDir})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bench.RunRecord(nil), s.runs...), nil
+}
+
+func (s *webServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	recs, err := s.history()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	runs := make([]webRun, 0, len(recs))
+	for _, rec := range recs {
+		run := webRun{Started: rec.Started, Host: rec.Host, Domain: rec.Domain, Network: rec.Network, Cold: rec.Cold}
+		for i, res := range rec.Results() {
+			st := res.Stats
+			run.Resolvers = append(run.Resolvers, webResolver{
+				Name:      res.Name,
+				Protocol:  protocolOf(rec.Resolvers[i].Addr),
+				Count:     st.Count,
+				Successes: st.Successes,
+				Min:       ms(st.Min),
+				Median:    ms(st.Median),
+				P95:       ms(st.P95),
+				Max:       ms(st.Max),
+				Samples:   st.DurationsMs,
+				Errors:    errorStrings(uniqueErrors(st.Errors)),
+			})
+		}
+		runs = append(runs, run)
+	}
+	writeJSON(w, runs)
+}
+
+func (s *webServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, map[string]any{"running": s.running, "error": s.lastErr})
+}
+
+// handleRun starts a benchmark in the background; the UI polls the status
+// and reloads the history once it finishes.
+func (s *webServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		http.Error(w, "a run is already in progress", http.StatusConflict)
+		return
+	}
+	s.running, s.lastErr = true, ""
+	go s.run()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *webServer) run() {
+	started := time.Now()
+	rows, err := runHooks.Run(context.Background(), s.runner, nil)
+	if err == nil && s.saveDir != "" {
+		_, err = saveRun(s.saveDir, s.runner, started, rows)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	if err != nil {
+		s.lastErr = err.Error()
+		return
+	}
+	if s.saveDir == "" {
+		s.runs = append(s.runs, bench.NewRunRecord(s.runner, started, rows))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// fineDur formats d to the microsecond, for the sub-millisecond
+// differences of -wire-timing.
+func fineDur(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "--"
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.1fµs", float64(d.Nanoseconds())/1000)
+	}
+	return fmt.Sprintf("%.3fms", float64(d.Nanoseconds())/1e6)
+}
+
+// finePercentile returns the p-th percentile of v, in microseconds,
+// sorting v in place; zero when v is empty.
+func finePercentile(v []float64, p float64) time.Duration {
+	if len(v) == 0 {
+		return 0
+	}
+	sort.Float64s(v)
+	return time.Duration(bench.Percentile(v, p) * float64(time.Microsecond))
+}
+
+// microseconds returns d in microseconds, for finePercentile.
+func microseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1000
+}
+
+// printWireTiming compares the time on the wire of each resolver's samples
+// with their whole time, for -wire-timing: the difference is what the
+// measurement itself costs per query, packing, connecting, parsing and
+// scheduling, which the main table leaves out.
+func printWireTiming(rows []bench.Result) {
+	fmt.Printf("\nOn the wire vs. whole query (-wire-timing)\n")
+	fmt.Printf("%-12s  %7s  %10s  %10s  %12s  %12s\n", "Resolver", "Timed", "Wire med", "Whole med", "Overhead med", "Overhead p95")
+	fmt.Println(strings.Repeat("-", 80))
+	untimed := false
+	for _, r := range rows {
+		var wire, whole, over []float64 // in microseconds
+		for _, s := range r.Samples {
+			if s.Overhead <= 0 {
+				continue
+			}
+			wire = append(wire, microseconds(s.Duration))
+			whole = append(whole, microseconds(s.Duration+s.Overhead))
+			over = append(over, microseconds(s.Overhead))
+		}
+		untimed = untimed || len(wire) < len(r.Samples)
+		fmt.Printf("%-12s  %7s  %10s  %10s  %12s  %12s\n", r.Name, fmt.Sprintf("%d/%d", len(wire), len(r.Samples)),
+			fineDur(finePercentile(wire, 50)), fineDur(finePercentile(whole, 50)), fineDur(finePercentile(over, 50)), fineDur(finePercentile(over, 95)))
+	}
+	if untimed {
+		fmt.Println("Samples not timed on the wire keep their whole time: queries without an answer, and transports that do not report the moments (OS, iterative, DNSCrypt, ODoH).")
+	}
+}
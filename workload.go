@@ -0,0 +1,230 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/dnsmsg"
+	"github.com/ohidurbappy/dns-bench/idna"
+)
+
+// topLists are the published top-sites rankings -workload can download.
+// Each is a zip archive holding one "rank,domain" CSV file.
+var topLists = map[string]string{
+	"tranco":   "https://tranco-list.eu/top-1m.csv.zip",
+	"umbrella": "https://s3-us-west-1.amazonaws.com/umbrella-static/top-1m.csv.zip",
+}
+
+// topListMaxAge is how long a downloaded list is reused; the lists are
+// regenerated daily.
+const topListMaxAge = 24 * time.Hour
+
+// loadWorkload returns the domains of a -workload spec: LIST[:N] for the
+// top N names (default 1000) of a list in topLists, file:PATH[:N] for a
+// local file with one domain per line or "rank,domain" CSV lines, or
+// dnsperf:PATH[:N] for a query file of dnsperf and resperf, whose lines
+// also give the record type of each name, returned as types. With offline,
+// as for -dry-run, a list is only read from the cache, never downloaded.
+func loadWorkload(spec string, timeout time.Duration, offline bool) (domains []string, types []dnsmsg.Type, err error) {
+	source, n := spec, 1000
+	if i := strings.LastIndexByte(spec, ':'); i >= 0 {
+		if v, err := strconv.Atoi(spec[i+1:]); err == nil {
+			if v < 1 {
+				return nil, nil, fmt.Errorf("workload %s: need at least one domain", spec)
+			}
+			source, n = spec[:i], v
+		}
+	}
+
+	var path string
+	dnsperf := false
+	if p, ok := strings.CutPrefix(source, "file:"); ok {
+		path = p
+	} else if p, ok := strings.CutPrefix(source, "dnsperf:"); ok {
+		path, dnsperf = p, true
+	} else if url, ok := topLists[source]; ok {
+		if path, err = cachedTopList(source, url, timeout, offline); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		return nil, nil, fmt.Errorf("unknown workload %q (want tranco, umbrella, file:PATH or dnsperf:PATH)", source)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".zip") {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		zr, err := zip.NewReader(f, fi.Size())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(zr.File) == 0 {
+			return nil, nil, fmt.Errorf("%s: empty archive", path)
+		}
+		rc, err := zr.File[0].Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rc.Close()
+		r = rc
+	}
+	if dnsperf {
+		domains, types, err = readQueryFile(r, n)
+	} else {
+		domains, err = readDomains(r, n)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(domains) == 0 {
+		return nil, nil, fmt.Errorf("%s: no domains", path)
+	}
+	return domains, types, nil
+}
+
+// readDomains reads up to n domains, one per line. Blank lines and
+// "#" comments are skipped; of a CSV line, the last field is the domain.
+func readDomains(r io.Reader, n int) ([]string, error) {
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() && len(out) < n {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.LastIndexByte(line, ','); i >= 0 {
+			line = strings.TrimSpace(line[i+1:])
+		}
+		name, err := idna.ToASCII(line)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, sc.Err()
+}
+
+// readQueryFile reads up to n queries of a dnsperf query file, a name and
+// a record type per line, such as "www.example.com AAAA". Blank lines and
+// ";" or "#" comments are skipped. A line with a name only gets type zero,
+// the type of -qtype or -network, as dnsperf defaults to A.
+func readQueryFile(r io.Reader, n int) (names []string, types []dnsmsg.Type, err error) {
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan() && len(names) < n; line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], ";") || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var qtype dnsmsg.Type
+		if len(fields) > 1 {
+			if qtype, err = dnsmsg.ParseType(fields[1]); err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		name, err := idna.ToASCII(fields[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		names = append(names, name)
+		types = append(types, qtype)
+	}
+	return names, types, sc.Err()
+}
+
+// cachedTopList returns the path of a downloaded copy of a top list in the
+// user cache directory, downloading it when missing or older than
+// topListMaxAge. A stale copy is used if the download fails. With offline,
+// any cached copy is used and a missing one is an error.
+func cachedTopList(name, url string, timeout time.Duration, offline bool) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "dnsbench")
+	path := filepath.Join(dir, name+"-top-1m.csv.zip")
+	fi, statErr := os.Stat(path)
+	if statErr == nil && (offline || time.Since(fi.ModTime()) < topListMaxAge) {
+		return path, nil
+	}
+	if offline {
+		return "", fmt.Errorf("workload %s is not downloaded yet and -dry-run does not download it; run once without -dry-run, or use file:PATH", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	slog.Info("downloading top list", "list", name, "url", url)
+	err = download(url, path, timeout)
+	if err != nil && statErr == nil {
+		slog.Warn("top list download failed, using cached copy", "list", name, "age", time.Since(fi.ModTime()).Round(time.Hour), "err", err)
+		return path, nil
+	}
+	return path, err
+}
+
+// download saves url to path, replacing it only once the body is complete.
+func download(url, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// parseDistribution parses -distribution and returns the Zipf exponent,
+// or 0 for names queried in turn.
+func parseDistribution(s string) (float64, error) {
+	name, param, hasParam := strings.Cut(s, ":")
+	switch name {
+	case "", "sequential":
+		return 0, nil
+	case "zipf":
+		if !hasParam {
+			return 1, nil
+		}
+		v, err := strconv.ParseFloat(param, 64)
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("invalid Zipf exponent %q", param)
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown distribution %q (want sequential or zipf[:S])", s)
+}
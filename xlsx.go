@@ -0,0 +1,302 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// Cell styles of styles.xml.
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1 // bold
+	xlsxStyleMs      = 2 // 0.000
+	xlsxStylePct     = 3 // 0.0%
+)
+
+// xlsxSheet is a worksheet: a header row, data rows of string, int,
+// float64, bool or nil (empty) cells, and the style of each column.
+type xlsxSheet struct {
+	Name   string
+	Header []string
+	Widths []float64
+	Styles []int
+	Rows   [][]any
+	// Conditional is the conditionalFormatting XML of the sheet, if any.
+	Conditional string
+}
+
+// writeXLSX writes the results of a run as an Excel workbook with Summary,
+// Samples and Errors sheets. The median latency is colored on a green to
+// red scale, and success rates below 100% and failed samples are
+// highlighted.
+func writeXLSX(path string, rec bench.RunRecord) error {
+	results := rec.Results()
+	addrs := make(map[string]string)
+	for _, rr := range rec.Resolvers {
+		addrs[rr.Name] = rr.Addr
+	}
+
+	summary := xlsxSheet{
+		Name:   "Summary",
+		Header: []string{"Resolver", "Group", "Address", "Count", "Successes", "Success", "Min ms", "Avg ms", "Median ms", "p95 ms", "Max ms"},
+		Widths: []float64{16, 12, 32, 9, 10, 9, 10, 10, 10, 10, 10},
+		Styles: []int{0, 0, 0, 0, 0, xlsxStylePct, xlsxStyleMs, xlsxStyleMs, xlsxStyleMs, xlsxStyleMs, xlsxStyleMs},
+	}
+	samples := xlsxSheet{
+		Name:   "Samples",
+		Header: []string{"Resolver", "Run index", "Duration ms", "Success", "Error", "TTFB ms", "RTT ms", "Bytes", "Queries", "Source port", "ID"},
+		Widths: []float64{16, 10, 12, 9, 60, 10, 10, 8, 8, 11, 8},
+		Styles: []int{0, 0, xlsxStyleMs, 0, 0, xlsxStyleMs, xlsxStyleMs, 0, 0, 0, 0},
+	}
+	errs := xlsxSheet{
+		Name:   "Errors",
+		Header: []string{"Resolver", "Error", "Count"},
+		Widths: []float64{16, 80, 8},
+	}
+	for _, r := range results {
+		s := r.Stats
+		row := []any{r.Name, r.Group, addrs[r.Name], s.Count, s.Successes, successPct(s) / 100}
+		if s.Successes > 0 {
+			row = append(row, ms(s.Min), ms(s.Avg), ms(s.Median), ms(s.P95), ms(s.Max))
+		}
+		summary.Rows = append(summary.Rows, row)
+
+		counts := make(map[string]int)
+		for i, sm := range r.Samples {
+			var msg string
+			if sm.Err != nil {
+				msg = sm.Err.Error()
+				counts[msg]++
+			}
+			samples.Rows = append(samples.Rows, []any{
+				r.Name, i, ms(sm.Duration), sm.Err == nil, msg,
+				xlsxOptional(ms(sm.FirstByte)), xlsxOptional(ms(sm.RTT)), sm.Size, sm.Queries,
+				xlsxOptional(float64(sm.SrcPort)), int(sm.ID),
+			})
+		}
+		msgs := make([]string, 0, len(counts))
+		for m := range counts {
+			msgs = append(msgs, m)
+		}
+		sort.Slice(msgs, func(i, j int) bool { return counts[msgs[i]] > counts[msgs[j]] })
+		for _, m := range msgs {
+			errs.Rows = append(errs.Rows, []any{r.Name, m, counts[m]})
+		}
+	}
+	if n := len(summary.Rows) + 1; n > 1 {
+		summary.Conditional = fmt.Sprintf(`<conditionalFormatting sqref="I2:I%[1]d"><cfRule type="colorScale" priority="1"><colorScale>`+
+			`<cfvo type="min"/><cfvo type="percentile" val="50"/><cfvo type="max"/>`+
+			`<color rgb="FF63BE7B"/><color rgb="FFFFEB84"/><color rgb="FFF8696B"/></colorScale></cfRule></conditionalFormatting>`+
+			`<conditionalFormatting sqref="F2:F%[1]d"><cfRule type="cellIs" dxfId="0" priority="2" operator="lessThan"><formula>1</formula></cfRule></conditionalFormatting>`, n)
+	}
+	if n := len(samples.Rows) + 1; n > 1 {
+		samples.Conditional = fmt.Sprintf(`<conditionalFormatting sqref="A2:K%d"><cfRule type="expression" dxfId="0" priority="1"><formula>NOT($D2)</formula></cfRule></conditionalFormatting>`, n)
+	}
+
+	sheets := []xlsxSheet{summary, samples, errs}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", xlsxRootRels},
+		{"docProps/core.xml", xlsxCore(rec)},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sh := range sheets {
+		files = append(files, struct{ name, body string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sh.xml()})
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(f.body)); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// xlsxOptional leaves a zero value, which stands for no value, empty.
+func xlsxOptional(v float64) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+func (sh xlsxSheet) xml() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// The header row stays in view when scrolling.
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<cols>`)
+	for i, w := range sh.Widths {
+		fmt.Fprintf(&b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, w)
+	}
+	b.WriteString(`</cols><sheetData>`)
+	header := make([]any, len(sh.Header))
+	for i, h := range sh.Header {
+		header[i] = h
+	}
+	writeXLSXRow(&b, 1, header, func(int) int { return xlsxStyleHeader })
+	for i, row := range sh.Rows {
+		writeXLSXRow(&b, i+2, row, func(col int) int {
+			if col < len(sh.Styles) {
+				return sh.Styles[col]
+			}
+			return xlsxStyleDefault
+		})
+	}
+	b.WriteString(`</sheetData>`)
+	fmt.Fprintf(&b, `<autoFilter ref="%s"/>`, sh.filterRef(false))
+	b.WriteString(sh.Conditional)
+	b.WriteString(`</worksheet>`)
+	return b.String()
+}
+
+// filterRef returns the range of the autofilter: the header and all rows,
+// with absolute references for the workbook's filter database name.
+func (sh xlsxSheet) filterRef(absolute bool) string {
+	last, n := xlsxColumn(len(sh.Header)-1), len(sh.Rows)+1
+	if absolute {
+		return fmt.Sprintf("$A$1:$%s$%d", last, n)
+	}
+	return fmt.Sprintf("A1:%s%d", last, n)
+}
+
+func writeXLSXRow(b *strings.Builder, n int, cells []any, style func(col int) int) {
+	fmt.Fprintf(b, `<row r="%d">`, n)
+	for col, v := range cells {
+		ref := xlsxColumn(col) + strconv.Itoa(n)
+		s := style(col)
+		switch v := v.(type) {
+		case nil:
+			continue
+		case string:
+			if v == "" {
+				continue
+			}
+			fmt.Fprintf(b, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, s, xlsxEscape(v))
+		case bool:
+			fmt.Fprintf(b, `<c r="%s" s="%d" t="b"><v>%s</v></c>`, ref, s, ternary(v, "1", "0"))
+		case int:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, s, v)
+		case float64:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, s, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	b.WriteString(`</row>`)
+}
+
+// xlsxColumn returns the letters of the zero-based column i: A, ..., Z, AA.
+func xlsxColumn(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+func xlsxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func xlsxContentTypes(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+	`</Relationships>`
+
+// xlsxCore describes the run in the document properties: the title names
+// the domain and host, the description the tool and schema version.
+func xlsxCore(rec bench.RunRecord) string {
+	title := fmt.Sprintf("DNS benchmark of %s from %s", rec.Domain, orDash(rec.Host))
+	desc := fmt.Sprintf("%s, results schema %d", rec.Tool, rec.Version)
+	return xml.Header + `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" ` +
+		`xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" ` +
+		`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<dc:title>` + xlsxEscape(title) + `</dc:title>` +
+		`<dc:description>` + xlsxEscape(desc) + `</dc:description>` +
+		`<dcterms:created xsi:type="dcterms:W3CDTF">` + rec.Started.UTC().Format(time.RFC3339) + `</dcterms:created>` +
+		`</cp:coreProperties>`
+}
+
+func xlsxWorkbook(sheets []xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sh := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sh.Name), i+1, i+1)
+	}
+	b.WriteString(`</sheets><definedNames>`)
+	for i, sh := range sheets {
+		ref := fmt.Sprintf("'%s'!%s", sh.Name, sh.filterRef(true))
+		fmt.Fprintf(&b, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">%s</definedName>`, i, xlsxEscape(ref))
+	}
+	b.WriteString(`</definedNames></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// xlsxStyles holds the cell styles (xlsxStyle*) and, as dxf 0, the light
+// red fill of the conditional formatting.
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="0.000"/><numFmt numFmtId="165" formatCode="0.0%"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`<dxfs count="1"><dxf><font><color rgb="FF9C0006"/></font><fill><patternFill><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf></dxfs>` +
+	`</styleSheet>`
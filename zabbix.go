@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ohidurbappy/dns-bench/bench"
+)
+
+// zabbixDiscoveryKey is the low-level discovery rule key. The item
+// prototypes are dnsbench.<metric>["{#RESOLVER}"]; the parameter is always
+// quoted so that names with commas or spaces need no special prototypes.
+const zabbixDiscoveryKey = "dnsbench.discovery"
+
+// writeZabbix writes the run as zabbix_sender input with timestamps (for
+// zabbix_sender -T -i -): first the low-level discovery data listing the
+// resolvers, then their median, average and p95 latency in milliseconds
+// and success rate in percent. Host "-" means the Hostname of the
+// zabbix_sender configuration.
+func writeZabbix(w io.Writer, host string, resolvers []bench.Resolver, rows []bench.Result, at time.Time) error {
+	addrs := make(map[string]string, len(resolvers))
+	for _, r := range resolvers {
+		addrs[r.Name] = r.Addr
+	}
+	type lldRow struct {
+		Resolver string `json:"{#RESOLVER}"`
+		Addr     string `json:"{#ADDR}"`
+	}
+	lld := struct {
+		Data []lldRow `json:"data"`
+	}{Data: []lldRow{}}
+	for _, r := range rows {
+		lld.Data = append(lld.Data, lldRow{Resolver: r.Name, Addr: addrs[r.Name]})
+	}
+	b, err := json.Marshal(lld)
+	if err != nil {
+		return err
+	}
+
+	ts := at.Unix()
+	line := func(key, value string) error {
+		_, err := fmt.Fprintf(w, "%s %s %d %s\n", zabbixQuote(host), zabbixQuote(key), ts, zabbixQuote(value))
+		return err
+	}
+	if err := line(zabbixDiscoveryKey, string(b)); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		s := r.Stats
+		item := func(metric string) string { return "dnsbench." + metric + "[" + strconv.Quote(r.Name) + "]" }
+		for _, v := range []struct{ key, value string }{
+			{item("success"), fmt.Sprintf("%.1f", successPct(s))},
+			{item("median"), fmt.Sprintf("%.2f", ms(s.Median))},
+			{item("avg"), fmt.Sprintf("%.2f", ms(s.Avg))},
+			{item("p95"), fmt.Sprintf("%.2f", ms(s.P95))},
+		} {
+			if s.Successes == 0 && v.key != item("success") {
+				continue // no latency without answers
+			}
+			if err := line(v.key, v.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// zabbixQuote quotes a zabbix_sender input field, which is needed when it
+// contains spaces or quotes.
+func zabbixQuote(s string) string {
+	for _, c := range s {
+		if c == ' ' || c == '"' || c == '\\' || c == '\t' {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}